@@ -9,6 +9,7 @@ import (
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cookie"
 	"github.com/coredns/coredns/request"
 )
 
@@ -62,6 +63,9 @@ type Config struct {
 	// TSIG secrets, [name]key.
 	TsigSecret map[string]string
 
+	// DNS Cookie configuration, nil when the server doesn't handle cookies.
+	Cookie *cookie.Config
+
 	// Plugin stack.
 	Plugin []plugin.Plugin
 
@@ -0,0 +1,94 @@
+package dnsserver
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cookie"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// cookies checks the COOKIE option in r, see RFC 7873. It returns a context that records whether
+// the client sent a valid server cookie, and a writer that adds the client's cookie and a server
+// cookie to the reply. The writer is nil when the cookie is malformed, a FORMERR has then been written.
+func (s *Server) cookies(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (context.Context, dns.ResponseWriter) {
+	state := request.Request{W: w, Req: r}
+	cw := &cookieWriter{ResponseWriter: w, config: s.cookie, req: r, udp: state.Proto() == "udp", ip: net.ParseIP(state.IP())}
+
+	o := cookie.Find(r)
+	if o == nil {
+		return context.WithValue(ctx, CookieKey{}, false), cw
+	}
+	client, server, err := cookie.Split(o)
+	if err != nil {
+		// Don't echo the malformed cookie.
+		cookie.Remove(r)
+		errorAndMetricsFunc(s.Addr, w, r, dns.RcodeFormatError)
+		return ctx, nil
+	}
+	cw.client = client
+	if server != nil {
+		valid, stale := cookie.Check(s.cookie.Secrets.Get(), client, server, cw.ip, time.Now())
+		cw.valid = valid
+		if valid && !stale {
+			cw.server = server
+		}
+	}
+	return context.WithValue(ctx, CookieKey{}, cw.valid), cw
+}
+
+// cookieWriter sets the COOKIE option in the reply. The server cookie the client sent is echoed when
+// it is valid and not too old, otherwise a new one is made. Over UDP, replies larger than the
+// configured size are only sent to clients with a valid server cookie.
+type cookieWriter struct {
+	dns.ResponseWriter
+	config *cookie.Config
+	req    *dns.Msg
+	udp    bool
+	ip     net.IP
+
+	client []byte // the client cookie, nil if the client didn't send one
+	server []byte // the server cookie to echo, nil if a new one should be made
+	valid  bool   // whether the client sent a valid server cookie
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *cookieWriter) WriteMsg(m *dns.Msg) error {
+	if w.client == nil {
+		// Don't send cookies to a client that didn't ask for them, these can come from an upstream.
+		cookie.Remove(m)
+		if w.required(m) {
+			// Without a cookie the client can only get a large reply over TCP.
+			m = new(dns.Msg)
+			m.SetRcode(w.req, dns.RcodeSuccess)
+			m.Truncated = true
+		}
+		return w.ResponseWriter.WriteMsg(m)
+	}
+
+	server := w.server
+	if server == nil {
+		server = cookie.Server(w.config.Secrets.Get()[0], w.client, w.ip, time.Now())
+	}
+	if m.IsEdns0() == nil {
+		m.SetEdns0(dns.MinMsgSize, false)
+	}
+	cookie.Set(m, w.client, server)
+
+	if w.required(m) {
+		// The client has a cookie, so it will retry with the new server cookie.
+		m = new(dns.Msg)
+		m.SetRcode(w.req, dns.RcodeBadCookie)
+		m.SetEdns0(dns.MinMsgSize, false)
+		cookie.Set(m, w.client, server)
+	}
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// required returns true if m may only be sent to a client with a valid server cookie.
+func (w *cookieWriter) required(m *dns.Msg) bool {
+	return w.udp && !w.valid && w.config.RequireSize > 0 && m.Len() > w.config.RequireSize
+}
@@ -0,0 +1,126 @@
+package dnsserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cookie"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestCookies(t *testing.T) {
+	var valid bool
+	p := plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		valid, _ = ctx.Value(CookieKey{}).(bool)
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if r.Question[0].Name == "large.example.com." {
+			for i := 0; i < 10; i++ {
+				m.Answer = append(m.Answer, test.TXT(`large.example.com. 300 IN TXT "`+strings.Repeat("a", 100)+`"`))
+			}
+		}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+	secret, _ := cookie.NewSecret()
+	c := testConfig("dns", p)
+	c.Cookie = &cookie.Config{Secrets: cookie.NewSecrets(secret), RequireSize: 512}
+	s, err := NewServer("127.0.0.1:53", []*Config{c})
+	if err != nil {
+		t.Fatalf("Expected no error for NewServer, got %s", err)
+	}
+
+	client := []byte("abcdefgh")
+	good := cookie.Server(secret, client, net.ParseIP("10.240.0.1"), time.Now().Add(-10*time.Minute))
+	stale := cookie.Server(secret, client, net.ParseIP("10.240.0.1"), time.Now().Add(-45*time.Minute))
+	bad := make([]byte, cookie.ServerLen)
+	copy(bad, good)
+	bad[15]++
+
+	tests := []struct {
+		name   string
+		cookie string // hex of the cookie sent, "-" is no EDNS
+		tcp    bool
+
+		rcode     int
+		truncated bool
+		answers   int
+		valid     bool
+		echo      bool // whether the server cookie sent is expected back
+	}{
+		{"example.com.", "-", false, dns.RcodeSuccess, false, 0, false, false},
+		{"example.com.", "", false, dns.RcodeSuccess, false, 0, false, false},
+		{"example.com.", hex.EncodeToString(client), false, dns.RcodeSuccess, false, 0, false, false},
+		{"example.com.", hex.EncodeToString(client) + hex.EncodeToString(good), false, dns.RcodeSuccess, false, 0, true, true},
+		{"example.com.", hex.EncodeToString(client) + hex.EncodeToString(stale), false, dns.RcodeSuccess, false, 0, true, false},
+		{"example.com.", hex.EncodeToString(client) + hex.EncodeToString(bad), false, dns.RcodeSuccess, false, 0, false, false},
+		{"example.com.", "abcd", false, dns.RcodeFormatError, false, 0, false, false},
+		// large replies over UDP need a valid cookie
+		{"large.example.com.", "-", false, dns.RcodeSuccess, true, 0, false, false},
+		{"large.example.com.", "", false, dns.RcodeSuccess, true, 0, false, false},
+		{"large.example.com.", hex.EncodeToString(client), false, dns.RcodeBadCookie, false, 0, false, false},
+		{"large.example.com.", hex.EncodeToString(client) + hex.EncodeToString(bad), false, dns.RcodeBadCookie, false, 0, false, false},
+		{"large.example.com.", hex.EncodeToString(client) + hex.EncodeToString(good), false, dns.RcodeSuccess, false, 10, true, true},
+		{"large.example.com.", "", true, dns.RcodeSuccess, false, 10, false, false},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.name, dns.TypeTXT)
+		if tc.cookie != "-" {
+			m.SetEdns0(4096, false)
+			if tc.cookie != "" {
+				o := m.IsEdns0()
+				o.Option = append(o.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: tc.cookie})
+			}
+		}
+		valid = false
+		rec := dnstest.NewRecorder(&test.ResponseWriter{TCP: tc.tcp})
+		s.ServeDNS(context.TODO(), rec, m)
+
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rec.Msg.Rcode])
+		}
+		if rec.Msg.Truncated != tc.truncated {
+			t.Errorf("Test %d: expected truncated %t, got %t", i, tc.truncated, rec.Msg.Truncated)
+		}
+		if len(rec.Msg.Answer) != tc.answers {
+			t.Errorf("Test %d: expected %d answers, got %d", i, tc.answers, len(rec.Msg.Answer))
+		}
+		if valid != tc.valid {
+			t.Errorf("Test %d: expected valid cookie %t, got %t", i, tc.valid, valid)
+		}
+
+		o := cookie.Find(rec.Msg)
+		if tc.cookie == "-" || tc.cookie == "" || tc.rcode == dns.RcodeFormatError {
+			if o != nil {
+				t.Errorf("Test %d: expected no cookie, got %s", i, o.Cookie)
+			}
+			continue
+		}
+		if o == nil {
+			t.Errorf("Test %d: expected a cookie, got none", i)
+			continue
+		}
+		c, server, err := cookie.Split(o)
+		if err != nil || !bytes.Equal(c, client) {
+			t.Errorf("Test %d: expected client cookie %x, got %s", i, client, o.Cookie)
+			continue
+		}
+		if tc.echo != bytes.Equal(server, good) {
+			t.Errorf("Test %d: expected server cookie echoed %t, got %x", i, tc.echo, server)
+		}
+		if ok, _ := cookie.Check([]cookie.Secret{secret}, client, server, net.ParseIP("10.240.0.1"), time.Now()); !ok {
+			t.Errorf("Test %d: expected a valid server cookie, got %x", i, server)
+		}
+	}
+}
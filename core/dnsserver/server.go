@@ -14,6 +14,7 @@ import (
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metrics/vars"
+	"github.com/coredns/coredns/plugin/pkg/cookie"
 	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/rcode"
@@ -49,6 +50,8 @@ type Server struct {
 	writeTimeout time.Duration        // Write timeout for TCP
 
 	tsigSecret map[string]string
+	cookie     *cookie.Config // DNS Cookies, nil when disabled
+	updaters   []Updater      // plugins that handle dynamic updates
 }
 
 // MetadataCollector is a plugin that can retrieve metadata functions from all metadata providing plugins
@@ -56,6 +59,13 @@ type MetadataCollector interface {
 	Collect(context.Context, request.Request) context.Context
 }
 
+// Updater is a plugin that handles dynamic updates (RFC 2136). Updates for zones no plugin handles
+// get a NOTIMP response.
+type Updater interface {
+	// Updates returns true if the plugin handles the dynamic updates for zone.
+	Updates(zone string) bool
+}
+
 // NewServer returns a new CoreDNS server and compiles all plugins in to it. By default CH class
 // queries are blocked unless queries from enableChaos are loaded.
 func NewServer(addr string, group []*Config) (*Server, error) {
@@ -103,6 +113,10 @@ func NewServer(addr string, group []*Config) (*Server, error) {
 			s.tsigSecret[key] = secret
 		}
 
+		if site.Cookie != nil {
+			s.cookie = site.Cookie
+		}
+
 		// compile custom plugin for everything
 		var stack plugin.Handler
 		for i := len(site.Plugin) - 1; i >= 0; i-- {
@@ -124,6 +138,9 @@ func NewServer(addr string, group []*Config) (*Server, error) {
 					s.trace = t
 				}
 			}
+			if u, ok := stack.(Updater); ok {
+				s.updaters = append(s.updaters, u)
+			}
 			// Unblock CH class queries when any of these plugins are loaded.
 			if _, ok := EnableChaos[stack.Name()]; ok {
 				s.classChaos = true
@@ -152,6 +169,7 @@ func (s *Server) Serve(l net.Listener) error {
 		Net:           "tcp",
 		TsigSecret:    s.tsigSecret,
 		MaxTCPQueries: tcpMaxQueries,
+		MsgAcceptFunc: MsgAcceptFunc,
 		ReadTimeout:   s.readTimeout,
 		WriteTimeout:  s.writeTimeout,
 		IdleTimeout: func() time.Duration {
@@ -176,7 +194,7 @@ func (s *Server) ServePacket(p net.PacketConn) error {
 		ctx := context.WithValue(context.Background(), Key{}, s)
 		ctx = context.WithValue(ctx, LoopKey{}, 0)
 		s.ServeDNS(ctx, w, r)
-	}), TsigSecret: s.tsigSecret}
+	}), TsigSecret: s.tsigSecret, MsgAcceptFunc: MsgAcceptFunc}
 	s.m.Unlock()
 
 	return s.server[udp].ActivateAndServe()
@@ -283,9 +301,21 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 		return
 	}
 
+	if r.Opcode == dns.OpcodeUpdate && !s.updates(r.Question[0].Name) {
+		errorAndMetricsFunc(s.Addr, w, r, dns.RcodeNotImplemented)
+		return
+	}
+
 	// Wrap the response writer in a ScrubWriter so we automatically make the reply fit in the client's buffer.
 	w = request.NewScrubWriter(r, w)
 
+	if s.cookie != nil {
+		// Check the client's cookie, and add ours to the reply before it is scrubbed.
+		if ctx, w = s.cookies(ctx, w, r); w == nil {
+			return
+		}
+	}
+
 	q := strings.ToLower(r.Question[0].Name)
 	var (
 		off       int
@@ -313,9 +343,9 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 						ctx = context.WithValue(ctx, ViewKey{}, h.ViewName)
 					}
 					if r.Question[0].Qtype != dns.TypeDS {
-						rcode, _ := h.pluginChain.ServeDNS(ctx, w, r)
+						rcode, err := h.pluginChain.ServeDNS(ctx, w, r)
 						if !plugin.ClientWrite(rcode) {
-							errorFunc(s.Addr, w, r, rcode)
+							errorFunc(s.Addr, w, r, rcode, err)
 						}
 						return
 					}
@@ -336,9 +366,9 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 
 	if r.Question[0].Qtype == dns.TypeDS && dshandler != nil && dshandler.pluginChain != nil {
 		// DS request, and we found a zone, use the handler for the query.
-		rcode, _ := dshandler.pluginChain.ServeDNS(ctx, w, r)
+		rcode, err := dshandler.pluginChain.ServeDNS(ctx, w, r)
 		if !plugin.ClientWrite(rcode) {
-			errorFunc(s.Addr, w, r, rcode)
+			errorFunc(s.Addr, w, r, rcode, err)
 		}
 		return
 	}
@@ -361,9 +391,9 @@ func (s *Server) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 					// if there was a view defined for this Config, set the view name in the context
 					ctx = context.WithValue(ctx, ViewKey{}, h.ViewName)
 				}
-				rcode, _ := h.pluginChain.ServeDNS(ctx, w, r)
+				rcode, err := h.pluginChain.ServeDNS(ctx, w, r)
 				if !plugin.ClientWrite(rcode) {
-					errorFunc(s.Addr, w, r, rcode)
+					errorFunc(s.Addr, w, r, rcode, err)
 				}
 				return
 			}
@@ -406,13 +436,44 @@ func (s *Server) Tracer() ot.Tracer {
 	return s.trace.Tracer()
 }
 
-// errorFunc responds to an DNS request with an error.
-func errorFunc(server string, w dns.ResponseWriter, r *dns.Msg, rc int) {
+// MsgAcceptFunc is the dns.MsgAcceptFunc used by the servers. It accepts the same messages as
+// dns.DefaultMsgAcceptFunc and also dynamic updates (RFC 2136), which are left to the plugins that
+// implement Updater.
+func MsgAcceptFunc(dh dns.Header) dns.MsgAcceptAction {
+	opcode := int(dh.Bits>>11) & 0xF
+	isResponse := dh.Bits&(1<<15) != 0 // QR bit
+	if opcode != dns.OpcodeUpdate || isResponse {
+		return dns.DefaultMsgAcceptFunc(dh)
+	}
+	// The zone section must hold a single zone, the other sections hold the prerequisites,
+	// updates and additional data and can hold any number of RRs.
+	if dh.Qdcount != 1 {
+		return dns.MsgReject
+	}
+	return dns.MsgAccept
+}
+
+// updates returns true if a plugin handles the dynamic updates for zone.
+func (s *Server) updates(zone string) bool {
+	zone = strings.ToLower(zone)
+	for _, u := range s.updaters {
+		if u.Updates(zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorFunc writes a response with rcode rc for r. If the client supports EDNS and err carries an
+// extended DNS error, it is added to the response.
+func errorFunc(server string, w dns.ResponseWriter, r *dns.Msg, rc int, err error) {
 	state := request.Request{W: w, Req: r}
 
 	answer := new(dns.Msg)
 	answer.SetRcode(r, rc)
-	state.SizeAndDo(answer)
+	if state.SizeAndDo(answer) {
+		edns.SetExtendedErrorFrom(answer, err)
+	}
 
 	w.WriteMsg(answer)
 }
@@ -445,6 +506,10 @@ type (
 
 	// ViewKey is the context key for the current view, if defined
 	ViewKey struct{}
+
+	// CookieKey is the context key for whether the client sent a valid server cookie, it is only
+	// set when DNS Cookies are enabled.
+	CookieKey struct{}
 )
 
 // EnableChaos is a map with plugin names for which we should open CH class queries as we block these by default.
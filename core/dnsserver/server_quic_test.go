@@ -0,0 +1,82 @@
+package dnsserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestNewServerQUIC(t *testing.T) {
+	c := Config{
+		Zone:        "example.com.",
+		Transport:   "quic",
+		TLSConfig:   &tls.Config{},
+		ListenHosts: []string{"127.0.0.1"},
+		Port:        "853",
+	}
+	s, err := NewServerQUIC("quic://127.0.0.1:853", []*Config{&c})
+	if err != nil {
+		t.Fatalf("Could not create QUIC server: %s", err)
+	}
+	if len(s.tlsConfig.NextProtos) != 1 || s.tlsConfig.NextProtos[0] != "doq" {
+		t.Errorf("Expected NextProtos to be [doq], got %v", s.tlsConfig.NextProtos)
+	}
+}
+
+func TestQUICValidRequest(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+
+	m.Id = 0
+	if !validRequest(m) {
+		t.Errorf("Expected message with ID 0 to be valid")
+	}
+
+	m.Id = 1
+	if validRequest(m) {
+		t.Errorf("Expected message with non-zero ID to be invalid")
+	}
+
+	m.Id = 0
+	m.SetEdns0(4096, false)
+	m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE})
+	if validRequest(m) {
+		t.Errorf("Expected message with edns-tcp-keepalive to be invalid")
+	}
+}
+
+func TestReadDOQMessage(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	m.Id = 0
+	buf, _ := m.Pack()
+
+	tests := []struct {
+		input     []byte
+		shouldErr bool
+	}{
+		{AddPrefix(buf), false},
+		{buf, true},                         // no length prefix
+		{[]byte{0, 0}, true},                // zero length
+		{AddPrefix(buf)[:len(buf)-1], true}, // truncated message
+	}
+
+	for i, tc := range tests {
+		b, err := readDOQMessage(bytes.NewReader(tc.input))
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if !bytes.Equal(b, buf) {
+			t.Errorf("Test %d: expected message %v, got %v", i, buf, b)
+		}
+	}
+}
@@ -2,9 +2,12 @@ package dnsserver
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/test"
 
@@ -98,6 +101,62 @@ func TestStacktrace(t *testing.T) {
 	}
 }
 
+func TestServeDNSExtendedError(t *testing.T) {
+	p := plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		return dns.RcodeServerFailure, edns.NewExtendedError(errors.New("upstream failed"), dns.ExtendedErrorCodeNetworkError, "")
+	})
+	s, err := NewServer("127.0.0.1:53", []*Config{testConfig("dns", p)})
+	if err != nil {
+		t.Fatalf("Expected no error for NewServer, got %s", err)
+	}
+
+	for _, do := range []bool{true, false} {
+		m := new(dns.Msg)
+		m.SetQuestion("aaa.example.com.", dns.TypeA)
+		if do {
+			m.SetEdns0(4096, false)
+		}
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		s.ServeDNS(context.TODO(), rec, m)
+		if rec.Msg.Rcode != dns.RcodeServerFailure {
+			t.Errorf("Expected SERVFAIL, got %s", dns.RcodeToString[rec.Msg.Rcode])
+		}
+		if got := edns.HasExtendedError(rec.Msg, dns.ExtendedErrorCodeNetworkError); got != do {
+			t.Errorf("Expected Network Error %t for a query with EDNS %t, got %t", do, do, got)
+		}
+	}
+}
+
+type updatePlugin struct{ testPlugin }
+
+func (updatePlugin) Updates(zone string) bool { return zone == "example.com." }
+
+func TestServeDNSUpdate(t *testing.T) {
+	tests := []struct {
+		p     plugin.Handler
+		zone  string
+		rcode int
+	}{
+		{testPlugin{}, "example.com.", dns.RcodeNotImplemented},
+		{updatePlugin{}, "example.com.", dns.RcodeSuccess},
+		{updatePlugin{}, "sub.example.com.", dns.RcodeNotImplemented},
+	}
+	for i, tc := range tests {
+		s, err := NewServer("127.0.0.1:53", []*Config{testConfig("dns", tc.p)})
+		if err != nil {
+			t.Fatalf("Expected no error for NewServer, got %s", err)
+		}
+		m := new(dns.Msg)
+		m.SetUpdate(tc.zone)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		s.ServeDNS(context.TODO(), rec, m)
+		// testPlugin doesn't write a response.
+		if rc := rec.Rcode; rc != tc.rcode {
+			t.Errorf("Test %d: expected %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rc])
+		}
+	}
+}
+
 func BenchmarkCoreServeDNS(b *testing.B) {
 	s, err := NewServer("127.0.0.1:53", []*Config{testConfig("dns", testPlugin{})})
 	if err != nil {
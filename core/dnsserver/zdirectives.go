@@ -15,6 +15,7 @@ var Directives = []string{
 	"cancel",
 	"tls",
 	"timeouts",
+	"cookie",
 	"reload",
 	"nsid",
 	"bufsize",
@@ -32,10 +33,14 @@ var Directives = []string{
 	"local",
 	"dns64",
 	"acl",
+	"ratelimit",
+	"rrl",
 	"any",
 	"chaos",
 	"loadbalance",
 	"tsig",
+	"rpz",
+	"blocklist",
 	"cache",
 	"rewrite",
 	"header",
@@ -56,6 +61,7 @@ var Directives = []string{
 	"etcd",
 	"loop",
 	"forward",
+	"recursive",
 	"grpc",
 	"erratic",
 	"whoami",
@@ -7,6 +7,7 @@ import (
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/request"
 
@@ -79,8 +80,7 @@ RulesCheckLoop:
 				m := new(dns.Msg).
 					SetRcode(r, dns.RcodeRefused).
 					SetEdns0(4096, true)
-				ede := dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeBlocked}
-				m.IsEdns0().Option = append(m.IsEdns0().Option, &ede)
+				edns.SetExtendedError(m, dns.ExtendedErrorCodeBlocked, "")
 				w.WriteMsg(m)
 				RequestBlockCount.WithLabelValues(metrics.WithServer(ctx), zone, metrics.WithView(ctx)).Inc()
 				return dns.RcodeSuccess, nil
@@ -94,8 +94,7 @@ RulesCheckLoop:
 				m := new(dns.Msg).
 					SetRcode(r, dns.RcodeSuccess).
 					SetEdns0(4096, true)
-				ede := dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeFiltered}
-				m.IsEdns0().Option = append(m.IsEdns0().Option, &ede)
+				edns.SetExtendedError(m, dns.ExtendedErrorCodeFiltered, "")
 				w.WriteMsg(m)
 				RequestFilterCount.WithLabelValues(metrics.WithServer(ctx), zone, metrics.WithView(ctx)).Inc()
 				return dns.RcodeSuccess, nil
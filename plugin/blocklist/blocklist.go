@@ -0,0 +1,117 @@
+// Package blocklist implements a plugin that blocks queries for the domains in lists of names.
+package blocklist
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// response is the kind of response sent for a blocked query.
+type response int
+
+const (
+	responseNXDomain response = iota // NXDOMAIN
+	responseNull                     // 0.0.0.0 or :: for A and AAAA queries, NODATA otherwise
+	responseRefused                  // REFUSED with the extended DNS error Blocked
+)
+
+// Blocklist is a plugin that blocks queries for the names in block lists and all names below them.
+type Blocklist struct {
+	Next  plugin.Handler
+	Zones []string
+
+	response response
+	ttl      uint32
+	reload   time.Duration
+
+	mu    sync.Mutex // serializes reading the files
+	files []*file
+	lists atomic.Pointer[lists]
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (b *Blocklist) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	zone := plugin.Zones(b.Zones).Matches(state.Name())
+	if zone == "" || !b.blocked(strings.ToLower(state.Name())) {
+		return plugin.NextOrFailure(b.Name(), b.Next, ctx, w, r)
+	}
+
+	blockCount.WithLabelValues(metrics.WithServer(ctx), zone).Inc()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	switch b.response {
+	case responseNXDomain:
+		m.Rcode = dns.RcodeNameError
+	case responseNull:
+		hdr := dns.RR_Header{Name: state.QName(), Rrtype: state.QType(), Class: dns.ClassINET, Ttl: b.ttl}
+		switch state.QType() {
+		case dns.TypeA:
+			m.Answer = []dns.RR{&dns.A{Hdr: hdr, A: net.IPv4zero}}
+		case dns.TypeAAAA:
+			m.Answer = []dns.RR{&dns.AAAA{Hdr: hdr, AAAA: net.IPv6zero}}
+		}
+	case responseRefused:
+		m.Authoritative = false
+		m.Rcode = dns.RcodeRefused
+		m.SetEdns0(4096, true)
+		edns.SetExtendedError(m, dns.ExtendedErrorCodeBlocked, "")
+	}
+
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+// blocked returns true if name is blocked, and not allowed.
+func (b *Blocklist) blocked(name string) bool {
+	l := b.lists.Load()
+	if l == nil {
+		return false
+	}
+	return l.block.match(name) && !l.allow.match(name)
+}
+
+// readLists reads the files if any of them changed. The new lists replace the current ones when
+// they're completely read, queries are answered with the current lists in the meantime.
+func (b *Blocklist) readLists() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	changed := b.lists.Load() == nil
+	for _, f := range b.files {
+		changed = changed || f.changed()
+	}
+	if !changed {
+		return
+	}
+
+	l := &lists{block: newTrie(), allow: newTrie()}
+	for _, f := range b.files {
+		if err := f.read(l.block, l.allow); err != nil {
+			log.Warningf("Failed to read %q: %s", f.path, err)
+		}
+	}
+	b.lists.Store(l)
+	log.Infof("Loaded %d blocked and %d allowed names", l.block.Len(), l.allow.Len())
+
+	entries.WithLabelValues("block").Set(float64(l.block.Len()))
+	entries.WithLabelValues("allow").Set(float64(l.allow.Len()))
+	reloadTime.Set(float64(time.Now().UnixNano()) / 1e9)
+}
+
+// Name implements the plugin.Handler interface.
+func (b *Blocklist) Name() string { return pluginName }
@@ -0,0 +1,134 @@
+package blocklist
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func newTestBlocklist(t *testing.T, r response) *Blocklist {
+	block, rm, err := test.TempFile(".", "0.0.0.0 blocked.example.org\n||adblock.example.org^\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(rm)
+	allow, rm, err := test.TempFile(".", "ok.blocked.example.org\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(rm)
+
+	b := &Blocklist{
+		Zones:    []string{"example.org."},
+		Next:     test.NextHandler(dns.RcodeSuccess, nil),
+		response: r,
+		ttl:      3600,
+		files:    []*file{{path: block}, {path: allow, allow: true}},
+	}
+	b.readLists()
+	return b
+}
+
+func TestBlocklist(t *testing.T) {
+	tests := []struct {
+		qname    string
+		qtype    uint16
+		response response
+		rcode    int
+		answer   []dns.RR
+		ede      bool
+		blocked  bool
+	}{
+		{qname: "www.example.org.", qtype: dns.TypeA, rcode: dns.RcodeSuccess},
+		{qname: "ok.blocked.example.org.", qtype: dns.TypeA, rcode: dns.RcodeSuccess},
+		{qname: "blocked.example.net.", qtype: dns.TypeA, rcode: dns.RcodeSuccess},
+		{qname: "blocked.example.org.", qtype: dns.TypeA, response: responseNXDomain, rcode: dns.RcodeNameError, blocked: true},
+		{qname: "WWW.Adblock.example.org.", qtype: dns.TypeA, response: responseNXDomain, rcode: dns.RcodeNameError, blocked: true},
+		{qname: "blocked.example.org.", qtype: dns.TypeA, response: responseNull, rcode: dns.RcodeSuccess, blocked: true,
+			answer: []dns.RR{test.A("blocked.example.org. 3600 IN A 0.0.0.0")}},
+		{qname: "blocked.example.org.", qtype: dns.TypeAAAA, response: responseNull, rcode: dns.RcodeSuccess, blocked: true,
+			answer: []dns.RR{test.AAAA("blocked.example.org. 3600 IN AAAA ::")}},
+		{qname: "blocked.example.org.", qtype: dns.TypeMX, response: responseNull, rcode: dns.RcodeSuccess, blocked: true},
+		{qname: "blocked.example.org.", qtype: dns.TypeA, response: responseRefused, rcode: dns.RcodeRefused, blocked: true, ede: true},
+	}
+
+	for i, tc := range tests {
+		b := newTestBlocklist(t, tc.response)
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := b.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if !tc.blocked {
+			if rec.Msg != nil {
+				t.Errorf("Test %d: expected %s to be passed to the next plugin", i, tc.qname)
+			}
+			continue
+		}
+		if rec.Msg == nil {
+			t.Fatalf("Test %d: expected a response", i)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %d, got %d", i, tc.rcode, rec.Msg.Rcode)
+		}
+		if len(rec.Msg.Answer) != len(tc.answer) {
+			t.Fatalf("Test %d: expected %d answers, got %d", i, len(tc.answer), len(rec.Msg.Answer))
+		}
+		for j := range tc.answer {
+			if !dns.IsDuplicate(rec.Msg.Answer[j], tc.answer[j]) || rec.Msg.Answer[j].Header().Ttl != tc.answer[j].Header().Ttl {
+				t.Errorf("Test %d: expected answer %s, got %s", i, tc.answer[j], rec.Msg.Answer[j])
+			}
+		}
+		ede := false
+		if opt := rec.Msg.IsEdns0(); opt != nil {
+			for _, o := range opt.Option {
+				if e, ok := o.(*dns.EDNS0_EDE); ok && e.InfoCode == dns.ExtendedErrorCodeBlocked {
+					ede = true
+				}
+			}
+		}
+		if ede != tc.ede {
+			t.Errorf("Test %d: expected extended error Blocked: %t, got %t", i, tc.ede, ede)
+		}
+	}
+}
+
+func TestBlocklistReload(t *testing.T) {
+	b := newTestBlocklist(t, responseNXDomain)
+	old := b.lists.Load()
+
+	b.readLists()
+	if b.lists.Load() != old {
+		t.Fatal("Expected the lists not to be read again when the files didn't change")
+	}
+
+	path := b.files[0].path
+	if err := os.WriteFile(path, []byte("other.example.org\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the modification time differs on file systems with a coarse resolution.
+	mtime := time.Now().Add(time.Second)
+	os.Chtimes(path, mtime, mtime)
+
+	b.readLists()
+	if b.blocked("blocked.example.org.") {
+		t.Error("Expected blocked.example.org. not to be blocked after reloading")
+	}
+	if !b.blocked("other.example.org.") {
+		t.Error("Expected other.example.org. to be blocked after reloading")
+	}
+
+	// A file that is removed no longer blocks anything.
+	os.Remove(path)
+	b.readLists()
+	if b.blocked("other.example.org.") {
+		t.Error("Expected other.example.org. not to be blocked after removing the list")
+	}
+}
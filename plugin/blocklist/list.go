@@ -0,0 +1,216 @@
+package blocklist
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// node is a node in a trie of domain names, keyed by label from the root down.
+type node struct {
+	children map[string]*node
+	end      bool // a name ends here, it matches itself and all names below it
+}
+
+// trie holds domain names and matches names by suffix.
+type trie struct {
+	root node
+	len  int
+}
+
+func newTrie() *trie { return &trie{} }
+
+// insert adds the lowercased, fully qualified name to t.
+func (t *trie) insert(name string) {
+	n := &t.root
+	for end := len(name) - 1; end > 0; {
+		start := strings.LastIndexByte(name[:end], '.') + 1
+		label := name[start:end]
+		if n.end {
+			// A parent is already in the trie, this name adds nothing.
+			return
+		}
+		c, ok := n.children[label]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[string]*node, 1)
+			}
+			c = &node{}
+			n.children[label] = c
+		}
+		n = c
+		end = start - 1
+	}
+	if !n.end {
+		t.len += 1 - n.count()
+		n.end = true
+		n.children = nil // everything below is matched anyway
+	}
+}
+
+// count returns the number of names below n.
+func (n *node) count() int {
+	i := 0
+	for _, c := range n.children {
+		if c.end {
+			i++
+			continue
+		}
+		i += c.count()
+	}
+	return i
+}
+
+// match returns true if the lowercased, fully qualified name or one of its parents is in t.
+func (t *trie) match(name string) bool {
+	n := &t.root
+	for end := len(name) - 1; end > 0; {
+		start := strings.LastIndexByte(name[:end], '.') + 1
+		c, ok := n.children[name[start:end]]
+		if !ok {
+			return false
+		}
+		if c.end {
+			return true
+		}
+		n = c
+		end = start - 1
+	}
+	return false
+}
+
+// Len returns the number of names in t.
+func (t *trie) Len() int { return t.len }
+
+// lists holds the blocked and allowed names loaded from the configured files.
+type lists struct {
+	block *trie
+	allow *trie
+}
+
+// file is a list file, its modification time and size are used to detect changes.
+type file struct {
+	path  string
+	allow bool // the names in the file are allowed, instead of blocked
+
+	mtime time.Time
+	size  int64
+}
+
+// changed returns true if f was modified since it was last read.
+func (f *file) changed() bool {
+	stat, err := os.Stat(f.path)
+	if err != nil {
+		return f.size != -1
+	}
+	return !f.mtime.Equal(stat.ModTime()) || f.size != stat.Size()
+}
+
+// read reads the names in f into block and allow.
+func (f *file) read(block, allow *trie) error {
+	r, err := os.Open(f.path)
+	if err != nil {
+		f.mtime, f.size = time.Time{}, -1
+		return err
+	}
+	defer r.Close()
+	stat, err := r.Stat()
+	if err != nil {
+		return err
+	}
+	f.mtime, f.size = stat.ModTime(), stat.Size()
+
+	if f.allow {
+		// An exception rule in an allowlist is still an allowed name.
+		return parse(r, allow, allow)
+	}
+	return parse(r, block, allow)
+}
+
+// parse reads a list in hosts, domain list or adblock format from r. Each line is parsed on its
+// own, so the formats can be mixed. Names are added to block, adblock exceptions (@@||name^) to
+// allow.
+func parse(r io.Reader, block, allow *trie) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' || line[0] == '[' {
+			// Comments, and the [Adblock Plus 2.0] header.
+			continue
+		}
+
+		if strings.HasPrefix(line, "||") || strings.HasPrefix(line, "@@||") {
+			t := block
+			if line[0] == '@' {
+				t = allow
+				line = line[2:]
+			}
+			// Only rules that block a whole domain are used, e.g. ||example.org^ and not
+			// ||example.org/ads or ||example.org^$third-party.
+			if !strings.HasSuffix(line, "^") {
+				continue
+			}
+			if name, ok := normalize(line[2 : len(line)-1]); ok {
+				t.insert(name)
+			}
+			continue
+		}
+
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 1:
+			// domain list
+			if name, ok := normalize(fields[0]); ok {
+				block.insert(name)
+			}
+		case len(fields) > 1 && net.ParseIP(fields[0]) != nil:
+			// hosts file
+			for _, f := range fields[1:] {
+				if local[strings.ToLower(f)] {
+					continue
+				}
+				if name, ok := normalize(f); ok {
+					block.insert(name)
+				}
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// local holds the names in hosts files that are not meant to be blocked.
+var local = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+	"0.0.0.0":               true,
+}
+
+// normalize returns the lowercased, fully qualified name s, a leading "*." is removed as all names
+// below a listed name match. It returns false if s is not a valid domain name.
+func normalize(s string) (string, bool) {
+	s = strings.TrimPrefix(s, "*.")
+	if s == "" || s == "." || net.ParseIP(s) != nil {
+		return "", false
+	}
+	if _, ok := dns.IsDomainName(s); !ok {
+		return "", false
+	}
+	return strings.ToLower(dns.Fqdn(s)), true
+}
@@ -0,0 +1,92 @@
+package blocklist
+
+import (
+	"strings"
+	"testing"
+)
+
+const testList = `# hosts
+127.0.0.1 localhost
+::1 localhost ip6-localhost
+0.0.0.0 0.0.0.0
+0.0.0.0 ads.example.org tracker.example.org # trailing comment
+# domain list
+malware.example.net
+*.wild.example.com
+not..valid
+192.0.2.1
+! adblock
+[Adblock Plus 2.0]
+||adblock.example.com^
+||path.example.com/ads
+||options.example.com^$third-party
+@@||ok.adblock.example.com^
+`
+
+func TestParse(t *testing.T) {
+	block, allow := newTrie(), newTrie()
+	if err := parse(strings.NewReader(testList), block, allow); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		blocked bool
+		allowed bool
+	}{
+		{"ads.example.org.", true, false},
+		{"www.ads.example.org.", true, false},
+		{"tracker.example.org.", true, false},
+		{"example.org.", false, false},
+		{"localhost.", false, false},
+		{"ip6-localhost.", false, false},
+		{"malware.example.net.", true, false},
+		{"wild.example.com.", true, false},
+		{"a.b.wild.example.com.", true, false},
+		{"adblock.example.com.", true, false},
+		{"ok.adblock.example.com.", true, true},
+		{"path.example.com.", false, false},
+		{"options.example.com.", false, false},
+		{"example.com.", false, false},
+	}
+	for _, tc := range tests {
+		if got := block.match(tc.name); got != tc.blocked {
+			t.Errorf("Expected %s to be blocked: %t, got %t", tc.name, tc.blocked, got)
+		}
+		if got := allow.match(tc.name); got != tc.allowed {
+			t.Errorf("Expected %s to be allowed: %t, got %t", tc.name, tc.allowed, got)
+		}
+	}
+	if block.Len() != 5 {
+		t.Errorf("Expected 5 blocked names, got %d", block.Len())
+	}
+}
+
+func TestTrie(t *testing.T) {
+	tr := newTrie()
+	tr.insert("a.b.example.org.")
+	tr.insert("c.b.example.org.")
+	if tr.Len() != 2 {
+		t.Errorf("Expected 2 names, got %d", tr.Len())
+	}
+	if tr.match("b.example.org.") {
+		t.Errorf("Expected b.example.org. not to match")
+	}
+
+	// A parent replaces the names below it.
+	tr.insert("b.example.org.")
+	tr.insert("d.b.example.org.")
+	if tr.Len() != 1 {
+		t.Errorf("Expected 1 name, got %d", tr.Len())
+	}
+	for _, name := range []string{"b.example.org.", "a.b.example.org.", "x.y.b.example.org."} {
+		if !tr.match(name) {
+			t.Errorf("Expected %s to match", name)
+		}
+	}
+	for _, name := range []string{"example.org.", "ab.example.org.", "."} {
+		if tr.match(name) {
+			t.Errorf("Expected %s not to match", name)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package blocklist
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// blockCount is the number of queries that were blocked.
+	blockCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "blocked_requests_total",
+		Help:      "Counter of queries that were blocked.",
+	}, []string{"server", "zone"})
+	// entries is the number of names in the block and allow lists.
+	entries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "entries",
+		Help:      "The number of names in the block and allow lists.",
+	}, []string{"list"})
+	// reloadTime is the timestamp of the last reload of the lists.
+	reloadTime = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "reload_timestamp_seconds",
+		Help:      "The timestamp of the last reload of the lists.",
+	})
+)
@@ -0,0 +1,144 @@
+package blocklist
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+)
+
+const pluginName = "blocklist"
+
+var log = clog.NewWithPlugin(pluginName)
+
+func init() { plugin.Register(pluginName, setup) }
+
+func setup(c *caddy.Controller) error {
+	b, err := blocklistParse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	stop := make(chan struct{})
+	c.OnStartup(func() error {
+		b.readLists()
+		if b.reload > 0 {
+			go b.refresh(stop)
+		}
+		return nil
+	})
+	c.OnShutdown(func() error {
+		close(stop)
+		return nil
+	})
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		b.Next = next
+		return b
+	})
+
+	return nil
+}
+
+// refresh checks the files for changes every reload interval, until stop is closed.
+func (b *Blocklist) refresh(stop chan struct{}) {
+	ticker := time.NewTicker(b.reload)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			b.readLists()
+		}
+	}
+}
+
+func blocklistParse(c *caddy.Controller) (*Blocklist, error) {
+	config := dnsserver.GetConfig(c)
+	b := &Blocklist{ttl: 3600, reload: time.Minute}
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		b.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "block", "allow":
+				allow := c.Val() == "allow"
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, path := range args {
+					if !filepath.IsAbs(path) && config.Root != "" {
+						path = filepath.Join(config.Root, path)
+					}
+					if _, err := os.Stat(path); err != nil {
+						if !os.IsNotExist(err) {
+							return nil, c.Errf("unable to access list '%s': %v", path, err)
+						}
+						log.Warningf("File does not exist: %s", path)
+					}
+					b.files = append(b.files, &file{path: path, allow: allow})
+				}
+			case "response":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "nxdomain":
+					b.response = responseNXDomain
+				case "null":
+					b.response = responseNull
+				case "refused":
+					b.response = responseRefused
+				default:
+					return nil, c.Errf("unknown response '%s'", args[0])
+				}
+			case "ttl":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				ttl, err := strconv.Atoi(args[0])
+				if err != nil || ttl < 0 || ttl > 65535 {
+					return nil, c.Errf("invalid ttl '%s'", args[0])
+				}
+				b.ttl = uint32(ttl)
+			case "reload":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d < 0 {
+					return nil, c.Errf("invalid reload interval '%s'", args[0])
+				}
+				b.reload = d
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	hasBlock := false
+	for _, f := range b.files {
+		hasBlock = hasBlock || !f.allow
+	}
+	if !hasBlock {
+		return nil, c.Err("no block lists")
+	}
+	return b, nil
+}
@@ -0,0 +1,95 @@
+package blocklist
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		files     int
+		zones     []string
+		response  response
+		ttl       uint32
+		reload    time.Duration
+	}{
+		{`blocklist {
+			block /does/not/exist
+		}`, false, 1, []string{}, responseNXDomain, 3600, time.Minute},
+		{`blocklist example.org {
+			block hosts.txt domains.txt
+			allow allow.txt
+			response refused
+			ttl 60
+			reload 1h
+		}`, false, 3, []string{"example.org."}, responseRefused, 60, time.Hour},
+		{`blocklist {
+			block hosts.txt
+			response null
+			reload 0
+		}`, false, 1, []string{}, responseNull, 3600, 0},
+		// fails
+		{`blocklist`, true, 0, nil, 0, 0, 0},
+		{`blocklist {
+			allow allow.txt
+		}`, true, 0, nil, 0, 0, 0},
+		{`blocklist {
+			block
+		}`, true, 0, nil, 0, 0, 0},
+		{`blocklist {
+			block hosts.txt
+			response servfail
+		}`, true, 0, nil, 0, 0, 0},
+		{`blocklist {
+			block hosts.txt
+			ttl -1
+		}`, true, 0, nil, 0, 0, 0},
+		{`blocklist {
+			block hosts.txt
+			reload -1s
+		}`, true, 0, nil, 0, 0, 0},
+		{`blocklist {
+			block hosts.txt
+			unknown
+		}`, true, 0, nil, 0, 0, 0},
+		{`blocklist {
+			block hosts.txt
+		}
+		blocklist {
+			block hosts.txt
+		}`, true, 0, nil, 0, 0, 0},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		b, err := blocklistParse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but found none for input %s", i, tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error but found one for input %s, got: %v", i, tc.input, err)
+		}
+		if len(b.files) != tc.files {
+			t.Errorf("Test %d: expected %d files, got %d", i, tc.files, len(b.files))
+		}
+		if len(b.Zones) != len(tc.zones) {
+			t.Errorf("Test %d: expected zones %v, got %v", i, tc.zones, b.Zones)
+		}
+		if b.response != tc.response {
+			t.Errorf("Test %d: expected response %d, got %d", i, tc.response, b.response)
+		}
+		if b.ttl != tc.ttl {
+			t.Errorf("Test %d: expected ttl %d, got %d", i, tc.ttl, b.ttl)
+		}
+		if b.reload != tc.reload {
+			t.Errorf("Test %d: expected reload %s, got %s", i, tc.reload, b.reload)
+		}
+	}
+}
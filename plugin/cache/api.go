@@ -0,0 +1,272 @@
+package cache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/reuseport"
+	"github.com/coredns/coredns/plugin/pkg/uniq"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	uniqAddr = uniq.New()
+
+	apisMu sync.Mutex
+	apis   = map[string]*api{} // the HTTP APIs per address, for the current configuration.
+)
+
+// api is the HTTP API to look at and purge the contents of the caches that use the same address.
+// When it has a token, requests must send it as a bearer token in the Authorization header.
+type api struct {
+	Addr  string
+	token string
+
+	sync.RWMutex
+	caches []*Cache
+	ln     net.Listener
+	done   bool
+}
+
+// register adds ca to the API listening on addr, creating it if needed. Caches that share the API
+// must use the same token.
+func register(addr, token string, ca *Cache) (*api, error) {
+	apisMu.Lock()
+	defer apisMu.Unlock()
+	a, ok := apis[addr]
+	if !ok {
+		a = &api{Addr: addr, token: token}
+		apis[addr] = a
+	}
+	if a.token != token {
+		return nil, fmt.Errorf("api on %s is used with different tokens", addr)
+	}
+	a.Lock()
+	a.caches = append(a.caches, ca)
+	a.Unlock()
+	return a, nil
+}
+
+func (a *api) onStartup() error {
+	ln, err := reuseport.Listen("tcp", a.Addr)
+	if err != nil {
+		log.Errorf("Failed to start cache API on %s: %s", a.Addr, err)
+		return err
+	}
+
+	a.Lock()
+	a.ln = ln
+	a.done = true
+	a.Unlock()
+
+	go func() { http.Serve(ln, a.handler()) }()
+
+	return nil
+}
+
+func (a *api) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cache/entries", a.entries)
+	mux.HandleFunc("/cache/purge", a.purge)
+	if a.token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (a *api) onShutdown() error {
+	apisMu.Lock()
+	delete(apis, a.Addr)
+	apisMu.Unlock()
+
+	a.Lock()
+	defer a.Unlock()
+	if !a.done {
+		return nil
+	}
+
+	uniqAddr.Unset(a.Addr)
+
+	a.ln.Close()
+	a.done = false
+	return nil
+}
+
+// apiEntry is a cached item as returned by the API.
+type apiEntry struct {
+	Zones  string   `json:"zones"`
+	View   string   `json:"view,omitempty"`
+	Cache  string   `json:"cache"`
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Rcode  string   `json:"rcode"`
+	Subnet string   `json:"subnet,omitempty"`
+	TTL    int      `json:"ttl"`
+	Stale  bool     `json:"stale"`
+	Answer []string `json:"answer,omitempty"`
+}
+
+// entries lists the cached items matching the filter in the query parameters.
+func (a *api) entries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	f, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ret := []apiEntry{}
+	a.RLock()
+	for _, c := range a.caches {
+		now := c.now()
+		for _, typ := range []string{Success, Denial} {
+			ca := c.pcache
+			if typ == Denial {
+				ca = c.ncache
+			}
+			for _, i := range items(ca) {
+				if !f.matches(i) {
+					continue
+				}
+				e := apiEntry{
+					Zones: c.zonesMetricLabel,
+					View:  c.viewMetricLabel,
+					Cache: typ,
+					Name:  i.Name,
+					Type:  dns.Type(i.QType).String(),
+					Rcode: dns.RcodeToString[i.Rcode],
+					TTL:   i.ttl(now),
+				}
+				if e.TTL <= 0 {
+					e.TTL = 0
+					e.Stale = true
+				}
+				if i.ecs != nil {
+					bits := net.IPv4len * 8
+					if i.ecs.Family == 2 {
+						bits = net.IPv6len * 8
+					}
+					n := &net.IPNet{IP: mask(i.ecs.Address, i.ecs.Family, i.ecs.SourceScope), Mask: net.CIDRMask(int(i.ecs.SourceScope), bits)}
+					e.Subnet = n.String()
+				}
+				for _, rr := range i.Answer {
+					e.Answer = append(e.Answer, rr.String())
+				}
+				ret = append(ret, e)
+			}
+		}
+	}
+	a.RUnlock()
+
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	writeJSON(w, ret)
+}
+
+// purge removes the cached items matching the filter in the query parameters.
+func (a *api) purge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	f, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if f.empty() {
+		http.Error(w, "name, suffix or type is required", http.StatusBadRequest)
+		return
+	}
+
+	n := 0
+	a.RLock()
+	for _, c := range a.caches {
+		n += remove(c.pcache, f)
+		n += remove(c.ncache, f)
+	}
+	a.RUnlock()
+
+	log.Infof("Purged %d cache entries matching %s", n, r.URL.RawQuery)
+	writeJSON(w, struct {
+		Purged int `json:"purged"`
+	}{n})
+}
+
+// filter selects cached items by name, name suffix and type. Empty fields match every item.
+type filter struct {
+	name   string
+	suffix string
+	qtype  uint16
+}
+
+func parseFilter(r *http.Request) (filter, error) {
+	q := r.URL.Query()
+	f := filter{}
+	if n := q.Get("name"); n != "" {
+		f.name = strings.ToLower(dns.Fqdn(n))
+	}
+	if s := q.Get("suffix"); s != "" {
+		f.suffix = strings.ToLower(dns.Fqdn(s))
+	}
+	if t := q.Get("type"); t != "" {
+		qtype, ok := dns.StringToType[strings.ToUpper(t)]
+		if !ok {
+			return f, fmt.Errorf("unknown type: %s", t)
+		}
+		f.qtype = qtype
+	}
+	return f, nil
+}
+
+func (f filter) empty() bool { return f.name == "" && f.suffix == "" && f.qtype == 0 }
+
+func (f filter) matches(i *item) bool {
+	name := strings.ToLower(i.Name)
+	if f.name != "" && name != f.name {
+		return false
+	}
+	if f.suffix != "" && !dns.IsSubDomain(f.suffix, name) {
+		return false
+	}
+	if f.qtype != 0 && i.QType != f.qtype {
+		return false
+	}
+	return true
+}
+
+// remove removes the items matching f from ca, and returns the number of items removed.
+func remove(ca *cache.Cache, f filter) int {
+	n := 0
+	ca.Walk(func(items map[uint64]interface{}, k uint64) bool {
+		if i, ok := items[k]; ok && f.matches(i.(*item)) {
+			delete(items, k)
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestAPI(t *testing.T) {
+	c := New()
+	c.zonesMetricLabel = "."
+	c.Next = ttlBackend(60)
+	for _, q := range []struct {
+		name  string
+		qtype uint16
+	}{
+		{"a.example.org.", dns.TypeA},
+		{"a.example.org.", dns.TypeAAAA},
+		{"b.example.org.", dns.TypeA},
+		{"example.net.", dns.TypeA},
+	} {
+		req := new(dns.Msg)
+		req.SetQuestion(q.name, q.qtype)
+		c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), req)
+	}
+	a := &api{caches: []*Cache{c}}
+
+	tests := []struct {
+		method string
+		url    string
+		code   int
+		purged int // number of entries purged, for purge requests
+		left   int // number of entries left
+	}{
+		{http.MethodGet, "/cache/entries", http.StatusOK, 0, 4},
+		{http.MethodGet, "/cache/entries?type=bla", http.StatusBadRequest, 0, 4},
+		{http.MethodPost, "/cache/entries", http.StatusMethodNotAllowed, 0, 4},
+		{http.MethodGet, "/cache/purge?name=a.example.org", http.StatusMethodNotAllowed, 0, 4},
+		{http.MethodPost, "/cache/purge", http.StatusBadRequest, 0, 4},
+		{http.MethodPost, "/cache/purge?name=A.example.org&type=aaaa", http.StatusOK, 1, 3},
+		{http.MethodPost, "/cache/purge?suffix=example.org", http.StatusOK, 2, 1},
+		{http.MethodDelete, "/cache/purge?type=A", http.StatusOK, 1, 0},
+	}
+
+	for i, tc := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.url, nil)
+		a.handler().ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("Test %d: expected status %d, got %d", i, tc.code, rec.Code)
+			continue
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		if req.URL.Path == "/cache/purge" {
+			var res struct{ Purged int }
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatalf("Test %d: %s", i, err)
+			}
+			if res.Purged != tc.purged {
+				t.Errorf("Test %d: expected %d entries purged, got %d", i, tc.purged, res.Purged)
+			}
+		}
+		if n := c.pcache.Len(); n != tc.left {
+			t.Errorf("Test %d: expected %d entries left, got %d", i, tc.left, n)
+		}
+	}
+}
+
+func TestAPIEntries(t *testing.T) {
+	c := New()
+	c.ecs = true
+	c.zonesMetricLabel = "."
+	queries := 0
+	c.Next = ecsHandler(&queries)
+	c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), ecsMsg("example.org.", "10.0.1.0/24"))
+	a := &api{caches: []*Cache{c}}
+
+	rec := httptest.NewRecorder()
+	a.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cache/entries?name=example.org.", nil))
+	var entries []apiEntry
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Name != "example.org." || e.Type != "A" || e.Cache != Success || e.Rcode != "NOERROR" || e.Zones != "." {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+	if e.Subnet != "10.0.0.0/16" {
+		t.Errorf("Expected subnet 10.0.0.0/16, got %s", e.Subnet)
+	}
+	if e.TTL != 300 || e.Stale {
+		t.Errorf("Expected TTL 300 and not stale, got %d and %t", e.TTL, e.Stale)
+	}
+	if len(e.Answer) != 1 {
+		t.Errorf("Expected 1 answer, got %d", len(e.Answer))
+	}
+}
+
+func TestAPIToken(t *testing.T) {
+	a := &api{token: "s3cr3t", caches: []*Cache{New()}}
+
+	tests := []struct {
+		auth string
+		code int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"s3cr3t", http.StatusUnauthorized},
+		{"Bearer s3cr3t", http.StatusOK},
+	}
+	for i, tc := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/cache/entries", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		a.handler().ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("Test %d: expected status %d, got %d", i, tc.code, rec.Code)
+		}
+	}
+
+	if _, err := register("localhost:8182", "a", New()); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(apis, "localhost:8182")
+	if _, err := register("localhost:8182", "b", New()); err == nil {
+		t.Errorf("Expected an error for an API with different tokens")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/cache"
 	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/pkg/response"
 	"github.com/coredns/coredns/request"
 
@@ -51,6 +52,18 @@ type Cache struct {
 	// Keep ttl option
 	keepttl bool
 
+	// Client subnet aware keys, see RFC 7871.
+	ecs    bool
+	scopes scopes
+
+	// Saving the cache to a file, and loading it on startup.
+	persistFile     string
+	persistInterval time.Duration
+
+	// Address of the HTTP API, and the token its clients must send.
+	apiAddr  string
+	apiToken string
+
 	// Testing.
 	now func() time.Time
 }
@@ -178,6 +191,22 @@ func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 
 	// key returns empty string for anything we don't want to cache.
 	hasKey, key := key(w.state.Name(), res, mt, w.do)
+	var (
+		ecs      *dns.EDNS0_SUBNET
+		ecsScope uint8
+	)
+	if w.ecs {
+		if ecs = subnet(w.state.Req); ecs != nil {
+			var ok bool
+			ecsScope, ok = scope(ecs, res)
+			if hasKey = hasKey && ok; hasKey {
+				key = hashSubnet(w.state.Name(), res.Question[0].Qtype, w.do, ecs.Family, ecs.Address, ecsScope)
+				if ecsScope > 0 {
+					w.scopes.add(ecs.Family, ecsScope)
+				}
+			}
+		}
+	}
 
 	msgTTL := dnsutil.MinimalTTL(res, mt)
 	var duration time.Duration
@@ -206,9 +235,16 @@ func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
 
 	// Apply capped TTL to this reply to avoid jarring TTL experience 1799 -> 8 (e.g.)
 	ttl := uint32(duration.Seconds())
+	ede := edns.ExtendedErrors(res)
 	res.Answer = filterRRSlice(res.Answer, ttl, false)
 	res.Ns = filterRRSlice(res.Ns, ttl, false)
 	res.Extra = filterRRSlice(res.Extra, ttl, false)
+	if ecs != nil {
+		res.Extra = append(res.Extra, subnetOPT(ecs, ecsScope))
+	}
+	for _, e := range ede {
+		edns.SetExtendedError(res, e.InfoCode, e.ExtraText)
+	}
 
 	if !w.do && !w.ad {
 		// unset AD bit if requester is not OK with DNSSEC
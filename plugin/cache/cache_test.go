@@ -9,6 +9,7 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metadata"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/pkg/response"
 	"github.com/coredns/coredns/plugin/test"
 	"github.com/coredns/coredns/request"
@@ -744,3 +745,43 @@ func wildcardMetadataBackend(qname, wildcard string) plugin.Handler {
 		return dns.RcodeSuccess, nil
 	})
 }
+
+func TestCacheExtendedErrors(t *testing.T) {
+	c := New()
+	c.staleUpTo = time.Hour
+	c.Next = plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = []dns.RR{test.A("example.org. 60 IN A 127.0.0.53")}
+		edns.SetExtendedError(m, dns.ExtendedErrorCodeForgedAnswer, "from upstream")
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.org.", dns.TypeA)
+	req.SetEdns0(4096, false)
+
+	tests := []struct {
+		future time.Duration
+		stale  bool
+	}{
+		{0, false},           // from the backend
+		{time.Second, false}, // from the cache
+		{time.Minute * 2, true},
+	}
+	for i, tc := range tests {
+		c.now = func() time.Time { return time.Now().Add(tc.future) }
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, req.Copy())
+		if !edns.HasExtendedError(rec.Msg, dns.ExtendedErrorCodeForgedAnswer) {
+			t.Errorf("Test %d: expected the extended error from upstream", i)
+		}
+		if got := edns.HasExtendedError(rec.Msg, dns.ExtendedErrorCodeStaleAnswer); got != tc.stale {
+			t.Errorf("Test %d: expected Stale Answer %t, got %t", i, tc.stale, got)
+		}
+		if n := len(rec.Msg.Extra); n != 1 {
+			t.Errorf("Test %d: expected a single OPT record, got %d records", i, n)
+		}
+	}
+}
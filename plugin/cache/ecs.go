@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"hash/fnv"
+	"net"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+// subnet returns the EDNS0 client subnet option in m, or nil if there is none.
+func subnet(m *dns.Msg) *dns.EDNS0_SUBNET {
+	o := m.IsEdns0()
+	if o == nil {
+		return nil
+	}
+	for _, opt := range o.Option {
+		if e, ok := opt.(*dns.EDNS0_SUBNET); ok {
+			return e
+		}
+	}
+	return nil
+}
+
+// scope returns the scope prefix length under which the response res to the request with client
+// subnet ecs can be cached, see RFC 7871, section 7.3.1. It returns false if res can't be cached.
+func scope(ecs *dns.EDNS0_SUBNET, res *dns.Msg) (uint8, bool) {
+	e := subnet(res)
+	if e == nil {
+		// No option in the response, the answer is valid for everyone.
+		return 0, true
+	}
+	if e.Family != ecs.Family || e.SourceNetmask != ecs.SourceNetmask || !mask(e.Address, e.Family, e.SourceNetmask).Equal(mask(ecs.Address, ecs.Family, ecs.SourceNetmask)) {
+		// Not an answer to our question.
+		return 0, false
+	}
+	if e.SourceScope > ecs.SourceNetmask {
+		return ecs.SourceNetmask, true
+	}
+	return e.SourceScope, true
+}
+
+// subnetOPT returns an OPT record holding the client subnet option ecs with a scope prefix length
+// of n, to be added to a reply.
+func subnetOPT(ecs *dns.EDNS0_SUBNET, n uint8) *dns.OPT {
+	e := *ecs
+	e.SourceScope = n
+	o := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+	o.Option = []dns.EDNS0{&e}
+	return o
+}
+
+// hashSubnet returns the key for qname, qtype and do, for clients in the network of the given family
+// with address addr and prefix length n. For n is 0 this is the same key as returned by hash.
+func hashSubnet(qname string, qtype uint16, do bool, family uint16, addr net.IP, n uint8) uint64 {
+	if n == 0 {
+		return hash(qname, qtype, do)
+	}
+	h := fnv.New64()
+
+	if do {
+		h.Write(one)
+	} else {
+		h.Write(zero)
+	}
+
+	h.Write([]byte{byte(qtype >> 8)})
+	h.Write([]byte{byte(qtype)})
+	h.Write([]byte(qname))
+	h.Write([]byte{byte(family), n})
+	h.Write(mask(addr, family, n))
+	return h.Sum64()
+}
+
+// mask returns addr masked to a prefix length of n bits.
+func mask(addr net.IP, family uint16, n uint8) net.IP {
+	if family == 1 {
+		return addr.To4().Mask(net.CIDRMask(int(n), net.IPv4len*8))
+	}
+	return addr.To16().Mask(net.CIDRMask(int(n), net.IPv6len*8))
+}
+
+// scopes records the scope prefix lengths seen in cached responses, so a lookup only needs to try
+// the keys for those lengths.
+type scopes struct {
+	bits [2][3]atomic.Uint64 // per family, bit n is set if scope n has been seen.
+}
+
+func (s *scopes) add(family uint16, n uint8) {
+	if family != 1 && family != 2 {
+		return
+	}
+	b := &s.bits[family-1][n/64]
+	for {
+		old := b.Load()
+		if old&(1<<(n%64)) != 0 || b.CompareAndSwap(old, old|1<<(n%64)) {
+			return
+		}
+	}
+}
+
+func (s *scopes) seen(family uint16, n uint8) bool {
+	if family != 1 && family != 2 {
+		return false
+	}
+	return s.bits[family-1][n/64].Load()&(1<<(n%64)) != 0
+}
+
+// keys returns the keys under which a response to a query for qname, qtype and do with client
+// subnet ecs might be cached, most specific first. If ecs is nil only the key without a subnet is
+// returned.
+func (s *scopes) keys(qname string, qtype uint16, do bool, ecs *dns.EDNS0_SUBNET) []uint64 {
+	if ecs == nil {
+		return []uint64{hash(qname, qtype, do)}
+	}
+	keys := make([]uint64, 0, 2)
+	for n := ecs.SourceNetmask; n > 0; n-- {
+		if s.seen(ecs.Family, n) {
+			keys = append(keys, hashSubnet(qname, qtype, do, ecs.Family, ecs.Address, n))
+		}
+	}
+	return append(keys, hash(qname, qtype, do))
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestECSCache(t *testing.T) {
+	tests := []struct {
+		subnet string // client subnet in the query, if any
+		answer string // expected address in the answer
+		scope  uint8  // expected scope in the reply
+		cached bool   // whether the reply should come from the cache
+		ecsOpt bool   // whether the reply should have a client subnet option
+	}{
+		{"10.0.1.0/24", "10.0.0.1", 16, false, true},
+		{"10.0.2.0/24", "10.0.0.1", 16, true, true},
+		{"10.1.1.0/24", "10.1.0.1", 16, false, true},
+		{"10.1.2.0/24", "10.1.0.1", 16, true, true},
+		// A source prefix shorter than the scope can't use the cached replies.
+		{"10.0.0.0/8", "10.0.0.1", 8, false, true},
+		{"2001:db8::/56", "127.0.0.1", 0, false, true},
+		// Scope 0 replies are shared with all clients.
+		{"2001:db8:1::/56", "127.0.0.1", 0, true, true},
+		{"", "127.0.0.1", 0, true, false},
+	}
+
+	c := New()
+	c.ecs = true
+	queries := 0
+	c.Next = ecsHandler(&queries)
+
+	for i, tc := range tests {
+		m := ecsMsg("example.org.", tc.subnet)
+		before := queries
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, m)
+
+		if cached := queries == before; cached != tc.cached {
+			t.Errorf("Test %d: expected cached to be %t, got %t", i, tc.cached, cached)
+		}
+		if len(rec.Msg.Answer) != 1 {
+			t.Fatalf("Test %d: expected 1 answer, got %d", i, len(rec.Msg.Answer))
+		}
+		if a := rec.Msg.Answer[0].(*dns.A).A.String(); a != tc.answer {
+			t.Errorf("Test %d: expected answer %s, got %s", i, tc.answer, a)
+		}
+		e := subnet(rec.Msg)
+		if (e != nil) != tc.ecsOpt {
+			t.Fatalf("Test %d: expected client subnet option to be %t, got %v", i, tc.ecsOpt, e)
+		}
+		if e != nil && e.SourceScope != tc.scope {
+			t.Errorf("Test %d: expected scope %d, got %d", i, tc.scope, e.SourceScope)
+		}
+	}
+}
+
+func TestECSCacheDisabled(t *testing.T) {
+	c := New()
+	queries := 0
+	c.Next = ecsHandler(&queries)
+
+	for _, s := range []string{"10.0.1.0/24", "10.1.1.0/24", ""} {
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		c.ServeDNS(context.TODO(), rec, ecsMsg("example.org.", s))
+		if a := rec.Msg.Answer[0].(*dns.A).A.String(); a != "10.0.0.1" {
+			t.Errorf("Expected answer 10.0.0.1 for %q, got %s", s, a)
+		}
+	}
+	if queries != 1 {
+		t.Errorf("Expected 1 query to the backend, got %d", queries)
+	}
+}
+
+func TestScopes(t *testing.T) {
+	var s scopes
+	s.add(1, 24)
+	s.add(2, 128)
+	s.add(2, 56)
+
+	if !s.seen(1, 24) || s.seen(1, 16) || s.seen(2, 24) {
+		t.Error("Expected only scope 24 to be seen for IPv4")
+	}
+	if !s.seen(2, 128) || !s.seen(2, 56) || s.seen(2, 64) {
+		t.Error("Expected only scopes 56 and 128 to be seen for IPv6")
+	}
+
+	ecs := &dns.EDNS0_SUBNET{Family: 2, SourceNetmask: 64, Address: net.ParseIP("2001:db8::1")}
+	if keys := s.keys("example.org.", dns.TypeA, false, ecs); len(keys) != 2 {
+		t.Errorf("Expected 2 keys, got %d", len(keys))
+	}
+	if keys := s.keys("example.org.", dns.TypeA, false, nil); len(keys) != 1 || keys[0] != hash("example.org.", dns.TypeA, false) {
+		t.Errorf("Expected only the key without subnet, got %v", keys)
+	}
+}
+
+func ecsMsg(qname, s string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, dns.TypeA)
+	if s == "" {
+		return m
+	}
+	_, n, _ := net.ParseCIDR(s)
+	ones, _ := n.Mask.Size()
+	e := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: uint8(ones), Address: n.IP}
+	if n.IP.To4() == nil {
+		e.Family = 2
+	}
+	m.SetEdns0(4096, false)
+	o := m.IsEdns0()
+	o.Option = append(o.Option, e)
+	return m
+}
+
+// ecsHandler returns an address per /16 for IPv4 clients with a scope of 16, and 127.0.0.1 with a
+// scope of 0 otherwise. It counts the queries in n.
+func ecsHandler(n *int) plugin.Handler {
+	return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		*n++
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Response, m.RecursionAvailable = true, true
+
+		addr := "127.0.0.1"
+		if e := subnet(r); e != nil {
+			e1 := *e
+			if e.Family == 1 {
+				ip := e.Address.To4().Mask(net.CIDRMask(16, 32))
+				ip[3] = 1
+				addr = ip.String()
+				e1.SourceScope = 16
+			}
+			m.SetEdns0(4096, false)
+			o := m.IsEdns0()
+			o.Option = append(o.Option, &e1)
+		}
+		m.Answer = []dns.RR{test.A(m.Question[0].Name + " 300 IN A " + addr)}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/coredns/coredns/plugin/cache/freq"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -20,6 +21,8 @@ type item struct {
 	Ns                 []dns.RR
 	Extra              []dns.RR
 	wildcard           string
+	ecs                *dns.EDNS0_SUBNET
+	ede                []*dns.EDNS0_EDE
 
 	origTTL uint32
 	stored  time.Time
@@ -49,6 +52,8 @@ func newItem(m *dns.Msg, now time.Time, d time.Duration) *item {
 		j++
 	}
 	i.Extra = i.Extra[:j]
+	i.ecs = subnet(m)
+	i.ede = edns.ExtendedErrors(m)
 
 	i.origTTL = uint32(d.Seconds())
 	i.stored = now.UTC()
@@ -94,6 +99,17 @@ func (i *item) toMsg(m *dns.Msg, now time.Time, do bool, ad bool) *dns.Msg {
 	return m1
 }
 
+// scope returns the scope prefix length for a reply from i to a query with client subnet ecs.
+func (i *item) scope(ecs *dns.EDNS0_SUBNET) uint8 {
+	if i.ecs == nil {
+		return 0
+	}
+	if i.ecs.SourceScope > ecs.SourceNetmask {
+		return ecs.SourceNetmask
+	}
+	return i.ecs.SourceScope
+}
+
 func (i *item) ttl(now time.Time) int {
 	ttl := int(i.origTTL) - int(now.UTC().Sub(i.stored).Seconds())
 	return ttl
@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+
+	"github.com/miekg/dns"
+)
+
+// entry is a cached item as saved in the persist file.
+type entry struct {
+	Key      uint64
+	Denial   bool
+	Msg      []byte // the cached message in wire format
+	Wildcard string
+	OrigTTL  uint32
+	Stored   time.Time
+}
+
+// persistVersion is written at the start of the persist file, a file with another version is ignored.
+const persistVersion = 1
+
+// save writes the contents of the cache to c.persistFile. The file is replaced atomically.
+func (c *Cache) save() error {
+	dir, base := filepath.Split(c.persistFile)
+	f, err := os.CreateTemp(dir, base+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	n, err := c.write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), c.persistFile); err != nil {
+		return err
+	}
+	log.Infof("Saved %d cache entries to %q", n, c.persistFile)
+	return nil
+}
+
+// write writes the contents of the cache to w, and returns the number of entries written.
+func (c *Cache) write(w io.Writer) (int, error) {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(persistVersion); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, ca := range []*cache.Cache{c.pcache, c.ncache} {
+		for k, i := range items(ca) {
+			buf, err := i.pack()
+			if err != nil {
+				// Can't happen for messages we received.
+				continue
+			}
+			e := entry{Key: k, Denial: ca == c.ncache, Msg: buf, Wildcard: i.wildcard, OrigTTL: i.origTTL, Stored: i.stored}
+			if err := enc.Encode(&e); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// load adds the entries in c.persistFile to the cache, it's not an error if the file doesn't exist.
+func (c *Cache) load() error {
+	f, err := os.Open(c.persistFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := c.read(bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+	log.Infof("Loaded %d cache entries from %q", n, c.persistFile)
+	return nil
+}
+
+// read adds the entries read from r to the cache, and returns the number of entries added. Entries
+// that expired, and can't be served stale, are skipped.
+func (c *Cache) read(r io.Reader) (int, error) {
+	dec := gob.NewDecoder(r)
+	version := 0
+	if err := dec.Decode(&version); err != nil {
+		return 0, err
+	}
+	if version != persistVersion {
+		return 0, nil
+	}
+
+	now := c.now()
+	n := 0
+	for {
+		var e entry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		m := new(dns.Msg)
+		if err := m.Unpack(e.Msg); err != nil || len(m.Question) == 0 {
+			continue
+		}
+		i := newItem(m, e.Stored, time.Duration(e.OrigTTL)*time.Second)
+		i.wildcard = e.Wildcard
+		if ttl := i.ttl(now); ttl <= 0 && -ttl >= int(c.staleUpTo.Seconds()) {
+			continue
+		}
+
+		if i.ecs != nil && i.ecs.SourceScope > 0 {
+			c.scopes.add(i.ecs.Family, i.scope(i.ecs))
+		}
+		if e.Denial {
+			c.ncache.Add(e.Key, i)
+		} else {
+			c.pcache.Add(e.Key, i)
+		}
+		n++
+	}
+}
+
+// persist saves the cache every c.persistInterval, until stop is closed.
+func (c *Cache) persist(stop <-chan struct{}) {
+	tick := time.NewTicker(c.persistInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+			if err := c.save(); err != nil {
+				log.Errorf("Failed to save cache to %q: %s", c.persistFile, err)
+			}
+		}
+	}
+}
+
+// items returns the items in ca.
+func items(ca *cache.Cache) map[uint64]*item {
+	ret := make(map[uint64]*item, ca.Len())
+	ca.Walk(func(items map[uint64]interface{}, k uint64) bool {
+		if i, ok := items[k]; ok {
+			ret[k] = i.(*item)
+		}
+		return true
+	})
+	return ret
+}
+
+// pack returns i as a message in wire format.
+func (i *item) pack() ([]byte, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(i.Name, i.QType)
+	m.Response = true
+	m.Rcode = i.Rcode
+	m.AuthenticatedData = i.AuthenticatedData
+	m.RecursionAvailable = i.RecursionAvailable
+	m.Answer = i.Answer
+	m.Ns = i.Ns
+	m.Extra = append([]dns.RR(nil), i.Extra...)
+	if i.ecs != nil {
+		m.Extra = append(m.Extra, subnetOPT(i.ecs, i.ecs.SourceScope))
+	}
+	for _, e := range i.ede {
+		edns.SetExtendedError(m, e.InfoCode, e.ExtraText)
+	}
+	return m.Pack()
+}
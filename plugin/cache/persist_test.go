@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestPersist(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache")
+	now := time.Now()
+
+	c := New()
+	c.persistFile = file
+	c.now = func() time.Time { return now }
+	c.Next = ttlBackend(60)
+
+	for _, name := range []string{"a.example.org.", "b.example.org."} {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), req)
+	}
+	req := new(dns.Msg)
+	req.SetQuestion("nx.example.org.", dns.TypeA)
+	c.Next = nxDomainBackend(60)
+	c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), req)
+
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load the file 10 seconds later into a new cache.
+	c1 := New()
+	c1.persistFile = file
+	c1.now = func() time.Time { return now.Add(10 * time.Second) }
+	if err := c1.load(); err != nil {
+		t.Fatal(err)
+	}
+	if c1.pcache.Len() != 2 || c1.ncache.Len() != 1 {
+		t.Fatalf("Expected 2 positive and 1 negative entries, got %d and %d", c1.pcache.Len(), c1.ncache.Len())
+	}
+
+	// The entries must be served from the cache, with the remaining TTL.
+	c1.Next = nxDomainBackend(60)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	req = new(dns.Msg)
+	req.SetQuestion("a.example.org.", dns.TypeA)
+	c1.ServeDNS(context.TODO(), rec, req)
+	if rec.Msg.Rcode != dns.RcodeSuccess || len(rec.Msg.Answer) != 1 {
+		t.Fatalf("Expected the answer from the cache, got %v", rec.Msg)
+	}
+	if ttl := rec.Msg.Answer[0].Header().Ttl; ttl != 50 {
+		t.Errorf("Expected TTL 50, got %d", ttl)
+	}
+
+	// Expired entries are not loaded.
+	c2 := New()
+	c2.persistFile = file
+	c2.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if err := c2.load(); err != nil {
+		t.Fatal(err)
+	}
+	if c2.pcache.Len() != 0 || c2.ncache.Len() != 0 {
+		t.Errorf("Expected no entries, got %d and %d", c2.pcache.Len(), c2.ncache.Len())
+	}
+
+	// Unless they can be served stale.
+	c2.staleUpTo = time.Hour
+	if err := c2.load(); err != nil {
+		t.Fatal(err)
+	}
+	if c2.pcache.Len() != 2 || c2.ncache.Len() != 1 {
+		t.Errorf("Expected 2 positive and 1 negative entries, got %d and %d", c2.pcache.Len(), c2.ncache.Len())
+	}
+}
+
+func TestPersistNoFile(t *testing.T) {
+	c := New()
+	c.persistFile = filepath.Join(t.TempDir(), "cache")
+	if err := c.load(); err != nil {
+		t.Errorf("Expected no error for a missing file, got %s", err)
+	}
+}
+
+func TestPersistECS(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache")
+	c := New()
+	c.ecs = true
+	c.persistFile = file
+	queries := 0
+	c.Next = ecsHandler(&queries)
+	c.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), ecsMsg("example.org.", "10.0.1.0/24"))
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	c1 := New()
+	c1.ecs = true
+	c1.persistFile = file
+	c1.Next = ecsHandler(&queries)
+	if err := c1.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	c1.ServeDNS(context.TODO(), rec, ecsMsg("example.org.", "10.0.2.0/24"))
+	if queries != 1 {
+		t.Errorf("Expected the answer from the cache, got %d queries", queries)
+	}
+	if e := subnet(rec.Msg); e == nil || e.SourceScope != 16 {
+		t.Errorf("Expected a client subnet option with scope 16, got %v", e)
+	}
+}
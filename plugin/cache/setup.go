@@ -3,6 +3,8 @@ package cache
 import (
 	"errors"
 	"fmt"
+	"net"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -29,6 +31,53 @@ func setup(c *caddy.Controller) error {
 		return nil
 	})
 
+	if ca.persistFile != "" {
+		var stop chan struct{}
+		start := func() error {
+			if ca.persistInterval > 0 {
+				stop = make(chan struct{})
+				go ca.persist(stop)
+			}
+			return nil
+		}
+		shutdown := func() error {
+			if stop != nil {
+				close(stop)
+				stop = nil
+			}
+			if err := ca.save(); err != nil {
+				log.Errorf("Failed to save cache to %q: %s", ca.persistFile, err)
+			}
+			return nil
+		}
+
+		c.OnStartup(func() error {
+			if err := ca.load(); err != nil {
+				log.Warningf("Failed to load cache from %q: %s", ca.persistFile, err)
+			}
+			return start()
+		})
+		// Save on restart, so the new instance can load the entries when it starts up.
+		c.OnRestart(shutdown)
+		c.OnRestartFailed(start)
+		c.OnFinalShutdown(shutdown)
+	}
+
+	if ca.apiAddr != "" {
+		a, err := register(ca.apiAddr, ca.apiToken, ca)
+		if err != nil {
+			return plugin.Error("cache", err)
+		}
+		start := func() error {
+			uniqAddr.Set(a.Addr, a.onStartup)
+			return uniqAddr.ForEach()
+		}
+		c.OnStartup(start)
+		c.OnRestartFailed(start)
+		c.OnRestart(a.onShutdown)
+		c.OnFinalShutdown(a.onShutdown)
+	}
+
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		ca.Next = next
 		return ca
@@ -245,6 +294,50 @@ func cacheParse(c *caddy.Controller) (*Cache, error) {
 					return nil, c.ArgErr()
 				}
 				ca.keepttl = true
+			case "persist":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				ca.persistFile = args[0]
+				if root := dnsserver.GetConfig(c).Root; !filepath.IsAbs(ca.persistFile) && root != "" {
+					ca.persistFile = filepath.Join(root, ca.persistFile)
+				}
+				if len(args) > 1 {
+					d, err := time.ParseDuration(args[1])
+					if err != nil {
+						return nil, err
+					}
+					if d < 0 {
+						return nil, errors.New("invalid negative interval for persist")
+					}
+					ca.persistInterval = d
+				}
+			case "api":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				host, port, err := net.SplitHostPort(args[0])
+				if err != nil {
+					return nil, err
+				}
+				if host == "" {
+					host = "localhost"
+				}
+				// Anyone that can reach the API can purge the cache, so other addresses need a token.
+				if ip := net.ParseIP(host); len(args) == 1 && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+					return nil, c.Errf("api on '%s' needs a token, or a loopback address", args[0])
+				}
+				ca.apiAddr = net.JoinHostPort(host, port)
+				if len(args) == 2 {
+					ca.apiToken = args[1]
+				}
+			case "ecs":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				ca.ecs = true
 			default:
 				return nil, c.ArgErr()
 			}
@@ -260,3 +260,108 @@ func TestKeepttl(t *testing.T) {
 		}
 	}
 }
+
+func TestECS(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+	}{
+		// positive
+		{"ecs", false},
+		// negative
+		{"ecs arg1", true},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if !ca.ecs {
+			t.Errorf("Test %v: Expected ecs enabled but disabled", i)
+		}
+	}
+}
+
+func TestPersistParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		file      string
+		interval  time.Duration
+	}{
+		// positive
+		{"persist /tmp/cache", false, "/tmp/cache", 0},
+		{"persist /tmp/cache 5m", false, "/tmp/cache", 5 * time.Minute},
+		// negative
+		{"persist", true, "", 0},
+		{"persist /tmp/cache 5m arg1", true, "", 0},
+		{"persist /tmp/cache -1m", true, "", 0},
+		{"persist /tmp/cache five", true, "", 0},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if ca.persistFile != test.file {
+			t.Errorf("Test %v: Expected persist file %q but found %q", i, test.file, ca.persistFile)
+		}
+		if ca.persistInterval != test.interval {
+			t.Errorf("Test %v: Expected persist interval %v but found %v", i, test.interval, ca.persistInterval)
+		}
+	}
+}
+
+func TestAPIParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		addr      string
+	}{
+		// positive
+		{"api localhost:8182", false, "localhost:8182"},
+		{"api :8182", false, "localhost:8182"},
+		{"api 127.0.0.1:8182", false, "127.0.0.1:8182"},
+		{"api [::1]:8182", false, "[::1]:8182"},
+		{"api 0.0.0.0:8182 s3cr3t", false, "0.0.0.0:8182"},
+		// negative
+		{"api", true, ""},
+		{"api localhost", true, ""},
+		{"api 0.0.0.0:8182", true, ""},
+		{"api example.org:8182", true, ""},
+		{"api :8182 arg1 arg2", true, ""},
+	}
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", fmt.Sprintf("cache {\n%s\n}", test.input))
+		ca, err := cacheParse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %v: Expected error but found nil", i)
+			continue
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %v: Expected no error but found error: %v", i, err)
+			continue
+		}
+		if test.shouldErr {
+			continue
+		}
+		if ca.apiAddr != test.addr {
+			t.Errorf("Test %v: Expected api address %q but found %q", i, test.addr, ca.apiAddr)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Package cookie implements the cookie plugin, it enables DNS Cookies (RFC 7873) on the server.
+package cookie
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cookie"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+)
+
+const pluginName = "cookie"
+
+var log = clog.NewWithPlugin(pluginName)
+
+func init() { plugin.Register(pluginName, setup) }
+
+func setup(c *caddy.Controller) error {
+	config, rotate, err := parse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	dnsserver.GetConfig(c).Cookie = config
+
+	if rotate > 0 {
+		stop := make(chan bool)
+		c.OnStartup(func() error {
+			go func() {
+				ticker := time.NewTicker(rotate)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-stop:
+						return
+					case <-ticker.C:
+						if err := config.Secrets.Rotate(); err != nil {
+							log.Errorf("Failed to rotate secret: %s", err)
+						}
+					}
+				}
+			}()
+			return nil
+		})
+		c.OnShutdown(func() error {
+			close(stop)
+			return nil
+		})
+	}
+	return nil
+}
+
+// parse parses the cookie configuration, it also returns how often the secret should be rotated, 0
+// when it is never rotated.
+func parse(c *caddy.Controller) (*cookie.Config, time.Duration, error) {
+	config := &cookie.Config{}
+	var secrets []cookie.Secret
+	rotate := time.Duration(0)
+	rotateSet := false
+
+	for i := 0; c.Next(); i++ {
+		if i > 0 {
+			return nil, 0, plugin.ErrOnce
+		}
+		if len(c.RemainingArgs()) > 0 {
+			return nil, 0, c.ArgErr()
+		}
+		for c.NextBlock() {
+			switch c.Val() {
+			case "secret":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, 0, c.ArgErr()
+				}
+				for _, a := range args {
+					s, err := cookie.ParseSecret(a)
+					if err != nil {
+						return nil, 0, c.Err(err.Error())
+					}
+					secrets = append(secrets, s)
+				}
+			case "rotate":
+				if !c.NextArg() {
+					return nil, 0, c.ArgErr()
+				}
+				d, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return nil, 0, c.Errf("invalid rotate duration %q: %s", c.Val(), err)
+				}
+				// A server cookie must stay valid for its lifetime, and only one older secret is kept.
+				if d < time.Hour {
+					return nil, 0, c.Errf("rotate duration %s can't be less than 1h", d)
+				}
+				rotate = d
+				rotateSet = true
+			case "require":
+				if !c.NextArg() {
+					return nil, 0, c.ArgErr()
+				}
+				n, err := strconv.Atoi(c.Val())
+				if err != nil {
+					return nil, 0, c.Errf("invalid require size %q: %s", c.Val(), err)
+				}
+				if n < 0 {
+					return nil, 0, c.Errf("require size can't be negative: %d", n)
+				}
+				config.RequireSize = n
+			default:
+				return nil, 0, c.Errf("unknown property '%s'", c.Val())
+			}
+			if len(c.RemainingArgs()) > 0 {
+				return nil, 0, c.ArgErr()
+			}
+		}
+	}
+
+	if len(secrets) > 0 {
+		if rotateSet {
+			return nil, 0, c.Err("secret and rotate can't be used together")
+		}
+		config.Secrets = cookie.NewSecrets(secrets...)
+		return config, 0, nil
+	}
+
+	if !rotateSet {
+		rotate = defaultRotate
+	}
+	config.Secrets = cookie.NewSecrets()
+	if err := config.Secrets.Rotate(); err != nil {
+		return nil, 0, err
+	}
+	return config, rotate, nil
+}
+
+const defaultRotate = 24 * time.Hour
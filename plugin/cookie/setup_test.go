@@ -0,0 +1,84 @@
+package cookie
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input           string
+		shouldErr       bool
+		expectedSecrets int
+		expectedRotate  time.Duration
+		expectedRequire int
+		expectedErr     string
+	}{
+		{`cookie`, false, 1, defaultRotate, 0, ""},
+		{`cookie {
+			rotate 6h
+			require 512
+		}`, false, 1, 6 * time.Hour, 512, ""},
+		{`cookie {
+			secret e5e973e5a6b2a43f48e7dc849e37bfcf dd3bdf9344b678b185a6f5cb60fca715
+		}`, false, 2, 0, 0, ""},
+		// fails
+		{`cookie example.org`, true, 0, 0, 0, "Wrong argument count"},
+		{`cookie {
+			secret e5e973e5
+		}`, true, 0, 0, 0, "must be 16 bytes"},
+		{`cookie {
+			secret zz
+		}`, true, 0, 0, 0, "invalid secret"},
+		{`cookie {
+			rotate 10m
+		}`, true, 0, 0, 0, "can't be less than 1h"},
+		{`cookie {
+			rotate 1h 2h
+		}`, true, 0, 0, 0, "Wrong argument count"},
+		{`cookie {
+			require -1
+		}`, true, 0, 0, 0, "can't be negative"},
+		{`cookie {
+			secret e5e973e5a6b2a43f48e7dc849e37bfcf
+			rotate 1h
+		}`, true, 0, 0, 0, "can't be used together"},
+		{`cookie {
+			blah
+		}`, true, 0, 0, 0, "unknown property"},
+		{`cookie
+		cookie`, true, 0, 0, 0, "this plugin"},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		config, rotate, err := parse(c)
+
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but found none for input %s", i, tc.input)
+				continue
+			}
+			if !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, tc.expectedErr, err, tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, tc.input, err)
+			continue
+		}
+		if x := len(config.Secrets.Get()); x != tc.expectedSecrets {
+			t.Errorf("Test %d: expected %d secrets, got %d", i, tc.expectedSecrets, x)
+		}
+		if rotate != tc.expectedRotate {
+			t.Errorf("Test %d: expected rotate %s, got %s", i, tc.expectedRotate, rotate)
+		}
+		if config.RequireSize != tc.expectedRequire {
+			t.Errorf("Test %d: expected require %d, got %d", i, tc.expectedRequire, config.RequireSize)
+		}
+	}
+}
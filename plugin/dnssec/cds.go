@@ -0,0 +1,72 @@
+package dnssec
+
+import (
+	"time"
+
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// cdsMode says which CDS and CDNSKEY records are published.
+type cdsMode int
+
+const (
+	cdsPublish cdsMode = iota // the records for the KSKs (RFC 7344)
+	cdsDelete                 // the delete form, the parent should remove the DS records (RFC 8078)
+	cdsNone                   // no records, queries for them are passed on to the next plugin
+)
+
+// getCDS returns the CDS or CDNSKEY records, depending on qtype, to the client. Signatures are
+// added when do is true.
+func (d Dnssec) getCDS(state request.Request, zone string, qtype uint16, do bool, server string) *dns.Msg {
+	hdr := dns.RR_Header{Name: zone, Rrtype: qtype, Class: dns.ClassINET, Ttl: 3600}
+	rrs := []dns.RR{}
+	switch {
+	case d.cds == cdsDelete && qtype == dns.TypeCDS:
+		rrs = append(rrs, &dns.CDS{DS: dns.DS{Hdr: hdr, Digest: "00"}})
+	case d.cds == cdsDelete:
+		rrs = append(rrs, &dns.CDNSKEY{DNSKEY: dns.DNSKEY{Hdr: hdr, Protocol: 3, PublicKey: "AA=="}})
+	default:
+		for _, k := range d.ksks() {
+			key := dns.Copy(k.K).(*dns.DNSKEY)
+			key.Hdr.Name = zone
+			if qtype == dns.TypeCDS {
+				rrs = append(rrs, key.ToDS(dns.SHA256).ToCDS())
+			} else {
+				rrs = append(rrs, key.ToCDNSKEY())
+			}
+		}
+		for _, rr := range rrs {
+			rr.Header().Ttl = 3600
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Answer = rrs
+	if !do {
+		return m
+	}
+
+	incep, expir := incepExpir(time.Now().UTC())
+	if sigs, err := d.sign(rrs, zone, 3600, incep, expir, server); err == nil {
+		m.Answer = append(m.Answer, sigs...)
+	}
+	return m
+}
+
+// ksks returns the keys the parent should have DS records for: the KSKs, or all keys if they
+// are used as CSKs.
+func (d Dnssec) ksks() []*DNSKEY {
+	if !d.splitkeys {
+		return d.keys
+	}
+	ksks := []*DNSKEY{}
+	for _, k := range d.keys {
+		if k.isKSK() {
+			ksks = append(ksks, k)
+		}
+	}
+	return ksks
+}
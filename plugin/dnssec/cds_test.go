@@ -0,0 +1,79 @@
+package dnssec
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestLookupCDS(t *testing.T) {
+	dnskey, rm1, rm2 := newKey(t)
+	defer rm1()
+	defer rm2()
+
+	tests := []struct {
+		cds    cdsMode
+		qtype  uint16
+		answer string
+	}{
+		{cdsPublish, dns.TypeCDS, "miek.nl.	3600	IN	CDS	18512 13 2 D4E806322598BC97A003EF1ACDFF352EEFF7B42DBB0D41B8224714C36AEF08D9"},
+		{cdsPublish, dns.TypeCDNSKEY, "miek.nl.	3600	IN	CDNSKEY	257 3 13 0J8u0XJ9GNGFEBXuAmLu04taHG4BXPP3gwhetiOUMnGA+x09nqzgF5IYOyjWB7N3rXqQbnOSILhH1hnuyh7mmA=="},
+		{cdsDelete, dns.TypeCDS, "miek.nl.	3600	IN	CDS	0 0 0 00"},
+		{cdsDelete, dns.TypeCDNSKEY, "miek.nl.	3600	IN	CDNSKEY	0 3 0 AA=="},
+	}
+
+	for i, tc := range tests {
+		dh := New([]string{"miek.nl."}, []*DNSKEY{dnskey}, false, test.ErrorHandler(), cache.New(defaultCap))
+		dh.cds = tc.cds
+
+		m := new(dns.Msg)
+		m.SetQuestion("miek.nl.", tc.qtype)
+		m.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := dh.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %v", i, err)
+		}
+
+		expect, _ := dns.NewRR(tc.answer)
+		var sig *dns.RRSIG
+		found := false
+		for _, rr := range rec.Msg.Answer {
+			switch x := rr.(type) {
+			case *dns.RRSIG:
+				sig = x
+			default:
+				found = found || strings.EqualFold(rr.String(), expect.String())
+			}
+		}
+		if !found {
+			t.Errorf("Test %d: expected %s, got %v", i, tc.answer, rec.Msg.Answer)
+		}
+		if sig == nil || sig.TypeCovered != tc.qtype || sig.KeyTag != dnskey.tag {
+			t.Errorf("Test %d: expected a signature over %s by key %d, got %v", i, dns.TypeToString[tc.qtype], dnskey.tag, sig)
+		}
+	}
+}
+
+func TestLookupCDSNone(t *testing.T) {
+	dnskey, rm1, rm2 := newKey(t)
+	defer rm1()
+	defer rm2()
+	dh := New([]string{"miek.nl."}, []*DNSKEY{dnskey}, false, test.NextHandler(dns.RcodeSuccess, nil), cache.New(defaultCap))
+	dh.cds = cdsNone
+
+	m := new(dns.Msg)
+	m.SetQuestion("miek.nl.", dns.TypeCDS)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := dh.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rec.Msg != nil && len(rec.Msg.Answer) != 0 {
+		t.Errorf("Expected CDS query to be passed on, got %v", rec.Msg.Answer)
+	}
+}
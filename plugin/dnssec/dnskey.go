@@ -2,17 +2,12 @@ package dnssec
 
 import (
 	"crypto"
-	"crypto/ecdsa"
-	"crypto/rsa"
-	"errors"
-	"os"
-	"path/filepath"
 	"time"
 
+	"github.com/coredns/coredns/plugin/pkg/keyprovider"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
-	"golang.org/x/crypto/ed25519"
 )
 
 // DNSKEY holds a DNSSEC public and private key used for on-the-fly signing.
@@ -26,41 +21,16 @@ type DNSKEY struct {
 // ParseKeyFile read a DNSSEC keyfile as generated by dnssec-keygen or other
 // utilities. It adds ".key" for the public key and ".private" for the private key.
 func ParseKeyFile(pubFile, privFile string) (*DNSKEY, error) {
-	f, e := os.Open(filepath.Clean(pubFile))
-	if e != nil {
-		return nil, e
-	}
-	defer f.Close()
-	k, e := dns.ReadRR(f, pubFile)
-	if e != nil {
-		return nil, e
-	}
-
-	f, e = os.Open(filepath.Clean(privFile))
-	if e != nil {
-		return nil, e
-	}
-	defer f.Close()
-
-	dk, ok := k.(*dns.DNSKEY)
-	if !ok {
-		return nil, errors.New("no public key found")
-	}
-	p, e := dk.ReadPrivateKey(f, privFile)
-	if e != nil {
-		return nil, e
+	k, err := keyprovider.ReadFile(pubFile, privFile)
+	if err != nil {
+		return nil, err
 	}
+	return newDNSKEY(k), nil
+}
 
-	if s, ok := p.(*rsa.PrivateKey); ok {
-		return &DNSKEY{K: dk, D: dk.ToDS(dns.SHA256), s: s, tag: dk.KeyTag()}, nil
-	}
-	if s, ok := p.(*ecdsa.PrivateKey); ok {
-		return &DNSKEY{K: dk, D: dk.ToDS(dns.SHA256), s: s, tag: dk.KeyTag()}, nil
-	}
-	if s, ok := p.(ed25519.PrivateKey); ok {
-		return &DNSKEY{K: dk, D: dk.ToDS(dns.SHA256), s: s, tag: dk.KeyTag()}, nil
-	}
-	return &DNSKEY{K: dk, D: dk.ToDS(dns.SHA256), s: nil, tag: 0}, errors.New("no private key found")
+// newDNSKEY returns the DNSKEY for k.
+func newDNSKEY(k keyprovider.Key) *DNSKEY {
+	return &DNSKEY{K: k.Public, D: k.Public.ToDS(dns.SHA256), s: k.Private, tag: k.Public.KeyTag()}
 }
 
 // getDNSKEY returns the correct DNSKEY to the client. Signatures are added when do is true.
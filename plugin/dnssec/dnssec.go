@@ -1,5 +1,5 @@
 // Package dnssec implements a plugin that signs responses on-the-fly using
-// NSEC black lies.
+// NSEC black lies or NSEC3 white lies.
 package dnssec
 
 import (
@@ -7,6 +7,7 @@ import (
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/pkg/response"
 	"github.com/coredns/coredns/plugin/pkg/singleflight"
 	"github.com/coredns/coredns/request"
@@ -21,6 +22,8 @@ type Dnssec struct {
 	zones     []string
 	keys      []*DNSKEY
 	splitkeys bool
+	cds       cdsMode
+	nsec3     *nsec3Params // when set NSEC3 white lies are used instead of NSEC black lies
 	inflight  *singleflight.Group
 	cache     *cache.Cache
 }
@@ -37,8 +40,8 @@ func New(zones []string, keys []*DNSKEY, splitkeys bool, next plugin.Handler, c
 }
 
 // Sign signs the message in state. it takes care of negative or nodata responses. It
-// uses NSEC black lies for authenticated denial of existence. For delegations it
-// will insert DS records and sign those.
+// uses NSEC black lies, or NSEC3 white lies, for authenticated denial of existence. For
+// delegations it will insert DS records and sign those.
 // Signatures will be cached for a short while. By default we sign for 8 days,
 // starting 3 hours ago.
 func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.Msg {
@@ -46,6 +49,9 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 
 	incep, expir := incepExpir(now)
 
+	// failed reports a record that couldn't be signed or denied with an extended DNS error.
+	failed := func(code uint16) { edns.SetExtendedError(req, code, "") }
+
 	mt, _ := response.Typify(req, time.Now().UTC()) // TODO(miek): need opt record here?
 	if mt == response.Delegation {
 		// We either sign DS or NSEC of DS.
@@ -58,11 +64,15 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 			}
 		}
 		if len(ds) == 0 {
-			if sigs, err := d.nsec(state, mt, ttl, incep, expir, server); err == nil {
+			if sigs, err := d.denial(state, mt, ttl, incep, expir, server); err == nil {
 				req.Ns = append(req.Ns, sigs...)
+			} else {
+				failed(dns.ExtendedErrorCodeNSECMissing)
 			}
 		} else if sigs, err := d.sign(ds, state.Zone, ttl, incep, expir, server); err == nil {
 			req.Ns = append(req.Ns, sigs...)
+		} else {
+			failed(dns.ExtendedErrorCodeRRSIGsMissing)
 		}
 		return req
 	}
@@ -76,9 +86,16 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 
 		if sigs, err := d.sign(req.Ns, state.Zone, ttl, incep, expir, server); err == nil {
 			req.Ns = append(req.Ns, sigs...)
+		} else {
+			failed(dns.ExtendedErrorCodeRRSIGsMissing)
 		}
-		if sigs, err := d.nsec(state, mt, ttl, incep, expir, server); err == nil {
+		if sigs, err := d.denial(state, mt, ttl, incep, expir, server); err == nil {
 			req.Ns = append(req.Ns, sigs...)
+		} else {
+			failed(dns.ExtendedErrorCodeNSECMissing)
+		}
+		if d.nsec3 != nil { // white lies don't change the meaning of the response
+			return req
 		}
 		if len(req.Ns) > 1 { // actually added nsec and sigs, reset the rcode
 			req.Rcode = dns.RcodeSuccess
@@ -94,23 +111,37 @@ func (d Dnssec) Sign(state request.Request, now time.Time, server string) *dns.M
 		ttl := r[0].Header().Ttl
 		if sigs, err := d.sign(r, state.Zone, ttl, incep, expir, server); err == nil {
 			req.Answer = append(req.Answer, sigs...)
+		} else {
+			failed(dns.ExtendedErrorCodeRRSIGsMissing)
 		}
 	}
 	for _, r := range rrSets(req.Ns) {
 		ttl := r[0].Header().Ttl
 		if sigs, err := d.sign(r, state.Zone, ttl, incep, expir, server); err == nil {
 			req.Ns = append(req.Ns, sigs...)
+		} else {
+			failed(dns.ExtendedErrorCodeRRSIGsMissing)
 		}
 	}
 	for _, r := range rrSets(req.Extra) {
 		ttl := r[0].Header().Ttl
 		if sigs, err := d.sign(r, state.Zone, ttl, incep, expir, server); err == nil {
 			req.Extra = append(req.Extra, sigs...)
+		} else {
+			failed(dns.ExtendedErrorCodeRRSIGsMissing)
 		}
 	}
 	return req
 }
 
+// denial returns the signed records that deny the existence of the name or type asked for.
+func (d Dnssec) denial(state request.Request, mt response.Type, ttl, incep, expir uint32, server string) ([]dns.RR, error) {
+	if d.nsec3 != nil {
+		return d.whiteLies(state, mt, ttl, incep, expir, server)
+	}
+	return d.nsec(state, mt, ttl, incep, expir, server)
+}
+
 func (d Dnssec) sign(rrs []dns.RR, signerName string, ttl, incep, expir uint32, server string) ([]dns.RR, error) {
 	k := hash(rrs)
 	sgs, ok := d.get(k, server)
@@ -122,13 +153,13 @@ func (d Dnssec) sign(rrs []dns.RR, signerName string, ttl, incep, expir uint32,
 		var sigs []dns.RR
 		for _, k := range d.keys {
 			if d.splitkeys {
-				if len(rrs) > 0 && rrs[0].Header().Rrtype == dns.TypeDNSKEY {
-					// We are signing a DNSKEY RRSet. With split keys, we need to use a KSK here.
+				if len(rrs) > 0 && isKeySet(rrs[0].Header().Rrtype) {
+					// We are signing a DNSKEY, CDS or CDNSKEY RRSet. With split keys, we need to use a KSK here.
 					if !k.isKSK() {
 						continue
 					}
 				} else {
-					// For non-DNSKEY RRSets, we want to use a ZSK.
+					// For other RRSets, we want to use a ZSK.
 					if !k.isZSK() {
 						continue
 					}
@@ -146,6 +177,11 @@ func (d Dnssec) sign(rrs []dns.RR, signerName string, ttl, incep, expir uint32,
 	return sigs.([]dns.RR), err
 }
 
+// isKeySet returns true for the types of RRsets that are signed with the KSK.
+func isKeySet(t uint16) bool {
+	return t == dns.TypeDNSKEY || t == dns.TypeCDS || t == dns.TypeCDNSKEY
+}
+
 func (d Dnssec) set(key uint64, sigs []dns.RR) { d.cache.Add(key, sigs) }
 
 func (d Dnssec) get(key uint64, server string) ([]dns.RR, bool) {
@@ -37,6 +37,27 @@ func (d Dnssec) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 			}
 		}
 	}
+	if (qtype == dns.TypeCDS || qtype == dns.TypeCDNSKEY) && d.cds != cdsNone {
+		for _, z := range d.zones {
+			if qname == z {
+				resp := d.getCDS(state, z, qtype, do, server)
+				resp.Authoritative = true
+				w.WriteMsg(resp)
+				return dns.RcodeSuccess, nil
+			}
+		}
+	}
+
+	if qtype == dns.TypeNSEC3PARAM && d.nsec3 != nil {
+		for _, z := range d.zones {
+			if qname == z {
+				resp := d.getNSEC3PARAM(state, z, do, server)
+				resp.Authoritative = true
+				w.WriteMsg(resp)
+				return dns.RcodeSuccess, nil
+			}
+		}
+	}
 
 	if do {
 		drr := &ResponseWriter{w, d, server}
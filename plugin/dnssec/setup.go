@@ -2,14 +2,14 @@ package dnssec
 
 import (
 	"fmt"
-	"path/filepath"
 	"strconv"
-	"strings"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/plugin/pkg/keyprovider"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 )
 
@@ -18,7 +18,7 @@ var log = clog.NewWithPlugin("dnssec")
 func init() { plugin.Register("dnssec", setup) }
 
 func setup(c *caddy.Controller) error {
-	zones, keys, capacity, splitkeys, err := dnssecParse(c)
+	zones, keys, capacity, splitkeys, cds, nsec3, err := dnssecParse(c)
 	if err != nil {
 		return plugin.Error("dnssec", err)
 	}
@@ -36,21 +36,26 @@ func setup(c *caddy.Controller) error {
 	})
 
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
-		return New(zones, keys, splitkeys, next, ca)
+		d := New(zones, keys, splitkeys, next, ca)
+		d.cds = cds
+		d.nsec3 = nsec3
+		return d
 	})
 
 	return nil
 }
 
-func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, error) {
+func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, cdsMode, *nsec3Params, error) {
 	zones := []string{}
 	keys := []*DNSKEY{}
 	capacity := defaultCap
+	cds := cdsPublish
+	var nsec3 *nsec3Params
 
 	i := 0
 	for c.Next() {
 		if i > 0 {
-			return nil, nil, 0, false, plugin.ErrOnce
+			return nil, nil, 0, false, 0, nil, plugin.ErrOnce
 		}
 		i++
 
@@ -62,21 +67,41 @@ func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, error) {
 			case "key":
 				k, e := keyParse(c)
 				if e != nil {
-					return nil, nil, 0, false, e
+					return nil, nil, 0, false, 0, nil, e
 				}
 				keys = append(keys, k...)
 			case "cache_capacity":
 				if !c.NextArg() {
-					return nil, nil, 0, false, c.ArgErr()
+					return nil, nil, 0, false, 0, nil, c.ArgErr()
 				}
 				value := c.Val()
 				cacheCap, err := strconv.Atoi(value)
 				if err != nil {
-					return nil, nil, 0, false, err
+					return nil, nil, 0, false, 0, nil, err
 				}
 				capacity = cacheCap
+			case "cds":
+				if !c.NextArg() {
+					return nil, nil, 0, false, 0, nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case "publish":
+					cds = cdsPublish
+				case "delete":
+					cds = cdsDelete
+				case "none":
+					cds = cdsNone
+				default:
+					return nil, nil, 0, false, 0, nil, c.Errf("unknown cds value '%s'", c.Val())
+				}
+			case "nsec3":
+				it, salt, err := dnsutil.ParseNSEC3(c.RemainingArgs())
+				if err != nil {
+					return nil, nil, 0, false, 0, nil, c.Err(err.Error())
+				}
+				nsec3 = &nsec3Params{iterations: it, salt: salt}
 			default:
-				return nil, nil, 0, false, c.Errf("unknown property '%s'", x)
+				return nil, nil, 0, false, 0, nil, c.Errf("unknown property '%s'", x)
 			}
 		}
 	}
@@ -102,11 +127,11 @@ func dnssecParse(c *caddy.Controller) ([]string, []*DNSKEY, int, bool, error) {
 			}
 		}
 		if !ok {
-			return zones, keys, capacity, splitkeys, fmt.Errorf("key %s (keyid: %d) can not sign any of the zones", string(kname), k.tag)
+			return zones, keys, capacity, splitkeys, cds, nsec3, fmt.Errorf("key %s (keyid: %d) can not sign any of the zones", string(kname), k.tag)
 		}
 	}
 
-	return zones, keys, capacity, splitkeys, nil
+	return zones, keys, capacity, splitkeys, cds, nsec3, nil
 }
 
 func keyParse(c *caddy.Controller) ([]*DNSKEY, error) {
@@ -116,31 +141,40 @@ func keyParse(c *caddy.Controller) ([]*DNSKEY, error) {
 	if !c.NextArg() {
 		return nil, c.ArgErr()
 	}
-	value := c.Val()
-	if value == "file" {
-		ks := c.RemainingArgs()
-		if len(ks) == 0 {
+	var (
+		provider keyprovider.Provider
+		ks       []string
+	)
+	switch c.Val() {
+	case "file":
+		provider = keyprovider.File{}
+		ks = c.RemainingArgs()
+	case "pkcs11":
+		// pkcs11 MODULE TOKEN PIN KEY...
+		args := c.RemainingArgs()
+		if len(args) < 4 {
 			return nil, c.ArgErr()
 		}
+		p, err := keyprovider.NewPKCS11(args[0], args[1], args[2])
+		if err != nil {
+			return nil, err
+		}
+		c.OnShutdown(p.Close)
+		provider, ks = p, args[3:]
+	default:
+		return keys, nil
+	}
+	if len(ks) == 0 {
+		return nil, c.ArgErr()
+	}
 
-		for _, k := range ks {
-			base := k
-			// Kmiek.nl.+013+26205.key, handle .private or without extension: Kmiek.nl.+013+26205
-			if strings.HasSuffix(k, ".key") {
-				base = k[:len(k)-4]
-			}
-			if strings.HasSuffix(k, ".private") {
-				base = k[:len(k)-8]
-			}
-			if !filepath.IsAbs(base) && config.Root != "" {
-				base = filepath.Join(config.Root, base)
-			}
-			k, err := ParseKeyFile(base+".key", base+".private")
-			if err != nil {
-				return nil, err
-			}
-			keys = append(keys, k)
+	for _, k := range ks {
+		// Kmiek.nl.+013+26205.key, handle .private or without extension: Kmiek.nl.+013+26205
+		key, err := provider.Load(keyprovider.Base(k, config.Root))
+		if err != nil {
+			return nil, err
 		}
+		keys = append(keys, newDNSKEY(key))
 	}
 	return keys, nil
 }
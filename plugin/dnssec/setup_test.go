@@ -69,6 +69,16 @@ func TestSetupDnssec(t *testing.T) {
 				key file
 			}`, true, []string{"example.org."}, nil, false, defaultCap, "argument count",
 		},
+		{
+			`dnssec example.org {
+				key pkcs11 /usr/lib/softhsm/libsofthsm2.so coredns 1234
+			}`, true, []string{"example.org."}, nil, false, defaultCap, "argument count",
+		},
+		{
+			`dnssec cluster.local {
+				key pkcs11 /nonexistent/libpkcs11.so coredns 1234 Kcluster.local
+			}`, true, []string{"cluster.local."}, nil, false, defaultCap, "",
+		},
 		{`dnssec
 		  dnssec`, true, nil, nil, false, defaultCap, ""},
 		{
@@ -81,7 +91,7 @@ func TestSetupDnssec(t *testing.T) {
 
 	for i, test := range tests {
 		c := caddy.NewTestController("dns", test.input)
-		zones, keys, capacity, splitkeys, err := dnssecParse(c)
+		zones, keys, capacity, splitkeys, _, _, err := dnssecParse(c)
 
 		if test.shouldErr && err == nil {
 			t.Errorf("Test %d: Expected error but found %s for input %s", i, err, test.input)
@@ -117,6 +127,66 @@ func TestSetupDnssec(t *testing.T) {
 	}
 }
 
+func TestSetupCDS(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  cdsMode
+	}{
+		{`dnssec`, false, cdsPublish},
+		{"dnssec {\n cds delete\n}", false, cdsDelete},
+		{"dnssec {\n cds none\n}", false, cdsNone},
+		{"dnssec {\n cds\n}", true, 0},
+		{"dnssec {\n cds remove\n}", true, 0},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		_, _, _, _, cds, _, err := dnssecParse(c)
+		if tc.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error for input %s", i, tc.input)
+		}
+		if !tc.shouldErr && err != nil {
+			t.Errorf("Test %d: expected no error for input %s, got %s", i, tc.input, err)
+		}
+		if !tc.shouldErr && cds != tc.expected {
+			t.Errorf("Test %d: expected cds mode %d, got %d", i, tc.expected, cds)
+		}
+	}
+}
+
+func TestSetupNSEC3(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  *nsec3Params
+	}{
+		{`dnssec`, false, nil},
+		{"dnssec {\n nsec3\n}", false, &nsec3Params{}},
+		{"dnssec {\n nsec3 5\n}", false, &nsec3Params{iterations: 5}},
+		{"dnssec {\n nsec3 0 aabb\n}", false, &nsec3Params{salt: "AABB"}},
+		{"dnssec {\n nsec3 0 -\n}", false, &nsec3Params{}},
+		{"dnssec {\n nsec3 1000\n}", true, nil},
+		{"dnssec {\n nsec3 1 xyz\n}", true, nil},
+		{"dnssec {\n nsec3 1 aa bb\n}", true, nil},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		_, _, _, _, _, nsec3, err := dnssecParse(c)
+		if tc.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error for input %s", i, tc.input)
+		}
+		if !tc.shouldErr && err != nil {
+			t.Errorf("Test %d: expected no error for input %s, got %s", i, tc.input, err)
+		}
+		if tc.shouldErr {
+			continue
+		}
+		if (nsec3 == nil) != (tc.expected == nil) || nsec3 != nil && *nsec3 != *tc.expected {
+			t.Errorf("Test %d: expected nsec3 %+v, got %+v", i, tc.expected, nsec3)
+		}
+	}
+}
+
 const keypub = `; This is a zone-signing key, keyid 45330, for cluster.local.
 ; Created: 20170901060531 (Fri Sep  1 08:05:31 2017)
 ; Publish: 20170901060531 (Fri Sep  1 08:05:31 2017)
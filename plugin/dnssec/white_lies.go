@@ -0,0 +1,171 @@
+package dnssec
+
+import (
+	"encoding/base32"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/response"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// nsec3Params holds the hash parameters of the NSEC3 white lies.
+type nsec3Params struct {
+	iterations uint16
+	salt       string // hex encoded, empty for no salt
+}
+
+// whiteLies returns minimally covering NSEC3 records (white lies) for denial of existence, see RFC 7129,
+// appendix B. Every record only covers the hash of the name it denies: its owner is that hash minus
+// one and its next hashed owner is that hash plus one. Unlike black lies the rcode is left alone,
+// NXDOMAIN stays NXDOMAIN.
+//
+// As the backend is unknown, the closest encloser of a non-existing name is taken to be its parent:
+//
+//   - a record matching the parent, claiming the parent exists;
+//   - a record covering qname, the next closer name;
+//   - a record covering the wildcard at the parent.
+//
+// NODATA responses get a single record matching qname, with qtype left out of its type bitmap. For
+// delegations without DS records the record matches the delegation and only has NS and RRSIG set.
+func (d Dnssec) whiteLies(state request.Request, mt response.Type, ttl, incep, expir uint32, server string) ([]dns.RR, error) {
+	var nsec3s []*dns.NSEC3
+	switch mt {
+	case response.Delegation:
+		cut := state.Req.Ns[0].Header().Name
+		nsec3s = append(nsec3s, d.nsec3Match(cut, state.Zone, ttl, []uint16{dns.TypeNS, dns.TypeRRSIG}))
+	case response.NameError:
+		ce := state.Zone
+		if state.Name() != state.Zone {
+			off, _ := dns.NextLabel(state.Name(), 0)
+			ce = state.Name()[off:]
+		}
+		nsec3s = append(nsec3s,
+			d.nsec3Match(ce, state.Zone, ttl, d.nsec3Bitmap(ce, state.Zone, 0, mt)),
+			d.nsec3Cover(state.Name(), state.Zone, ttl),
+			d.nsec3Cover("*."+ce, state.Zone, ttl),
+		)
+	default:
+		nsec3s = append(nsec3s, d.nsec3Match(state.Name(), state.Zone, ttl, d.nsec3Bitmap(state.Name(), state.Zone, state.QType(), mt)))
+	}
+
+	rrs := []dns.RR{}
+	for _, nsec3 := range nsec3s {
+		sigs, err := d.sign([]dns.RR{nsec3}, state.Zone, ttl, incep, expir, server)
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, nsec3)
+		rrs = append(rrs, sigs...)
+	}
+	return rrs, nil
+}
+
+// nsec3Match returns the NSEC3 record for name, its next hashed owner is the hash of name plus one.
+func (d Dnssec) nsec3Match(name, zone string, ttl uint32, bitmap []uint16) *dns.NSEC3 {
+	h := d.hash(name)
+	return d.newNSEC3(h, increment(h), zone, ttl, bitmap)
+}
+
+// nsec3Cover returns the NSEC3 record that covers just the hash of name.
+func (d Dnssec) nsec3Cover(name, zone string, ttl uint32) *dns.NSEC3 {
+	h := d.hash(name)
+	return d.newNSEC3(decrement(h), increment(h), zone, ttl, nil)
+}
+
+func (d Dnssec) newNSEC3(owner, next []byte, zone string, ttl uint32, bitmap []uint16) *dns.NSEC3 {
+	nsec3 := &dns.NSEC3{}
+	nsec3.Hdr = dns.RR_Header{Name: strings.ToLower(b32.EncodeToString(owner)) + "." + zone, Ttl: ttl, Class: dns.ClassINET, Rrtype: dns.TypeNSEC3}
+	nsec3.Hash = dns.SHA1
+	nsec3.Iterations = d.nsec3.iterations
+	nsec3.Salt = d.nsec3.salt
+	nsec3.SaltLength = uint8(len(d.nsec3.salt) / 2)
+	nsec3.NextDomain = b32.EncodeToString(next)
+	nsec3.HashLength = uint8(len(next))
+	nsec3.TypeBitMap = bitmap
+	return nsec3
+}
+
+// nsec3Bitmap returns the type bitmap for name. The black lies bitmaps are used, without NSEC, and
+// with NSEC3PARAM at the apex.
+func (d Dnssec) nsec3Bitmap(name, zone string, t uint16, mt response.Type) []uint16 {
+	var bitmap []uint16
+	switch {
+	case name == zone:
+		bitmap = append(filter18(t, apexBitmap, mt), dns.TypeNSEC3PARAM)
+	case t == dns.TypeDS:
+		bitmap = delegationBitmap[:]
+	default:
+		bitmap = filter14(t, zoneBitmap, mt)
+	}
+
+	types := make([]uint16, 0, len(bitmap))
+	for _, b := range bitmap {
+		if b != dns.TypeNSEC {
+			types = append(types, b)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// getNSEC3PARAM returns the NSEC3PARAM record of zone to the client. Signatures are added when do
+// is true.
+func (d Dnssec) getNSEC3PARAM(state request.Request, zone string, do bool, server string) *dns.Msg {
+	param := &dns.NSEC3PARAM{
+		Hdr:        dns.RR_Header{Name: zone, Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET, Ttl: 3600},
+		Hash:       dns.SHA1,
+		Iterations: d.nsec3.iterations,
+		SaltLength: uint8(len(d.nsec3.salt) / 2),
+		Salt:       d.nsec3.salt,
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Answer = []dns.RR{param}
+	if !do {
+		return m
+	}
+
+	incep, expir := incepExpir(time.Now().UTC())
+	if sigs, err := d.sign(m.Answer, zone, 3600, incep, expir, server); err == nil {
+		m.Answer = append(m.Answer, sigs...)
+	}
+	return m
+}
+
+// hash returns the binary NSEC3 hash of name.
+func (d Dnssec) hash(name string) []byte {
+	h, _ := b32.DecodeString(dns.HashName(name, dns.SHA1, d.nsec3.iterations, d.nsec3.salt))
+	return h
+}
+
+// increment returns h plus one, wrapping around at the end of the hash space.
+func increment(h []byte) []byte {
+	n := append([]byte(nil), h...)
+	for i := len(n) - 1; i >= 0; i-- {
+		n[i]++
+		if n[i] != 0 {
+			break
+		}
+	}
+	return n
+}
+
+// decrement returns h minus one, wrapping around at the start of the hash space.
+func decrement(h []byte) []byte {
+	n := append([]byte(nil), h...)
+	for i := len(n) - 1; i >= 0; i-- {
+		n[i]--
+		if n[i] != 0xff {
+			break
+		}
+	}
+	return n
+}
+
+// b32 is the base32 encoding with the extended hex alphabet, used for NSEC3 hashes (RFC 5155, section 3.3).
+var b32 = base32.HexEncoding.WithPadding(base32.NoPadding)
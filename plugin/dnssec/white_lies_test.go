@@ -0,0 +1,200 @@
+package dnssec
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func newWhiteLies(t *testing.T) (Dnssec, func(), func()) {
+	d, rm1, rm2 := newDnssec(t, []string{"miek.nl."})
+	d.nsec3 = &nsec3Params{iterations: 1, salt: "AABB"}
+	return d, rm1, rm2
+}
+
+func nsec3s(rrs []dns.RR) []*dns.NSEC3 {
+	x := []*dns.NSEC3{}
+	for _, rr := range rrs {
+		if n, ok := rr.(*dns.NSEC3); ok {
+			x = append(x, n)
+		}
+	}
+	return x
+}
+
+func matches(nsec3s []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, n := range nsec3s {
+		if n.Match(name) {
+			return n
+		}
+	}
+	return nil
+}
+
+func covers(nsec3s []*dns.NSEC3, name string) bool {
+	for _, n := range nsec3s {
+		if n.Cover(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWhiteLiesNameError(t *testing.T) {
+	d, rm1, rm2 := newWhiteLies(t)
+	defer rm1()
+	defer rm2()
+
+	m := testNxdomainMsg()
+	m.Question[0].Name = "a.ww.miek.nl."
+	state := request.Request{Req: m, Zone: "miek.nl."}
+	m = d.Sign(state, time.Now().UTC(), server)
+
+	if m.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeNameError, m.Rcode)
+	}
+	if !section(m.Ns, 4) {
+		t.Errorf("Authority section should have 4 sigs")
+	}
+	n := nsec3s(m.Ns)
+	if len(n) != 3 {
+		t.Fatalf("Expected 3 NSEC3 records, got %d", len(n))
+	}
+	if x := matches(n, "ww.miek.nl."); x == nil {
+		t.Errorf("Expected an NSEC3 record matching the closest encloser")
+	} else if x.Iterations != 1 || x.Salt != "AABB" {
+		t.Errorf("Expected NSEC3 hash parameters 1 AABB, got %d %s", x.Iterations, x.Salt)
+	}
+	if !covers(n, "a.ww.miek.nl.") {
+		t.Errorf("Expected an NSEC3 record covering the next closer name")
+	}
+	if !covers(n, "*.ww.miek.nl.") {
+		t.Errorf("Expected an NSEC3 record covering the wildcard")
+	}
+	// The records are minimally covering and don't deny any other names.
+	for _, name := range []string{"b.ww.miek.nl.", "*.miek.nl.", "www.miek.nl."} {
+		if covers(n, name) {
+			t.Errorf("Expected %s not to be covered", name)
+		}
+	}
+}
+
+func TestWhiteLiesNoData(t *testing.T) {
+	d, rm1, rm2 := newWhiteLies(t)
+	defer rm1()
+	defer rm2()
+
+	m := testNxdomainMsg()
+	m.Rcode = dns.RcodeSuccess
+	state := request.Request{Req: m, Zone: "miek.nl."}
+	m = d.Sign(state, time.Now().UTC(), server)
+
+	if m.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected rcode %d, got %d", dns.RcodeSuccess, m.Rcode)
+	}
+	n := nsec3s(m.Ns)
+	if len(n) != 1 {
+		t.Fatalf("Expected 1 NSEC3 record, got %d", len(n))
+	}
+	x := matches(n, "ww.miek.nl.")
+	if x == nil {
+		t.Fatalf("Expected an NSEC3 record matching ww.miek.nl.")
+	}
+	for _, b := range x.TypeBitMap {
+		if b == dns.TypeTXT || b == dns.TypeNSEC {
+			t.Errorf("Expected %s not to be in the type bitmap", dns.TypeToString[b])
+		}
+	}
+}
+
+func TestWhiteLiesApexNoData(t *testing.T) {
+	d, rm1, rm2 := newWhiteLies(t)
+	defer rm1()
+	defer rm2()
+
+	m := testNxdomainMsg()
+	m.Rcode = dns.RcodeSuccess
+	m.Question[0].Name = "miek.nl."
+	state := request.Request{Req: m, Zone: "miek.nl."}
+	m = d.Sign(state, time.Now().UTC(), server)
+
+	x := matches(nsec3s(m.Ns), "miek.nl.")
+	if x == nil {
+		t.Fatalf("Expected an NSEC3 record matching miek.nl.")
+	}
+	soa, param := false, false
+	for _, b := range x.TypeBitMap {
+		soa = soa || b == dns.TypeSOA
+		param = param || b == dns.TypeNSEC3PARAM
+	}
+	if !soa || !param {
+		t.Errorf("Expected SOA and NSEC3PARAM in the apex type bitmap, got %v", x.TypeBitMap)
+	}
+}
+
+func TestWhiteLiesDelegation(t *testing.T) {
+	d, rm1, rm2 := newWhiteLies(t)
+	defer rm1()
+	defer rm2()
+
+	m := testMsgDelegationUnSigned()
+	m.SetQuestion("www.sub.miek.nl.", dns.TypeA)
+	state := request.Request{Req: m, Zone: "miek.nl."}
+	m = d.Sign(state, time.Now().UTC(), server)
+
+	x := matches(nsec3s(m.Ns), "sub.miek.nl.")
+	if x == nil {
+		t.Fatalf("Expected an NSEC3 record matching sub.miek.nl.")
+	}
+	for _, b := range x.TypeBitMap {
+		if b == dns.TypeDS || b == dns.TypeSOA {
+			t.Errorf("Expected %s not to be in the type bitmap", dns.TypeToString[b])
+		}
+	}
+}
+
+func TestLookupNSEC3PARAM(t *testing.T) {
+	d, rm1, rm2 := newWhiteLies(t)
+	defer rm1()
+	defer rm2()
+
+	m := new(dns.Msg)
+	m.SetQuestion("miek.nl.", dns.TypeNSEC3PARAM)
+	state := request.Request{Req: m, Zone: "miek.nl."}
+	resp := d.getNSEC3PARAM(state, "miek.nl.", true, server)
+
+	if len(resp.Answer) != 2 {
+		t.Fatalf("Expected NSEC3PARAM and RRSIG in the answer section, got %d records", len(resp.Answer))
+	}
+	param, ok := resp.Answer[0].(*dns.NSEC3PARAM)
+	if !ok {
+		t.Fatalf("Expected NSEC3PARAM, got %s", resp.Answer[0])
+	}
+	if param.Iterations != 1 || param.Salt != "AABB" {
+		t.Errorf("Expected NSEC3PARAM 1 0 1 AABB, got %s", param)
+	}
+}
+
+func TestIncrementDecrement(t *testing.T) {
+	tests := []struct {
+		h, inc, dec []byte
+	}{
+		{[]byte{0x00, 0x01}, []byte{0x00, 0x02}, []byte{0x00, 0x00}},
+		{[]byte{0x00, 0xff}, []byte{0x01, 0x00}, []byte{0x00, 0xfe}},
+		{[]byte{0x01, 0x00}, []byte{0x01, 0x01}, []byte{0x00, 0xff}},
+		{[]byte{0xff, 0xff}, []byte{0x00, 0x00}, []byte{0xff, 0xfe}},
+		{[]byte{0x00, 0x00}, []byte{0x00, 0x01}, []byte{0xff, 0xff}},
+	}
+	for i, tc := range tests {
+		if x := increment(tc.h); !bytes.Equal(x, tc.inc) {
+			t.Errorf("Test %d: expected increment %x, got %x", i, tc.inc, x)
+		}
+		if x := decrement(tc.h); !bytes.Equal(x, tc.dec) {
+			t.Errorf("Test %d: expected decrement %x, got %x", i, tc.dec, x)
+		}
+	}
+}
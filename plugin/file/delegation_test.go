@@ -166,6 +166,7 @@ func TestLookupDelegation(t *testing.T) {
 }
 
 func TestLookupSecureDelegation(t *testing.T) {
+	signedAt(t, "20161101000000")
 	testDelegation(t, exampleOrgSigned, "example.org.", secureDelegationTestCases)
 }
 
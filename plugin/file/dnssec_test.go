@@ -4,8 +4,10 @@ import (
 	"context"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/test"
 
 	"github.com/miekg/dns"
@@ -116,7 +118,19 @@ var auth = []dns.RR{
 	test.RRSIG("miek.nl.	1800	IN	RRSIG	NS 8 2 1800 20160426031301 20160327031301 12051 miek.nl. ZLtsQhwazbqSpztFoR1Vxs="),
 }
 
+// signedAt sets the time the file plugin checks signatures against to at, in the RRSIG time format,
+// so the long expired signatures of a test zone are seen as valid.
+func signedAt(t *testing.T, at string) {
+	ts, err := dns.StringToTime(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeNow = func() time.Time { return time.Unix(int64(ts), 0) }
+	t.Cleanup(func() { timeNow = time.Now })
+}
+
 func TestLookupDNSSEC(t *testing.T) {
+	signedAt(t, "20160401000000")
 	zone, err := Parse(strings.NewReader(dbMiekNLSigned), testzone, "stdin", 0)
 	if err != nil {
 		t.Fatalf("Expected no error when reading zone, got %q", err)
@@ -142,6 +156,47 @@ func TestLookupDNSSEC(t *testing.T) {
 	}
 }
 
+func TestLookupSignatureExpired(t *testing.T) {
+	zone, err := Parse(strings.NewReader(dbMiekNLSigned), testzone, "stdin", 0)
+	if err != nil {
+		t.Fatalf("Expected no error when reading zone, got %q", err)
+	}
+	fm := File{Next: test.ErrorHandler(), Zones: Zones{Z: map[string]*Zone{testzone: zone}, Names: []string{testzone}}}
+
+	tests := []struct {
+		at   string
+		do   bool
+		code uint16
+	}{
+		{"20160401000000", true, 0},
+		{"20160501000000", true, dns.ExtendedErrorCodeSignatureExpired},
+		{"20160301000000", true, dns.ExtendedErrorCodeSignatureNotYetValid},
+		{"20160501000000", false, 0},
+	}
+	for i, tc := range tests {
+		signedAt(t, tc.at)
+		m := new(dns.Msg)
+		m.SetQuestion("www.miek.nl.", dns.TypeA)
+		if tc.do {
+			m.SetEdns0(4096, true)
+		}
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := fm.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %v", i, err)
+		}
+		codes := []uint16{}
+		for _, e := range edns.ExtendedErrors(rec.Msg) {
+			codes = append(codes, e.InfoCode)
+		}
+		if tc.code == 0 && len(codes) > 0 {
+			t.Errorf("Test %d: expected no extended errors, got %v", i, codes)
+		}
+		if tc.code != 0 && !edns.HasExtendedError(rec.Msg, tc.code) {
+			t.Errorf("Test %d: expected extended error %d, got %v", i, tc.code, codes)
+		}
+	}
+}
+
 func BenchmarkFileLookupDNSSEC(b *testing.B) {
 	zone, err := Parse(strings.NewReader(dbMiekNLSigned), testzone, "stdin", 0)
 	if err != nil {
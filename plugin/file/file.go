@@ -5,8 +5,11 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/transfer"
 	"github.com/coredns/coredns/request"
@@ -52,6 +55,10 @@ func (f File) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (i
 		return dns.RcodeRefused, nil
 	}
 
+	if r.Opcode == dns.OpcodeUpdate {
+		return f.serveUpdate(ctx, w, r, z)
+	}
+
 	// This is only for when we are a secondary zones.
 	if r.Opcode == dns.OpcodeNotify {
 		if z.isNotify(state) {
@@ -109,6 +116,12 @@ func (f File) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (i
 		m.Rcode = dns.RcodeServerFailure
 	}
 
+	if state.Do() && result != Delegation {
+		if code := signatureError(m.Answer, timeNow()); code != 0 {
+			edns.SetExtendedError(m, code, "")
+		}
+	}
+
 	w.WriteMsg(m)
 	return dns.RcodeSuccess, nil
 }
@@ -116,6 +129,37 @@ func (f File) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (i
 // Name implements the Handler interface.
 func (f File) Name() string { return "file" }
 
+// timeNow returns the current time, the signatures of answers are checked against it.
+var timeNow = time.Now
+
+// signatureError returns the extended DNS error code for an RRset in rrs of which none of the
+// signatures is valid at now, because they expired or because they aren't valid yet. This happens
+// when a signed zone isn't re-signed in time. It returns 0 if there is no such RRset.
+func signatureError(rrs []dns.RR, now time.Time) uint16 {
+	type rrset struct {
+		name  string
+		rtype uint16
+	}
+	valid := map[rrset]bool{}
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok && sig.ValidityPeriod(now) {
+			valid[rrset{strings.ToLower(sig.Hdr.Name), sig.TypeCovered}] = true
+		}
+	}
+	for _, rr := range rrs {
+		sig, ok := rr.(*dns.RRSIG)
+		if !ok || valid[rrset{strings.ToLower(sig.Hdr.Name), sig.TypeCovered}] {
+			continue
+		}
+		// Serial number arithmetic (RFC 1982), like RRSIG.ValidityPeriod does.
+		if int32(sig.Inception-uint32(now.Unix())) > 0 {
+			return dns.ExtendedErrorCodeSignatureNotYetValid
+		}
+		return dns.ExtendedErrorCodeSignatureExpired
+	}
+	return 0
+}
+
 type serialErr struct {
 	err    string
 	zone   string
@@ -32,6 +32,7 @@ var atoomTestCases = []test.Case{
 }
 
 func TestLookupGlue(t *testing.T) {
+	signedAt(t, "20170101000000")
 	zone, err := Parse(strings.NewReader(dbAtoomNetSigned), atoom, "stdin", 0)
 	if err != nil {
 		t.Fatalf("Expected no error when reading zone, got %q", err)
@@ -0,0 +1,185 @@
+package file
+
+import (
+	"strings"
+
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultJournalSize is the default number of diffs kept to answer incremental zone transfers.
+const DefaultJournalSize = 10
+
+// Diff holds the differences between two versions of a zone, as sent in an incremental
+// zone transfer, see RFC 1995.
+type Diff struct {
+	From    *dns.SOA // SOA of the old version of the zone
+	To      *dns.SOA // SOA of the new version of the zone
+	Deleted []dns.RR
+	Added   []dns.RR
+}
+
+// addDiff adds d to the journal of z, the oldest diff is discarded if the journal is full.
+// The caller must hold the write lock of z.
+func (z *Zone) addDiff(d *Diff) {
+	if z.JournalSize <= 0 {
+		return
+	}
+	// A diff that doesn't continue from the last one breaks the chain, everything before it is useless.
+	if n := len(z.journal); n > 0 && z.journal[n-1].To.Serial != d.From.Serial {
+		z.journal = nil
+	}
+	z.journal = append(z.journal, d)
+	if len(z.journal) > z.JournalSize {
+		z.journal = z.journal[len(z.journal)-z.JournalSize:]
+	}
+}
+
+// incremental returns the diffs needed to bring a zone with serial up to date, or nil if the
+// journal of z doesn't go back that far.
+func (z *Zone) incremental(serial uint32) []*Diff {
+	z.RLock()
+	defer z.RUnlock()
+
+	if z.Apex.SOA == nil {
+		return nil
+	}
+	for i, d := range z.journal {
+		if d.From.Serial == serial && z.journal[len(z.journal)-1].To.Serial == z.Apex.SOA.Serial {
+			return z.journal[i:]
+		}
+	}
+	return nil
+}
+
+// records returns all records in apex and t, except the SOA record.
+func records(ap Apex, t *tree.Tree) []dns.RR {
+	rrs := make([]dns.RR, 0, len(ap.SIGSOA)+len(ap.NS)+len(ap.SIGNS)+t.Len())
+	rrs = append(rrs, ap.SIGSOA...)
+	rrs = append(rrs, ap.NS...)
+	rrs = append(rrs, ap.SIGNS...)
+	rrs = append(rrs, ap.NSEC3s()...)
+	t.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error {
+		rrs = append(rrs, e.All()...)
+		return nil
+	})
+	return rrs
+}
+
+// diff returns the diff between the old zone and the new zone.
+func diff(oldApex Apex, oldTree *tree.Tree, newApex Apex, newTree *tree.Tree) *Diff {
+	d := &Diff{From: oldApex.SOA, To: newApex.SOA}
+
+	old := make(map[string]dns.RR)
+	for _, rr := range records(oldApex, oldTree) {
+		old[key(rr)] = rr
+	}
+	for _, rr := range records(newApex, newTree) {
+		k := key(rr)
+		o, ok := old[k]
+		if ok && o.Header().Ttl == rr.Header().Ttl {
+			delete(old, k)
+			continue
+		}
+		if ok {
+			d.Deleted = append(d.Deleted, o)
+			delete(old, k)
+		}
+		d.Added = append(d.Added, rr)
+	}
+	for _, rr := range old {
+		d.Deleted = append(d.Deleted, rr)
+	}
+	return d
+}
+
+// apply returns the records in rrs with the diffs applied. Deleted records are matched regardless
+// of their TTL.
+func apply(rrs []dns.RR, diffs []*Diff) []dns.RR {
+	set := make(map[string]dns.RR, len(rrs))
+	for _, rr := range rrs {
+		set[key(rr)] = rr
+	}
+	for _, d := range diffs {
+		for _, rr := range d.Deleted {
+			delete(set, key(rr))
+		}
+		for _, rr := range d.Added {
+			set[key(rr)] = rr
+		}
+	}
+
+	ret := make([]dns.RR, 0, len(set))
+	for _, rr := range set {
+		ret = append(ret, rr)
+	}
+	return ret
+}
+
+// key returns a key that identifies rr in a zone, the TTL is not part of the key.
+func key(rr dns.RR) string {
+	rr = dns.Copy(rr)
+	normalize(rr)
+	rr.Header().Ttl = 0
+	return rr.String()
+}
+
+// parseIncremental parses the records of an incremental zone transfer into diffs. The first and
+// last record are the SOA of the new version of the zone. It returns false if rrs is not an
+// incremental zone transfer.
+func parseIncremental(rrs []dns.RR) ([]*Diff, bool) {
+	if len(rrs) < 4 {
+		return nil, false
+	}
+	if _, ok := rrs[1].(*dns.SOA); !ok {
+		return nil, false
+	}
+
+	var diffs []*Diff
+	i := 1
+	for i < len(rrs)-1 {
+		d := &Diff{From: rrs[i].(*dns.SOA)}
+		for i++; i < len(rrs)-1; i++ {
+			if soa, ok := rrs[i].(*dns.SOA); ok {
+				d.To = soa
+				break
+			}
+			d.Deleted = append(d.Deleted, rrs[i])
+		}
+		if d.To == nil {
+			return nil, false
+		}
+		for i++; i < len(rrs)-1; i++ {
+			if _, ok := rrs[i].(*dns.SOA); ok {
+				break
+			}
+			d.Added = append(d.Added, rrs[i])
+		}
+		diffs = append(diffs, d)
+	}
+	if _, ok := rrs[len(rrs)-1].(*dns.SOA); !ok {
+		return nil, false
+	}
+	return diffs, true
+}
+
+// normalize lowercases the owner name and the domain names in the rdata of rr, as done when
+// inserting rr in a zone.
+func normalize(rr dns.RR) {
+	rr.Header().Name = strings.ToLower(rr.Header().Name)
+
+	switch x := rr.(type) {
+	case *dns.NS:
+		x.Ns = strings.ToLower(x.Ns)
+	case *dns.SOA:
+		x.Ns = strings.ToLower(x.Ns)
+		x.Mbox = strings.ToLower(x.Mbox)
+	case *dns.CNAME:
+		x.Target = strings.ToLower(x.Target)
+	case *dns.MX:
+		x.Mx = strings.ToLower(x.Mx)
+	case *dns.SRV:
+		x.Target = strings.ToLower(x.Target)
+	}
+}
@@ -0,0 +1,162 @@
+package file
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const journalZone1 = `example.org.		3600	IN	SOA	ns.example.org. admin.example.org. 1 3600 600 86400 300
+example.org.		3600	IN	NS	ns.example.org.
+ns.example.org.		3600	IN	A	127.0.0.1
+a.example.org.		3600	IN	A	127.0.0.1
+b.example.org.		3600	IN	A	127.0.0.2
+`
+
+const journalZone2 = `example.org.		3600	IN	SOA	ns.example.org. admin.example.org. 2 3600 600 86400 300
+example.org.		3600	IN	NS	ns.example.org.
+ns.example.org.		3600	IN	A	127.0.0.1
+a.example.org.		300	IN	A	127.0.0.1
+c.example.org.		3600	IN	A	127.0.0.3
+`
+
+func TestDiff(t *testing.T) {
+	z1, err := Parse(strings.NewReader(journalZone1), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z2, err := Parse(strings.NewReader(journalZone2), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := diff(z1.Apex, z1.Tree, z2.Apex, z2.Tree)
+	if d.From.Serial != 1 || d.To.Serial != 2 {
+		t.Errorf("Expected diff from serial 1 to 2, got %d to %d", d.From.Serial, d.To.Serial)
+	}
+	// The TTL change of a.example.org is a deletion and an addition.
+	if err := test.Section(test.Case{Answer: []dns.RR{
+		test.A("a.example.org.	3600	IN	A	127.0.0.1"),
+		test.A("b.example.org.	3600	IN	A	127.0.0.2"),
+	}}, test.Answer, sorted(d.Deleted)); err != nil {
+		t.Errorf("Unexpected deleted records: %s", err)
+	}
+	if err := test.Section(test.Case{Answer: []dns.RR{
+		test.A("a.example.org.	300	IN	A	127.0.0.1"),
+		test.A("c.example.org.	3600	IN	A	127.0.0.3"),
+	}}, test.Answer, sorted(d.Added)); err != nil {
+		t.Errorf("Unexpected added records: %s", err)
+	}
+
+	// Applying the diff to the old zone results in the new zone.
+	got := sorted(apply(records(z1.Apex, z1.Tree), []*Diff{d}))
+	if err := test.Section(test.Case{Answer: sorted(records(z2.Apex, z2.Tree))}, test.Answer, got); err != nil {
+		t.Errorf("Unexpected records after applying diff: %s", err)
+	}
+}
+
+func TestTransferIncremental(t *testing.T) {
+	z1, err := Parse(strings.NewReader(journalZone1), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z2, err := Parse(strings.NewReader(journalZone2), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := z1
+	z.JournalSize = DefaultJournalSize
+	z.addDiff(diff(z1.Apex, z1.Tree, z2.Apex, z2.Tree))
+	z.Apex, z.Tree = z2.Apex, z2.Tree
+
+	rrs := transferred(t, z, 1)
+	diffs, ok := parseIncremental(rrs)
+	if !ok {
+		t.Fatalf("Expected an incremental transfer, got %v", rrs)
+	}
+	if len(diffs) != 1 || len(diffs[0].Deleted) != 2 || len(diffs[0].Added) != 2 {
+		t.Errorf("Expected a single diff with 2 deletions and 2 additions, got %v", diffs)
+	}
+
+	// Up to date, only the SOA is sent.
+	if rrs := transferred(t, z, 2); len(rrs) != 1 {
+		t.Errorf("Expected only the SOA, got %v", rrs)
+	}
+
+	// A serial that's not in the journal gets the full zone.
+	rrs = transferred(t, z, 0)
+	if _, ok := parseIncremental(rrs); ok {
+		t.Errorf("Expected a full transfer, got %v", rrs)
+	}
+	if len(rrs) != 6 {
+		t.Errorf("Expected 6 records, got %d", len(rrs))
+	}
+}
+
+func TestAddDiff(t *testing.T) {
+	z := NewZone("example.org.", "stdin")
+	z.JournalSize = 2
+	for i := uint32(1); i < 5; i++ {
+		z.addDiff(&Diff{From: &dns.SOA{Serial: i}, To: &dns.SOA{Serial: i + 1}})
+	}
+	if len(z.journal) != 2 || z.journal[0].From.Serial != 3 {
+		t.Errorf("Expected the journal to hold the last 2 diffs, got %d starting at %d", len(z.journal), z.journal[0].From.Serial)
+	}
+
+	// A gap in the serials discards the journal.
+	z.addDiff(&Diff{From: &dns.SOA{Serial: 10}, To: &dns.SOA{Serial: 11}})
+	if len(z.journal) != 1 {
+		t.Errorf("Expected the journal to hold 1 diff, got %d", len(z.journal))
+	}
+}
+
+func TestParseIncremental(t *testing.T) {
+	soa := func(serial string) dns.RR {
+		return test.SOA("example.org. 3600 IN SOA ns.example.org. admin.example.org. " + serial + " 3600 600 86400 300")
+	}
+	tests := []struct {
+		rrs   []dns.RR
+		ok    bool
+		diffs int
+	}{
+		{[]dns.RR{soa("3"), soa("1"), test.A("a.example.org. IN A 127.0.0.1"), soa("2"), soa("2"), soa("3"), test.A("b.example.org. IN A 127.0.0.1"), soa("3")}, true, 2},
+		{[]dns.RR{soa("2"), soa("1"), soa("2"), soa("2")}, true, 1},
+		// AXFR
+		{[]dns.RR{soa("2"), test.A("a.example.org. IN A 127.0.0.1"), test.A("b.example.org. IN A 127.0.0.1"), soa("2")}, false, 0},
+		// Missing the new SOA of a diff.
+		{[]dns.RR{soa("2"), soa("1"), test.A("a.example.org. IN A 127.0.0.1"), soa("2")}, false, 0},
+	}
+	for i, tc := range tests {
+		diffs, ok := parseIncremental(tc.rrs)
+		if ok != tc.ok {
+			t.Errorf("Test %d: expected %t, got %t", i, tc.ok, ok)
+		}
+		if len(diffs) != tc.diffs {
+			t.Errorf("Test %d: expected %d diffs, got %d", i, tc.diffs, len(diffs))
+		}
+	}
+}
+
+// transferred returns all records z sends in a transfer for serial.
+func transferred(t *testing.T, z *Zone, serial uint32) []dns.RR {
+	t.Helper()
+	ch, err := z.Transfer(serial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rrs []dns.RR
+	for x := range ch {
+		rrs = append(rrs, x...)
+	}
+	return rrs
+}
+
+func sorted(rrs []dns.RR) []dns.RR {
+	sort.Sort(test.RRSet(rrs))
+	return rrs
+}
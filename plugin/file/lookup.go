@@ -162,6 +162,9 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 			glue := tr.Glue(nsrrs, do)
 			if do {
 				dss := typeFromElem(elem, dns.TypeDS, do)
+				if len(dss) == 0 {
+					dss = ap.nsec3NoData(elem.Name())
+				}
 				nsrrs = append(nsrrs, dss...)
 			}
 
@@ -191,6 +194,7 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 			if do {
 				nsec := typeFromElem(elem, dns.TypeNSEC, do)
 				ret = append(ret, nsec...)
+				ret = append(ret, ap.nsec3NoData(qname)...)
 			}
 			return nil, ret, nil, NoData
 		}
@@ -230,6 +234,9 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 			if do {
 				nsec := typeFromElem(wildElem, dns.TypeNSEC, do)
 				ret = append(ret, nsec...)
+				if _, nsec3 := ap.nsec3Encloser(qname); nsec3 != nil {
+					ret = append(ret, appendNSEC3(nsec3, ap.nsec3Match(wildElem.Name()))...)
+				}
 			}
 			return nil, ret, nil, NoData
 		}
@@ -241,6 +248,7 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 				nsec := typeFromElem(deny, dns.TypeNSEC, do)
 				auth = append(auth, nsec...)
 			}
+			auth = append(auth, ap.nsec3Wildcard(qname, wildElem.Name())...)
 
 			sigs := wildElem.TypeForWildcard(dns.TypeRRSIG, qname)
 			sigs = rrutil.SubTypeSignature(sigs, qtype)
@@ -261,6 +269,15 @@ func (z *Zone) Lookup(ctx context.Context, state request.Request, qname string)
 
 	ret := ap.soa(do)
 	if do {
+		if ap.NSEC3 != nil {
+			if rcode == NameError {
+				ret = append(ret, ap.nsec3NameError(qname)...)
+			} else {
+				ret = append(ret, ap.nsec3NoData(qname)...)
+			}
+			goto Out
+		}
+
 		deny, found := tr.Prev(qname)
 		if !found {
 			goto Out
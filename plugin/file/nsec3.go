@@ -0,0 +1,140 @@
+package file
+
+import (
+	"strings"
+
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/miekg/dns"
+)
+
+// insertNSEC3 inserts an NSEC3 record, or its signature, in the NSEC3 tree of the apex.
+func (z *Zone) insertNSEC3(r dns.RR) {
+	if z.Apex.NSEC3 == nil {
+		z.Apex.NSEC3 = &tree.Tree{}
+	}
+	z.Apex.NSEC3.Insert(r)
+}
+
+// NSEC3s returns all NSEC3 records and their signatures.
+func (a Apex) NSEC3s() []dns.RR {
+	if a.NSEC3 == nil {
+		return nil
+	}
+	rrs := []dns.RR{}
+	a.NSEC3.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error {
+		rrs = append(rrs, e.All()...)
+		return nil
+	})
+	return rrs
+}
+
+// hash returns the owner name of the NSEC3 record for name. The hash parameters are taken from an
+// NSEC3 record in the zone, they are the same for all of them.
+func (a Apex) hash(name string) string {
+	rrs := a.NSEC3.Min().Type(dns.TypeNSEC3)
+	if len(rrs) == 0 {
+		return ""
+	}
+	nsec3 := rrs[0].(*dns.NSEC3)
+	h := dns.HashName(name, nsec3.Hash, nsec3.Iterations, nsec3.Salt)
+	return strings.ToLower(h) + "." + a.SOA.Header().Name
+}
+
+// nsec3Match returns the NSEC3 record, and its signatures, that matches name, or nil.
+func (a Apex) nsec3Match(name string) []dns.RR {
+	if a.NSEC3 == nil {
+		return nil
+	}
+	if e, found := a.NSEC3.Search(a.hash(name)); found {
+		return typeFromElem(e, dns.TypeNSEC3, true)
+	}
+	return nil
+}
+
+// nsec3Cover returns the NSEC3 record, and its signatures, that covers name. The last NSEC3 record
+// covers the hashes before the first one.
+func (a Apex) nsec3Cover(name string) []dns.RR {
+	if a.NSEC3 == nil {
+		return nil
+	}
+	e, found := a.NSEC3.Prev(a.hash(name))
+	if !found {
+		e = a.NSEC3.Max()
+	}
+	return typeFromElem(e, dns.TypeNSEC3, true)
+}
+
+// nsec3Encloser returns the closest encloser proof for qname (RFC 5155, section 7.2.1): the NSEC3
+// record matching the closest encloser and the one covering the next closer name. The closest
+// encloser is returned too.
+func (a Apex) nsec3Encloser(qname string) (string, []dns.RR) {
+	if a.NSEC3 == nil {
+		return "", nil
+	}
+	origin := a.SOA.Header().Name
+	next := qname
+	for off, end := dns.NextLabel(qname, 0); !end; off, end = dns.NextLabel(qname, off) {
+		ce := qname[off:]
+		if rrs := a.nsec3Match(ce); rrs != nil || ce == origin {
+			return ce, appendNSEC3(rrs, a.nsec3Cover(next))
+		}
+		next = ce
+	}
+	return "", nil
+}
+
+// nsec3NoData returns the NSEC3 records that prove name has no data of the type asked for. For
+// names that don't have an NSEC3 record, a delegation in an opt-out span, the closest provable
+// encloser proof is returned.
+func (a Apex) nsec3NoData(name string) []dns.RR {
+	if rrs := a.nsec3Match(name); rrs != nil {
+		return rrs
+	}
+	_, rrs := a.nsec3Encloser(name)
+	return rrs
+}
+
+// nsec3NameError returns the NSEC3 records that prove qname doesn't exist: the closest encloser
+// proof and the NSEC3 record covering the wildcard at the closest encloser.
+func (a Apex) nsec3NameError(qname string) []dns.RR {
+	ce, rrs := a.nsec3Encloser(qname)
+	if rrs == nil {
+		return nil
+	}
+	return appendNSEC3(rrs, a.nsec3Cover("*."+ce))
+}
+
+// nsec3Wildcard returns the NSEC3 record that covers the next closer name of qname, when it's
+// answered from the wildcard.
+func (a Apex) nsec3Wildcard(qname, wildcard string) []dns.RR {
+	if a.NSEC3 == nil {
+		return nil
+	}
+	ce := wildcard[2:] // strip "*."
+	next := qname
+	for off, end := dns.NextLabel(qname, 0); !end; off, end = dns.NextLabel(qname, off) {
+		if qname[off:] == ce {
+			break
+		}
+		next = qname[off:]
+	}
+	return a.nsec3Cover(next)
+}
+
+// appendNSEC3 appends the records in add to rrs, if they are not already in there.
+func appendNSEC3(rrs []dns.RR, add []dns.RR) []dns.RR {
+	for _, rr := range add {
+		dup := false
+		for _, r := range rrs {
+			if dns.IsDuplicate(r, rr) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
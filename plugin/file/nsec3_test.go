@@ -1,24 +1,156 @@
 package file
 
 import (
+	"context"
+	"sort"
 	"strings"
 	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
 )
 
 func TestParseNSEC3PARAM(t *testing.T) {
-	_, err := Parse(strings.NewReader(nsec3paramTest), "miek.nl", "stdin", 0)
-	if err == nil {
-		t.Fatalf("Expected error when reading zone, got nothing")
+	z, err := Parse(strings.NewReader(nsec3paramTest), "miek.nl", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Expected no error when reading zone, got %q", err)
+	}
+	apex, _ := z.Search("miek.nl.")
+	if x := apex.Type(dns.TypeNSEC3PARAM); len(x) != 1 {
+		t.Errorf("Expected 1 NSEC3PARAM record, got %d", len(x))
 	}
 }
 
 func TestParseNSEC3(t *testing.T) {
-	_, err := Parse(strings.NewReader(nsec3Test), "miek.nl", "stdin", 0)
-	if err == nil {
-		t.Fatalf("Expected error when reading zone, got nothing")
+	z, err := Parse(strings.NewReader(nsec3Test), "example.org", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Expected no error when reading zone, got %q", err)
+	}
+	// NSEC3 records are kept out of the tree.
+	if _, found := z.Search("aub8v9ce95ie18spjubsr058h41n7pa5.example.org."); found {
+		t.Errorf("Expected NSEC3 owner name not to be in the tree")
+	}
+	if x := len(z.Apex.NSEC3s()); x != 2 {
+		t.Errorf("Expected 2 NSEC3 records, got %d", x)
+	}
+}
+
+// nsec3Zone returns dbNSEC3 with an NSEC3 chain added. The records aren't signed, the lookups only
+// need to return the right ones.
+func nsec3Zone(t *testing.T) *Zone {
+	z, err := Parse(strings.NewReader(dbNSEC3), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatalf("Expected no error when reading zone, got %q", err)
+	}
+
+	names := []string{"example.org.", "a.example.org.", "c.example.org.", "b.c.example.org.", "w.example.org.", "*.w.example.org."}
+	hashes := make([]string, len(names))
+	for i := range names {
+		hashes[i] = dns.HashName(names[i], dns.SHA1, 0, "")
+	}
+	sort.Strings(hashes)
+	for i := range hashes {
+		nsec3 := test.NSEC3(strings.ToLower(hashes[i]) + ".example.org. 3600 IN NSEC3 1 0 0 - " + hashes[(i+1)%len(hashes)] + " A")
+		z.Insert(nsec3)
 	}
+	return z
 }
 
+func TestLookupNSEC3(t *testing.T) {
+	fm := File{Next: test.ErrorHandler(), Zones: Zones{Z: map[string]*Zone{"example.org.": nsec3Zone(t)}, Names: []string{"example.org."}}}
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		rcode int
+		match []string // names that must have a matching NSEC3 record in the authority section
+		cover []string // names that must have a covering NSEC3 record in the authority section
+	}{
+		{
+			qname: "nx.example.org.", qtype: dns.TypeA, rcode: dns.RcodeNameError,
+			match: []string{"example.org."}, cover: []string{"nx.example.org.", "*.example.org."},
+		},
+		{
+			qname: "x.nx.example.org.", qtype: dns.TypeA, rcode: dns.RcodeNameError,
+			match: []string{"example.org."}, cover: []string{"nx.example.org.", "*.example.org."},
+		},
+		{
+			qname: "a.example.org.", qtype: dns.TypeMX,
+			match: []string{"a.example.org."},
+		},
+		{
+			// Empty non-terminal.
+			qname: "c.example.org.", qtype: dns.TypeA,
+			match: []string{"c.example.org."},
+		},
+		{
+			qname: "x.w.example.org.", qtype: dns.TypeTXT,
+			cover: []string{"x.w.example.org."},
+		},
+		{
+			// Wildcard without the type.
+			qname: "x.w.example.org.", qtype: dns.TypeMX,
+			match: []string{"w.example.org.", "*.w.example.org."}, cover: []string{"x.w.example.org."},
+		},
+		{
+			// Unsigned delegation.
+			qname: "www.sub.example.org.", qtype: dns.TypeA,
+			cover: []string{"sub.example.org."}, match: []string{"example.org."},
+		},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		m.SetEdns0(4096, true)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := fm.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rec.Msg.Rcode])
+		}
+
+		nsec3s := []*dns.NSEC3{}
+		for _, rr := range rec.Msg.Ns {
+			if x, ok := rr.(*dns.NSEC3); ok {
+				nsec3s = append(nsec3s, x)
+			}
+		}
+		for _, name := range tc.match {
+			if !proves(nsec3s, name, (*dns.NSEC3).Match) {
+				t.Errorf("Test %d: expected an NSEC3 record matching %s", i, name)
+			}
+		}
+		for _, name := range tc.cover {
+			if !proves(nsec3s, name, (*dns.NSEC3).Cover) {
+				t.Errorf("Test %d: expected an NSEC3 record covering %s", i, name)
+			}
+		}
+	}
+}
+
+func proves(nsec3s []*dns.NSEC3, name string, fn func(*dns.NSEC3, string) bool) bool {
+	for _, x := range nsec3s {
+		if fn(x, name) {
+			return true
+		}
+	}
+	return false
+}
+
+const dbNSEC3 = `$ORIGIN example.org.
+@       3600 IN SOA sns.dns.icann.org. noc.dns.icann.org. 2016082508 7200 3600 1209600 3600
+        3600 IN NS  a.iana-servers.net.
+        3600 IN NSEC3PARAM 1 0 0 -
+a       3600 IN A   127.0.0.1
+b.c     3600 IN A   127.0.0.1
+*.w     3600 IN TXT "wildcard"
+sub     3600 IN NS  ns.example.net.
+`
+
 const nsec3paramTest = `miek.nl.	1800	IN	SOA	linode.atoom.net. miek.miek.nl. 1460175181 14400 3600 604800 14400
 miek.nl.		1800	IN	NS	omval.tednet.nl.
 miek.nl.		0	IN	NSEC3PARAM 1 0 5 A3DEBC9CC4F695C7`
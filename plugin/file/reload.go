@@ -36,10 +36,21 @@ func (z *Zone) Reload(t *transfer.Transfer) error {
 					continue
 				}
 
+				z.RLock()
+				ap, tr := z.Apex, z.Tree
+				z.RUnlock()
+				var d *Diff
+				if ap.SOA != nil && z.JournalSize > 0 {
+					d = diff(ap, tr, zone.Apex, zone.Tree)
+				}
+
 				// copy elements we need
 				z.Lock()
 				z.Apex = zone.Apex
 				z.Tree = zone.Tree
+				if d != nil {
+					z.addDiff(d)
+				}
 				z.Unlock()
 
 				log.Infof("Successfully reloaded zone %q in %q with %d SOA serial", z.origin, zFile, z.Apex.SOA.Serial)
@@ -1,51 +1,53 @@
 package file
 
 import (
+	"fmt"
 	"math/rand"
 	"time"
 
+	"github.com/coredns/coredns/plugin/file/tree"
+
 	"github.com/miekg/dns"
 )
 
-// TransferIn retrieves the zone from the masters, parses it and sets it live.
+// TransferIn retrieves the zone from the masters, parses it and sets it live. If the zone has been
+// transferred before, an incremental zone transfer is requested.
 func (z *Zone) TransferIn() error {
 	if len(z.TransferFrom) == 0 {
 		return nil
 	}
-	m := new(dns.Msg)
-	m.SetAxfr(z.origin)
 
-	z1 := z.CopyWithoutApex()
+	z.RLock()
+	ap, t := z.Apex, z.Tree
+	z.RUnlock()
+
 	var (
 		Err error
+		z1  *Zone
+		d   []*Diff
 		tr  string
 	)
 
-Transfer:
 	for _, tr = range z.TransferFrom {
-		t := new(dns.Transfer)
-		c, err := t.In(m, tr)
-		if err != nil {
-			log.Errorf("Failed to setup transfer `%s' with `%q': %v", z.origin, tr, err)
-			Err = err
-			continue Transfer
-		}
-		for env := range c {
-			if env.Error != nil {
-				log.Errorf("Failed to transfer `%s' from %q: %v", z.origin, tr, env.Error)
-				Err = env.Error
-				continue Transfer
-			}
-			for _, rr := range env.RR {
-				if err := z1.Insert(rr); err != nil {
-					log.Errorf("Failed to parse transfer `%s' from: %q: %v", z.origin, tr, err)
-					Err = err
-					continue Transfer
+		if ap.SOA != nil {
+			z1, d, Err = z.transferIncremental(tr, ap, t)
+			if Err == nil {
+				if z1 == nil {
+					log.Infof("Zone %s is up to date with %s at %d SOA serial", z.origin, tr, ap.SOA.Serial)
+					return nil
 				}
+				break
 			}
+			log.Warningf("Failed incremental transfer `%s' from %q, trying a full transfer: %v", z.origin, tr, Err)
+		}
+
+		z1, Err = z.transferFull(tr)
+		if Err == nil {
+			if ap.SOA != nil {
+				d = []*Diff{diff(ap, t, z1.Apex, z1.Tree)}
+			}
+			break
 		}
-		Err = nil
-		break
 	}
 	if Err != nil {
 		return Err
@@ -55,11 +57,114 @@ Transfer:
 	z.Tree = z1.Tree
 	z.Apex = z1.Apex
 	z.Expired = false
+	for i := range d {
+		z.addDiff(d[i])
+	}
 	z.Unlock()
 	log.Infof("Transferred: %s from %s", z.origin, tr)
 	return nil
 }
 
+// transferFull retrieves the zone from the master with an AXFR and returns it.
+func (z *Zone) transferFull(from string) (*Zone, error) {
+	m := new(dns.Msg)
+	m.SetAxfr(z.origin)
+
+	rrs, err := z.transfer(m, from)
+	if err != nil {
+		return nil, err
+	}
+
+	z1 := z.CopyWithoutApex()
+	for _, rr := range rrs {
+		if err := z1.Insert(rr); err != nil {
+			log.Errorf("Failed to parse transfer `%s' from: %q: %v", z.origin, from, err)
+			return nil, err
+		}
+	}
+	return z1, nil
+}
+
+// transferIncremental requests the changes since the current version of the zone, ap and tr, from
+// the master with an IXFR. It returns the updated zone and the diffs applied, or a nil zone if the
+// zone is up to date. If the master answers with the full zone, that is returned instead.
+func (z *Zone) transferIncremental(from string, ap Apex, tr *tree.Tree) (*Zone, []*Diff, error) {
+	m := new(dns.Msg)
+	m.SetIxfr(z.origin, ap.SOA.Serial, ap.SOA.Ns, ap.SOA.Mbox)
+
+	rrs, err := z.transfer(m, from)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rrs) == 0 {
+		return nil, nil, fmt.Errorf("empty response")
+	}
+
+	soa, ok := rrs[0].(*dns.SOA)
+	if !ok {
+		return nil, nil, dns.ErrSoa
+	}
+	if len(rrs) == 1 {
+		if less(ap.SOA.Serial, soa.Serial) {
+			return nil, nil, fmt.Errorf("only SOA received for newer %d SOA serial", soa.Serial)
+		}
+		return nil, nil, nil
+	}
+
+	diffs, ok := parseIncremental(rrs)
+	if !ok || diffs[0].From.Serial != ap.SOA.Serial {
+		// Not an incremental zone transfer, the master has sent the full zone.
+		z1 := z.CopyWithoutApex()
+		for _, rr := range rrs {
+			if err := z1.Insert(rr); err != nil {
+				return nil, nil, err
+			}
+		}
+		return z1, []*Diff{diff(ap, tr, z1.Apex, z1.Tree)}, nil
+	}
+
+	for i := 1; i < len(diffs); i++ {
+		if diffs[i].From.Serial != diffs[i-1].To.Serial {
+			return nil, nil, fmt.Errorf("non-contiguous serials in incremental transfer: %d and %d", diffs[i-1].To.Serial, diffs[i].From.Serial)
+		}
+	}
+
+	z1 := z.CopyWithoutApex()
+	for _, rr := range apply(records(ap, tr), diffs) {
+		if err := z1.Insert(rr); err != nil {
+			return nil, nil, err
+		}
+	}
+	z1.Insert(soa)
+	return z1, diffs, nil
+}
+
+// transfer performs the zone transfer in m with the master and returns all records received.
+func (z *Zone) transfer(m *dns.Msg, from string) ([]dns.RR, error) {
+	t := new(dns.Transfer)
+	c, err := t.In(m, from)
+	if err != nil {
+		log.Errorf("Failed to setup transfer `%s' with `%q': %v", z.origin, from, err)
+		return nil, err
+	}
+
+	var (
+		rrs []dns.RR
+		Err error
+	)
+	for env := range c {
+		if env.Error != nil {
+			if Err == nil {
+				log.Errorf("Failed to transfer `%s' from %q: %v", z.origin, from, env.Error)
+			}
+			Err = env.Error
+			continue // drain the channel
+		}
+		rrs = append(rrs, env.RR...)
+	}
+	return rrs, Err
+}
+
 // shouldTransfer checks the primaries of zone, retrieves the SOA record, checks the current serial
 // and the remote serial and will return true if the remote one is higher than the locally configured one.
 func (z *Zone) shouldTransfer() (bool, error) {
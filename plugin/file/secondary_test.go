@@ -121,6 +121,67 @@ func TestTransferIn(t *testing.T) {
 	}
 }
 
+// ixfr serves version 1 of testZone with AXFR and the changes to version 2 with IXFR.
+type ixfr struct{}
+
+func (ixfr) Handler(w dns.ResponseWriter, req *dns.Msg) {
+	soa1 := test.SOA(fmt.Sprintf("%s IN SOA bla. bla. 1 0 0 0 0", testZone))
+	soa2 := test.SOA(fmt.Sprintf("%s IN SOA bla. bla. 2 0 0 0 0", testZone))
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	switch req.Question[0].Qtype {
+	case dns.TypeAXFR:
+		m.Answer = []dns.RR{
+			soa1,
+			test.A(fmt.Sprintf("a.%s IN A 127.0.0.1", testZone)),
+			test.A(fmt.Sprintf("b.%s IN A 127.0.0.2", testZone)),
+			soa1,
+		}
+	case dns.TypeIXFR:
+		m.Answer = []dns.RR{
+			soa2,
+			soa1, test.A(fmt.Sprintf("b.%s IN A 127.0.0.2", testZone)),
+			soa2, test.A(fmt.Sprintf("c.%s IN A 127.0.0.3", testZone)),
+			soa2,
+		}
+	}
+	w.WriteMsg(m)
+}
+
+func TestTransferInIncremental(t *testing.T) {
+	s := dnstest.NewServer(ixfr{}.Handler)
+	defer s.Close()
+
+	z := NewZone(testZone, "stdin")
+	z.TransferFrom = []string{s.Addr}
+	z.JournalSize = DefaultJournalSize
+
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Unable to run TransferIn: %v", err)
+	}
+	if z.Apex.SOA.Serial != 1 {
+		t.Fatalf("Expected SOA serial 1, got %d", z.Apex.SOA.Serial)
+	}
+	if err := z.TransferIn(); err != nil {
+		t.Fatalf("Unable to run TransferIn: %v", err)
+	}
+	if z.Apex.SOA.Serial != 2 {
+		t.Fatalf("Expected SOA serial 2, got %d", z.Apex.SOA.Serial)
+	}
+
+	for name, exists := range map[string]bool{"a.": true, "b.": false, "c.": true} {
+		if _, ok := z.Tree.Search(name + testZone); ok != exists {
+			t.Errorf("Expected %s%s to exist: %t", name, testZone, exists)
+		}
+	}
+
+	// The applied changes can be transferred outwards again.
+	if diffs := z.incremental(1); len(diffs) != 1 {
+		t.Errorf("Expected 1 diff in the journal, got %d", len(diffs))
+	}
+}
+
 func TestIsNotify(t *testing.T) {
 	z := new(Zone)
 	z.origin = testZone
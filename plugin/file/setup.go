@@ -4,6 +4,8 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/coredns/caddy"
@@ -11,6 +13,8 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/upstream"
 	"github.com/coredns/coredns/plugin/transfer"
+
+	"github.com/miekg/dns"
 )
 
 func init() { plugin.Register("file", setup) }
@@ -21,7 +25,7 @@ func setup(c *caddy.Controller) error {
 		return plugin.Error("file", err)
 	}
 
-	f := File{Zones: zones}
+	f := &File{Zones: zones}
 	// get the transfer plugin, so we can send notifies and send notifies on startup as well.
 	c.OnStartup(func() error {
 		t := dnsserver.GetConfig(c).Handler("transfer")
@@ -75,6 +79,7 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 
 	var openErr error
 	reload := 1 * time.Minute
+	journal := DefaultJournalSize
 
 	for c.Next() {
 		// file db.file [zones...]
@@ -115,6 +120,11 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 			return Zones{}, err
 		}
 
+		var (
+			update     bool
+			updateKeys []string
+			writeBack  bool
+		)
 		for c.NextBlock() {
 			switch c.Val() {
 			case "reload":
@@ -127,6 +137,24 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 					return Zones{}, plugin.Error("file", err)
 				}
 				reload = d
+			case "journal":
+				t := c.RemainingArgs()
+				if len(t) != 1 {
+					return Zones{}, c.ArgErr()
+				}
+				n, err := strconv.Atoi(t[0])
+				if err != nil || n < 0 {
+					return Zones{}, c.Errf("invalid journal size: %s", t[0])
+				}
+				journal = n
+			case "update":
+				update = true
+				updateKeys = append(updateKeys, c.RemainingArgs()...)
+			case "write_back":
+				if c.NextArg() {
+					return Zones{}, c.ArgErr()
+				}
+				writeBack = true
 			case "upstream":
 				// remove soon
 				c.RemainingArgs()
@@ -136,8 +164,18 @@ func fileParse(c *caddy.Controller) (Zones, error) {
 			}
 		}
 
+		if writeBack && !update {
+			return Zones{}, c.Errf("write_back requires update")
+		}
+
 		for i := range origins {
 			z[origins[i]].ReloadInterval = reload
+			z[origins[i]].JournalSize = journal
+			z[origins[i]].AllowUpdate = update
+			z[origins[i]].WriteBack = writeBack
+			for _, k := range updateKeys {
+				z[origins[i]].UpdateKeys = append(z[origins[i]].UpdateKeys, dns.Fqdn(strings.ToLower(k)))
+			}
 			z[origins[i]].Upstream = upstream.New()
 		}
 	}
@@ -1,6 +1,7 @@
 package file
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
@@ -122,3 +123,104 @@ func TestParseReload(t *testing.T) {
 		}
 	}
 }
+
+func TestParseJournal(t *testing.T) {
+	name, rm, err := test.TempFile(".", dbMiekNL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		journal   int
+	}{
+		{`file ` + name + ` example.org.`, false, DefaultJournalSize},
+		{`file ` + name + ` example.org. {
+			journal 100
+			}`, false, 100},
+		{`file ` + name + ` example.org. {
+			journal 0
+			}`, false, 0},
+		{`file ` + name + ` example.org. {
+			journal -1
+			}`, true, 0},
+		{`file ` + name + ` example.org. {
+			journal
+			}`, true, 0},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		z, err := fileParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d expected errors, but got no error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		if x := z.Z["example.org."].JournalSize; x != test.journal {
+			t.Errorf("Test %d expected journal to be %d, but got %d", i, test.journal, x)
+		}
+	}
+}
+
+func TestParseUpdate(t *testing.T) {
+	name, rm, err := test.TempFile(".", dbMiekNL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		update    bool
+		keys      []string
+		writeBack bool
+	}{
+		{`file ` + name + ` example.org.`, false, false, nil, false},
+		{`file ` + name + ` example.org. {
+			update
+			}`, false, true, nil, false},
+		{`file ` + name + ` example.org. {
+			update Key.Example.org tsig.key.
+			write_back
+			}`, false, true, []string{"key.example.org.", "tsig.key."}, true},
+		{`file ` + name + ` example.org. {
+			write_back
+			}`, true, false, nil, false},
+		{`file ` + name + ` example.org. {
+			update
+			write_back yes
+			}`, true, false, nil, false},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		z, err := fileParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d expected errors, but got no error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		zone := z.Z["example.org."]
+		if zone.AllowUpdate != test.update {
+			t.Errorf("Test %d expected update to be %t, but got %t", i, test.update, zone.AllowUpdate)
+		}
+		if !reflect.DeepEqual(zone.UpdateKeys, test.keys) {
+			t.Errorf("Test %d expected update keys %v, but got %v", i, test.keys, zone.UpdateKeys)
+		}
+		if zone.WriteBack != test.writeBack {
+			t.Errorf("Test %d expected write_back to be %t, but got %t", i, test.writeBack, zone.WriteBack)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file/tree"
+	"github.com/coredns/coredns/plugin/tsig"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// serveUpdate handles the dynamic update (RFC 2136) in r for zone z.
+func (f File) serveUpdate(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, z *Zone) (int, error) {
+	state := request.Request{W: w, Req: r}
+	key := tsig.KeyName(ctx)
+
+	rcode, changed := z.update(key, r)
+
+	m := new(dns.Msg)
+	m.SetRcode(r, rcode)
+	w.WriteMsg(m)
+
+	if rcode != dns.RcodeSuccess {
+		log.Infof("Update from %s with key %q for %s failed: %s", state.IP(), key, z.origin, dns.RcodeToString[rcode])
+		return dns.RcodeSuccess, nil
+	}
+	if !changed {
+		return dns.RcodeSuccess, nil
+	}
+
+	log.Infof("Update from %s with key %q applied to %s with %d SOA serial", state.IP(), key, z.origin, z.SOASerialIfDefined())
+	if f.transfer != nil {
+		go func() {
+			if err := f.transfer.Notify(z.origin); err != nil {
+				log.Warningf("Failed sending notifies: %s", err)
+			}
+		}()
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// Updates implements the dnsserver.Updater interface. Updates for zones that don't allow them are
+// refused.
+func (f File) Updates(zone string) bool { return plugin.Zones(f.Zones.Names).Matches(zone) != "" }
+
+// update applies the dynamic update in r, signed with the TSIG key named key, to z. It returns the
+// rcode for the response and whether the zone was changed.
+func (z *Zone) update(key string, r *dns.Msg) (int, bool) {
+	if !z.updateAllowed(key) {
+		return dns.RcodeRefused, false
+	}
+
+	// Zone section, see RFC 2136, section 3.1.
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError, false
+	}
+	if !strings.EqualFold(dns.Fqdn(r.Question[0].Name), z.origin) || r.Question[0].Qclass != dns.ClassINET {
+		return dns.RcodeNotAuth, false
+	}
+
+	z.updateMu.Lock()
+	defer z.updateMu.Unlock()
+
+	z.RLock()
+	ap, t := z.Apex, z.Tree
+	z.RUnlock()
+	if ap.SOA == nil {
+		return dns.RcodeServerFailure, false
+	}
+	// We can't sign the updated records.
+	if len(ap.SIGSOA) > 0 {
+		return dns.RcodeRefused, false
+	}
+
+	set := newRRSets(append(records(ap, t), ap.SOA))
+	if rcode := set.prerequisites(z.origin, r.Answer); rcode != dns.RcodeSuccess {
+		return rcode, false
+	}
+	if rcode := prescan(z.origin, r.Ns); rcode != dns.RcodeSuccess {
+		return rcode, false
+	}
+	if !set.apply(z.origin, r.Ns) {
+		return dns.RcodeSuccess, false
+	}
+
+	// Bump the serial, unless the update did so itself.
+	soa := set[z.origin][dns.TypeSOA][0].(*dns.SOA)
+	if !less(ap.SOA.Serial, soa.Serial) {
+		soa = dns.Copy(soa).(*dns.SOA)
+		soa.Serial = ap.SOA.Serial + 1
+		set[z.origin][dns.TypeSOA] = []dns.RR{soa}
+	}
+
+	z1 := z.CopyWithoutApex()
+	for _, rr := range set.records() {
+		if err := z1.Insert(rr); err != nil {
+			log.Errorf("Failed to apply update to %s: %s", z.origin, err)
+			return dns.RcodeServerFailure, false
+		}
+	}
+
+	z.Lock()
+	defer z.Unlock()
+	// The zone has been reloaded in the mean time, the prerequisites must be checked again.
+	if z.Apex.SOA != ap.SOA {
+		return dns.RcodeServerFailure, false
+	}
+	if z.WriteBack {
+		if err := writeZone(z.file, z1.Apex, z1.Tree); err != nil {
+			log.Errorf("Failed to write zone %s to %q: %s", z.origin, z.file, err)
+			return dns.RcodeServerFailure, false
+		}
+	}
+	z.Apex = z1.Apex
+	z.Tree = z1.Tree
+	z.addDiff(diff(ap, t, z1.Apex, z1.Tree))
+	return dns.RcodeSuccess, true
+}
+
+// updateAllowed returns true if z can be updated with the TSIG key named key.
+func (z *Zone) updateAllowed(key string) bool {
+	if !z.AllowUpdate || key == "" {
+		return false
+	}
+	if len(z.UpdateKeys) == 0 {
+		return true
+	}
+	for _, k := range z.UpdateKeys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// prescan checks the update section, see RFC 2136, section 3.4.1.
+func prescan(origin string, updates []dns.RR) int {
+	for _, rr := range updates {
+		h := rr.Header()
+		if !dns.IsSubDomain(origin, strings.ToLower(h.Name)) {
+			return dns.RcodeNotZone
+		}
+		switch h.Class {
+		case dns.ClassINET:
+			if isMeta(h.Rrtype) {
+				return dns.RcodeFormatError
+			}
+			if isDNSSEC(h.Rrtype) {
+				return dns.RcodeRefused
+			}
+		case dns.ClassANY:
+			if h.Ttl != 0 || (h.Rrtype != dns.TypeANY && isMeta(h.Rrtype)) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if h.Ttl != 0 || isMeta(h.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// rrsets holds the records of a zone by owner name and type, while applying a dynamic update.
+type rrsets map[string]map[uint16][]dns.RR
+
+func newRRSets(rrs []dns.RR) rrsets {
+	s := rrsets{}
+	for _, rr := range rrs {
+		s.add(rr)
+	}
+	return s
+}
+
+// add adds rr to s, replacing a record with the same data. It returns false if s already held rr
+// with the same TTL.
+func (s rrsets) add(rr dns.RR) bool {
+	// rr can be a record of the zone being served, don't change it.
+	rr = dns.Copy(rr)
+	normalize(rr)
+	name, typ := rr.Header().Name, rr.Header().Rrtype
+	if s[name] == nil {
+		s[name] = map[uint16][]dns.RR{}
+	}
+	k := key(rr)
+	for i, x := range s[name][typ] {
+		if key(x) == k {
+			if x.Header().Ttl == rr.Header().Ttl {
+				return false
+			}
+			s[name][typ][i] = rr
+			return true
+		}
+	}
+	s[name][typ] = append(s[name][typ], rr)
+	return true
+}
+
+// remove removes the record with the same data as rr from s, and returns true if it was found.
+func (s rrsets) remove(rr dns.RR) bool {
+	name, typ := strings.ToLower(rr.Header().Name), rr.Header().Rrtype
+	k := key(rr)
+	for i, x := range s[name][typ] {
+		if key(x) == k {
+			s[name][typ] = append(s[name][typ][:i:i], s[name][typ][i+1:]...)
+			s.cleanup(name, typ)
+			return true
+		}
+	}
+	return false
+}
+
+// cleanup removes the RRset of type typ at name if it's empty, and name if it holds no RRsets.
+func (s rrsets) cleanup(name string, typ uint16) {
+	if len(s[name][typ]) == 0 {
+		delete(s[name], typ)
+	}
+	if len(s[name]) == 0 {
+		delete(s, name)
+	}
+}
+
+// records returns all records in s.
+func (s rrsets) records() []dns.RR {
+	var rrs []dns.RR
+	for _, types := range s {
+		for _, set := range types {
+			rrs = append(rrs, set...)
+		}
+	}
+	return rrs
+}
+
+// prerequisites checks the prerequisite section, see RFC 2136, section 3.2.
+func (s rrsets) prerequisites(origin string, prereqs []dns.RR) int {
+	temp := rrsets{}
+	for _, rr := range prereqs {
+		h := rr.Header()
+		name := strings.ToLower(h.Name)
+		if h.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !dns.IsSubDomain(origin, name) {
+			return dns.RcodeNotZone
+		}
+
+		switch h.Class {
+		case dns.ClassANY:
+			if h.Rrtype == dns.TypeANY {
+				if len(s[name]) == 0 {
+					return dns.RcodeNameError
+				}
+				continue
+			}
+			if len(s[name][h.Rrtype]) == 0 {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if h.Rrtype == dns.TypeANY {
+				if len(s[name]) > 0 {
+					return dns.RcodeYXDomain
+				}
+				continue
+			}
+			if len(s[name][h.Rrtype]) > 0 {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			temp.add(dns.Copy(rr))
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	// RRsets must exist and be equal, regardless of the TTLs.
+	for name, types := range temp {
+		for typ, set := range types {
+			if len(set) != len(s[name][typ]) {
+				return dns.RcodeNXRrset
+			}
+			for _, rr := range set {
+				found := false
+				for _, x := range s[name][typ] {
+					if key(x) == key(rr) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					return dns.RcodeNXRrset
+				}
+			}
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// apply applies the updates to s, see RFC 2136, section 3.4.2. It returns true if s was changed.
+func (s rrsets) apply(origin string, updates []dns.RR) bool {
+	changed := false
+	for _, rr := range updates {
+		h := rr.Header()
+		name := strings.ToLower(h.Name)
+
+		switch h.Class {
+		case dns.ClassINET:
+			switch {
+			case h.Rrtype == dns.TypeSOA:
+				// Only a SOA at the apex with a newer serial replaces the current one.
+				if name != origin || !less(s[origin][dns.TypeSOA][0].(*dns.SOA).Serial, rr.(*dns.SOA).Serial) {
+					continue
+				}
+				s[origin][dns.TypeSOA] = nil
+			case h.Rrtype == dns.TypeCNAME:
+				// A CNAME can't coexist with other data, and there can be only one.
+				if s.hasOther(name, dns.TypeCNAME) {
+					continue
+				}
+				if cname := s[name][dns.TypeCNAME]; len(cname) > 0 && key(cname[0]) != key(rr) {
+					delete(s[name], dns.TypeCNAME)
+				}
+			default:
+				if len(s[name][dns.TypeCNAME]) > 0 {
+					continue
+				}
+			}
+			if s.add(rr) {
+				changed = true
+			}
+
+		case dns.ClassANY:
+			if h.Rrtype == dns.TypeANY {
+				for typ := range s[name] {
+					if name == origin && (typ == dns.TypeSOA || typ == dns.TypeNS) {
+						continue
+					}
+					delete(s[name], typ)
+					changed = true
+				}
+				s.cleanup(name, dns.TypeANY)
+				continue
+			}
+			if name == origin && (h.Rrtype == dns.TypeSOA || h.Rrtype == dns.TypeNS) {
+				continue
+			}
+			if len(s[name][h.Rrtype]) > 0 {
+				changed = true
+			}
+			delete(s[name], h.Rrtype)
+			s.cleanup(name, h.Rrtype)
+
+		case dns.ClassNONE:
+			if h.Rrtype == dns.TypeSOA {
+				continue
+			}
+			// The last NS record of the zone is never deleted.
+			if name == origin && h.Rrtype == dns.TypeNS && len(s[origin][dns.TypeNS]) == 1 {
+				continue
+			}
+			x := dns.Copy(rr)
+			x.Header().Class = dns.ClassINET
+			if s.remove(x) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// hasOther returns true if name has RRsets of other types than typ.
+func (s rrsets) hasOther(name string, typ uint16) bool {
+	for t := range s[name] {
+		if t != typ {
+			return true
+		}
+	}
+	return false
+}
+
+func isMeta(t uint16) bool {
+	switch t {
+	case dns.TypeANY, dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB, dns.TypeOPT, dns.TypeTSIG:
+		return true
+	}
+	return false
+}
+
+func isDNSSEC(t uint16) bool {
+	switch t {
+	case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeNSEC3PARAM:
+		return true
+	}
+	return false
+}
+
+// writeZone writes the zone, with its apex ap and tree t, to the zone file at path. The zone is written
+// to a temporary file first, which then replaces the zone file.
+func writeZone(path string, ap Apex, t *tree.Tree) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if fi, err := os.Stat(path); err == nil {
+		f.Chmod(fi.Mode())
+	}
+
+	w := bufio.NewWriter(f)
+	w.WriteString(ap.SOA.String() + "\n")
+	for _, rr := range records(ap, t) {
+		w.WriteString(rr.String() + "\n")
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
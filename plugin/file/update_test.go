@@ -0,0 +1,231 @@
+package file
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const updateZone = `example.org.		3600	IN	SOA	ns.example.org. admin.example.org. 10 3600 600 86400 300
+example.org.		3600	IN	NS	ns.example.org.
+ns.example.org.		3600	IN	A	127.0.0.1
+a.example.org.		3600	IN	A	127.0.0.1
+a.example.org.		3600	IN	A	127.0.0.2
+www.example.org.	3600	IN	CNAME	a.example.org.
+`
+
+func newUpdateZone(t *testing.T) *Zone {
+	t.Helper()
+	z, err := Parse(strings.NewReader(updateZone), "example.org.", "stdin", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.AllowUpdate = true
+	z.JournalSize = DefaultJournalSize
+	return z
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		update   func(m *dns.Msg)
+		rcode    int
+		changed  bool
+		exists   []string // name/type that must exist after the update
+		notExist []string // name/type that must not exist after the update
+	}{
+		// prerequisites
+		{func(m *dns.Msg) { m.NameUsed([]dns.RR{test.A("b.example.org. A 127.0.0.1")}) }, dns.RcodeNameError, false, nil, nil},
+		{func(m *dns.Msg) { m.NameNotUsed([]dns.RR{test.A("a.example.org. A 127.0.0.1")}) }, dns.RcodeYXDomain, false, nil, nil},
+		{func(m *dns.Msg) { m.RRsetUsed([]dns.RR{test.AAAA("a.example.org. AAAA ::1")}) }, dns.RcodeNXRrset, false, nil, nil},
+		{func(m *dns.Msg) { m.RRsetNotUsed([]dns.RR{test.A("a.example.org. A 127.0.0.1")}) }, dns.RcodeYXRrset, false, nil, nil},
+		{func(m *dns.Msg) { m.Used([]dns.RR{test.A("a.example.org. A 127.0.0.1")}) }, dns.RcodeNXRrset, false, nil, nil},
+		{func(m *dns.Msg) { m.NameUsed([]dns.RR{test.A("a.example.net. A 127.0.0.1")}) }, dns.RcodeNotZone, false, nil, nil},
+		// A value dependent prerequisite must match the whole RRset, and the update is applied.
+		{func(m *dns.Msg) {
+			m.Used([]dns.RR{test.A("a.example.org. A 127.0.0.1"), test.A("a.example.org. A 127.0.0.2")})
+			m.Insert([]dns.RR{test.A("b.example.org. 300 A 127.0.0.3")})
+		}, dns.RcodeSuccess, true, []string{"b.example.org./A"}, nil},
+		// updates
+		{func(m *dns.Msg) { m.Insert([]dns.RR{test.A("b.example.net. 300 A 127.0.0.3")}) }, dns.RcodeNotZone, false, nil, nil},
+		{func(m *dns.Msg) {
+			m.Insert([]dns.RR{test.RRSIG("b.example.org. 300 RRSIG A 8 3 300 20230101000000 20220101000000 1 example.org. AAAA")})
+		}, dns.RcodeRefused, false, nil, nil},
+		{func(m *dns.Msg) { m.Insert([]dns.RR{test.A("a.example.org. 3600 A 127.0.0.1")}) }, dns.RcodeSuccess, false, nil, nil},
+		{func(m *dns.Msg) { m.RemoveRRset([]dns.RR{test.A("a.example.org. A 127.0.0.1")}) }, dns.RcodeSuccess, true, nil, []string{"a.example.org./A"}},
+		{func(m *dns.Msg) { m.Remove([]dns.RR{test.A("a.example.org. A 127.0.0.1")}) }, dns.RcodeSuccess, true, []string{"a.example.org./A"}, nil},
+		{func(m *dns.Msg) { m.RemoveName([]dns.RR{test.A("www.example.org. A 127.0.0.1")}) }, dns.RcodeSuccess, true, nil, []string{"www.example.org./CNAME"}},
+		// CNAME and other data can't coexist.
+		{func(m *dns.Msg) { m.Insert([]dns.RR{test.A("www.example.org. 300 A 127.0.0.3")}) }, dns.RcodeSuccess, false, nil, []string{"www.example.org./A"}},
+		{func(m *dns.Msg) { m.Insert([]dns.RR{test.CNAME("a.example.org. 300 CNAME www.example.org.")}) }, dns.RcodeSuccess, false, nil, []string{"a.example.org./CNAME"}},
+		// The SOA and NS records at the apex are kept.
+		{func(m *dns.Msg) { m.RemoveName([]dns.RR{test.A("example.org. A 127.0.0.1")}) }, dns.RcodeSuccess, false, []string{"example.org./NS"}, nil},
+		{func(m *dns.Msg) { m.Remove([]dns.RR{test.NS("example.org. NS ns.example.org.")}) }, dns.RcodeSuccess, false, []string{"example.org./NS"}, nil},
+	}
+
+	for i, tc := range tests {
+		z := newUpdateZone(t)
+		m := new(dns.Msg)
+		m.SetUpdate("example.org.")
+		tc.update(m)
+
+		rcode, changed := z.update("key.", m)
+		if rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rcode])
+		}
+		if changed != tc.changed {
+			t.Errorf("Test %d: expected changed to be %t, got %t", i, tc.changed, changed)
+		}
+
+		// The serial is bumped on every change.
+		serial := uint32(10)
+		if tc.changed {
+			serial = 11
+		}
+		if z.Apex.SOA.Serial != serial {
+			t.Errorf("Test %d: expected SOA serial %d, got %d", i, serial, z.Apex.SOA.Serial)
+		}
+
+		for _, e := range tc.exists {
+			if !hasRRset(z, e) {
+				t.Errorf("Test %d: expected %s to exist", i, e)
+			}
+		}
+		for _, e := range tc.notExist {
+			if hasRRset(z, e) {
+				t.Errorf("Test %d: expected %s to not exist", i, e)
+			}
+		}
+	}
+}
+
+func TestUpdateNotAllowed(t *testing.T) {
+	z := newUpdateZone(t)
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.Insert([]dns.RR{test.A("b.example.org. 300 A 127.0.0.3")})
+
+	if rcode, _ := z.update("", m); rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for an unsigned update, got %s", dns.RcodeToString[rcode])
+	}
+
+	z.UpdateKeys = []string{"key."}
+	if rcode, _ := z.update("other.", m); rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for an update signed with another key, got %s", dns.RcodeToString[rcode])
+	}
+	if rcode, _ := z.update("key.", m); rcode != dns.RcodeSuccess {
+		t.Errorf("Expected NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+
+	// Through ServeDNS the key comes from the tsig plugin, which isn't there.
+	f := File{Zones: Zones{Z: map[string]*Zone{"example.org.": z}, Names: []string{"example.org."}}}
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Msg.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+}
+
+func TestUpdateSOA(t *testing.T) {
+	z := newUpdateZone(t)
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.Insert([]dns.RR{test.SOA("example.org. 3600 IN SOA ns.example.org. admin.example.org. 100 3600 600 86400 300")})
+
+	if rcode, changed := z.update("key.", m); rcode != dns.RcodeSuccess || !changed {
+		t.Fatalf("Expected a successful update, got %s", dns.RcodeToString[rcode])
+	}
+	if z.Apex.SOA.Serial != 100 {
+		t.Errorf("Expected SOA serial 100, got %d", z.Apex.SOA.Serial)
+	}
+
+	// An older serial is ignored.
+	m.Ns = []dns.RR{test.SOA("example.org. 3600 IN SOA ns.example.org. admin.example.org. 50 3600 600 86400 300")}
+	if rcode, changed := z.update("key.", m); rcode != dns.RcodeSuccess || changed {
+		t.Fatalf("Expected a successful update without changes, got %s", dns.RcodeToString[rcode])
+	}
+
+	// The changes are in the journal.
+	if diffs := z.incremental(10); len(diffs) != 1 {
+		t.Errorf("Expected 1 diff in the journal, got %d", len(diffs))
+	}
+}
+
+func TestUpdateKeepsCase(t *testing.T) {
+	z := newUpdateZone(t)
+	e, _ := z.Tree.Search("www.example.org.")
+	cname := e.Type(dns.TypeCNAME)[0].(*dns.CNAME)
+	cname.Hdr.Name = "WWW.example.org."
+	cname.Target = "A.example.org."
+
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.Insert([]dns.RR{test.A("b.example.org. 300 A 127.0.0.3")})
+	if rcode, _ := z.update("key.", m); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+	// The records of the zone that was served during the update are unchanged.
+	if cname.Hdr.Name != "WWW.example.org." || cname.Target != "A.example.org." {
+		t.Errorf("Expected the served CNAME to keep its case, got %s", cname)
+	}
+}
+
+func TestUpdateWriteBack(t *testing.T) {
+	name, rm, err := test.TempFile(".", updateZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	z := newUpdateZone(t)
+	z.file = name
+	z.WriteBack = true
+
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.Insert([]dns.RR{test.A("b.example.org. 300 A 127.0.0.3")})
+	if rcode, _ := z.update("key.", m); rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", dns.RcodeToString[rcode])
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	z1, err := Parse(f, "example.org.", name, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse written zone: %s", err)
+	}
+	if z1.Apex.SOA.Serial != 11 {
+		t.Errorf("Expected SOA serial 11 in the written zone, got %d", z1.Apex.SOA.Serial)
+	}
+	if !hasRRset(z1, "b.example.org./A") {
+		t.Error("Expected b.example.org./A in the written zone")
+	}
+	if len(z1.All()) != len(z.All()) {
+		t.Errorf("Expected %d records in the written zone, got %d", len(z.All()), len(z1.All()))
+	}
+}
+
+// hasRRset returns true if the RRset nametype, written as "name/type", exists in z.
+func hasRRset(z *Zone, nametype string) bool {
+	name, typ, _ := strings.Cut(nametype, "/")
+	if name == z.origin {
+		switch typ {
+		case "SOA":
+			return z.Apex.SOA != nil
+		case "NS":
+			return len(z.Apex.NS) > 0
+		}
+	}
+	e, ok := z.Tree.Search(name)
+	return ok && len(e.Type(dns.StringToType[typ])) > 0
+}
@@ -76,6 +76,7 @@ var dnssexAuth = []dns.RR{
 }
 
 func TestLookupWildcard(t *testing.T) {
+	signedAt(t, "20160401000000")
 	zone, err := Parse(strings.NewReader(dbDnssexNLSigned), testzone1, "stdin", 0)
 	if err != nil {
 		t.Fatalf("Expect no error when reading zone, got %q", err)
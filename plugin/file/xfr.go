@@ -16,19 +16,38 @@ func (f File) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
 	return z.Transfer(serial)
 }
 
-// Transfer transfers a zone with serial in the returned channel and implements IXFR fallback, by just
-// sending a single SOA record.
+// Transfer transfers a zone with serial in the returned channel. If serial is not 0 and the journal
+// of the zone holds the changes since serial, an incremental zone transfer is done, otherwise the
+// full zone is sent. If serial is up to date, a single SOA record is sent.
 func (z *Zone) Transfer(serial uint32) (<-chan []dns.RR, error) {
 	// get soa and apex
 	apex, err := z.ApexIfDefined()
 	if err != nil {
 		return nil, err
 	}
+	soa := apex[0].(*dns.SOA)
+
+	var diffs []*Diff
+	if serial != 0 && less(serial, soa.Serial) {
+		diffs = z.incremental(serial)
+	}
 
 	ch := make(chan []dns.RR)
 	go func() {
-		if serial != 0 && apex[0].(*dns.SOA).Serial == serial { // ixfr fallback, only send SOA
-			ch <- []dns.RR{apex[0]}
+		if serial != 0 && !less(serial, soa.Serial) { // ixfr fallback, only send SOA
+			ch <- []dns.RR{soa}
+
+			close(ch)
+			return
+		}
+
+		if diffs != nil {
+			ch <- []dns.RR{soa}
+			for _, d := range diffs {
+				ch <- append([]dns.RR{d.From}, d.Deleted...)
+				ch <- append([]dns.RR{d.To}, d.Added...)
+			}
+			ch <- []dns.RR{soa}
 
 			close(ch)
 			return
@@ -36,7 +55,7 @@ func (z *Zone) Transfer(serial uint32) (<-chan []dns.RR, error) {
 
 		ch <- apex
 		z.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error { ch <- e.All(); return nil })
-		ch <- []dns.RR{apex[0]}
+		ch <- []dns.RR{soa}
 
 		close(ch)
 	}()
@@ -3,7 +3,6 @@ package file
 import (
 	"fmt"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
@@ -30,15 +29,26 @@ type Zone struct {
 	ReloadInterval time.Duration
 	reloadShutdown chan bool
 
+	JournalSize int     // Number of diffs kept to answer incremental zone transfers, 0 disables the journal.
+	journal     []*Diff // Protected by the zone lock, the newest diff is last.
+
+	AllowUpdate bool       // Allow dynamic updates (RFC 2136) signed with a TSIG key.
+	UpdateKeys  []string   // If not empty, the names of the TSIG keys that may update the zone.
+	WriteBack   bool       // Write the zone back to its file after an update.
+	updateMu    sync.Mutex // Serializes updates.
+
 	Upstream *upstream.Upstream // Upstream for looking up external names during the resolution process.
 }
 
-// Apex contains the apex records of a zone: SOA, NS and their potential signatures.
+// Apex contains the apex records of a zone: SOA, NS and their potential signatures. The NSEC3
+// records of a signed zone, and their signatures, are kept here too: their owner names are hashes
+// and not names in the zone, so they are not put in the zone's tree.
 type Apex struct {
 	SOA    *dns.SOA
 	NS     []dns.RR
 	SIGSOA []dns.RR
 	SIGNS  []dns.RR
+	NSEC3  *tree.Tree
 }
 
 // NewZone returns a new zone.
@@ -57,6 +67,7 @@ func (z *Zone) Copy() *Zone {
 	z1 := NewZone(z.origin, z.file)
 	z1.TransferFrom = z.TransferFrom
 	z1.Expired = z.Expired
+	z1.JournalSize = z.JournalSize
 
 	z1.Apex = z.Apex
 	return z1
@@ -67,30 +78,27 @@ func (z *Zone) CopyWithoutApex() *Zone {
 	z1 := NewZone(z.origin, z.file)
 	z1.TransferFrom = z.TransferFrom
 	z1.Expired = z.Expired
+	z1.JournalSize = z.JournalSize
 
 	return z1
 }
 
 // Insert inserts r into z.
 func (z *Zone) Insert(r dns.RR) error {
-	r.Header().Name = strings.ToLower(r.Header().Name)
+	normalize(r)
 
 	switch h := r.Header().Rrtype; h {
 	case dns.TypeNS:
-		r.(*dns.NS).Ns = strings.ToLower(r.(*dns.NS).Ns)
-
 		if r.Header().Name == z.origin {
 			z.Apex.NS = append(z.Apex.NS, r)
 			return nil
 		}
 	case dns.TypeSOA:
-		r.(*dns.SOA).Ns = strings.ToLower(r.(*dns.SOA).Ns)
-		r.(*dns.SOA).Mbox = strings.ToLower(r.(*dns.SOA).Mbox)
-
 		z.Apex.SOA = r.(*dns.SOA)
 		return nil
-	case dns.TypeNSEC3, dns.TypeNSEC3PARAM:
-		return fmt.Errorf("NSEC3 zone is not supported, dropping RR: %s for zone: %s", r.Header().Name, z.origin)
+	case dns.TypeNSEC3:
+		z.insertNSEC3(r)
+		return nil
 	case dns.TypeRRSIG:
 		x := r.(*dns.RRSIG)
 		switch x.TypeCovered {
@@ -102,13 +110,10 @@ func (z *Zone) Insert(r dns.RR) error {
 				z.Apex.SIGNS = append(z.Apex.SIGNS, x)
 				return nil
 			}
+		case dns.TypeNSEC3:
+			z.insertNSEC3(r)
+			return nil
 		}
-	case dns.TypeCNAME:
-		r.(*dns.CNAME).Target = strings.ToLower(r.(*dns.CNAME).Target)
-	case dns.TypeMX:
-		r.(*dns.MX).Mx = strings.ToLower(r.(*dns.MX).Mx)
-	case dns.TypeSRV:
-		r.(*dns.SRV).Target = strings.ToLower(r.(*dns.SRV).Target)
 	}
 
 	z.Tree.Insert(r)
@@ -148,6 +153,7 @@ func (z *Zone) ApexIfDefined() ([]dns.RR, error) {
 	if len(z.Apex.SIGNS) > 0 {
 		rrs = append(rrs, z.Apex.SIGNS...)
 	}
+	rrs = append(rrs, z.Apex.NSEC3s()...)
 
 	return rrs, nil
 }
@@ -0,0 +1,55 @@
+package forward
+
+import (
+	"sync"
+	"time"
+)
+
+// budget limits the number of retries to other upstreams, so an outage of some upstreams doesn't
+// multiply the load on the others. In every window of budgetWindow the number of retries may be
+// ratio times the number of queries, plus perSecond per second.
+type budget struct {
+	ratio     float64
+	perSecond float64 // retries per second that are always allowed
+
+	sync.Mutex
+	start   time.Time // start of the current window
+	queries int
+	retries int
+}
+
+func newBudget(ratio, perSecond float64) *budget {
+	return &budget{ratio: ratio, perSecond: perSecond, start: time.Now()}
+}
+
+// query records a query.
+func (b *budget) query() {
+	b.Lock()
+	defer b.Unlock()
+	b.roll()
+	b.queries++
+}
+
+// retry returns true if a retry is within the budget, and records it if so.
+func (b *budget) retry() bool {
+	b.Lock()
+	defer b.Unlock()
+	b.roll()
+	if float64(b.retries) >= b.ratio*float64(b.queries)+b.perSecond*budgetWindow.Seconds() {
+		retryBudgetExhaustedCount.Add(1)
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// roll starts a new window when the current one is over, b must be locked.
+func (b *budget) roll() {
+	if now := time.Now(); now.Sub(b.start) >= budgetWindow {
+		b.start = now
+		b.queries = 0
+		b.retries = 0
+	}
+}
+
+var budgetWindow = 10 * time.Second
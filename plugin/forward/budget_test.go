@@ -0,0 +1,76 @@
+package forward
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestBudget(t *testing.T) {
+	b := newBudget(0.5, 0)
+	if b.retry() {
+		t.Errorf("Expected no retry before any query")
+	}
+	for i := 0; i < 4; i++ {
+		b.query()
+	}
+	for i := 0; i < 2; i++ {
+		if !b.retry() {
+			t.Errorf("Expected retry %d to be within the budget", i)
+		}
+	}
+	if b.retry() {
+		t.Errorf("Expected third retry to exceed the budget")
+	}
+
+	// A new window starts with a fresh budget.
+	b.start = time.Now().Add(-budgetWindow)
+	b.query()
+	b.query()
+	if !b.retry() || b.retry() {
+		t.Errorf("Expected a single retry in the new window")
+	}
+
+	// The minimum is allowed without any queries.
+	b = newBudget(0, 0.2)
+	if !b.retry() || !b.retry() || b.retry() {
+		t.Errorf("Expected two retries per window of %s", budgetWindow)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	tests := []struct {
+		budget    string
+		shouldErr bool
+	}{
+		{"retry_budget 0 0", true},
+		{"retry_budget 0 1", false},
+		{"retry_budget 1 0", false}, // the query itself adds to the budget
+	}
+	for i, tc := range tests {
+		f := startForward(t, "forward . SILENT "+s.Addr+" {\npolicy sequential\n"+tc.budget+"\n}\n")
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		_, err := f.ServeDNS(context.TODO(), rec, m)
+		if tc.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error when the retry isn't in the budget", i)
+		}
+		if !tc.shouldErr && err != nil {
+			t.Errorf("Test %d: expected the retry to the next upstream to succeed, got %s", i, err)
+		}
+	}
+}
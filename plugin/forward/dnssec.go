@@ -0,0 +1,127 @@
+package forward
+
+import (
+	"context"
+	"errors"
+
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/plugin/pkg/validator"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// dnssecRequest returns a copy of r that asks the upstream for signatures and to not validate them.
+func dnssecRequest(r *dns.Msg) *dns.Msg {
+	req := r.Copy()
+	req.CheckingDisabled = true
+	if o := req.IsEdns0(); o != nil {
+		o.SetDo()
+	} else {
+		req.SetEdns0(dns.DefaultMsgSize, true)
+	}
+	return req
+}
+
+// validate validates ret, the upstream's response to the client's request r, and writes it to w.
+// Bogus responses aren't written, SERVFAIL with the extended DNS error for the failure is
+// returned instead.
+func (f *Forward) validate(ctx context.Context, w dns.ResponseWriter, r, ret *dns.Msg) (int, error) {
+	ex := func(ctx context.Context, m *dns.Msg) (*dns.Msg, error) { return f.exchange(ctx, w, m) }
+
+	res, err := f.validator.Validate(ctx, ex, ret)
+	validationCount.WithLabelValues(res.String()).Inc()
+	if res == validator.Bogus {
+		code := dns.ExtendedErrorCodeDNSBogus
+		var verr *validator.Error
+		if errors.As(err, &verr) {
+			code = verr.Code
+		}
+		log.Debugf("Bogus response for %s %s: %s", ret.Question[0].Name, dns.Type(ret.Question[0].Qtype), err)
+		return dns.RcodeServerFailure, edns.NewExtendedError(err, code, "")
+	}
+
+	do := false
+	if o := r.IsEdns0(); o != nil {
+		do = o.Do()
+	}
+	ret.AuthenticatedData = res == validator.Secure && (do || r.AuthenticatedData)
+	ret.CheckingDisabled = r.CheckingDisabled
+
+	if !do {
+		qtype := r.Question[0].Qtype
+		ret.Answer = stripDNSSEC(ret.Answer, qtype)
+		ret.Ns = stripDNSSEC(ret.Ns, qtype)
+		ret.Extra = stripDNSSEC(ret.Extra, qtype)
+		if o := ret.IsEdns0(); o != nil {
+			if r.IsEdns0() == nil {
+				ret.Extra = stripOPT(ret.Extra)
+			} else {
+				o.SetDo(false)
+			}
+		}
+	}
+
+	w.WriteMsg(ret)
+	return 0, nil
+}
+
+// exchange sends m to the first healthy upstream and returns the response. The validator uses
+// it for the DS and DNSKEY queries.
+func (f *Forward) exchange(ctx context.Context, w dns.ResponseWriter, m *dns.Msg) (*dns.Msg, error) {
+	state := request.Request{W: w, Req: m}
+	u := f.upstream(state.Name())
+
+	list := u.List()
+	p := list[0]
+	for _, l := range list {
+		if !l.Down(u.maxfails) {
+			p = l
+			break
+		}
+	}
+
+	opts := u.opts
+	for {
+		ret, err := p.Connect(ctx, state, opts)
+		if err == ErrCachedClosed {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ret.Truncated && !opts.ForceTCP {
+			opts.ForceTCP = true
+			continue
+		}
+		if !state.Match(ret) {
+			return nil, errors.New("wrong reply for " + state.Name())
+		}
+		return ret, nil
+	}
+}
+
+// stripDNSSEC removes the DNSSEC records from rrs, unless they were asked for with qtype.
+func stripDNSSEC(rrs []dns.RR, qtype uint16) []dns.RR {
+	ret := rrs[:0]
+	for _, rr := range rrs {
+		switch t := rr.Header().Rrtype; t {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+			if t != qtype {
+				continue
+			}
+		}
+		ret = append(ret, rr)
+	}
+	return ret
+}
+
+func stripOPT(rrs []dns.RR) []dns.RR {
+	ret := rrs[:0]
+	for _, rr := range rrs {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			ret = append(ret, rr)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,147 @@
+package forward
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestDNSSECValidation(t *testing.T) {
+	key := &dns.DNSKEY{Hdr: dns.RR_Header{Name: "example.org.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600}, Flags: 257, Protocol: 3, Algorithm: dns.ECDSAP256SHA256}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(rr dns.RR) []dns.RR {
+		sig := &dns.RRSIG{
+			Hdr:         dns.RR_Header{Name: rr.Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: rr.Header().Ttl},
+			TypeCovered: rr.Header().Rrtype, Algorithm: key.Algorithm, Labels: uint8(dns.CountLabel(rr.Header().Name)), OrigTtl: rr.Header().Ttl,
+			Expiration: uint32(time.Now().Add(time.Hour).Unix()), Inception: uint32(time.Now().Add(-time.Hour).Unix()),
+			KeyTag: key.KeyTag(), SignerName: key.Hdr.Name,
+		}
+		if err := sig.Sign(priv.(crypto.Signer), []dns.RR{rr}); err != nil {
+			t.Fatal(err)
+		}
+		return []dns.RR{rr, sig}
+	}
+
+	dnskey := sign(key)
+	good := sign(test.A("good.example.org. 300 IN A 192.0.2.1"))
+	bad := sign(test.A("bad.example.org. 300 IN A 192.0.2.1"))
+	bad[0].(*dns.A).A = net.ParseIP("192.0.2.2")
+
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.SetEdns0(4096, true)
+		switch r.Question[0].Name {
+		case "example.org.":
+			ret.Answer = dnskey
+		case "good.example.org.":
+			ret.Answer = good
+		case "bad.example.org.":
+			ret.Answer = bad
+		}
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	dir := t.TempDir()
+	anchors := filepath.Join(dir, "anchors")
+	if err := os.WriteFile(anchors, []byte(key.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := caddy.NewTestController("dns", "forward . "+s.Addr+" {\ndnssec "+anchors+"\n}\n")
+	fs, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f := fs[0]
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	m := new(dns.Msg)
+	m.SetQuestion("good.example.org.", dns.TypeA)
+	m.SetEdns0(4096, true)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected to receive reply, got %s", err)
+	}
+	if !rec.Msg.AuthenticatedData {
+		t.Errorf("Expected AD bit for validated answer")
+	}
+	if len(rec.Msg.Answer) != 2 {
+		t.Errorf("Expected answer with signature, got %d records", len(rec.Msg.Answer))
+	}
+
+	// Without DO, no AD bit and no signatures.
+	m = new(dns.Msg)
+	m.SetQuestion("good.example.org.", dns.TypeA)
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected to receive reply, got %s", err)
+	}
+	if rec.Msg.AuthenticatedData || len(rec.Msg.Answer) != 1 || rec.Msg.IsEdns0() != nil {
+		t.Errorf("Expected answer without DNSSEC records, got %s", rec.Msg)
+	}
+
+	m = new(dns.Msg)
+	m.SetQuestion("bad.example.org.", dns.TypeA)
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	rcode, err := f.ServeDNS(context.TODO(), rec, m)
+	if rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected SERVFAIL for bogus answer, got %s", dns.RcodeToString[rcode])
+	}
+	var ede *edns.ExtendedError
+	if !errors.As(err, &ede) || ede.Code != dns.ExtendedErrorCodeDNSBogus {
+		t.Errorf("Expected error to carry extended error DNSSEC Bogus, got %v", err)
+	}
+
+	// Checking disabled, the bogus answer is passed on.
+	m.CheckingDisabled = true
+	rec = dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected to receive reply, got %s", err)
+	}
+}
+
+func TestSetupDNSSEC(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+	}{
+		{"forward . 127.0.0.1 {\ndnssec\n}\n", false},
+		{"forward . 127.0.0.1 {\ndnssec /does/not/exist\n}\n", true},
+		{"forward . 127.0.0.1 {\ndnssec a b\n}\n", true},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		fs, err := parseForward(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error but found none for input %s", i, test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+		}
+		if fs[0].validator == nil {
+			t.Errorf("Test %d: expected validator to be set", i)
+		}
+	}
+}
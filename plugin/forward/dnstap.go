@@ -13,24 +13,10 @@ import (
 	"github.com/miekg/dns"
 )
 
-// toDnstap will send the forward and received message to the dnstap plugin.
+// toDnstap will send the forward and received message to the dnstap plugin. host is the
+// host:port of the upstream, see proxy.DialAddr.
 func toDnstap(f *Forward, host string, state request.Request, opts proxy.Options, reply *dns.Msg, start time.Time) {
-	h, p, _ := net.SplitHostPort(host)      // this is preparsed and can't err here
-	port, _ := strconv.ParseUint(p, 10, 32) // same here
-	ip := net.ParseIP(h)
-
-	var ta net.Addr = &net.UDPAddr{IP: ip, Port: int(port)}
-	t := state.Proto()
-	switch {
-	case opts.ForceTCP:
-		t = "tcp"
-	case opts.PreferUDP:
-		t = "udp"
-	}
-
-	if t == "tcp" {
-		ta = &net.TCPAddr{IP: ip, Port: int(port)}
-	}
+	ta := tapAddr(host, state, opts)
 
 	for _, t := range f.tapPlugins {
 		// Query
@@ -63,3 +49,23 @@ func toDnstap(f *Forward, host string, state request.Request, opts proxy.Options
 		}
 	}
 }
+
+// tapAddr returns the address of the upstream at host, with the protocol used to reach it.
+func tapAddr(host string, state request.Request, opts proxy.Options) net.Addr {
+	h, p, _ := net.SplitHostPort(host)      // this is preparsed and can't err here
+	port, _ := strconv.ParseUint(p, 10, 32) // same here
+	ip := net.ParseIP(h)
+
+	t := state.Proto()
+	switch {
+	case opts.ForceTCP:
+		t = "tcp"
+	case opts.PreferUDP:
+		t = "udp"
+	}
+
+	if t == "tcp" {
+		return &net.TCPAddr{IP: ip, Port: int(port)}
+	}
+	return &net.UDPAddr{IP: ip, Port: int(port)}
+}
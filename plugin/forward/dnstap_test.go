@@ -0,0 +1,45 @@
+package forward
+
+import (
+	"testing"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func TestTapAddr(t *testing.T) {
+	tests := []struct {
+		input   string
+		network string
+		addr    string
+	}{
+		{"forward . 127.0.0.1", "udp", "127.0.0.1:53"},
+		{"forward . 127.0.0.1:5353 {\nforce_tcp\n}\n", "tcp", "127.0.0.1:5353"},
+		// DoH upstreams are configured with their URL.
+		{"forward . https://127.0.0.1", "udp", "127.0.0.1:443"},
+		{"forward . https://127.0.0.1:8443/resolve", "udp", "127.0.0.1:8443"},
+		{"forward . https://[::1]/dns-query {\nforce_tcp\n}\n", "tcp", "[::1]:443"},
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	state := request.Request{Req: m, W: &test.ResponseWriter{}}
+
+	for i, tc := range tests {
+		fs, err := parseForward(caddy.NewTestController("dns", tc.input))
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		f := fs[0]
+		ta := tapAddr(f.proxies[0].DialAddr(), state, f.opts)
+		if ta.Network() != tc.network {
+			t.Errorf("Test %d: expected network %s, got %s", i, tc.network, ta.Network())
+		}
+		if ta.String() != tc.addr {
+			t.Errorf("Test %d: expected address %s, got %s", i, tc.addr, ta.String())
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"net/http"
 	"sync/atomic"
 	"time"
 
@@ -15,8 +16,10 @@ import (
 	"github.com/coredns/coredns/plugin/debug"
 	"github.com/coredns/coredns/plugin/dnstap"
 	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/plugin/pkg/proxy"
+	"github.com/coredns/coredns/plugin/pkg/validator"
 	"github.com/coredns/coredns/request"
 
 	"github.com/miekg/dns"
@@ -42,12 +45,19 @@ type Forward struct {
 
 	from    string
 	ignored []string
+	routes  *routes // routes to the named upstream groups, nil when there are none
 
 	tlsConfig     *tls.Config
 	tlsServerName string
+	dohMethod     string
 	maxfails      uint32
 	expire        time.Duration
 	maxConcurrent int64
+	hedge         int            // number of upstreams a query is sent to in parallel
+	hedgeDelay    time.Duration  // delay before the query is sent to the next upstream, when hedging
+	breaker       *proxy.Breaker // circuit breaker settings for the upstreams, nil when there are none
+	budget        *budget        // limits the retries to other upstreams, nil when there is no limit
+	cookies       bool           // whether DNS Cookies are sent to the upstreams
 
 	opts proxy.Options // also here for testing
 
@@ -57,12 +67,14 @@ type Forward struct {
 
 	tapPlugins []*dnstap.Dnstap // when dnstap plugins are loaded, we use to this to send messages out.
 
+	validator *validator.Validator // validates responses when DNSSEC validation is enabled
+
 	Next plugin.Handler
 }
 
 // New returns a new Forward.
 func New() *Forward {
-	f := &Forward{maxfails: 2, tlsConfig: new(tls.Config), expire: defaultExpire, p: new(random), from: ".", hcInterval: hcInterval, opts: proxy.Options{ForceTCP: false, PreferUDP: false, HCRecursionDesired: true, HCDomain: "."}}
+	f := &Forward{maxfails: 2, tlsConfig: new(tls.Config), dohMethod: http.MethodPost, expire: defaultExpire, p: new(random), from: ".", hcInterval: hcInterval, opts: proxy.Options{ForceTCP: false, PreferUDP: false, HCRecursionDesired: true, HCDomain: "."}}
 	return f
 }
 
@@ -75,6 +87,11 @@ func (f *Forward) SetProxy(p *proxy.Proxy) {
 // SetTapPlugin appends one or more dnstap plugins to the tap plugin list.
 func (f *Forward) SetTapPlugin(tapPlugin *dnstap.Dnstap) {
 	f.tapPlugins = append(f.tapPlugins, tapPlugin)
+	if f.routes != nil {
+		for _, g := range f.routes.groups {
+			g.tapPlugins = append(g.tapPlugins, tapPlugin)
+		}
+	}
 	if nextPlugin, ok := tapPlugin.Next.(*dnstap.Dnstap); ok {
 		f.SetTapPlugin(nextPlugin)
 	}
@@ -101,15 +118,34 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 			return dns.RcodeRefused, f.ErrLimitExceeded
 		}
 	}
+	if f.budget != nil {
+		f.budget.query()
+	}
+
+	// When validating, the upstream is asked for the signatures, but not to check them itself.
+	validate := f.validator != nil && !r.CheckingDisabled
+	if validate {
+		state = request.Request{W: w, Req: dnssecRequest(r)}
+	}
 
-	fails := 0
+	fails, attempts := 0, 0
 	var span, child ot.Span
 	var upstreamErr error
 	span = ot.SpanFromContext(ctx)
 	i := 0
-	list := f.List()
+	u := f.upstream(state.Name())
+	list := u.List()
 	deadline := time.Now().Add(defaultTimeout)
 	start := time.Now()
+
+	if u.hedge > 1 {
+		ret, err := u.hedged(ctx, state, list, validate, start)
+		if err != nil {
+			return dns.RcodeServerFailure, edns.NewExtendedError(err, dns.ExtendedErrorCodeNetworkError, "")
+		}
+		return f.reply(ctx, w, r, state, ret, validate)
+	}
+
 	for time.Now().Before(deadline) {
 		if i >= len(list) {
 			// reached the end of list, reset to begin
@@ -119,18 +155,21 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 
 		proxy := list[i]
 		i++
-		if proxy.Down(f.maxfails) {
+		if proxy.Down(u.maxfails) {
 			fails++
-			if fails < len(f.proxies) {
+			if fails < len(u.proxies) {
 				continue
 			}
-			// All upstream proxies are dead, assume healthcheck is completely broken and randomly
-			// select an upstream to connect to.
-			r := new(random)
-			proxy = r.List(f.proxies)[0]
+			proxy = u.fallback()
+			if proxy == nil {
+				break
+			}
+		}
 
-			healthcheckBrokenCount.Add(1)
+		if attempts > 0 && u.budget != nil && !u.budget.retry() {
+			break
 		}
+		attempts++
 
 		if span != nil {
 			child = span.Tracer().StartSpan("connect", ot.ChildOf(span.Context()))
@@ -142,67 +181,91 @@ func (f *Forward) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 			return proxy.Addr()
 		})
 
-		var (
-			ret *dns.Msg
-			err error
-		)
-		opts := f.opts
-
-		for {
-			ret, err = proxy.Connect(ctx, state, opts)
-
-			if err == ErrCachedClosed { // Remote side closed conn, can only happen with TCP.
-				continue
-			}
-			// Retry with TCP if truncated and prefer_udp configured.
-			if ret != nil && ret.Truncated && !opts.ForceTCP && opts.PreferUDP {
-				opts.ForceTCP = true
-				continue
-			}
-			break
-		}
+		ret, opts, err := u.connect(ctx, proxy, state, validate)
 
 		if child != nil {
 			child.Finish()
 		}
 
 		if len(f.tapPlugins) != 0 {
-			toDnstap(f, proxy.Addr(), state, opts, ret, start)
+			toDnstap(f, proxy.DialAddr(), state, opts, ret, start)
 		}
 
 		upstreamErr = err
 
 		if err != nil {
 			// Kick off health check to see if *our* upstream is broken.
-			if f.maxfails != 0 {
+			if u.maxfails != 0 {
 				proxy.Healthcheck()
 			}
 
-			if fails < len(f.proxies) {
+			if fails < len(u.proxies) {
 				continue
 			}
 			break
 		}
 
-		// Check if the reply is correct; if not return FormErr.
-		if !state.Match(ret) {
-			debug.Hexdumpf(ret, "Wrong reply for id: %d, %s %d", ret.Id, state.QName(), state.QType())
+		return f.reply(ctx, w, r, state, ret, validate)
+	}
+
+	if upstreamErr != nil {
+		return dns.RcodeServerFailure, edns.NewExtendedError(upstreamErr, dns.ExtendedErrorCodeNetworkError, "")
+	}
 
-			formerr := new(dns.Msg)
-			formerr.SetRcode(state.Req, dns.RcodeFormatError)
-			w.WriteMsg(formerr)
-			return 0, nil
+	return dns.RcodeServerFailure, edns.NewExtendedError(ErrNoHealthy, dns.ExtendedErrorCodeNoReachableAuthority, "")
+}
+
+// fallback returns a random upstream for when all of them are down, assuming the health checking is
+// completely broken. Upstreams with a tripped circuit breaker are left out, when that leaves none it
+// returns nil.
+func (f *Forward) fallback() *proxy.Proxy {
+	healthcheckBrokenCount.Add(1)
+	for _, p := range new(random).List(f.proxies) {
+		if !p.Tripped() {
+			return p
 		}
+	}
+	return nil
+}
+
+// connect sends the query in state to p. It retries when a cached connection was closed, and over TCP
+// when a truncated response can't be used.
+func (f *Forward) connect(ctx context.Context, p *proxy.Proxy, state request.Request, validate bool) (*dns.Msg, proxy.Options, error) {
+	opts := f.opts
+	for {
+		ret, err := p.Connect(ctx, state, opts)
 
-		w.WriteMsg(ret)
+		if err == ErrCachedClosed { // Remote side closed conn, can only happen with TCP.
+			continue
+		}
+		// Retry with TCP if truncated and prefer_udp configured, or a complete response is needed for validation.
+		if ret != nil && ret.Truncated && !opts.ForceTCP && (opts.PreferUDP || validate) {
+			opts.ForceTCP = true
+			continue
+		}
+		return ret, opts, err
+	}
+}
+
+// reply writes the upstream's reply ret to w, after checking it belongs to the query and validating it
+// when asked to.
+func (f *Forward) reply(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, state request.Request, ret *dns.Msg, validate bool) (int, error) {
+	// Check if the reply is correct; if not return FormErr.
+	if !state.Match(ret) {
+		debug.Hexdumpf(ret, "Wrong reply for id: %d, %s %d", ret.Id, state.QName(), state.QType())
+
+		formerr := new(dns.Msg)
+		formerr.SetRcode(state.Req, dns.RcodeFormatError)
+		w.WriteMsg(formerr)
 		return 0, nil
 	}
 
-	if upstreamErr != nil {
-		return dns.RcodeServerFailure, upstreamErr
+	if validate {
+		return f.validate(ctx, w, r, ret)
 	}
 
-	return dns.RcodeServerFailure, ErrNoHealthy
+	w.WriteMsg(ret)
+	return 0, nil
 }
 
 func (f *Forward) match(state request.Request) bool {
@@ -1,15 +1,22 @@
 package forward
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/caddy/caddyfile"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin/dnstap"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/pkg/proxy"
 	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
 )
 
 func TestList(t *testing.T) {
@@ -74,3 +81,50 @@ func TestSetTapPlugin(t *testing.T) {
 		t.Error("Unexpected order of dnstap plugins")
 	}
 }
+
+func TestCircuitBreakerTripped(t *testing.T) {
+	f := startForward(t, "forward . SILENT {\nmax_fails 0\ncircuit_breaker 1 min_queries 1 cooldown 1m\n}\n")
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := f.ServeDNS(context.TODO(), rec, m); err == nil {
+		t.Fatalf("Expected error from upstream that doesn't reply")
+	}
+	if s := f.proxies[0].State(); s != proxy.Open {
+		t.Fatalf("Expected open circuit, got %s", s)
+	}
+
+	// With the circuit open there is no upstream left to try, not even as a fallback.
+	if _, err := f.ServeDNS(context.TODO(), rec, m); !errors.Is(err, ErrNoHealthy) {
+		t.Errorf("Expected %s, got %v", ErrNoHealthy, err)
+	}
+}
+
+// startForward returns the started forward of config, it's shut down when the test ends. SILENT in
+// config is an upstream that never replies, queries to it time out after 10ms. defaultTimeout is set
+// to 5s for the test.
+func startForward(t *testing.T, config string) *Forward {
+	t.Helper()
+	timeout := defaultTimeout
+	defaultTimeout = 5 * time.Second
+	t.Cleanup(func() { defaultTimeout = timeout })
+
+	silent := dnstest.NewSilentServer()
+	t.Cleanup(silent.Close)
+
+	c := caddy.NewTestController("dns", strings.ReplaceAll(config, "SILENT", silent.Addr))
+	fs, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f := fs[0]
+	for _, p := range f.proxies {
+		if p.Addr() == silent.Addr {
+			p.SetReadTimeout(10 * time.Millisecond)
+		}
+	}
+	f.OnStartup()
+	t.Cleanup(func() { f.OnShutdown() })
+	return f
+}
@@ -0,0 +1,184 @@
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/miekg/dns"
+)
+
+// routes maps domains to the named upstream groups queries for them are forwarded to. The routes
+// come from the Corefile and from a route file that is reloaded when it changes.
+type routes struct {
+	sync.RWMutex
+
+	groups map[string]*Forward // the upstream groups by name
+	from   string              // the zone of the forward, routes must be for domains in it
+
+	inline map[string]string // domain to group name, from the Corefile
+	file   map[string]string // domain to group name, from the route file
+
+	// path to the route file and how often it is checked for changes
+	path   string
+	reload time.Duration
+	stop   chan bool
+
+	// mtime and size are only read and modified by a single goroutine, size is -1 when the route
+	// file couldn't be read
+	mtime time.Time
+	size  int64
+}
+
+func newRoutes(from string) *routes {
+	return &routes{groups: make(map[string]*Forward), from: from, inline: make(map[string]string), reload: defaultReload, size: -1}
+}
+
+// match returns the group for name, the one with the longest matching domain wins. Routes from the
+// Corefile take precedence over the ones in the route file. It returns nil if no route matches.
+func (r *routes) match(name string) *Forward {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, i := range dns.Split(name) {
+		if g := r.get(name[i:]); g != nil {
+			return g
+		}
+	}
+	return r.get(".")
+}
+
+func (r *routes) get(domain string) *Forward {
+	if group, ok := r.inline[domain]; ok {
+		return r.groups[group]
+	}
+	if group, ok := r.file[domain]; ok {
+		return r.groups[group]
+	}
+	return nil
+}
+
+// readRoutes reads the route file when its size or modification time has changed.
+func (r *routes) readRoutes() {
+	if r.path == "" {
+		return
+	}
+	file, err := os.Open(r.path)
+	if err != nil {
+		// We already log a warning if the file can't be opened on setup, only warn when its routes go.
+		if r.size != -1 {
+			log.Warningf("Failed to open route file %s, its routes are removed: %s", r.path, err)
+		}
+		r.Lock()
+		r.file = nil
+		r.mtime, r.size = time.Time{}, -1
+		r.Unlock()
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return
+	}
+	if r.mtime.Equal(stat.ModTime()) && r.size == stat.Size() {
+		return
+	}
+
+	routes := r.parse(file)
+	log.Debugf("Parsed route file into %d routes", len(routes))
+
+	r.Lock()
+	r.file = routes
+	r.mtime = stat.ModTime()
+	r.size = stat.Size()
+	r.Unlock()
+}
+
+// parse reads routes from rd. Each line has a domain and the name of its group, # starts a comment.
+// Lines that don't parse, name an unknown group or have a domain outside r.from are skipped.
+func (r *routes) parse(rd io.Reader) map[string]string {
+	routes := make(map[string]string)
+
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if i := bytes.Index(line, []byte{'#'}); i >= 0 {
+			// Discard comments.
+			line = line[0:i]
+		}
+		f := bytes.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) != 2 {
+			log.Warningf("Skipping malformed line in route file %s: %q", r.path, line)
+			continue
+		}
+		domain, group := string(f[0]), string(f[1])
+		if _, ok := dns.IsDomainName(domain); !ok {
+			log.Warningf("Skipping invalid domain in route file %s: %s", r.path, domain)
+			continue
+		}
+		if _, ok := r.groups[group]; !ok {
+			log.Warningf("Skipping route to unknown group in route file %s: %s", r.path, group)
+			continue
+		}
+		domain = plugin.Name(domain).Normalize()
+		if !plugin.Name(r.from).Matches(domain) {
+			log.Warningf("Skipping route for %s in route file %s, it is not in %s", domain, r.path, r.from)
+			continue
+		}
+		routes[domain] = group
+	}
+	return routes
+}
+
+// start reads the route file and checks it for changes every r.reload.
+func (r *routes) start() {
+	r.readRoutes()
+	if r.path == "" || r.reload == 0 {
+		return
+	}
+
+	stop := make(chan bool)
+	r.stop = stop
+	go func() {
+		ticker := time.NewTicker(r.reload)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				r.readRoutes()
+			}
+		}
+	}()
+}
+
+func (r *routes) shutdown() {
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// upstream returns the forwarder that has the upstreams for name. That is the group name is routed
+// to, or f itself.
+func (f *Forward) upstream(name string) *Forward {
+	if f.routes == nil {
+		return f
+	}
+	if g := f.routes.match(name); g != nil {
+		return g
+	}
+	return f
+}
+
+const defaultReload = 5 * time.Second
@@ -0,0 +1,176 @@
+package forward
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestRoutesMatch(t *testing.T) {
+	corp, lab := New(), New()
+	r := newRoutes(".")
+	r.groups = map[string]*Forward{"corp": corp, "lab": lab}
+	r.inline = map[string]string{"example.corp.": "corp", "lab.example.corp.": "lab"}
+	r.file = map[string]string{"example.lab.": "lab", "example.corp.": "lab", "gone.example.": "gone"}
+
+	tests := []struct {
+		name     string
+		expected *Forward
+	}{
+		{"example.corp.", corp},
+		{"www.example.corp.", corp},
+		{"lab.example.corp.", lab},
+		{"www.lab.example.corp.", lab},
+		{"example.lab.", lab},
+		{"corp.", nil},
+		{"example.org.", nil},
+		{"gone.example.", nil},
+		{".", nil},
+	}
+	for i, tc := range tests {
+		if g := r.match(tc.name); g != tc.expected {
+			t.Errorf("Test %d: expected %p for %s, got %p", i, tc.expected, tc.name, g)
+		}
+	}
+}
+
+func TestRoutesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`# split horizon
+example.corp corp
+EXAMPLE.lab. lab # case doesn't matter
+example.net lab extra
+example.org unknown
+`)
+
+	corp, lab := New(), New()
+	r := newRoutes(".")
+	r.groups = map[string]*Forward{"corp": corp, "lab": lab}
+	r.path = path
+	r.reload = 10 * time.Millisecond
+	r.start()
+	defer r.shutdown()
+
+	if g := r.match("www.example.corp."); g != corp {
+		t.Errorf("Expected www.example.corp. to be routed to corp")
+	}
+	if g := r.match("example.lab."); g != lab {
+		t.Errorf("Expected example.lab. to be routed to lab")
+	}
+	for _, name := range []string{"example.net.", "example.org."} {
+		if g := r.match(name); g != nil {
+			t.Errorf("Expected %s not to be routed", name)
+		}
+	}
+
+	write("example.corp lab\n")
+	for i := 0; i < 100 && r.match("example.corp.") != lab; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if g := r.match("example.corp."); g != lab {
+		t.Errorf("Expected example.corp. to be routed to lab after reload")
+	}
+	if g := r.match("example.lab."); g != nil {
+		t.Errorf("Expected example.lab. not to be routed after reload")
+	}
+
+	// The routes go when the file is removed.
+	os.Remove(path)
+	for i := 0; i < 100 && r.match("example.corp.") != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if g := r.match("example.corp."); g != nil {
+		t.Errorf("Expected example.corp. not to be routed after the route file is removed")
+	}
+}
+
+func TestRoutesFileFrom(t *testing.T) {
+	r := newRoutes("corp.")
+	r.groups = map[string]*Forward{"corp": New()}
+	routes := r.parse(strings.NewReader("example.corp corp\nexample.lab corp\n"))
+	if len(routes) != 1 || routes["example.corp."] != "corp" {
+		t.Errorf("Expected only the route for example.corp., got %v", routes)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	// dnstest servers share one handler, it answers with the IP address it knows the server by.
+	var upstreams sync.Map
+	handler := func(w dns.ResponseWriter, r *dns.Msg) {
+		ip, _ := upstreams.Load(w.LocalAddr().String())
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.Answer = append(ret.Answer, test.A(r.Question[0].Name+" IN A "+ip.(string)))
+		w.WriteMsg(ret)
+	}
+	server := func(ip string) string {
+		s := dnstest.NewServer(handler)
+		t.Cleanup(s.Close)
+		upstreams.Store(s.Addr, ip)
+		return s.Addr
+	}
+	def := server("127.0.0.1")
+	corp := server("127.0.0.2")
+	lab := server("127.0.0.3")
+
+	path := filepath.Join(t.TempDir(), "routes")
+	if err := os.WriteFile(path, []byte("example.lab lab\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := caddy.NewTestController("dns", "forward . "+def+` {
+		group corp `+corp+` {
+			policy sequential
+		}
+		group lab `+lab+`
+		route corp example.corp
+		route_file `+path+`
+	}`)
+	fs, err := parseForward(c)
+	if err != nil {
+		t.Fatalf("Failed to create forwarder: %s", err)
+	}
+	f := fs[0]
+	f.OnStartup()
+	defer f.OnShutdown()
+
+	if _, ok := f.routes.groups["corp"].p.(*sequential); !ok {
+		t.Errorf("Expected sequential policy for group corp, got %T", f.routes.groups["corp"].p)
+	}
+
+	tests := []struct {
+		qname    string
+		expected string
+	}{
+		{"www.example.corp.", "127.0.0.2"},
+		{"www.example.lab.", "127.0.0.3"},
+		{"www.example.org.", "127.0.0.1"},
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+		if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected to receive reply, got %s", i, err)
+		}
+		if len(rec.Msg.Answer) != 1 || !strings.HasSuffix(rec.Msg.Answer[0].String(), tc.expected) {
+			t.Errorf("Test %d: expected answer from %s, got %v", i, tc.expected, rec.Msg.Answer)
+		}
+	}
+}
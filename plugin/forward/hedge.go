@@ -0,0 +1,127 @@
+package forward
+
+import (
+	"context"
+	"time"
+
+	"github.com/coredns/coredns/plugin/metadata"
+	"github.com/coredns/coredns/plugin/pkg/proxy"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+	ot "github.com/opentracing/opentracing-go"
+	otext "github.com/opentracing/opentracing-go/ext"
+)
+
+// result is the outcome of a query to one upstream.
+type result struct {
+	proxy *proxy.Proxy
+	ret   *dns.Msg
+	err   error
+}
+
+// hedged sends the query in state to the healthy upstreams in list, f.hedge of them at a time. The next
+// one is started every f.hedgeDelay, or as soon as one fails. The first good reply is returned and the
+// queries still in flight are cancelled. Replies with SERVFAIL or REFUSED aren't good, but the last of
+// those is returned if no upstream does better.
+func (f *Forward) hedged(ctx context.Context, state request.Request, list []*proxy.Proxy, validate bool, start time.Time) (*dns.Msg, error) {
+	healthy := make([]*proxy.Proxy, 0, len(list))
+	for _, p := range list {
+		if !p.Down(f.maxfails) {
+			healthy = append(healthy, p)
+		}
+	}
+	if len(healthy) == 0 {
+		p := f.fallback()
+		if p == nil {
+			return nil, ErrNoHealthy
+		}
+		healthy = append(healthy, p)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	results := make(chan result, len(healthy))
+	span := ot.SpanFromContext(ctx)
+	next, inflight := 0, 0
+	launch := func() {
+		p := healthy[next]
+		next++
+		inflight++
+		// Every query gets its own copy, the proxy changes the message ID.
+		st := request.Request{W: state.W, Req: state.Req.Copy()}
+		go func() {
+			pctx := ctx
+			var child ot.Span
+			if span != nil {
+				child = span.Tracer().StartSpan("connect", ot.ChildOf(span.Context()))
+				otext.PeerAddress.Set(child, p.Addr())
+				pctx = ot.ContextWithSpan(ctx, child)
+			}
+			ret, opts, err := f.connect(pctx, p, st, validate)
+			if child != nil {
+				child.Finish()
+			}
+			if len(f.tapPlugins) != 0 && ctx.Err() == nil {
+				toDnstap(f, p.DialAddr(), st, opts, ret, start)
+			}
+			results <- result{proxy: p, ret: ret, err: err}
+		}()
+	}
+
+	launch()
+	for f.hedgeDelay == 0 && next < len(healthy) && inflight < f.hedge {
+		launch()
+	}
+	var tick <-chan time.Time
+	if f.hedgeDelay > 0 {
+		ticker := time.NewTicker(f.hedgeDelay)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var (
+		fallback *dns.Msg
+		err      error
+	)
+wait:
+	for inflight > 0 {
+		select {
+		case <-tick:
+			if next < len(healthy) && inflight < f.hedge {
+				launch()
+			}
+		case <-ctx.Done():
+			err = ctx.Err()
+			break wait
+		case res := <-results:
+			inflight--
+			switch {
+			case res.err != nil:
+				err = res.err
+				// Kick off health check to see if *our* upstream is broken.
+				if f.maxfails != 0 {
+					res.proxy.Healthcheck()
+				}
+			case !state.Match(res.ret) || res.ret.Rcode == dns.RcodeServerFailure || res.ret.Rcode == dns.RcodeRefused:
+				fallback = res.ret
+			default:
+				hedgeWinCount.WithLabelValues(res.proxy.Addr()).Add(1)
+				metadata.SetValueFunc(ctx, "forward/upstream", func() string {
+					return res.proxy.Addr()
+				})
+				return res.ret, nil
+			}
+			// Replace the failed query, as long as the retry budget allows.
+			if next < len(healthy) && (f.budget == nil || f.budget.retry()) {
+				launch()
+			}
+		}
+	}
+
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, err
+}
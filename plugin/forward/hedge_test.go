@@ -0,0 +1,85 @@
+package forward
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+type upstream struct {
+	delay time.Duration
+	rcode int
+}
+
+func TestHedge(t *testing.T) {
+	defaultTimeout = 5 * time.Second
+
+	// dnstest servers share one handler, it looks up how to reply by the address the query came in on.
+	var upstreams sync.Map
+	handler := func(w dns.ResponseWriter, r *dns.Msg) {
+		u, _ := upstreams.Load(w.LocalAddr().String())
+		time.Sleep(u.(upstream).delay)
+		ret := new(dns.Msg)
+		ret.SetRcode(r, u.(upstream).rcode)
+		if ret.Rcode == dns.RcodeSuccess {
+			ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.1"))
+		}
+		w.WriteMsg(ret)
+	}
+	server := func(u upstream) string {
+		s := dnstest.NewServer(handler)
+		t.Cleanup(s.Close)
+		upstreams.Store(s.Addr, u)
+		return s.Addr
+	}
+	slow := server(upstream{500 * time.Millisecond, dns.RcodeSuccess})
+	fast := server(upstream{0, dns.RcodeSuccess})
+	servfail := server(upstream{0, dns.RcodeServerFailure})
+
+	tests := []struct {
+		hedge string
+		to    string
+		rcode int
+	}{
+		{"hedge 2", slow + " " + fast, dns.RcodeSuccess},
+		{"hedge 2 50ms", slow + " " + fast, dns.RcodeSuccess},
+		// A bad reply starts the query to the next upstream straight away.
+		{"hedge 2 1s", servfail + " " + fast, dns.RcodeSuccess},
+		// Only bad replies, the last one is returned.
+		{"hedge 2", servfail, dns.RcodeServerFailure},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", "forward . "+tc.to+" {\npolicy sequential\n"+tc.hedge+"\n}\n")
+		fs, err := parseForward(c)
+		if err != nil {
+			t.Fatalf("Test %d: failed to create forwarder: %s", i, err)
+		}
+		f := fs[0]
+		f.OnStartup()
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+
+		start := time.Now()
+		if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Errorf("Test %d: expected to receive reply, got %s", i, err)
+		}
+		// The slow upstream would take 500ms.
+		if x := time.Since(start); x > 250*time.Millisecond {
+			t.Errorf("Test %d: expected reply within 250ms, took %s", i, x)
+		}
+		if rec.Msg == nil || rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %v", i, dns.RcodeToString[tc.rcode], rec.Msg)
+		}
+		f.OnShutdown()
+	}
+}
@@ -22,4 +22,25 @@ var (
 		Name:      "max_concurrent_rejects_total",
 		Help:      "Counter of the number of queries rejected because the concurrent queries were at maximum.",
 	})
+
+	validationCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "dnssec_validations_total",
+		Help:      "Counter of DNSSEC validated responses per result.",
+	}, []string{"result"})
+
+	hedgeWinCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "hedge_wins_total",
+		Help:      "Counter of hedged queries per upstream that returned the first good reply.",
+	}, []string{"to"})
+
+	retryBudgetExhaustedCount = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "forward",
+		Name:      "retry_budget_exhausted_total",
+		Help:      "Counter of the number of retries to other upstreams that were not made because the retry budget was used up.",
+	})
 )
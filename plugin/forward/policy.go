@@ -1,6 +1,7 @@
 package forward
 
 import (
+	"sort"
 	"sync/atomic"
 	"time"
 
@@ -66,4 +67,36 @@ func (r *sequential) List(p []*proxy.Proxy) []*proxy.Proxy {
 	return p
 }
 
+// fastest is a policy that orders hosts by their expected latency: the moving average of their round
+// trip time, plus failPenalty for the fraction of queries that fail. One in exploreRate lists is
+// random, so the hosts that aren't picked keep being measured.
+type fastest struct{}
+
+func (r *fastest) String() string { return "fastest" }
+
+func (r *fastest) List(p []*proxy.Proxy) []*proxy.Proxy {
+	if len(p) == 1 {
+		return p
+	}
+	if rn.Int()%exploreRate == 0 {
+		return (&random{}).List(p)
+	}
+
+	fast := make([]*proxy.Proxy, len(p))
+	copy(fast, p)
+	score := make(map[*proxy.Proxy]time.Duration, len(p))
+	for _, x := range p {
+		score[x] = x.RTT() + time.Duration(x.ErrorRate()*float64(failPenalty))
+	}
+	sort.SliceStable(fast, func(i, j int) bool { return score[fast[i]] < score[fast[j]] })
+	return fast
+}
+
+const (
+	// exploreRate is how often, one in exploreRate, the fastest policy returns a random list.
+	exploreRate = 20
+	// failPenalty is what a failed query costs, the time it takes to try the next host.
+	failPenalty = 2 * time.Second
+)
+
 var rn = rand.New(time.Now().UnixNano())
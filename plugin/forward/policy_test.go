@@ -0,0 +1,62 @@
+package forward
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/proxy"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func TestFastest(t *testing.T) {
+	// dnstest servers share one handler, the query name tells it to be slow.
+	handler := func(w dns.ResponseWriter, r *dns.Msg) {
+		if r.Question[0].Name == "slow.example.org." {
+			time.Sleep(50 * time.Millisecond)
+		}
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		w.WriteMsg(ret)
+	}
+	slow := dnstest.NewServer(handler)
+	defer slow.Close()
+	fast := dnstest.NewServer(handler)
+	defer fast.Close()
+
+	p := []*proxy.Proxy{
+		proxy.NewProxy("TestFastest", slow.Addr, transport.DNS),
+		proxy.NewProxy("TestFastest", fast.Addr, transport.DNS),
+	}
+	for _, x := range p {
+		x.Start(5 * time.Second)
+		defer x.Stop()
+
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		if x.Addr() == slow.Addr {
+			m.SetQuestion("slow.example.org.", dns.TypeA)
+		}
+		state := request.Request{Req: m, W: &test.ResponseWriter{}}
+		if _, err := x.Connect(context.Background(), state, proxy.Options{}); err != nil {
+			t.Fatalf("Failed to connect to %s: %s", x.Addr(), err)
+		}
+	}
+
+	f := &fastest{}
+	first := 0
+	for i := 0; i < 100; i++ {
+		if f.List(p)[0].Addr() == fast.Addr {
+			first++
+		}
+	}
+	// Exploration puts the slow one first, at most half of the time in one in exploreRate lists.
+	if first < 80 {
+		t.Errorf("Expected the fast upstream to be first in most lists, got %d out of 100", first)
+	}
+}
@@ -2,10 +2,12 @@ package forward
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/test"
 
 	"github.com/miekg/dns"
@@ -64,7 +66,12 @@ func TestProxyTLSFail(t *testing.T) {
 	m.SetQuestion("example.org.", dns.TypeA)
 	rec := dnstest.NewRecorder(&test.ResponseWriter{})
 
-	if _, err := f.ServeDNS(context.TODO(), rec, m); err == nil {
+	_, err = f.ServeDNS(context.TODO(), rec, m)
+	if err == nil {
 		t.Fatal("Expected *not* to receive reply, but got one")
 	}
+	var ede *edns.ExtendedError
+	if !errors.As(err, &ede) || ede.Code != dns.ExtendedErrorCodeNetworkError {
+		t.Errorf("Expected error to carry extended error Network Error, got %v", err)
+	}
 }
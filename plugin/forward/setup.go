@@ -4,17 +4,24 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/dnstap"
+	"github.com/coredns/coredns/plugin/pkg/doh"
 	"github.com/coredns/coredns/plugin/pkg/parse"
 	"github.com/coredns/coredns/plugin/pkg/proxy"
 	pkgtls "github.com/coredns/coredns/plugin/pkg/tls"
 	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/pkg/validator"
 
 	"github.com/miekg/dns"
 )
@@ -33,6 +40,13 @@ func setup(c *caddy.Controller) error {
 		if f.Len() > max {
 			return plugin.Error("forward", fmt.Errorf("more than %d TOs configured: %d", max, f.Len()))
 		}
+		if f.routes != nil {
+			for name, g := range f.routes.groups {
+				if g.Len() > max {
+					return plugin.Error("forward", fmt.Errorf("more than %d TOs configured in group %s: %d", max, name, g.Len()))
+				}
+			}
+		}
 
 		if i == len(fs)-1 {
 			// last forward: point next to next plugin
@@ -72,6 +86,12 @@ func (f *Forward) OnStartup() (err error) {
 	for _, p := range f.proxies {
 		p.Start(f.hcInterval)
 	}
+	if f.routes != nil {
+		for _, g := range f.routes.groups {
+			g.OnStartup()
+		}
+		f.routes.start()
+	}
 	return nil
 }
 
@@ -80,6 +100,12 @@ func (f *Forward) OnShutdown() error {
 	for _, p := range f.proxies {
 		p.Stop()
 	}
+	if f.routes != nil {
+		for _, g := range f.routes.groups {
+			g.OnShutdown()
+		}
+		f.routes.shutdown()
+	}
 	return nil
 }
 
@@ -117,30 +143,64 @@ func parseStanza(c *caddy.Controller) (*Forward, error) {
 		return f, c.ArgErr()
 	}
 
-	toHosts, err := parse.HostPortOrFile(to...)
+	transports, err := f.addProxies(to)
 	if err != nil {
 		return f, err
 	}
 
+	for c.NextBlock() {
+		if err := parseBlock(c, f); err != nil {
+			return f, err
+		}
+	}
+
+	if f.routes != nil {
+		for domain, group := range f.routes.inline {
+			if _, ok := f.routes.groups[group]; !ok {
+				return f, fmt.Errorf("route for %s to unknown group: %s", domain, group)
+			}
+		}
+		// The retry budget is shared with the groups.
+		for _, g := range f.routes.groups {
+			g.budget = f.budget
+		}
+	}
+
+	if err := f.setupProxies(transports); err != nil {
+		return f, err
+	}
+
+	return f, nil
+}
+
+// addProxies adds a proxy for each of the TO addresses to f and returns their transports.
+func (f *Forward) addProxies(to []string) ([]string, error) {
+	toHosts, err := parseTo(to)
+	if err != nil {
+		return nil, err
+	}
+
 	transports := make([]string, len(toHosts))
-	allowedTrans := map[string]bool{"dns": true, "tls": true}
+	allowedTrans := map[string]bool{"dns": true, "tls": true, "quic": true, "https": true}
 	for i, host := range toHosts {
 		trans, h := parse.Transport(host)
 
 		if !allowedTrans[trans] {
-			return f, fmt.Errorf("'%s' is not supported as a destination protocol in forward: %s", trans, host)
+			return nil, fmt.Errorf("'%s' is not supported as a destination protocol in forward: %s", trans, host)
+		}
+		// DoH upstreams are addressed by their full URL.
+		if trans == transport.HTTPS {
+			h = host
 		}
 		p := proxy.NewProxy("forward", h, trans)
 		f.proxies = append(f.proxies, p)
 		transports[i] = trans
 	}
+	return transports, nil
+}
 
-	for c.NextBlock() {
-		if err := parseBlock(c, f); err != nil {
-			return f, err
-		}
-	}
-
+// setupProxies applies the TLS, expire, health check and cookie settings of f to its proxies.
+func (f *Forward) setupProxies(transports []string) error {
 	if f.tlsServerName != "" {
 		f.tlsConfig.ServerName = f.tlsServerName
 	}
@@ -151,19 +211,74 @@ func parseStanza(c *caddy.Controller) (*Forward, error) {
 
 	for i := range f.proxies {
 		// Only set this for proxies that need it.
-		if transports[i] == transport.TLS {
+		if transports[i] == transport.TLS || transports[i] == transport.QUIC || transports[i] == transport.HTTPS {
 			f.proxies[i].SetTLSConfig(f.tlsConfig)
 		}
+		if transports[i] == transport.HTTPS {
+			f.proxies[i].SetDoHMethod(f.dohMethod)
+		}
 		f.proxies[i].SetExpire(f.expire)
 		f.proxies[i].GetHealthchecker().SetRecursionDesired(f.opts.HCRecursionDesired)
 		// when TLS is used, checks are set to tcp-tls
-		if f.opts.ForceTCP && transports[i] != transport.TLS {
+		if f.opts.ForceTCP && transports[i] == transport.DNS {
 			f.proxies[i].GetHealthchecker().SetTCPTransport()
 		}
 		f.proxies[i].GetHealthchecker().SetDomain(f.opts.HCDomain)
+		if f.breaker != nil {
+			f.proxies[i].SetBreaker(*f.breaker)
+		}
+		if f.cookies {
+			if err := f.proxies[i].SetCookies(); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
+}
 
-	return f, nil
+// parseTo parses the TO addresses of a forward stanza. DoH upstreams are given as a URL and are
+// handled here, everything else is handled by parse.HostPortOrFile.
+func parseTo(to []string) ([]string, error) {
+	var hosts []string
+	for _, h := range to {
+		if strings.HasPrefix(h, transport.HTTPS+"://") {
+			u, err := parseDoHURL(h)
+			if err != nil {
+				return nil, err
+			}
+			hosts = append(hosts, u)
+			continue
+		}
+
+		hs, err := parse.HostPortOrFile(h)
+		if err != nil && err != parse.ErrNoNameservers {
+			return nil, err
+		}
+		hosts = append(hosts, hs...)
+	}
+	if len(hosts) == 0 {
+		return nil, parse.ErrNoNameservers
+	}
+	return hosts, nil
+}
+
+// parseDoHURL checks s is a valid DoH URL and returns it. When s has no path the default
+// /dns-query path is added.
+func parseDoHURL(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid DoH URL %q: %s", s, err)
+	}
+	if u.Host == "" || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid DoH URL %q: no host", s)
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", fmt.Errorf("invalid DoH URL %q: must only contain a host, optional port and path", s)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = doh.Path
+	}
+	return u.String(), nil
 }
 
 func parseBlock(c *caddy.Controller, f *Forward) error {
@@ -227,6 +342,11 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 			return c.ArgErr()
 		}
 		f.opts.PreferUDP = true
+	case "cookie":
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		f.cookies = true
 	case "tls":
 		args := c.RemainingArgs()
 		if len(args) > 3 {
@@ -238,6 +358,16 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 			return err
 		}
 		f.tlsConfig = tlsConfig
+	case "doh_method":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		switch x := strings.ToUpper(c.Val()); x {
+		case http.MethodGet, http.MethodPost:
+			f.dohMethod = x
+		default:
+			return c.Errf("unknown doh_method '%s'", c.Val())
+		}
 	case "tls_servername":
 		if !c.NextArg() {
 			return c.ArgErr()
@@ -266,6 +396,8 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 			f.p = &roundRobin{}
 		case "sequential":
 			f.p = &sequential{}
+		case "fastest":
+			f.p = &fastest{}
 		default:
 			return c.Errf("unknown policy '%s'", x)
 		}
@@ -282,6 +414,191 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 		}
 		f.ErrLimitExceeded = errors.New("concurrent queries exceeded maximum " + c.Val())
 		f.maxConcurrent = int64(n)
+	case "hedge":
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return err
+		}
+		if n < 1 {
+			return fmt.Errorf("hedge must be at least 1: %d", n)
+		}
+		f.hedge = n
+		if len(args) == 2 {
+			dur, err := time.ParseDuration(args[1])
+			if err != nil {
+				return err
+			}
+			if dur < 0 {
+				return fmt.Errorf("hedge delay can't be negative: %s", dur)
+			}
+			f.hedgeDelay = dur
+		}
+	case "circuit_breaker":
+		if !c.NextArg() {
+			return c.ArgErr()
+		}
+		ratio, err := strconv.ParseFloat(c.Val(), 64)
+		if err != nil {
+			return err
+		}
+		if ratio <= 0 || ratio > 1 {
+			return fmt.Errorf("circuit_breaker ratio must be between 0 and 1: %s", c.Val())
+		}
+		b := &proxy.Breaker{Ratio: ratio, MinQueries: defaultBreakerMin, Window: defaultBreakerWindow, Cooldown: defaultBreakerCooldown}
+
+		for c.NextArg() {
+			switch opt := c.Val(); opt {
+			case "window", "cooldown":
+				if !c.NextArg() {
+					return c.ArgErr()
+				}
+				dur, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return err
+				}
+				if dur <= 0 {
+					return fmt.Errorf("circuit_breaker: %s must be positive: %s", opt, dur)
+				}
+				if opt == "window" {
+					b.Window = dur
+				} else {
+					b.Cooldown = dur
+				}
+			case "min_queries":
+				if !c.NextArg() {
+					return c.ArgErr()
+				}
+				n, err := strconv.ParseUint(c.Val(), 10, 32)
+				if err != nil {
+					return err
+				}
+				if n == 0 {
+					return fmt.Errorf("circuit_breaker: min_queries must be at least 1")
+				}
+				b.MinQueries = uint32(n)
+			default:
+				return fmt.Errorf("circuit_breaker: unknown option %s", opt)
+			}
+		}
+		f.breaker = b
+	case "retry_budget":
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		ratio, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return err
+		}
+		if ratio < 0 {
+			return fmt.Errorf("retry_budget ratio can't be negative: %s", args[0])
+		}
+		perSecond := float64(defaultBudgetMin)
+		if len(args) == 2 {
+			perSecond, err = strconv.ParseFloat(args[1], 64)
+			if err != nil {
+				return err
+			}
+			if perSecond < 0 {
+				return fmt.Errorf("retry_budget minimum can't be negative: %s", args[1])
+			}
+		}
+		f.budget = newBudget(ratio, perSecond)
+	case "group":
+		args := c.RemainingArgs()
+		if len(args) < 2 {
+			return c.ArgErr()
+		}
+		if f.routes == nil {
+			f.routes = newRoutes(f.from)
+		}
+		name := args[0]
+		if _, ok := f.routes.groups[name]; ok {
+			return c.Errf("duplicate group '%s'", name)
+		}
+		g := New()
+		transports, err := g.addProxies(args[1:])
+		if err != nil {
+			return err
+		}
+		// RemainingArgs stops at the opening brace of the group's block.
+		if c.NextArg() {
+			if err := parseGroup(c, g); err != nil {
+				return err
+			}
+		}
+		if err := g.setupProxies(transports); err != nil {
+			return err
+		}
+		f.routes.groups[name] = g
+	case "route":
+		args := c.RemainingArgs()
+		if len(args) < 2 {
+			return c.ArgErr()
+		}
+		if f.routes == nil {
+			f.routes = newRoutes(f.from)
+		}
+		for _, domain := range args[1:] {
+			for _, d := range plugin.Host(domain).NormalizeExact() {
+				if !plugin.Name(f.from).Matches(d) {
+					return fmt.Errorf("route for %s is not in %s", d, f.from)
+				}
+				f.routes.inline[d] = args[0]
+			}
+		}
+	case "route_file":
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		if f.routes == nil {
+			f.routes = newRoutes(f.from)
+		}
+		path := args[0]
+		if root := dnsserver.GetConfig(c).Root; !filepath.IsAbs(path) && root != "" {
+			path = filepath.Join(root, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			log.Warningf("File does not exist: %s", path)
+		}
+		f.routes.path = path
+		if len(args) == 2 {
+			dur, err := time.ParseDuration(args[1])
+			if err != nil {
+				return err
+			}
+			if dur < 0 {
+				return fmt.Errorf("route_file reload can't be negative: %s", dur)
+			}
+			f.routes.reload = dur
+		}
+	case "dnssec":
+		args := c.RemainingArgs()
+		if len(args) > 1 {
+			return c.ArgErr()
+		}
+		anchors := validator.Root()
+		if len(args) == 1 {
+			path := args[0]
+			if root := dnsserver.GetConfig(c).Root; !filepath.IsAbs(path) && root != "" {
+				path = filepath.Join(root, path)
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			anchors, err = validator.ReadAnchors(file, path)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+		f.validator = validator.New(anchors)
 
 	default:
 		return c.Errf("unknown property '%s'", c.Val())
@@ -290,4 +607,44 @@ func parseBlock(c *caddy.Controller, f *Forward) error {
 	return nil
 }
 
+// groupProperties are the properties that can be set per upstream group.
+var groupProperties = map[string]bool{
+	"max_fails":       true,
+	"health_check":    true,
+	"force_tcp":       true,
+	"prefer_udp":      true,
+	"tls":             true,
+	"doh_method":      true,
+	"tls_servername":  true,
+	"expire":          true,
+	"policy":          true,
+	"hedge":           true,
+	"circuit_breaker": true,
+	"cookie":          true,
+}
+
+// parseGroup parses the block of a group up to its closing brace.
+func parseGroup(c *caddy.Controller, g *Forward) error {
+	for c.Next() {
+		if c.Val() == "}" {
+			return nil
+		}
+		if !groupProperties[c.Val()] {
+			return c.Errf("unknown property '%s' in group", c.Val())
+		}
+		if err := parseBlock(c, g); err != nil {
+			return err
+		}
+	}
+	return c.EOFErr()
+}
+
 const max = 15 // Maximum number of upstreams.
+
+const (
+	defaultBreakerMin      = 10
+	defaultBreakerWindow   = 10 * time.Second
+	defaultBreakerCooldown = 5 * time.Second
+
+	defaultBudgetMin = 10 // retries per second
+)
@@ -1,10 +1,12 @@
 package forward
 
 import (
+	"net/http"
 	"os"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
@@ -43,7 +45,9 @@ func TestSetup(t *testing.T) {
 		{"forward . a27.0.0.1", true, "", nil, 0, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "not an IP"},
 		{"forward . 127.0.0.1 {\nblaatl\n}\n", true, "", nil, 0, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "unknown property"},
 		{"forward . 127.0.0.1 {\nhealth_check 0.5s domain\n}\n", true, "", nil, 0, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "Wrong argument count or unexpected line ending after 'domain'"},
-		{"forward . https://127.0.0.1 \n", true, ".", nil, 2, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "'https' is not supported as a destination protocol in forward: https://127.0.0.1"},
+		{"forward . grpc://127.0.0.1 \n", true, ".", nil, 2, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "'grpc' is not supported as a destination protocol in forward: grpc://127.0.0.1:443"},
+		{"forward . https://127.0.0.1?dns=x \n", true, ".", nil, 2, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "invalid DoH URL"},
+		{"forward . 127.0.0.1 {\ndoh_method put\n}\n", true, ".", nil, 2, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "unknown doh_method"},
 		{"forward xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx 127.0.0.1 \n", true, ".", nil, 2, proxy.Options{HCRecursionDesired: true, HCDomain: "."}, "unable to normalize 'xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx'"},
 	}
 
@@ -103,6 +107,12 @@ func TestSetupTLS(t *testing.T) {
 				tls
 			}`, false, "", ""},
 		{`forward . tls://127.0.0.1`, false, "", ""},
+		{`forward . quic://127.0.0.1 {
+				tls_servername dns
+			}`, false, "dns", ""},
+		{`forward . https://127.0.0.1/dns-query {
+				tls_servername dns
+			}`, false, "dns", ""},
 	}
 
 	for i, test := range tests {
@@ -134,6 +144,39 @@ func TestSetupTLS(t *testing.T) {
 	}
 }
 
+func TestSetupDoH(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedAddrs  []string
+		expectedMethod string
+	}{
+		{"forward . https://127.0.0.1", []string{"https://127.0.0.1/dns-query"}, http.MethodPost},
+		{"forward . https://127.0.0.1:8443/resolve", []string{"https://127.0.0.1:8443/resolve"}, http.MethodPost},
+		{"forward . https://dns.example/dns-query 127.0.0.1 {\ndoh_method get\n}\n", []string{"https://dns.example/dns-query", "127.0.0.1:53"}, http.MethodGet},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		fs, err := parseForward(c)
+		if err != nil {
+			t.Fatalf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+		}
+		f := fs[0]
+
+		if f.dohMethod != test.expectedMethod {
+			t.Errorf("Test %d: expected method %s, got %s", i, test.expectedMethod, f.dohMethod)
+		}
+		if len(f.proxies) != len(test.expectedAddrs) {
+			t.Fatalf("Test %d: expected %d proxies, got %d", i, len(test.expectedAddrs), len(f.proxies))
+		}
+		for j, p := range f.proxies {
+			if p.Addr() != test.expectedAddrs[j] {
+				t.Errorf("Test %d: expected proxy address %s, got %s", i, test.expectedAddrs[j], p.Addr())
+			}
+		}
+	}
+}
+
 func TestSetupResolvconf(t *testing.T) {
 	const resolv = "resolv.conf"
 	if err := os.WriteFile(resolv,
@@ -333,3 +376,247 @@ func TestMultiForward(t *testing.T) {
 		t.Error("expected third plugin to be last, but Next is not nil")
 	}
 }
+
+func TestSetupHedge(t *testing.T) {
+	tests := []struct {
+		input         string
+		shouldErr     bool
+		expectedHedge int
+		expectedDelay time.Duration
+		expectedErr   string
+	}{
+		// positive
+		{"forward . 127.0.0.1 {\nhedge 2\n}\n", false, 2, 0, ""},
+		{"forward . 127.0.0.1 {\nhedge 3 50ms\n}\n", false, 3, 50 * time.Millisecond, ""},
+		// negative
+		{"forward . 127.0.0.1 {\nhedge\n}\n", true, 0, 0, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\nhedge 0\n}\n", true, 0, 0, "at least 1"},
+		{"forward . 127.0.0.1 {\nhedge 2 -1s\n}\n", true, 0, 0, "negative"},
+		{"forward . 127.0.0.1 {\nhedge 2 soon\n}\n", true, 0, 0, "invalid duration"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		fs, err := parseForward(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found %s for input %s", i, err, test.input)
+		}
+
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+
+			if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+		}
+
+		if test.shouldErr {
+			continue
+		}
+		f := fs[0]
+		if f.hedge != test.expectedHedge || f.hedgeDelay != test.expectedDelay {
+			t.Errorf("Test %d: expected: %d %s, got: %d %s", i, test.expectedHedge, test.expectedDelay, f.hedge, f.hedgeDelay)
+		}
+	}
+}
+
+func TestSetupGroup(t *testing.T) {
+	tests := []struct {
+		input          string
+		shouldErr      bool
+		expectedGroups int
+		expectedRoutes int
+		expectedErr    string
+	}{
+		// positive
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1 10.0.0.2\nroute corp example.corp\n}\n", false, 1, 1, ""},
+		{"forward . 127.0.0.1 {\nroute corp example.corp example.lab\ngroup corp 10.0.0.1\n}\n", false, 1, 2, ""},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1 {\npolicy sequential\nhealth_check 5s\n}\ngroup lab tls://10.0.0.3 {\ntls_servername lab.example.org\n}\nroute corp example.corp\nroute lab example.lab\n}\n", false, 2, 2, ""},
+		{"forward example.org 127.0.0.1 {\ngroup corp 10.0.0.1\nroute corp corp.example.org\n}\n", false, 1, 1, ""},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1\nroute_file routes 10s\n}\n", false, 1, 0, ""},
+		// negative
+		{"forward . 127.0.0.1 {\ngroup corp\n}\n", true, 0, 0, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1\ngroup corp 10.0.0.2\n}\n", true, 0, 0, "duplicate group"},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1 {\nexcept example.org\n}\n}\n", true, 0, 0, "unknown property 'except' in group"},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1 {\npolicy fast\n}\n}\n", true, 0, 0, "unknown policy"},
+		{"forward . 127.0.0.1 {\nroute corp example.corp\n}\n", true, 0, 0, "unknown group: corp"},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1\nroute corp\n}\n", true, 0, 0, "Wrong argument count"},
+		{"forward example.org 127.0.0.1 {\ngroup corp 10.0.0.1\nroute corp example.corp\n}\n", true, 0, 0, "not in example.org."},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1\nroute_file routes -1s\n}\n", true, 0, 0, "negative"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		fs, err := parseForward(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found %s for input %s", i, err, test.input)
+		}
+
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+
+			if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+		}
+
+		if test.shouldErr {
+			continue
+		}
+		f := fs[0]
+		if len(f.routes.groups) != test.expectedGroups || len(f.routes.inline) != test.expectedRoutes {
+			t.Errorf("Test %d: expected: %d groups and %d routes, got: %d and %d", i, test.expectedGroups, test.expectedRoutes, len(f.routes.groups), len(f.routes.inline))
+		}
+	}
+}
+
+func TestSetupCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		input           string
+		shouldErr       bool
+		expectedBreaker *proxy.Breaker
+		expectedErr     string
+	}{
+		// positive
+		{"forward . 127.0.0.1\n", false, nil, ""},
+		{"forward . 127.0.0.1 {\ncircuit_breaker 0.5\n}\n", false, &proxy.Breaker{Ratio: 0.5, MinQueries: 10, Window: 10 * time.Second, Cooldown: 5 * time.Second}, ""},
+		{"forward . 127.0.0.1 {\ncircuit_breaker 1 window 1m cooldown 30s min_queries 100\n}\n", false, &proxy.Breaker{Ratio: 1, MinQueries: 100, Window: time.Minute, Cooldown: 30 * time.Second}, ""},
+		// negative
+		{"forward . 127.0.0.1 {\ncircuit_breaker\n}\n", true, nil, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\ncircuit_breaker 0\n}\n", true, nil, "between 0 and 1"},
+		{"forward . 127.0.0.1 {\ncircuit_breaker 1.5\n}\n", true, nil, "between 0 and 1"},
+		{"forward . 127.0.0.1 {\ncircuit_breaker 0.5 window\n}\n", true, nil, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\ncircuit_breaker 0.5 cooldown 0s\n}\n", true, nil, "must be positive"},
+		{"forward . 127.0.0.1 {\ncircuit_breaker 0.5 min_queries 0\n}\n", true, nil, "at least 1"},
+		{"forward . 127.0.0.1 {\ncircuit_breaker 0.5 threshold 2\n}\n", true, nil, "unknown option threshold"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		fs, err := parseForward(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found %s for input %s", i, err, test.input)
+		}
+
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+
+			if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+		}
+
+		if test.shouldErr {
+			continue
+		}
+		f := fs[0]
+		if !reflect.DeepEqual(f.breaker, test.expectedBreaker) {
+			t.Errorf("Test %d: expected: %+v, got: %+v", i, test.expectedBreaker, f.breaker)
+		}
+	}
+}
+
+func TestSetupRetryBudget(t *testing.T) {
+	tests := []struct {
+		input             string
+		shouldErr         bool
+		expectedRatio     float64
+		expectedPerSecond float64
+		expectedErr       string
+	}{
+		// positive
+		{"forward . 127.0.0.1 {\nretry_budget 0.2\n}\n", false, 0.2, 10, ""},
+		{"forward . 127.0.0.1 {\nretry_budget 0.5 1\n}\n", false, 0.5, 1, ""},
+		{"forward . 127.0.0.1 {\nretry_budget 0 0\n}\n", false, 0, 0, ""},
+		// negative
+		{"forward . 127.0.0.1 {\nretry_budget\n}\n", true, 0, 0, "Wrong argument count"},
+		{"forward . 127.0.0.1 {\nretry_budget -1\n}\n", true, 0, 0, "negative"},
+		{"forward . 127.0.0.1 {\nretry_budget 0.2 -1\n}\n", true, 0, 0, "negative"},
+		{"forward . 127.0.0.1 {\nretry_budget lots\n}\n", true, 0, 0, "invalid syntax"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		fs, err := parseForward(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found %s for input %s", i, err, test.input)
+		}
+
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+
+			if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+		}
+
+		if test.shouldErr {
+			continue
+		}
+		f := fs[0]
+		if f.budget.ratio != test.expectedRatio || f.budget.perSecond != test.expectedPerSecond {
+			t.Errorf("Test %d: expected: %f %f, got: %f %f", i, test.expectedRatio, test.expectedPerSecond, f.budget.ratio, f.budget.perSecond)
+		}
+	}
+}
+
+func TestSetupCookie(t *testing.T) {
+	tests := []struct {
+		input           string
+		shouldErr       bool
+		expectedCookies bool
+		expectedGroup   bool
+		expectedErr     string
+	}{
+		// positive
+		{"forward . 127.0.0.1\n", false, false, false, ""},
+		{"forward . 127.0.0.1 {\ncookie\n}\n", false, true, false, ""},
+		{"forward . 127.0.0.1 {\ngroup corp 10.0.0.1 {\ncookie\n}\nroute corp example.corp\n}\n", false, false, true, ""},
+		// negative
+		{"forward . 127.0.0.1 {\ncookie yes\n}\n", true, false, false, "Wrong argument count"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		fs, err := parseForward(c)
+
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found %s for input %s", i, err, test.input)
+		}
+
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+
+			if !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectedErr, err, test.input)
+			}
+		}
+
+		if test.shouldErr {
+			continue
+		}
+		f := fs[0]
+		if f.cookies != test.expectedCookies {
+			t.Errorf("Test %d: expected cookies %t, got %t", i, test.expectedCookies, f.cookies)
+		}
+		if f.routes != nil {
+			if g := f.routes.groups["corp"]; g.cookies != test.expectedGroup {
+				t.Errorf("Test %d: expected group cookies %t, got %t", i, test.expectedGroup, g.cookies)
+			}
+		}
+	}
+}
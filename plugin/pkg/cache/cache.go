@@ -57,6 +57,13 @@ func (c *Cache) Get(key uint64) (interface{}, bool) {
 	return c.shards[shard].Get(key)
 }
 
+// GetOrAdd looks up the element under key, when there is none the element returned by f is added.
+// The lookup and the add are atomic, so concurrent callers for the same key get the same element.
+func (c *Cache) GetOrAdd(key uint64, f func() interface{}) interface{} {
+	shard := key & (shardSize - 1)
+	return c.shards[shard].GetOrAdd(key, f)
+}
+
 // Remove removes the element indexed with key.
 func (c *Cache) Remove(key uint64) {
 	shard := key & (shardSize - 1)
@@ -85,22 +92,45 @@ func newShard(size int) *shard { return &shard{items: make(map[uint64]interface{
 // Add adds element indexed by key into the cache. Any existing element is overwritten
 // Returns true if an existing element was evicted to make room for this element.
 func (s *shard) Add(key uint64, el interface{}) bool {
-	eviction := false
 	s.Lock()
-	if len(s.items) >= s.size {
-		if _, ok := s.items[key]; !ok {
-			for k := range s.items {
-				delete(s.items, k)
-				eviction = true
-				break
-			}
-		}
-	}
+	eviction := s.makeRoom(key)
 	s.items[key] = el
 	s.Unlock()
 	return eviction
 }
 
+// GetOrAdd looks up the element indexed by key, and adds the element returned by f when there is none.
+func (s *shard) GetOrAdd(key uint64, f func() interface{}) interface{} {
+	if el, ok := s.Get(key); ok {
+		return el
+	}
+	s.Lock()
+	defer s.Unlock()
+	if el, ok := s.items[key]; ok {
+		return el
+	}
+	s.makeRoom(key)
+	el := f()
+	s.items[key] = el
+	return el
+}
+
+// makeRoom evicts a random element when the shard is full and key isn't in it, s must be locked.
+// Returns true if an element was evicted.
+func (s *shard) makeRoom(key uint64) bool {
+	if len(s.items) < s.size {
+		return false
+	}
+	if _, ok := s.items[key]; ok {
+		return false
+	}
+	for k := range s.items {
+		delete(s.items, k)
+		return true
+	}
+	return false
+}
+
 // Remove removes the element indexed by key from the cache.
 func (s *shard) Remove(key uint64) {
 	s.Lock()
@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -24,6 +26,35 @@ func TestCacheAddAndGet(t *testing.T) {
 	}
 }
 
+func TestCacheGetOrAdd(t *testing.T) {
+	c := New(4)
+	var calls int32
+	f := func() interface{} {
+		atomic.AddInt32(&calls, 1)
+		return new(int)
+	}
+
+	var wg sync.WaitGroup
+	els := make([]interface{}, 10)
+	for i := range els {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			els[i] = c.GetOrAdd(1, f)
+		}(i)
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected the element to be made once, got %d", calls)
+	}
+	for i := range els {
+		if els[i] != els[0] {
+			t.Fatalf("Expected every caller to get the same element")
+		}
+	}
+}
+
 func TestCacheLen(t *testing.T) {
 	c := New(4)
 
@@ -0,0 +1,197 @@
+// Package cookie implements DNS Cookies (RFC 7873), with the interoperable server cookies of RFC 9018.
+//
+// A server cookie is 16 bytes: a version (1), 3 reserved bytes, a timestamp and a SipHash-2-4 over
+// the client cookie, the first 8 bytes and the client's IP address, keyed with a server secret. Any
+// server knowing the secret can check the cookie, so it can be shared by the servers of an anycast
+// set.
+package cookie
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// ClientLen is the length of a client cookie.
+	ClientLen = 8
+	// ServerLen is the length of the server cookies made by this package.
+	ServerLen = 16
+
+	version = 1
+
+	// Server cookies are valid for an hour, and up to 5 minutes in the future to allow for clock skew
+	// between servers sharing a secret. After half an hour a new one is handed out.
+	maxAge   = 3600
+	maxSkew  = 300
+	staleAge = 1800
+)
+
+// Secret is a server secret, server cookies are made with it.
+type Secret [16]byte
+
+// NewSecret returns a new random secret.
+func NewSecret() (Secret, error) {
+	var s Secret
+	_, err := rand.Read(s[:])
+	return s, err
+}
+
+// ParseSecret parses a secret in hex.
+func ParseSecret(s string) (Secret, error) {
+	var secret Secret
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return secret, fmt.Errorf("invalid secret %q: %s", s, err)
+	}
+	if len(b) != len(secret) {
+		return secret, fmt.Errorf("invalid secret %q: must be %d bytes", s, len(secret))
+	}
+	copy(secret[:], b)
+	return secret, nil
+}
+
+// ErrMalformed is returned for a COOKIE option that isn't a valid client and server cookie.
+var ErrMalformed = errors.New("malformed cookie")
+
+// Find returns the COOKIE option in the OPT record of m, or nil if there is none.
+func Find(m *dns.Msg) *dns.EDNS0_COOKIE {
+	o := m.IsEdns0()
+	if o == nil {
+		return nil
+	}
+	for _, opt := range o.Option {
+		if c, ok := opt.(*dns.EDNS0_COOKIE); ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// Split returns the client and server cookie in o, server is nil when there is none.
+func Split(o *dns.EDNS0_COOKIE) (client, server []byte, err error) {
+	b, err := hex.DecodeString(o.Cookie)
+	if err != nil {
+		return nil, nil, ErrMalformed
+	}
+	// A server cookie is between 8 and 32 bytes.
+	if len(b) != ClientLen && (len(b) < ClientLen+8 || len(b) > ClientLen+32) {
+		return nil, nil, ErrMalformed
+	}
+	if len(b) == ClientLen {
+		return b, nil, nil
+	}
+	return b[:ClientLen], b[ClientLen:], nil
+}
+
+// Set sets the COOKIE option in the OPT record of m to client and server. Other COOKIE options are
+// removed. m must have an OPT record.
+func Set(m *dns.Msg, client, server []byte) {
+	o := m.IsEdns0()
+	Remove(m)
+	o.Option = append(o.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: hex.EncodeToString(client) + hex.EncodeToString(server)})
+}
+
+// Remove removes the COOKIE options from the OPT record of m.
+func Remove(m *dns.Msg) {
+	o := m.IsEdns0()
+	if o == nil {
+		return
+	}
+	opts := o.Option[:0]
+	for _, opt := range o.Option {
+		if opt.Option() != dns.EDNS0COOKIE {
+			opts = append(opts, opt)
+		}
+	}
+	o.Option = opts
+}
+
+// Server returns the server cookie for client and ip, made with secret at time t.
+func Server(secret Secret, client []byte, ip net.IP, t time.Time) []byte {
+	server := make([]byte, ServerLen)
+	server[0] = version
+	binary.BigEndian.PutUint32(server[4:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint64(server[8:], hash(secret, client, server[:8], ip))
+	return server
+}
+
+// Check returns true if server is a valid server cookie for client and ip, made with one of secrets.
+// It also returns true if the server cookie is old enough to be replaced with a new one.
+func Check(secrets []Secret, client, server []byte, ip net.IP, now time.Time) (valid, stale bool) {
+	if len(server) != ServerLen || server[0] != version {
+		return false, false
+	}
+	// Serial number arithmetic, the timestamp wraps in 2106.
+	age := int32(uint32(now.Unix()) - binary.BigEndian.Uint32(server[4:]))
+	if age > maxAge || age < -maxSkew {
+		return false, false
+	}
+	h := binary.LittleEndian.Uint64(server[8:])
+	for _, s := range secrets {
+		if hash(s, client, server[:8], ip) == h {
+			return true, age > staleAge
+		}
+	}
+	return false, false
+}
+
+func hash(secret Secret, client, header []byte, ip net.IP) uint64 {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	msg := make([]byte, 0, ClientLen+8+net.IPv6len)
+	msg = append(msg, client...)
+	msg = append(msg, header...)
+	msg = append(msg, ip...)
+	return sipHash(secret, msg)
+}
+
+// Secrets holds the secrets of a server. The first one is used to make server cookies, all of them
+// are used to check them.
+type Secrets struct {
+	sync.RWMutex
+	s []Secret
+}
+
+// NewSecrets returns a new Secrets with secrets.
+func NewSecrets(secrets ...Secret) *Secrets { return &Secrets{s: secrets} }
+
+// Get returns the secrets, the first one is the current one.
+func (s *Secrets) Get() []Secret {
+	s.RLock()
+	defer s.RUnlock()
+	return s.s
+}
+
+// Rotate makes a new random secret the current one. The previous one is kept, so the server cookies
+// made with it stay valid, any others are dropped.
+func (s *Secrets) Rotate() error {
+	secret, err := NewSecret()
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if len(s.s) == 0 {
+		s.s = []Secret{secret}
+		return nil
+	}
+	s.s = []Secret{secret, s.s[0]}
+	return nil
+}
+
+// Config is the DNS Cookie configuration of a server.
+type Config struct {
+	Secrets *Secrets
+	// RequireSize is the size above which UDP responses are only sent to clients with a valid server
+	// cookie, 0 means there is no such limit.
+	RequireSize int
+}
@@ -0,0 +1,163 @@
+package cookie
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestSipHash(t *testing.T) {
+	// Test vectors from the SipHash reference implementation: key 00..0f, messages 00..n-1.
+	var key Secret
+	for i := range key {
+		key[i] = byte(i)
+	}
+	msg := make([]byte, 15)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	tests := []struct {
+		n        int
+		expected uint64
+	}{
+		{0, 0x726fdb47dd0e0e31},
+		{8, 0x93f5f5799a932462},
+		{15, 0xa129ca6149be45e5},
+	}
+	for _, tc := range tests {
+		if h := sipHash(key, msg[:tc.n]); h != tc.expected {
+			t.Errorf("Expected %x for %d bytes, got %x", tc.expected, tc.n, h)
+		}
+	}
+}
+
+// The examples from appendix A of RFC 9018.
+func TestServer(t *testing.T) {
+	tests := []struct {
+		client   string
+		ip       string
+		secret   string
+		time     int64
+		expected string
+	}{
+		{"2464c4abcf10c957", "198.51.100.100", "e5e973e5a6b2a43f48e7dc849e37bfcf", 1559731985, "010000005cf79f111f8130c3eee29480"},
+		{"2464c4abcf10c957", "198.51.100.100", "e5e973e5a6b2a43f48e7dc849e37bfcf", 1559734385, "010000005cf7a871d4a564a1442aca77"},
+		{"fc93fc62807ddb86", "203.0.113.203", "e5e973e5a6b2a43f48e7dc849e37bfcf", 1559734700, "010000005cf7a9acf73a7810aca2381e"},
+	}
+	for i, tc := range tests {
+		client, _ := hex.DecodeString(tc.client)
+		secret, err := ParseSecret(tc.secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := Server(secret, client, net.ParseIP(tc.ip), time.Unix(tc.time, 0))
+		if x := hex.EncodeToString(server); x != tc.expected {
+			t.Errorf("Test %d: expected server cookie %s, got %s", i, tc.expected, x)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	secret, _ := NewSecret()
+	other, _ := NewSecret()
+	client := []byte("abcdefgh")
+	ip := net.ParseIP("192.0.2.1")
+	now := time.Now()
+	server := Server(secret, client, ip, now)
+
+	tests := []struct {
+		secrets []Secret
+		client  []byte
+		ip      string
+		now     time.Time
+		valid   bool
+		stale   bool
+	}{
+		{[]Secret{secret}, client, "192.0.2.1", now, true, false},
+		{[]Secret{other, secret}, client, "192.0.2.1", now, true, false},
+		{[]Secret{secret}, client, "192.0.2.1", now.Add(45 * time.Minute), true, true},
+		{[]Secret{secret}, client, "192.0.2.1", now.Add(-4 * time.Minute), true, false}, // clock skew
+		{[]Secret{other}, client, "192.0.2.1", now, false, false},
+		{[]Secret{secret}, []byte("hgfedcba"), "192.0.2.1", now, false, false},
+		{[]Secret{secret}, client, "192.0.2.2", now, false, false},
+		{[]Secret{secret}, client, "192.0.2.1", now.Add(2 * time.Hour), false, false},
+		{[]Secret{secret}, client, "192.0.2.1", now.Add(-10 * time.Minute), false, false},
+	}
+	for i, tc := range tests {
+		valid, stale := Check(tc.secrets, tc.client, server, net.ParseIP(tc.ip), tc.now)
+		if valid != tc.valid || stale != tc.stale {
+			t.Errorf("Test %d: expected valid %t and stale %t, got %t and %t", i, tc.valid, tc.stale, valid, stale)
+		}
+	}
+
+	if valid, _ := Check([]Secret{secret}, client, server[:8], ip, now); valid {
+		t.Errorf("Expected short server cookie to be invalid")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		cookie    string
+		client    string
+		server    string
+		shouldErr bool
+	}{
+		{"2464c4abcf10c957", "2464c4abcf10c957", "", false},
+		{"2464c4abcf10c957010000005cf79f111f8130c3eee29480", "2464c4abcf10c957", "010000005cf79f111f8130c3eee29480", false},
+		{"2464c4abcf10c9570100", "", "", true}, // server cookie too short
+		{"2464c4abcf10", "", "", true},
+		{"2464c4abcf10c957" + string(bytes.Repeat([]byte("00"), 33)), "", "", true},
+		{"not hex", "", "", true},
+	}
+	for i, tc := range tests {
+		client, server, err := Split(&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: tc.cookie})
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+		}
+		if hex.EncodeToString(client) != tc.client || hex.EncodeToString(server) != tc.server {
+			t.Errorf("Test %d: expected %s %s, got %x %x", i, tc.client, tc.server, client, server)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	m.SetEdns0(4096, false)
+	o := m.IsEdns0()
+	o.Option = append(o.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "2464c4abcf10c957"}, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+
+	Set(m, []byte("abcdefgh"), []byte("0123456789abcdef"))
+	if len(o.Option) != 2 {
+		t.Fatalf("Expected 2 options, got %d", len(o.Option))
+	}
+	if c := Find(m); c == nil || c.Cookie != hex.EncodeToString([]byte("abcdefgh0123456789abcdef")) {
+		t.Errorf("Expected the new cookie, got %v", c)
+	}
+
+	Remove(m)
+	if Find(m) != nil || len(o.Option) != 1 {
+		t.Errorf("Expected the cookie to be removed, got %v", o.Option)
+	}
+}
+
+func TestSecretsRotate(t *testing.T) {
+	s := NewSecrets()
+	s.Rotate()
+	first := s.Get()[0]
+	s.Rotate()
+	s.Rotate()
+	if x := s.Get(); len(x) != 2 || x[0] == first || x[1] == first {
+		t.Errorf("Expected two new secrets, got %d", len(x))
+	}
+}
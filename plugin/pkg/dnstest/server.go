@@ -21,12 +21,22 @@ type Server struct {
 // finished, to shut it down.
 func NewServer(f dns.HandlerFunc) *Server {
 	dns.HandleFunc(".", f)
+	return newServer(nil)
+}
+
+// NewSilentServer starts and returns a new Server that reads the queries, but never replies. The
+// caller should call Close when finished, to shut it down.
+func NewSilentServer() *Server {
+	return newServer(dns.HandlerFunc(func(dns.ResponseWriter, *dns.Msg) {}))
+}
 
+// newServer starts a Server with handler h, or the default handler when h is nil.
+func newServer(h dns.Handler) *Server {
 	ch1 := make(chan bool)
 	ch2 := make(chan bool)
 
-	s1 := &dns.Server{} // udp
-	s2 := &dns.Server{} // tcp
+	s1 := &dns.Server{Handler: h} // udp
+	s2 := &dns.Server{Handler: h} // tcp
 
 	for i := 0; i < 5; i++ { // 5 attempts
 		s2.Listener, _ = reuseport.Listen("tcp", ":0")
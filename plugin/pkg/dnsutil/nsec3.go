@@ -0,0 +1,38 @@
+package dnsutil
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxNSEC3Iterations is the maximum number of NSEC3 iterations, validators are allowed to treat
+// answers with more iterations as insecure (RFC 9276, section 3.2).
+const MaxNSEC3Iterations = 100
+
+// ParseNSEC3 parses the NSEC3 hash parameters in args: [ITERATIONS [SALT]]. The salt is returned in
+// upper case hex, a SALT of "-" is no salt.
+func ParseNSEC3(args []string) (iterations uint16, salt string, err error) {
+	if len(args) > 2 {
+		return 0, "", fmt.Errorf("too many NSEC3 arguments: %q", args)
+	}
+	if len(args) > 0 {
+		it, err := strconv.ParseUint(args[0], 10, 16)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid iterations '%s'", args[0])
+		}
+		if it > MaxNSEC3Iterations {
+			return 0, "", fmt.Errorf("iterations can't be more than %d", MaxNSEC3Iterations)
+		}
+		iterations = uint16(it)
+	}
+	if len(args) > 1 && args[1] != "-" {
+		b, err := hex.DecodeString(args[1])
+		if err != nil || len(b) > 255 {
+			return 0, "", fmt.Errorf("invalid salt '%s'", args[1])
+		}
+		salt = strings.ToUpper(args[1])
+	}
+	return iterations, salt, nil
+}
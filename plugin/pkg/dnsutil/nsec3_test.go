@@ -0,0 +1,33 @@
+package dnsutil
+
+import "testing"
+
+func TestParseNSEC3(t *testing.T) {
+	tests := []struct {
+		args       []string
+		shouldErr  bool
+		iterations uint16
+		salt       string
+	}{
+		{nil, false, 0, ""},
+		{[]string{"5"}, false, 5, ""},
+		{[]string{"0", "aabb"}, false, 0, "AABB"},
+		{[]string{"1", "-"}, false, 1, ""},
+		{[]string{"1000"}, true, 0, ""},
+		{[]string{"five"}, true, 0, ""},
+		{[]string{"1", "xyz"}, true, 0, ""},
+		{[]string{"1", "aa", "bb"}, true, 0, ""},
+	}
+	for i, tc := range tests {
+		it, salt, err := ParseNSEC3(tc.args)
+		if tc.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error for %q", i, tc.args)
+		}
+		if !tc.shouldErr && err != nil {
+			t.Errorf("Test %d: expected no error for %q, got %s", i, tc.args, err)
+		}
+		if it != tc.iterations || salt != tc.salt {
+			t.Errorf("Test %d: expected %d iterations and salt %q, got %d and %q", i, tc.iterations, tc.salt, it, salt)
+		}
+	}
+}
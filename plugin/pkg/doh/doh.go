@@ -23,22 +23,28 @@ const Path = "/dns-query"
 // be prefixed with https:// by default, unless it's already prefixed with
 // either http:// or https://.
 func NewRequest(method, url string, m *dns.Msg) (*http.Request, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = fmt.Sprintf("https://%s", url)
+	}
+
+	return NewRequestURL(method, url+Path, m)
+}
+
+// NewRequestURL returns a new DoH request given a HTTP method, the full URL of
+// the DoH endpoint (including the path) and dns.Msg.
+func NewRequestURL(method, url string, m *dns.Msg) (*http.Request, error) {
 	buf, err := m.Pack()
 	if err != nil {
 		return nil, err
 	}
 
-	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-		url = fmt.Sprintf("https://%s", url)
-	}
-
 	switch method {
 	case http.MethodGet:
 		b64 := base64.RawURLEncoding.EncodeToString(buf)
 
 		req, err := http.NewRequest(
 			http.MethodGet,
-			fmt.Sprintf("%s%s?dns=%s", url, Path, b64),
+			fmt.Sprintf("%s?dns=%s", url, b64),
 			nil,
 		)
 		if err != nil {
@@ -52,7 +58,7 @@ func NewRequest(method, url string, m *dns.Msg) (*http.Request, error) {
 	case http.MethodPost:
 		req, err := http.NewRequest(
 			http.MethodPost,
-			fmt.Sprintf("%s%s?bla=foo:443", url, Path),
+			url,
 			bytes.NewReader(buf),
 		)
 		if err != nil {
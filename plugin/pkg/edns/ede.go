@@ -0,0 +1,74 @@
+package edns
+
+import (
+	"errors"
+
+	"github.com/miekg/dns"
+)
+
+// SetExtendedError adds the extended DNS error (RFC 8914) code with the optional text to m. If m
+// has no OPT record one is added. An error with the same code is only added once.
+func SetExtendedError(m *dns.Msg, code uint16, text string) {
+	o := m.IsEdns0()
+	if o == nil {
+		m.SetEdns0(dns.DefaultMsgSize, false)
+		o = m.IsEdns0()
+	}
+	for _, e := range o.Option {
+		if ede, ok := e.(*dns.EDNS0_EDE); ok && ede.InfoCode == code {
+			return
+		}
+	}
+	o.Option = append(o.Option, &dns.EDNS0_EDE{InfoCode: code, ExtraText: text})
+}
+
+// ExtendedErrors returns the extended DNS errors in m.
+func ExtendedErrors(m *dns.Msg) []*dns.EDNS0_EDE {
+	o := m.IsEdns0()
+	if o == nil {
+		return nil
+	}
+	var ret []*dns.EDNS0_EDE
+	for _, e := range o.Option {
+		if ede, ok := e.(*dns.EDNS0_EDE); ok {
+			ret = append(ret, ede)
+		}
+	}
+	return ret
+}
+
+// HasExtendedError returns true if m has the extended DNS error code.
+func HasExtendedError(m *dns.Msg, code uint16) bool {
+	for _, ede := range ExtendedErrors(m) {
+		if ede.InfoCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtendedError is an error that carries an extended DNS error. When a plugin returns it together
+// with an rcode the server writes the response for, the extended error is added to that response.
+type ExtendedError struct {
+	Code uint16
+	Text string
+	Err  error
+}
+
+// NewExtendedError returns err wrapped in an ExtendedError with code and text.
+func NewExtendedError(err error, code uint16, text string) error {
+	return &ExtendedError{Code: code, Text: text, Err: err}
+}
+
+func (e *ExtendedError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the wrapped error.
+func (e *ExtendedError) Unwrap() error { return e.Err }
+
+// SetExtendedErrorFrom adds the extended DNS error carried by err to m, if there is one.
+func SetExtendedErrorFrom(m *dns.Msg, err error) {
+	var e *ExtendedError
+	if errors.As(err, &e) {
+		SetExtendedError(m, e.Code, e.Text)
+	}
+}
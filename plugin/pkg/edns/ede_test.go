@@ -0,0 +1,59 @@
+package edns
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSetExtendedError(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+
+	SetExtendedError(m, dns.ExtendedErrorCodeBlocked, "blocked")
+	if m.IsEdns0() == nil {
+		t.Fatal("Expected an OPT record to be added")
+	}
+	SetExtendedError(m, dns.ExtendedErrorCodeBlocked, "again")
+	SetExtendedError(m, dns.ExtendedErrorCodeStaleAnswer, "")
+
+	ede := ExtendedErrors(m)
+	if len(ede) != 2 {
+		t.Fatalf("Expected 2 extended errors, got %d", len(ede))
+	}
+	if ede[0].InfoCode != dns.ExtendedErrorCodeBlocked || ede[0].ExtraText != "blocked" {
+		t.Errorf("Expected the first error to be kept, got %s", ede[0])
+	}
+	if !HasExtendedError(m, dns.ExtendedErrorCodeStaleAnswer) {
+		t.Error("Expected Stale Answer")
+	}
+	if HasExtendedError(m, dns.ExtendedErrorCodeNetworkError) {
+		t.Error("Expected no Network Error")
+	}
+	if n := len(m.Extra); n != 1 {
+		t.Errorf("Expected 1 OPT record, got %d records", n)
+	}
+}
+
+func TestExtendedErrorFrom(t *testing.T) {
+	errUpstream := errors.New("upstream")
+	err := fmt.Errorf("wrapped: %w", NewExtendedError(errUpstream, dns.ExtendedErrorCodeNetworkError, ""))
+	if !errors.Is(err, errUpstream) {
+		t.Error("Expected the wrapped error to be found")
+	}
+
+	m := ednsMsg()
+	SetExtendedErrorFrom(m, err)
+	if !HasExtendedError(m, dns.ExtendedErrorCodeNetworkError) {
+		t.Error("Expected Network Error")
+	}
+
+	m = ednsMsg()
+	SetExtendedErrorFrom(m, errUpstream)
+	SetExtendedErrorFrom(m, nil)
+	if len(ExtendedErrors(m)) != 0 {
+		t.Error("Expected no extended errors")
+	}
+}
@@ -0,0 +1,50 @@
+package keyprovider
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// File is the Provider for keys stored in files as generated by dnssec-keygen: the public key in
+// base.key and the private key in base.private.
+type File struct{}
+
+// Load implements the Provider interface.
+func (File) Load(base string) (Key, error) { return ReadFile(base+".key", base+".private") }
+
+// ReadFile reads a key from the files public and private.
+func ReadFile(public, private string) (Key, error) {
+	dnskey, err := ReadPublic(public)
+	if err != nil {
+		return Key{}, err
+	}
+
+	f, err := os.Open(filepath.Clean(private))
+	if err != nil {
+		return Key{}, err
+	}
+	defer f.Close()
+
+	p, err := dnskey.ReadPrivateKey(f, private)
+	if err != nil {
+		return Key{}, err
+	}
+
+	var signer crypto.Signer
+	switch s := p.(type) {
+	case *rsa.PrivateKey:
+		signer = s
+	case *ecdsa.PrivateKey:
+		signer = s
+	case ed25519.PrivateKey:
+		signer = s
+	default:
+		return Key{Public: dnskey}, errNoPrivate
+	}
+	return Key{Public: dnskey, Private: signer}, nil
+}
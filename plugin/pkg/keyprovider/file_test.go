@@ -0,0 +1,111 @@
+package keyprovider
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestBase(t *testing.T) {
+	tests := []struct {
+		name, root, expected string
+	}{
+		{"Kmiek.nl.+013+59725", "", "Kmiek.nl.+013+59725"},
+		{"Kmiek.nl.+013+59725.key", "", "Kmiek.nl.+013+59725"},
+		{"Kmiek.nl.+013+59725.private", "", "Kmiek.nl.+013+59725"},
+		{"Kmiek.nl.+013+59725", "/etc/coredns", "/etc/coredns/Kmiek.nl.+013+59725"},
+		{"/keys/Kmiek.nl.+013+59725.key", "/etc/coredns", "/keys/Kmiek.nl.+013+59725"},
+	}
+	for i, tc := range tests {
+		if x := Base(tc.name, tc.root); x != tc.expected {
+			t.Errorf("Test %d: expected %s, got %s", i, tc.expected, x)
+		}
+	}
+}
+
+// writeKey writes a new ECDSA key for miek.nl. to dir and returns its base name.
+func writeKey(t *testing.T, dir string) (string, *dns.DNSKEY) {
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "miek.nl.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := dnskey.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join(dir, "Kmiek.nl.+013+1")
+	if err := os.WriteFile(base+".key", []byte(dnskey.String()+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(base+".private", []byte(dnskey.PrivateKeyString(priv)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return base, dnskey
+}
+
+func TestFileLoad(t *testing.T) {
+	base, dnskey := writeKey(t, t.TempDir())
+
+	k, err := File{}.Load(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Public.KeyTag() != dnskey.KeyTag() {
+		t.Errorf("Expected key tag %d, got %d", dnskey.KeyTag(), k.Public.KeyTag())
+	}
+	verify(t, k)
+
+	if _, err := (File{}).Load(base + ".nonexistent"); err == nil {
+		t.Errorf("Expected error for a key that doesn't exist")
+	}
+}
+
+func TestPublicKey(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, dnskey := writeKey(t, t.TempDir())
+	dnskey.PublicKey = ""
+	if _, err := publicKey(dnskey); err == nil {
+		t.Errorf("Expected error for an empty public key")
+	}
+	dnskey.PublicKey = base64.StdEncoding.EncodeToString(append(priv.X.FillBytes(make([]byte, 32)), priv.Y.FillBytes(make([]byte, 32))...))
+	pub, err := publicKey(dnskey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !priv.PublicKey.Equal(pub) {
+		t.Errorf("Expected the public key of the DNSKEY to be the generated key")
+	}
+}
+
+// verify signs an RRset with k and verifies the signature with its DNSKEY.
+func verify(t *testing.T, k Key) {
+	t.Helper()
+	rrs := []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: "miek.nl.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 3600}, A: []byte{127, 0, 0, 1}}}
+	now := time.Now().UTC()
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: "miek.nl.", Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+		Algorithm:  k.Public.Algorithm,
+		SignerName: k.Public.Hdr.Name,
+		KeyTag:     k.Public.KeyTag(),
+		Inception:  uint32(now.Add(-time.Hour).Unix()),
+		Expiration: uint32(now.Add(time.Hour).Unix()),
+	}
+	if err := sig.Sign(k.Private, rrs); err != nil {
+		t.Fatalf("Failed to sign: %s", err)
+	}
+	if err := sig.Verify(k.Public, rrs); err != nil {
+		t.Errorf("Failed to verify: %s", err)
+	}
+}
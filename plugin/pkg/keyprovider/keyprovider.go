@@ -0,0 +1,62 @@
+// Package keyprovider loads DNSSEC signing keys for the dnssec and sign plugins.
+//
+// A key is named by the base name of its BIND style public key file, i.e. Kexample.org.+013+45330,
+// the DNSKEY is always read from that file. Where the private key lives is up to the Provider: File
+// reads it from the accompanying .private file, PKCS11 uses the key on a PKCS#11 token, so it never
+// touches the filesystem.
+package keyprovider
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Key is a DNSKEY and the signer for its private key.
+type Key struct {
+	Public  *dns.DNSKEY
+	Private crypto.Signer
+}
+
+// Provider loads keys.
+type Provider interface {
+	// Load returns the key with the base name base.
+	Load(base string) (Key, error)
+}
+
+// Base returns the base name of the key file name, name may have the .key or .private extension.
+// Relative names are taken to be relative to root.
+func Base(name, root string) string {
+	base := strings.TrimSuffix(strings.TrimSuffix(name, ".key"), ".private")
+	if !filepath.IsAbs(base) && root != "" {
+		base = filepath.Join(root, base)
+	}
+	return base
+}
+
+// ReadPublic reads the DNSKEY from the file public.
+func ReadPublic(public string) (*dns.DNSKEY, error) {
+	f, err := os.Open(filepath.Clean(public))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rr, err := dns.ReadRR(f, public)
+	if err != nil {
+		return nil, err
+	}
+	dnskey, ok := rr.(*dns.DNSKEY)
+	if !ok {
+		return nil, fmt.Errorf("no public key found in %q", public)
+	}
+	return dnskey, nil
+}
+
+// errNoPrivate is returned when a key is found, but it can't be used for signing.
+var errNoPrivate = errors.New("no private key found")
@@ -0,0 +1,262 @@
+//go:build cgo
+
+package keyprovider
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/miekg/pkcs11"
+)
+
+// PKCS11 is the Provider for private keys on a PKCS#11 token, such as a hardware security module.
+// The private key of a DNSKEY is found via the public key object on the token with the same key
+// material, both must have the same CKA_ID.
+type PKCS11 struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+
+	mu sync.Mutex // a session can only be used by one goroutine at a time
+}
+
+// NewPKCS11 opens a session on the token with label token and logs in with pin. Module is the path
+// to the PKCS#11 library of the token.
+func NewPKCS11(module, token, pin string) (*PKCS11, error) {
+	ctx, err := initialize(module)
+	if err != nil {
+		return nil, err
+	}
+
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return nil, err
+	}
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil || info.Label != token {
+			continue
+		}
+
+		session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+		if err != nil {
+			return nil, err
+		}
+		// Logins are shared by all sessions of the token, after a reload we are still logged in.
+		if err := ctx.Login(session, pkcs11.CKU_USER, pin); err != nil && !isError(err, pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+			ctx.CloseSession(session)
+			return nil, err
+		}
+		return &PKCS11{ctx: ctx, session: session}, nil
+	}
+	return nil, fmt.Errorf("no token with label %q found in %q", token, module)
+}
+
+// Close closes the session. It doesn't log out, as that would log out all sessions on the token.
+func (p *PKCS11) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ctx.CloseSession(p.session)
+}
+
+// Load implements the Provider interface. The public key is read from base.key.
+func (p *PKCS11) Load(base string) (Key, error) {
+	dnskey, err := ReadPublic(base + ".key")
+	if err != nil {
+		return Key{}, err
+	}
+	pub, err := publicKey(dnskey)
+	if err != nil {
+		return Key{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id, err := p.findPublic(dnskey)
+	if err != nil {
+		return Key{}, err
+	}
+	private, err := p.find([]*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	})
+	if err != nil {
+		return Key{}, err
+	}
+	if len(private) == 0 {
+		return Key{Public: dnskey}, fmt.Errorf("%s for %q", errNoPrivate, base)
+	}
+	return Key{Public: dnskey, Private: &signer{p: p, key: private[0], pub: pub, alg: dnskey.Algorithm}}, nil
+}
+
+// findPublic returns the CKA_ID of the public key object on the token that matches dnskey.
+func (p *PKCS11) findPublic(dnskey *dns.DNSKEY) ([]byte, error) {
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY)}
+	attr := uint(pkcs11.CKA_EC_POINT)
+	switch dnskey.Algorithm {
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA))
+		attr = pkcs11.CKA_MODULUS
+	case dns.ECDSAP256SHA256, dns.ECDSAP384SHA384:
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC))
+	case dns.ED25519:
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, ckkECEdwards))
+	default:
+		return nil, dns.ErrAlg
+	}
+	want, err := keyMaterial(dnskey)
+	if err != nil {
+		return nil, err
+	}
+
+	objs, err := p.find(template)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range objs {
+		attrs, err := p.ctx.GetAttributeValue(p.session, o, []*pkcs11.Attribute{pkcs11.NewAttribute(attr, nil), pkcs11.NewAttribute(pkcs11.CKA_ID, nil)})
+		if err != nil || len(attrs) != 2 {
+			continue
+		}
+		got := attrs[0].Value
+		if attr == pkcs11.CKA_EC_POINT {
+			got = ecPoint(got)
+		}
+		if bytes.Equal(got, want) {
+			return attrs[1].Value, nil
+		}
+	}
+	return nil, fmt.Errorf("no public key found on the token for DNSKEY with key tag %d", dnskey.KeyTag())
+}
+
+func (p *PKCS11) find(template []*pkcs11.Attribute) ([]pkcs11.ObjectHandle, error) {
+	if err := p.ctx.FindObjectsInit(p.session, template); err != nil {
+		return nil, err
+	}
+	defer p.ctx.FindObjectsFinal(p.session)
+
+	all := []pkcs11.ObjectHandle{}
+	for {
+		objs, _, err := p.ctx.FindObjects(p.session, 100)
+		if err != nil {
+			return nil, err
+		}
+		if len(objs) == 0 {
+			return all, nil
+		}
+		all = append(all, objs...)
+	}
+}
+
+// signer is a crypto.Signer for a private key on a token. It returns signatures in the format
+// dns.RRSIG.Sign expects them.
+type signer struct {
+	p   *PKCS11
+	key pkcs11.ObjectHandle
+	pub crypto.PublicKey
+	alg uint8
+}
+
+// Public implements the crypto.Signer interface.
+func (s *signer) Public() crypto.PublicKey { return s.pub }
+
+// Sign implements the crypto.Signer interface.
+func (s *signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var mech *pkcs11.Mechanism
+	data := digest
+	switch s.alg {
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
+		prefix, ok := hashPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, dns.ErrAlg
+		}
+		mech = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+		data = append(append([]byte{}, prefix...), digest...)
+	case dns.ECDSAP256SHA256, dns.ECDSAP384SHA384:
+		mech = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	case dns.ED25519:
+		mech = pkcs11.NewMechanism(ckmEdDSA, nil)
+	default:
+		return nil, dns.ErrAlg
+	}
+
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+	if err := s.p.ctx.SignInit(s.p.session, []*pkcs11.Mechanism{mech}, s.key); err != nil {
+		return nil, err
+	}
+	sig, err := s.p.ctx.Sign(s.p.session, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.alg == dns.ECDSAP256SHA256 || s.alg == dns.ECDSAP384SHA384 {
+		// The token returns r and s concatenated, crypto.Signer returns them ASN.1 encoded.
+		if len(sig)%2 != 0 {
+			return nil, errors.New("invalid ECDSA signature from token")
+		}
+		half := len(sig) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{new(big.Int).SetBytes(sig[:half]), new(big.Int).SetBytes(sig[half:])})
+	}
+	return sig, nil
+}
+
+// ecPoint returns the uncompressed point, or the raw Ed25519 key, without the ASN.1 OCTET STRING
+// wrapping most tokens put around CKA_EC_POINT.
+func ecPoint(b []byte) []byte {
+	var point []byte
+	if rest, err := asn1.Unmarshal(b, &point); err == nil && len(rest) == 0 {
+		return point
+	}
+	return b
+}
+
+// initialize loads and initializes module, it's done once per module for the lifetime of the process.
+func initialize(module string) (*pkcs11.Ctx, error) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+
+	if ctx, ok := modules[module]; ok {
+		return ctx, nil
+	}
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %q", module)
+	}
+	if err := ctx.Initialize(); err != nil && !isError(err, pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return nil, err
+	}
+	modules[module] = ctx
+	return ctx, nil
+}
+
+func isError(err error, code uint) bool {
+	var e pkcs11.Error
+	return errors.As(err, &e) && uint(e) == code
+}
+
+var (
+	modules   = map[string]*pkcs11.Ctx{}
+	modulesMu sync.Mutex
+)
+
+// These are from PKCS#11 version 3.0, the pkcs11 package doesn't have them.
+const (
+	ckkECEdwards = 0x00000040
+	ckmEdDSA     = 0x00001057
+)
+
+// hashPrefixes are the ASN.1 DigestInfo prefixes for RSA PKCS #1 v1.5 signatures, see crypto/rsa.
+var hashPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
@@ -0,0 +1,20 @@
+//go:build !cgo
+
+package keyprovider
+
+import "errors"
+
+// PKCS11 is the Provider for private keys on a PKCS#11 token. It needs cgo, without it NewPKCS11
+// returns an error.
+type PKCS11 struct{}
+
+// NewPKCS11 returns an error, as CoreDNS is compiled without cgo.
+func NewPKCS11(module, token, pin string) (*PKCS11, error) {
+	return nil, errors.New("PKCS#11 is not supported, CoreDNS must be compiled with CGO_ENABLED=1")
+}
+
+// Close does nothing.
+func (p *PKCS11) Close() error { return nil }
+
+// Load implements the Provider interface.
+func (p *PKCS11) Load(base string) (Key, error) { return Key{}, errNoPrivate }
@@ -0,0 +1,89 @@
+//go:build cgo
+
+package keyprovider
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/miekg/pkcs11"
+)
+
+// newSoftHSM returns a PKCS11 provider for SoftHSM. The test is skipped unless SOFTHSM2_MODULE is
+// set to the path of libsofthsm2.so, with a token initialized like this:
+//
+//	softhsm2-util --init-token --free --label coredns --pin 1234 --so-pin 1234
+func newSoftHSM(t *testing.T) *PKCS11 {
+	module := os.Getenv("SOFTHSM2_MODULE")
+	if module == "" {
+		t.Skip("SOFTHSM2_MODULE not set")
+	}
+	p, err := NewPKCS11(module, "coredns", "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestPKCS11Load(t *testing.T) {
+	p := newSoftHSM(t)
+
+	// Generate a P-256 key pair in the session, it's gone when the session is closed.
+	id := []byte("coredns-test")
+	pub, _, err := p.ctx.GenerateKeyPair(p.session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, false),
+			pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+			pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}), // P-256
+		},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, false),
+			pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs, err := p.ctx.GetAttributeValue(p.session, pub, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Write the public key file for it, the point without the leading 0x04 is the DNSKEY's public key.
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "miek.nl.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+		PublicKey: base64.StdEncoding.EncodeToString(ecPoint(attrs[0].Value)[1:]),
+	}
+	base := filepath.Join(t.TempDir(), "Kmiek.nl.+013+1")
+	if err := os.WriteFile(base+".key", []byte(dnskey.String()+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := p.Load(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify(t, k)
+
+	// A key that isn't on the token.
+	other, _ := writeKey(t, t.TempDir())
+	if _, err := p.Load(other); err == nil {
+		t.Errorf("Expected error for a key that isn't on the token")
+	}
+}
+
+func TestNewPKCS11Error(t *testing.T) {
+	if _, err := NewPKCS11("/nonexistent/libpkcs11.so", "coredns", "1234"); err == nil {
+		t.Errorf("Expected error for a module that doesn't exist")
+	}
+}
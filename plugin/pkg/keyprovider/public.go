@@ -0,0 +1,87 @@
+package keyprovider
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/ed25519"
+)
+
+// publicKey returns the public key of dnskey.
+func publicKey(dnskey *dns.DNSKEY) (crypto.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(dnskey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch dnskey.Algorithm {
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
+		e, n, err := rsaKey(b)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case dns.ECDSAP256SHA256, dns.ECDSAP384SHA384:
+		curve := elliptic.P256()
+		if dnskey.Algorithm == dns.ECDSAP384SHA384 {
+			curve = elliptic.P384()
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(b) != 2*size {
+			return nil, errBadKey
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(b[:size]), Y: new(big.Int).SetBytes(b[size:])}, nil
+	case dns.ED25519:
+		if len(b) != ed25519.PublicKeySize {
+			return nil, errBadKey
+		}
+		return ed25519.PublicKey(b), nil
+	}
+	return nil, dns.ErrAlg
+}
+
+// keyMaterial returns the public key of dnskey the way a PKCS#11 token stores it: the modulus for
+// RSA, the uncompressed point for ECDSA and the key itself for Ed25519.
+func keyMaterial(dnskey *dns.DNSKEY) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(dnskey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch dnskey.Algorithm {
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
+		_, n, err := rsaKey(b)
+		return n, err
+	case dns.ECDSAP256SHA256, dns.ECDSAP384SHA384:
+		return append([]byte{0x04}, b...), nil
+	case dns.ED25519:
+		return b, nil
+	}
+	return nil, dns.ErrAlg
+}
+
+// rsaKey splits an RSA public key in the DNSKEY format (RFC 3110, section 2) in its exponent and modulus.
+func rsaKey(b []byte) (e, n []byte, err error) {
+	if len(b) < 1 {
+		return nil, nil, errBadKey
+	}
+	explen, off := int(b[0]), 1
+	if explen == 0 {
+		if len(b) < 3 {
+			return nil, nil, errBadKey
+		}
+		explen, off = int(b[1])<<8|int(b[2]), 3
+	}
+	if len(b) <= off+explen {
+		return nil, nil, errBadKey
+	}
+	return b[off : off+explen], b[off+explen:], nil
+}
+
+var errBadKey = errors.New("bad public key in DNSKEY")
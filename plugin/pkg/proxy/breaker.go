@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/log"
+)
+
+// Breaker holds the settings of a circuit breaker. The breaker counts the exchanges with an upstream
+// and the ones that failed over windows of Window. When at least MinQueries were made and Ratio of
+// them failed, the circuit opens and the upstream is considered down. After Cooldown a single trial
+// query is let through, the circuit closes when it succeeds and opens again when it fails.
+type Breaker struct {
+	Ratio      float64
+	MinQueries uint32
+	Window     time.Duration
+	Cooldown   time.Duration
+}
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// Closed means queries flow to the upstream.
+	Closed State = iota
+	// Open means the upstream failed too often and no queries are sent to it.
+	Open
+	// HalfOpen means the cooldown is over and a trial query may be sent to the upstream.
+	HalfOpen
+)
+
+// String implements fmt.Stringer.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// circuit is the circuit breaker of one upstream.
+type circuit struct {
+	Breaker
+	proxyName string
+	addr      string
+
+	sync.Mutex
+	state   State
+	start   time.Time // start of the current window
+	queries uint32
+	fails   uint32
+	opened  time.Time // when the circuit opened
+	trial   bool      // whether the trial query is in flight
+}
+
+func newCircuit(b Breaker, proxyName, addr string) *circuit {
+	c := &circuit{Breaker: b, proxyName: proxyName, addr: addr, start: time.Now()}
+	breakerState.WithLabelValues(proxyName, addr).Set(float64(Closed))
+	return c
+}
+
+// current returns the state of the circuit at now: an open circuit is half-open when the cooldown is
+// over, c must be locked.
+func (c *circuit) current(now time.Time) State {
+	if c.state == Open && now.Sub(c.opened) >= c.Cooldown {
+		return HalfOpen
+	}
+	return c.state
+}
+
+// allow returns true if a query may be sent to the upstream. It doesn't reserve the trial query of a
+// half-open circuit, begin does that when the query is sent.
+func (c *circuit) allow() bool {
+	c.Lock()
+	defer c.Unlock()
+
+	switch c.current(time.Now()) {
+	case Closed:
+		return true
+	case HalfOpen:
+		return !c.trial
+	}
+	return false
+}
+
+// begin is called when a query is about to be sent to the upstream. It returns false if the query
+// may not be sent, and whether it is the trial query of a half-open circuit. Only one trial query is
+// let through, even when several queries found the circuit half-open.
+func (c *circuit) begin() (trial, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	if s := c.current(time.Now()); s != c.state {
+		c.transition(s)
+	}
+	switch c.state {
+	case Closed:
+		return false, true
+	case HalfOpen:
+		if c.trial {
+			return false, false
+		}
+		c.trial = true
+		return true, true
+	}
+	return false, false
+}
+
+// done records the outcome of a query, trial must be what begin returned for it.
+func (c *circuit) done(trial, failed bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	if trial {
+		c.trial = false
+		if failed {
+			log.Warningf("Circuit breaker for %s opened: trial query failed", c.addr)
+			c.open()
+			return
+		}
+		c.reset(time.Now())
+		c.transition(Closed)
+		return
+	}
+	// Queries that were in flight when the circuit opened don't count.
+	if c.state != Closed {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(c.start) >= c.Window {
+		c.reset(now)
+	}
+	c.queries++
+	if failed {
+		c.fails++
+	}
+	if c.queries >= c.MinQueries && float64(c.fails) >= c.Ratio*float64(c.queries) {
+		log.Warningf("Circuit breaker for %s opened: %d of %d queries failed", c.addr, c.fails, c.queries)
+		c.open()
+	}
+}
+
+// cancel is called instead of done when the trial query was cancelled.
+func (c *circuit) cancel() {
+	c.Lock()
+	c.trial = false
+	c.Unlock()
+}
+
+func (c *circuit) open() {
+	c.opened = time.Now()
+	c.transition(Open)
+}
+
+func (c *circuit) reset(now time.Time) {
+	c.start = now
+	c.queries = 0
+	c.fails = 0
+}
+
+// transition moves the circuit to state s, c must be locked.
+func (c *circuit) transition(s State) {
+	if c.state == s {
+		return
+	}
+	if s != Open {
+		log.Infof("Circuit breaker for %s is %s", c.addr, s)
+	}
+	c.state = s
+	breakerState.WithLabelValues(c.proxyName, c.addr).Set(float64(s))
+	breakerTransitionCount.WithLabelValues(c.proxyName, c.addr, s.String()).Add(1)
+}
+
+// State returns the state of the circuit breaker, it is Closed when p has none.
+func (p *Proxy) State() State {
+	if p.cb == nil {
+		return Closed
+	}
+	p.cb.Lock()
+	defer p.cb.Unlock()
+	return p.cb.current(time.Now())
+}
+
+// SetBreaker gives p a circuit breaker with the settings in b.
+func (p *Proxy) SetBreaker(b Breaker) { p.cb = newCircuit(b, p.proxyName, p.addr) }
+
+// Tripped returns true if the circuit breaker of p doesn't allow a query to be sent. When it does,
+// Connect may still return ErrTripped if another query became the trial query in the meantime.
+func (p *Proxy) Tripped() bool { return p.cb != nil && !p.cb.allow() }
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func TestCircuit(t *testing.T) {
+	c := newCircuit(Breaker{Ratio: 0.5, MinQueries: 4, Window: time.Minute, Cooldown: 20 * time.Millisecond}, "TestCircuit", "127.0.0.1:53")
+
+	c.done(false, false)
+	c.done(false, true)
+	c.done(false, false)
+	if !c.allow() || c.state != Closed {
+		t.Fatalf("Expected closed circuit, got %s", c.state)
+	}
+	c.done(false, true) // 2 of 4 failed
+	if c.allow() || c.state != Open {
+		t.Fatalf("Expected open circuit, got %s", c.state)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if s := c.current(time.Now()); s != HalfOpen {
+		t.Fatalf("Expected half-open circuit after the cooldown, got %s", s)
+	}
+	if !c.allow() || !c.allow() {
+		t.Fatalf("Expected checking the circuit not to reserve the trial query")
+	}
+	if trial, ok := c.begin(); !trial || !ok {
+		t.Fatalf("Expected the first query to be the trial")
+	}
+	if _, ok := c.begin(); c.allow() || ok {
+		t.Errorf("Expected no queries while the trial is in flight")
+	}
+	c.done(false, false) // was in flight before, doesn't count
+	c.done(true, true)
+	if c.state != Open {
+		t.Fatalf("Expected open circuit after failed trial, got %s", c.state)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	c.begin()
+	c.cancel()
+	if trial, _ := c.begin(); !trial {
+		t.Fatalf("Expected a new trial after a cancelled one")
+	}
+	c.done(true, false)
+	if !c.allow() || c.state != Closed {
+		t.Fatalf("Expected closed circuit after good trial, got %s", c.state)
+	}
+	c.done(false, true)
+	if c.state != Closed {
+		t.Errorf("Expected the counts to be reset when the circuit closed, got %s", c.state)
+	}
+}
+
+func TestCircuitWindow(t *testing.T) {
+	c := newCircuit(Breaker{Ratio: 0.5, MinQueries: 2, Window: 20 * time.Millisecond, Cooldown: time.Minute}, "TestCircuitWindow", "127.0.0.1:53")
+
+	c.done(false, true)
+	time.Sleep(20 * time.Millisecond)
+	c.done(false, true)
+	if c.state != Closed {
+		t.Errorf("Expected failures in an earlier window not to count, got %s", c.state)
+	}
+}
+
+func TestProxyBreaker(t *testing.T) {
+	s := dnstest.NewSilentServer()
+	defer s.Close()
+
+	p := NewProxy("TestProxyBreaker", s.Addr, transport.DNS)
+	p.readTimeout = 10 * time.Millisecond
+	p.SetBreaker(Breaker{Ratio: 1, MinQueries: 2, Window: time.Minute, Cooldown: time.Minute})
+	p.Start(5 * time.Second)
+	defer p.Stop()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	req := request.Request{Req: m, W: &test.ResponseWriter{}}
+
+	for i := 0; i < 2; i++ {
+		if p.Down(0) {
+			t.Fatalf("Expected proxy to be up after %d failures", i)
+		}
+		if _, err := p.Connect(context.Background(), req, Options{}); err == nil {
+			t.Fatalf("Expected error from upstream that doesn't reply")
+		}
+	}
+	if !p.Down(0) || p.State() != Open {
+		t.Errorf("Expected proxy to be down with an open circuit, got %s", p.State())
+	}
+	if _, err := p.Connect(context.Background(), req, Options{}); err != ErrTripped {
+		t.Errorf("Expected %s when the circuit is open, got %v", ErrTripped, err)
+	}
+
+	// Cancelled queries aren't the upstream's fault.
+	q := NewProxy("TestProxyBreaker", s.Addr, transport.DNS)
+	q.readTimeout = 10 * time.Millisecond
+	q.SetBreaker(Breaker{Ratio: 1, MinQueries: 1, Window: time.Minute, Cooldown: time.Minute})
+	q.Start(5 * time.Second)
+	defer q.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.Connect(ctx, req, Options{})
+	if q.State() != Closed {
+		t.Errorf("Expected closed circuit after a cancelled query, got %s", q.State())
+	}
+}
@@ -1,7 +1,7 @@
 // Package proxy implements a forwarding proxy. It caches an upstream net.Conn for some time, so if the same
 // client returns the upstream's Conn will be precached. Depending on how you benchmark this looks to be
-// 50% faster than just opening a new connection for every client. It works with UDP and TCP and uses
-// inband healthchecking.
+// 50% faster than just opening a new connection for every client. It works with UDP, TCP, DNS-over-TLS,
+// DNS-over-QUIC and DNS-over-HTTPS and uses inband healthchecking.
 package proxy
 
 import (
@@ -32,8 +32,13 @@ func limitTimeout(currentAvg *int64, minValue time.Duration, maxValue time.Durat
 }
 
 func averageTimeout(currentAvg *int64, observedDuration time.Duration, weight int64) {
-	dt := time.Duration(atomic.LoadInt64(currentAvg))
-	atomic.AddInt64(currentAvg, int64(observedDuration-dt)/weight)
+	ewma(currentAvg, int64(observedDuration), weight)
+}
+
+// ewma moves the average in currentAvg towards observed, moderated by weight.
+func ewma(currentAvg *int64, observed int64, weight int64) {
+	avg := atomic.LoadInt64(currentAvg)
+	atomic.AddInt64(currentAvg, (observed-avg)/weight)
 }
 
 func (t *Transport) dialTimeout() time.Duration {
@@ -72,8 +77,42 @@ func (t *Transport) Dial(proto string) (*persistConn, bool, error) {
 	return &persistConn{c: conn}, false, err
 }
 
-// Connect selects an upstream, sends the request and waits for a response.
+// Connect selects an upstream, sends the request and waits for a response. The time it took and
+// whether it failed are recorded in the round trip time and error rate of p, and in its circuit
+// breaker. When the circuit breaker doesn't allow the query ErrTripped is returned.
 func (p *Proxy) Connect(ctx context.Context, state request.Request, opts Options) (*dns.Msg, error) {
+	trial := false
+	if p.cb != nil {
+		ok := false
+		if trial, ok = p.cb.begin(); !ok {
+			return nil, ErrTripped
+		}
+	}
+	start := time.Now()
+	ret, err := p.connect(ctx, state, opts)
+	if err == nil && ret.Rcode == dns.RcodeBadCookie && p.cookies != nil {
+		// The upstream wants a valid server cookie, it has sent us a new one.
+		ret, err = p.connect(ctx, state, opts)
+	}
+	if err != ErrCachedClosed && ctx.Err() == nil { // neither is the upstream's fault
+		p.observe(time.Since(start), err)
+		if p.cb != nil {
+			p.cb.done(trial, err != nil)
+		}
+	} else if trial {
+		p.cb.cancel()
+	}
+	return ret, err
+}
+
+func (p *Proxy) connect(ctx context.Context, state request.Request, opts Options) (*dns.Msg, error) {
+	switch {
+	case p.doq != nil:
+		return p.connectQUIC(ctx, state)
+	case p.doh != nil:
+		return p.connectHTTPS(ctx, state)
+	}
+
 	start := time.Now()
 
 	proto := ""
@@ -104,6 +143,13 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts Options
 	defer func() {
 		state.Req.Id = originId
 	}()
+	// Likewise replace the client's cookie with ours.
+	cookies := p.cookies
+	if cookies != nil && state.Req.IsEdns0() != nil {
+		defer cookies.set(state.Req)()
+	} else {
+		cookies = nil
+	}
 
 	if err := pc.c.WriteMsg(state.Req); err != nil {
 		pc.c.Close() // not giving it back
@@ -137,8 +183,8 @@ func (p *Proxy) Connect(ctx context.Context, state request.Request, opts Options
 			}
 			return ret, err
 		}
-		// drop out-of-order responses
-		if state.Req.Id == ret.Id {
+		// drop out-of-order responses, and spoofs that don't echo our client cookie
+		if state.Req.Id == ret.Id && (cookies == nil || cookies.check(ret)) {
 			break
 		}
 	}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"sync"
+
+	"github.com/coredns/coredns/plugin/pkg/cookie"
+
+	"github.com/miekg/dns"
+)
+
+// cookies holds the client cookie sent to an upstream and the last server cookie it sent back, see
+// RFC 7873.
+type cookies struct {
+	client []byte
+
+	sync.Mutex
+	server []byte
+}
+
+// SetCookies makes p send DNS Cookies to its upstream, with a random client cookie. Replies that
+// don't echo the client cookie are dropped. DNS Cookies aren't sent over DNS-over-QUIC and
+// DNS-over-HTTPS, these can't be spoofed.
+func (p *Proxy) SetCookies() error {
+	client := make([]byte, cookie.ClientLen)
+	if _, err := rand.Read(client); err != nil {
+		return err
+	}
+	p.cookies = &cookies{client: client}
+	return nil
+}
+
+// set replaces the COOKIE option in m with the client cookie and the server cookie learned, m must have
+// an OPT record. It returns a function that restores the options of m.
+func (c *cookies) set(m *dns.Msg) func() {
+	o := m.IsEdns0()
+	options := o.Option
+	o.Option = append(make([]dns.EDNS0, 0, len(options)+1), options...)
+
+	c.Lock()
+	server := c.server
+	c.Unlock()
+	cookie.Set(m, c.client, server)
+
+	return func() { o.Option = options }
+}
+
+// check returns false if the reply m doesn't echo the client cookie, otherwise it learns the server
+// cookie in m. A reply without a cookie is only accepted while no server cookie has been learned,
+// as the upstream may not support cookies, see RFC 7873, section 5.3. The COOKIE option is removed
+// from m, it is of no use to the client.
+func (c *cookies) check(m *dns.Msg) bool {
+	o := cookie.Find(m)
+	if o == nil {
+		c.Lock()
+		defer c.Unlock()
+		return c.server == nil
+	}
+	client, server, err := cookie.Split(o)
+	if err != nil || !bytes.Equal(client, c.client) {
+		return false
+	}
+	if server != nil {
+		c.Lock()
+		c.server = server
+		c.Unlock()
+	}
+	cookie.Remove(m)
+	return true
+}
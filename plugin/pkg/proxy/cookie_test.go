@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cookie"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+func TestProxyCookies(t *testing.T) {
+	server := []byte("0123456789abcdef")
+	var queries int32
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&queries, 1)
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		ret.SetEdns0(4096, false)
+
+		client, got, err := cookie.Split(cookie.Find(r))
+		if err != nil {
+			t.Errorf("Expected a valid cookie, got %s", err)
+			return
+		}
+		switch r.Question[0].Name {
+		case "spoof.example.org.":
+			client = make([]byte, cookie.ClientLen)
+		case "nocookie.example.org.":
+			ret.Answer = append(ret.Answer, test.A(r.Question[0].Name+" IN A 127.0.0.1"))
+			w.WriteMsg(ret)
+			return
+		}
+		if !bytes.Equal(got, server) {
+			ret.Rcode = dns.RcodeBadCookie
+		} else {
+			ret.Answer = append(ret.Answer, test.A(r.Question[0].Name+" IN A 127.0.0.1"))
+		}
+		cookie.Set(ret, client, server)
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	p := NewProxy("TestProxyCookies", s.Addr, transport.DNS)
+	p.readTimeout = 10 * time.Millisecond
+	if err := p.SetCookies(); err != nil {
+		t.Fatal(err)
+	}
+	p.Start(5 * time.Second)
+	defer p.Stop()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	m.SetEdns0(4096, false)
+	o := m.IsEdns0()
+	o.Option = append(o.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "1111111111111111"})
+	req := request.Request{Req: m, W: &test.ResponseWriter{}}
+
+	// The first query learns the server cookie from the BADCOOKIE reply, and is retried with it.
+	ret, err := p.Connect(context.Background(), req, Options{PreferUDP: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if ret.Rcode != dns.RcodeSuccess || len(ret.Answer) != 1 {
+		t.Errorf("Expected an answer, got %s", ret)
+	}
+	if x := atomic.LoadInt32(&queries); x != 2 {
+		t.Errorf("Expected 2 queries, got %d", x)
+	}
+	if o := cookie.Find(ret); o != nil {
+		t.Errorf("Expected the upstream's cookie to be removed, got %s", o.Cookie)
+	}
+	if o := cookie.Find(m); o == nil || o.Cookie != "1111111111111111" {
+		t.Errorf("Expected the client's cookie to be restored, got %v", o)
+	}
+
+	if _, err := p.Connect(context.Background(), req, Options{PreferUDP: true}); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if x := atomic.LoadInt32(&queries); x != 3 {
+		t.Errorf("Expected the server cookie to be reused, got %d queries", x)
+	}
+
+	// A reply that doesn't echo our client cookie is dropped.
+	m.Question[0].Name = "spoof.example.org."
+	if ret, err := p.Connect(context.Background(), req, Options{PreferUDP: true}); err == nil {
+		t.Errorf("Expected the reply to be dropped, got %s", ret)
+	}
+	// So is a reply without a cookie, now that the upstream has sent us a server cookie.
+	m.Question[0].Name = "nocookie.example.org."
+	if ret, err := p.Connect(context.Background(), req, Options{PreferUDP: true}); err == nil {
+		t.Errorf("Expected the reply without a cookie to be dropped, got %s", ret)
+	}
+
+	// Before that, the upstream may not support cookies.
+	q := NewProxy("TestProxyCookies", s.Addr, transport.DNS)
+	q.readTimeout = 10 * time.Millisecond
+	if err := q.SetCookies(); err != nil {
+		t.Fatal(err)
+	}
+	q.Start(5 * time.Second)
+	defer q.Stop()
+	if _, err := q.Connect(context.Background(), req, Options{PreferUDP: true}); err != nil {
+		t.Errorf("Expected a reply without a cookie to be accepted, got %s", err)
+	}
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	neturl "net/url"
+	"strconv"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/doh"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// dohTransport sends queries to a DNS-over-HTTPS endpoint. Connections are pooled by the
+// underlying http.Transport, which multiplexes requests over HTTP/2 when the server supports it.
+type dohTransport struct {
+	avgDialTime int64 // kind of average time of dial time
+	url         string
+	addr        string // host:port from url
+	method      string
+	proxyName   string
+
+	transport *http.Transport
+	client    *http.Client
+}
+
+func newDoHTransport(proxyName, url string) *dohTransport {
+	t := &dohTransport{
+		avgDialTime: int64(maxDialTimeout / 2),
+		url:         url,
+		addr:        hostPort(url),
+		method:      http.MethodPost,
+		proxyName:   proxyName,
+	}
+	t.transport = &http.Transport{
+		DialContext:         t.dialContext,
+		TLSClientConfig:     &tls.Config{NextProtos: []string{"h2", "http/1.1"}},
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: dohMaxIdleConns,
+		IdleConnTimeout:     defaultExpire,
+		TLSHandshakeTimeout: maxDialTimeout,
+	}
+	t.client = &http.Client{Transport: t.transport}
+	return t
+}
+
+// hostPort returns the host and port of the DoH URL u, the port is 443 when u doesn't have one.
+func hostPort(u string) string {
+	parsed, err := neturl.Parse(u)
+	if err != nil {
+		return ""
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+	}
+	return net.JoinHostPort(parsed.Hostname(), port)
+}
+
+func (t *dohTransport) dialTimeout() time.Duration {
+	return limitTimeout(&t.avgDialTime, minDialTimeout, maxDialTimeout)
+}
+
+func (t *dohTransport) updateDialTimeout(newDialTime time.Duration) {
+	averageTimeout(&t.avgDialTime, newDialTime, cumulativeAvgWeight)
+}
+
+func (t *dohTransport) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	reqTime := time.Now()
+	d := &net.Dialer{Timeout: t.dialTimeout()}
+	conn, err := d.DialContext(ctx, network, addr)
+	t.updateDialTimeout(time.Since(reqTime))
+	return conn, err
+}
+
+// Exchange sends m to the DoH endpoint and returns the response.
+func (t *dohTransport) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				connCacheHitsCount.WithLabelValues(t.proxyName, t.url, "https").Add(1)
+				return
+			}
+			connCacheMissesCount.WithLabelValues(t.proxyName, t.url, "https").Add(1)
+		},
+	}
+	return exchangeDoH(httptrace.WithClientTrace(ctx, trace), t.client, t.method, t.url, m)
+}
+
+// exchangeDoH performs a single DoH request with client.
+func exchangeDoH(ctx context.Context, client *http.Client, method, url string, m *dns.Msg) (*dns.Msg, error) {
+	req, err := doh.NewRequestURL(method, url, m)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected HTTP status code from %s: %d", url, resp.StatusCode)
+	}
+
+	return doh.ResponseToMsg(resp)
+}
+
+// Stop closes all idle connections.
+func (t *dohTransport) Stop() { t.transport.CloseIdleConnections() }
+
+// SetExpire sets the time after which idle connections are closed.
+func (t *dohTransport) SetExpire(expire time.Duration) { t.transport.IdleConnTimeout = expire }
+
+// SetTLSConfig sets the TLS config, the ALPN is always set to "h2" and "http/1.1".
+func (t *dohTransport) SetTLSConfig(cfg *tls.Config) {
+	cfg = cfg.Clone()
+	cfg.NextProtos = []string{"h2", "http/1.1"}
+	t.transport.TLSClientConfig = cfg
+}
+
+// SetMethod sets the HTTP method, GET or POST, used for the DoH requests.
+func (t *dohTransport) SetMethod(method string) { t.method = method }
+
+// connectHTTPS sends the request to the upstream over DNS-over-HTTPS and waits for a response.
+func (p *Proxy) connectHTTPS(ctx context.Context, state request.Request) (*dns.Msg, error) {
+	start := time.Now()
+
+	// The request may need to establish a new connection, allow for that on top of the read timeout.
+	ctx, cancel := context.WithTimeout(ctx, p.doh.dialTimeout()+p.readTimeout)
+	defer cancel()
+
+	// Use a message ID of 0 to maximize HTTP cache friendliness, see section 4.1 of RFC 8484.
+	originId := state.Req.Id
+	state.Req.Id = 0
+	ret, err := p.doh.Exchange(ctx, state.Req)
+	state.Req.Id = originId
+	if err != nil {
+		return nil, err
+	}
+	ret.Id = originId
+
+	rc, ok := dns.RcodeToString[ret.Rcode]
+	if !ok {
+		rc = strconv.Itoa(ret.Rcode)
+	}
+
+	requestDuration.WithLabelValues(p.proxyName, p.addr, rc).Observe(time.Since(start).Seconds())
+
+	return ret, nil
+}
+
+const dohMaxIdleConns = 4
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/doh"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// newDoHServer starts a HTTP/2 DoH server that replies with an A record for every query and
+// records the HTTP method and protocol of the last request.
+func newDoHServer(method, proto *atomic.Value) *httptest.Server {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method.Store(r.Method)
+		proto.Store(r.Proto)
+		if r.URL.Path != doh.Path {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		m, err := doh.RequestToMsg(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ret := new(dns.Msg)
+		ret.SetReply(m)
+		ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.1"))
+		buf, _ := ret.Pack()
+		w.Header().Set("Content-Type", doh.MimeType)
+		w.Write(buf)
+	}))
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	return s
+}
+
+func TestProxyDoH(t *testing.T) {
+	var method, proto atomic.Value
+	s := newDoHServer(&method, &proto)
+	defer s.Close()
+
+	for _, m := range []string{http.MethodPost, http.MethodGet} {
+		p := NewProxy("TestProxyDoH", s.URL+doh.Path, transport.HTTPS)
+		p.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+		p.SetDoHMethod(m)
+		p.readTimeout = 1 * time.Second
+
+		req := new(dns.Msg)
+		req.SetQuestion("example.org.", dns.TypeA)
+		req.Id = 1234
+		state := request.Request{Req: req, W: dnstest.NewRecorder(&test.ResponseWriter{})}
+
+		resp, err := p.Connect(context.Background(), state, Options{})
+		if err != nil {
+			t.Fatalf("Failed to connect to DoH server: %s", err)
+		}
+		if resp.Id != 1234 {
+			t.Errorf("Expected message ID %d, got %d", 1234, resp.Id)
+		}
+		if x := resp.Answer[0].Header().Name; x != "example.org." {
+			t.Errorf("Expected %s, got %s", "example.org.", x)
+		}
+		if x := method.Load().(string); x != m {
+			t.Errorf("Expected HTTP method %s, got %s", m, x)
+		}
+		if x := proto.Load().(string); x != "HTTP/2.0" {
+			t.Errorf("Expected HTTP/2.0, got %s", x)
+		}
+	}
+}
+
+func TestProxyDoHFail(t *testing.T) {
+	var method, proto atomic.Value
+	s := newDoHServer(&method, &proto)
+	defer s.Close()
+
+	p := NewProxy("TestProxyDoHFail", s.URL+"/bad-path", transport.HTTPS)
+	p.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	p.readTimeout = 1 * time.Second
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.org.", dns.TypeA)
+	state := request.Request{Req: req, W: dnstest.NewRecorder(&test.ResponseWriter{})}
+
+	if _, err := p.Connect(context.Background(), state, Options{}); err == nil {
+		t.Fatal("Expected error for non-200 HTTP response, got none")
+	}
+}
+
+func TestHealthDoH(t *testing.T) {
+	var method, proto atomic.Value
+	s := newDoHServer(&method, &proto)
+	defer s.Close()
+
+	hc := NewHealthChecker("TestHealthDoH", transport.HTTPS, true, ".")
+	hc.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+
+	p := NewProxy("TestHealthDoH", s.URL+doh.Path, transport.HTTPS)
+	p.fails = 1
+	if err := hc.Check(p); err != nil {
+		t.Errorf("Check failed: %v", err)
+	}
+	if p.Fails() != 0 {
+		t.Errorf("Expected fails to be reset to 0, got %d", p.Fails())
+	}
+}
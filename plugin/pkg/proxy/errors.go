@@ -11,6 +11,8 @@ var (
 	ErrNoForward = errors.New("no forwarder defined")
 	// ErrCachedClosed means cached connection was closed by peer.
 	ErrCachedClosed = errors.New("cached connection was closed by peer")
+	// ErrTripped means the circuit breaker didn't allow the query to be sent.
+	ErrTripped = errors.New("circuit breaker is open")
 )
 
 // Options holds various Options that can be set.
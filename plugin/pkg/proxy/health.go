@@ -1,7 +1,9 @@
 package proxy
 
 import (
+	"context"
 	"crypto/tls"
+	"net/http"
 	"sync/atomic"
 	"time"
 
@@ -9,6 +11,7 @@ import (
 	"github.com/coredns/coredns/plugin/pkg/transport"
 
 	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
 )
 
 // HealthChecker checks the upstream health.
@@ -51,6 +54,33 @@ func NewHealthChecker(proxyName, trans string, recursionDesired bool, domain str
 			domain:           domain,
 			proxyName:        proxyName,
 		}
+
+	case transport.HTTPS:
+		return &dohHc{
+			c: &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig:   &tls.Config{NextProtos: []string{"h2", "http/1.1"}},
+					ForceAttemptHTTP2: true,
+					DisableKeepAlives: true,
+				},
+			},
+			method:           http.MethodPost,
+			readTimeout:      1 * time.Second,
+			writeTimeout:     1 * time.Second,
+			recursionDesired: recursionDesired,
+			domain:           domain,
+			proxyName:        proxyName,
+		}
+
+	case transport.QUIC:
+		return &quicHc{
+			tlsConfig:        &tls.Config{NextProtos: []string{doqALPN}},
+			readTimeout:      1 * time.Second,
+			writeTimeout:     1 * time.Second,
+			recursionDesired: recursionDesired,
+			domain:           domain,
+			proxyName:        proxyName,
+		}
 	}
 
 	log.Warningf("No healthchecker for transport %q", trans)
@@ -132,3 +162,169 @@ func (h *dnsHc) send(addr string) error {
 
 	return err
 }
+
+// quicHc is a health checker for a DNS-over-QUIC endpoint. Each check dials a new QUIC connection.
+type quicHc struct {
+	tlsConfig        *tls.Config
+	readTimeout      time.Duration
+	writeTimeout     time.Duration
+	recursionDesired bool
+	domain           string
+
+	proxyName string
+}
+
+func (h *quicHc) SetTLSConfig(cfg *tls.Config) {
+	cfg = cfg.Clone()
+	cfg.NextProtos = []string{doqALPN}
+	h.tlsConfig = cfg
+}
+
+func (h *quicHc) GetTLSConfig() *tls.Config {
+	return h.tlsConfig
+}
+
+func (h *quicHc) SetRecursionDesired(recursionDesired bool) {
+	h.recursionDesired = recursionDesired
+}
+func (h *quicHc) GetRecursionDesired() bool {
+	return h.recursionDesired
+}
+
+func (h *quicHc) SetDomain(domain string) {
+	h.domain = domain
+}
+func (h *quicHc) GetDomain() string {
+	return h.domain
+}
+
+// SetTCPTransport is a no-op, DNS-over-QUIC always uses QUIC.
+func (h *quicHc) SetTCPTransport() {}
+
+func (h *quicHc) GetReadTimeout() time.Duration {
+	return h.readTimeout
+}
+
+func (h *quicHc) SetReadTimeout(t time.Duration) {
+	h.readTimeout = t
+}
+
+func (h *quicHc) GetWriteTimeout() time.Duration {
+	return h.writeTimeout
+}
+
+func (h *quicHc) SetWriteTimeout(t time.Duration) {
+	h.writeTimeout = t
+}
+
+// Check is used as the up.Func in the up.Probe.
+func (h *quicHc) Check(p *Proxy) error {
+	err := h.send(p.addr)
+	if err != nil {
+		healthcheckFailureCount.WithLabelValues(p.proxyName, p.addr).Add(1)
+		p.incrementFails()
+		return err
+	}
+
+	atomic.StoreUint32(&p.fails, 0)
+	return nil
+}
+
+func (h *quicHc) send(addr string) error {
+	ping := new(dns.Msg)
+	ping.SetQuestion(h.domain, dns.TypeNS)
+	ping.MsgHdr.RecursionDesired = h.recursionDesired
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.writeTimeout+h.readTimeout)
+	defer cancel()
+
+	conn, err := quic.DialAddr(ctx, addr, h.tlsConfig, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.CloseWithError(0, "")
+
+	_, err = exchangeQUIC(ctx, conn, ping, h.readTimeout)
+	return err
+}
+
+// dohHc is a health checker for a DNS-over-HTTPS endpoint. Each check uses a new HTTP connection.
+type dohHc struct {
+	c                *http.Client
+	method           string
+	readTimeout      time.Duration
+	writeTimeout     time.Duration
+	recursionDesired bool
+	domain           string
+
+	proxyName string
+}
+
+func (h *dohHc) SetTLSConfig(cfg *tls.Config) {
+	cfg = cfg.Clone()
+	cfg.NextProtos = []string{"h2", "http/1.1"}
+	h.c.Transport.(*http.Transport).TLSClientConfig = cfg
+}
+
+func (h *dohHc) GetTLSConfig() *tls.Config {
+	return h.c.Transport.(*http.Transport).TLSClientConfig
+}
+
+func (h *dohHc) SetRecursionDesired(recursionDesired bool) {
+	h.recursionDesired = recursionDesired
+}
+func (h *dohHc) GetRecursionDesired() bool {
+	return h.recursionDesired
+}
+
+func (h *dohHc) SetDomain(domain string) {
+	h.domain = domain
+}
+func (h *dohHc) GetDomain() string {
+	return h.domain
+}
+
+// SetTCPTransport is a no-op, DNS-over-HTTPS always uses TCP.
+func (h *dohHc) SetTCPTransport() {}
+
+func (h *dohHc) GetReadTimeout() time.Duration {
+	return h.readTimeout
+}
+
+func (h *dohHc) SetReadTimeout(t time.Duration) {
+	h.readTimeout = t
+}
+
+func (h *dohHc) GetWriteTimeout() time.Duration {
+	return h.writeTimeout
+}
+
+func (h *dohHc) SetWriteTimeout(t time.Duration) {
+	h.writeTimeout = t
+}
+
+// Check is used as the up.Func in the up.Probe.
+func (h *dohHc) Check(p *Proxy) error {
+	err := h.send(p.addr)
+	if err != nil {
+		healthcheckFailureCount.WithLabelValues(p.proxyName, p.addr).Add(1)
+		p.incrementFails()
+		return err
+	}
+
+	atomic.StoreUint32(&p.fails, 0)
+	return nil
+}
+
+func (h *dohHc) send(url string) error {
+	ping := new(dns.Msg)
+	ping.SetQuestion(h.domain, dns.TypeNS)
+	ping.MsgHdr.RecursionDesired = h.recursionDesired
+	ping.Id = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.writeTimeout+h.readTimeout)
+	defer cancel()
+
+	_, err := exchangeDoH(ctx, h.c, h.method, url, ping)
+	return err
+}
@@ -37,4 +37,18 @@ var (
 		Name:      "conn_cache_misses_total",
 		Help:      "Counter of connection cache misses per upstream and protocol.",
 	}, []string{"proxy_name", "to", "proto"})
+
+	breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "proxy",
+		Name:      "circuit_breaker_state",
+		Help:      "Gauge of the state of the circuit breaker per upstream, 0 is closed, 1 open and 2 half-open.",
+	}, []string{"proxy_name", "to"})
+
+	breakerTransitionCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "proxy",
+		Name:      "circuit_breaker_transitions_total",
+		Help:      "Counter of the circuit breaker state transitions per upstream and new state.",
+	}, []string{"proxy_name", "to", "state"})
 )
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/transport"
 	"github.com/coredns/coredns/plugin/pkg/up"
 )
 
@@ -17,9 +18,19 @@ type Proxy struct {
 	proxyName string
 
 	transport *Transport
+	doq       *quicTransport // only set when the upstream speaks DNS-over-QUIC
+	doh       *dohTransport  // only set when the upstream speaks DNS-over-HTTPS
 
 	readTimeout time.Duration
 
+	// observed performance, see RTT and ErrorRate
+	avgRTT  int64 // nanoseconds
+	errRate int64 // parts per million
+
+	cb *circuit // circuit breaker, nil when there is none
+
+	cookies *cookies // DNS Cookies, nil when they aren't sent
+
 	// health checking
 	probe  *up.Probe
 	health HealthChecker
@@ -36,6 +47,12 @@ func NewProxy(proxyName, addr, trans string) *Proxy {
 		health:      NewHealthChecker(proxyName, trans, true, "."),
 		proxyName:   proxyName,
 	}
+	switch trans {
+	case transport.QUIC:
+		p.doq = newQUICTransport(proxyName, addr)
+	case transport.HTTPS:
+		p.doh = newDoHTransport(proxyName, addr)
+	}
 
 	runtime.SetFinalizer(p, (*Proxy).finalizer)
 	return p
@@ -43,14 +60,48 @@ func NewProxy(proxyName, addr, trans string) *Proxy {
 
 func (p *Proxy) Addr() string { return p.addr }
 
+// DialAddr returns the host:port the proxy connects to. This is Addr, except for DNS-over-HTTPS
+// where Addr is the URL of the endpoint.
+func (p *Proxy) DialAddr() string {
+	if p.doh != nil {
+		return p.doh.addr
+	}
+	return p.addr
+}
+
 // SetTLSConfig sets the TLS config in the lower p.transport and in the healthchecking client.
 func (p *Proxy) SetTLSConfig(cfg *tls.Config) {
-	p.transport.SetTLSConfig(cfg)
+	switch {
+	case p.doq != nil:
+		p.doq.SetTLSConfig(cfg)
+	case p.doh != nil:
+		p.doh.SetTLSConfig(cfg)
+	default:
+		p.transport.SetTLSConfig(cfg)
+	}
 	p.health.SetTLSConfig(cfg)
 }
 
 // SetExpire sets the expire duration in the lower p.transport.
-func (p *Proxy) SetExpire(expire time.Duration) { p.transport.SetExpire(expire) }
+func (p *Proxy) SetExpire(expire time.Duration) {
+	if p.doq != nil {
+		p.doq.SetExpire(expire)
+	}
+	if p.doh != nil {
+		p.doh.SetExpire(expire)
+	}
+	p.transport.SetExpire(expire)
+}
+
+// SetDoHMethod sets the HTTP method used for DNS-over-HTTPS upstreams, it is a no-op for other transports.
+func (p *Proxy) SetDoHMethod(method string) {
+	if p.doh != nil {
+		p.doh.SetMethod(method)
+	}
+	if hc, ok := p.health.(*dohHc); ok {
+		hc.method = method
+	}
+}
 
 func (p *Proxy) GetHealthchecker() HealthChecker {
 	return p.health
@@ -60,6 +111,25 @@ func (p *Proxy) Fails() uint32 {
 	return atomic.LoadUint32(&p.fails)
 }
 
+// RTT returns the moving average of the time the exchanges with p took, including the failed ones.
+// It is zero until the first exchange.
+func (p *Proxy) RTT() time.Duration { return time.Duration(atomic.LoadInt64(&p.avgRTT)) }
+
+// ErrorRate returns the moving average of the fraction of exchanges with p that failed.
+func (p *Proxy) ErrorRate() float64 { return float64(atomic.LoadInt64(&p.errRate)) / 1e6 }
+
+// observe records the duration and outcome of an exchange. The first one sets the RTT.
+func (p *Proxy) observe(d time.Duration, err error) {
+	if !atomic.CompareAndSwapInt64(&p.avgRTT, 0, int64(d)) {
+		averageTimeout(&p.avgRTT, d, statsAvgWeight)
+	}
+	failed := int64(0)
+	if err != nil {
+		failed = 1e6
+	}
+	ewma(&p.errRate, failed, statsAvgWeight)
+}
+
 // Healthcheck kicks of a round of health checks for this proxy.
 func (p *Proxy) Healthcheck() {
 	if p.health == nil {
@@ -72,8 +142,12 @@ func (p *Proxy) Healthcheck() {
 	})
 }
 
-// Down returns true if this proxy is down, i.e. has *more* fails than maxfails.
+// Down returns true if this proxy is down, i.e. has *more* fails than maxfails or its circuit
+// breaker is tripped.
 func (p *Proxy) Down(maxfails uint32) bool {
+	if p.Tripped() {
+		return true
+	}
 	if maxfails == 0 {
 		return false
 	}
@@ -83,8 +157,16 @@ func (p *Proxy) Down(maxfails uint32) bool {
 }
 
 // Stop close stops the health checking goroutine.
-func (p *Proxy) Stop()      { p.probe.Stop() }
-func (p *Proxy) finalizer() { p.transport.Stop() }
+func (p *Proxy) Stop() { p.probe.Stop() }
+func (p *Proxy) finalizer() {
+	p.transport.Stop()
+	if p.doq != nil {
+		p.doq.Stop()
+	}
+	if p.doh != nil {
+		p.doh.Stop()
+	}
+}
 
 // Start starts the proxy's healthchecking.
 func (p *Proxy) Start(duration time.Duration) {
@@ -108,4 +190,8 @@ func (p *Proxy) incrementFails() {
 
 const (
 	maxTimeout = 2 * time.Second
+
+	// statsAvgWeight moderates the moving averages of RTT and ErrorRate, a new observation moves
+	// them 1/statsAvgWeight of the way.
+	statsAvgWeight = 8
 )
@@ -3,6 +3,7 @@ package proxy
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"math"
 	"testing"
 	"time"
@@ -128,3 +129,39 @@ func TestProxyIncrementFails(t *testing.T) {
 		})
 	}
 }
+
+func TestProxyStats(t *testing.T) {
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		ret := new(dns.Msg)
+		ret.SetReply(r)
+		w.WriteMsg(ret)
+	})
+	defer s.Close()
+
+	p := NewProxy("TestProxyStats", s.Addr, transport.DNS)
+	p.readTimeout = 10 * time.Millisecond
+	p.Start(5 * time.Second)
+	defer p.Stop()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	req := request.Request{Req: m, W: &test.ResponseWriter{}}
+
+	if p.RTT() != 0 {
+		t.Errorf("Expected no RTT before the first exchange, got %s", p.RTT())
+	}
+	if _, err := p.Connect(context.Background(), req, Options{PreferUDP: true}); err != nil {
+		t.Fatalf("Failed to connect to testdnsserver: %s", err)
+	}
+	if p.RTT() <= 0 || p.RTT() > p.readTimeout {
+		t.Errorf("Expected RTT between 0 and %s, got %s", p.readTimeout, p.RTT())
+	}
+	if p.ErrorRate() != 0 {
+		t.Errorf("Expected error rate 0, got %f", p.ErrorRate())
+	}
+
+	p.observe(p.readTimeout, errors.New("timeout"))
+	if x := p.ErrorRate(); x != 1.0/statsAvgWeight {
+		t.Errorf("Expected error rate %f, got %f", 1.0/statsAvgWeight, x)
+	}
+}
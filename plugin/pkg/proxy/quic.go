@@ -0,0 +1,247 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// quicTransport holds a single QUIC connection to the upstream. Each query is sent on its own
+// stream on that connection, see RFC 9250, so there is no need for a pool of connections.
+type quicTransport struct {
+	avgDialTime int64 // kind of average time of dial time
+	addr        string
+	proxyName   string
+	tlsConfig   *tls.Config
+	quicConfig  *quic.Config
+
+	mu      sync.Mutex // protects conn and stopped
+	conn    quic.Connection
+	stopped bool
+}
+
+func newQUICTransport(proxyName, addr string) *quicTransport {
+	return &quicTransport{
+		avgDialTime: int64(maxDialTimeout / 2),
+		addr:        addr,
+		proxyName:   proxyName,
+		tlsConfig:   &tls.Config{NextProtos: []string{doqALPN}},
+		quicConfig:  &quic.Config{MaxIdleTimeout: defaultExpire},
+	}
+}
+
+func (t *quicTransport) dialTimeout() time.Duration {
+	return limitTimeout(&t.avgDialTime, minDialTimeout, maxDialTimeout)
+}
+
+func (t *quicTransport) updateDialTimeout(newDialTime time.Duration) {
+	averageTimeout(&t.avgDialTime, newDialTime, cumulativeAvgWeight)
+}
+
+// Dial returns the cached QUIC connection if it is still alive, otherwise a new connection is established.
+// The handshake is done without holding the lock, so queries that find a live connection aren't
+// held up by it.
+func (t *quicTransport) Dial(ctx context.Context) (quic.Connection, bool, error) {
+	if conn := t.cached(); conn != nil {
+		connCacheHitsCount.WithLabelValues(t.proxyName, t.addr, "quic").Add(1)
+		return conn, true, nil
+	}
+	connCacheMissesCount.WithLabelValues(t.proxyName, t.addr, "quic").Add(1)
+
+	reqTime := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, t.dialTimeout())
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, t.addr, t.tlsConfig, t.quicConfig)
+	t.updateDialTimeout(time.Since(reqTime))
+	if err != nil {
+		return nil, false, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		conn.CloseWithError(0, "")
+		return nil, false, net.ErrClosed
+	}
+	if t.conn != nil && t.conn.Context().Err() == nil {
+		// Another query dialed at the same time, and was first.
+		conn.CloseWithError(0, "")
+		return t.conn, false, nil
+	}
+	t.conn = conn
+	return conn, false, nil
+}
+
+// cached returns the cached connection if it is still alive.
+func (t *quicTransport) cached() quic.Connection {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn != nil && t.conn.Context().Err() != nil {
+		t.conn = nil
+	}
+	return t.conn
+}
+
+// Exchange sends m to the upstream and returns its response, the cached connection is used when available.
+func (t *quicTransport) Exchange(ctx context.Context, m *dns.Msg, readTimeout time.Duration) (*dns.Msg, error) {
+	conn, cached, err := t.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := exchangeQUIC(ctx, conn, m, readTimeout)
+	if err != nil {
+		// If the connection itself is gone, don't hand it out again.
+		if conn.Context().Err() != nil {
+			t.drop(conn)
+			if cached {
+				return nil, ErrCachedClosed
+			}
+		}
+		return nil, err
+	}
+	return ret, nil
+}
+
+// exchangeQUIC sends m on a new stream on conn and returns the response. The message ID of m is
+// ignored: it is set to 0 on the wire as required by RFC 9250, section 4.2.1.
+func exchangeQUIC(ctx context.Context, conn quic.Connection, m *dns.Msg, readTimeout time.Duration) (*dns.Msg, error) {
+	buf, err := packDoQ(m)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stream.SetWriteDeadline(time.Now().Add(maxTimeout))
+	if _, err := stream.Write(buf); err != nil {
+		stream.CancelRead(0)
+		return nil, err
+	}
+	// The client MUST send the DNS query over the selected stream, and MUST indicate through
+	// the STREAM FIN mechanism that no further data will be sent on that stream.
+	stream.Close()
+
+	stream.SetReadDeadline(time.Now().Add(readTimeout))
+	ret, err := readDoQ(stream)
+	if err != nil {
+		stream.CancelRead(0)
+		return nil, err
+	}
+	return ret, nil
+}
+
+// drop forgets conn if it is the cached connection and closes it.
+func (t *quicTransport) drop(conn quic.Connection) {
+	t.mu.Lock()
+	if t.conn == conn {
+		t.conn = nil
+	}
+	t.mu.Unlock()
+	conn.CloseWithError(0, "")
+}
+
+// Stop closes the cached connection.
+func (t *quicTransport) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	if t.conn != nil {
+		t.conn.CloseWithError(0, "")
+		t.conn = nil
+	}
+}
+
+// SetExpire sets the idle timeout of the QUIC connection.
+func (t *quicTransport) SetExpire(expire time.Duration) { t.quicConfig.MaxIdleTimeout = expire }
+
+// SetTLSConfig sets the TLS config, the ALPN is always set to "doq".
+func (t *quicTransport) SetTLSConfig(cfg *tls.Config) {
+	cfg = cfg.Clone()
+	cfg.NextProtos = []string{doqALPN}
+	t.tlsConfig = cfg
+}
+
+// packDoQ packs m with a zero message ID, prefixed with the 2-octet length. Any edns-tcp-keepalive
+// option is removed, as a DoQ server treats this as a protocol error.
+func packDoQ(m *dns.Msg) ([]byte, error) {
+	if opt := m.IsEdns0(); opt != nil {
+		for _, o := range opt.Option {
+			if o.Option() == dns.EDNS0TCPKEEPALIVE {
+				m = m.Copy()
+				opt = m.IsEdns0()
+				opts := opt.Option[:0]
+				for _, o := range opt.Option {
+					if o.Option() != dns.EDNS0TCPKEEPALIVE {
+						opts = append(opts, o)
+					}
+				}
+				opt.Option = opts
+				break
+			}
+		}
+	}
+
+	b, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(buf, uint16(len(b)))
+	copy(buf[2:], b)
+	buf[2], buf[3] = 0, 0 // message ID
+	return buf, nil
+}
+
+// readDoQ reads a single length prefixed DNS message from r.
+func readDoQ(r io.Reader) (*dns.Msg, error) {
+	l := make([]byte, 2)
+	if _, err := io.ReadFull(r, l); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(l))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	ret := new(dns.Msg)
+	if err := ret.Unpack(buf); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+const doqALPN = "doq"
+
+// connectQUIC sends the request to the upstream over DNS-over-QUIC and waits for a response.
+func (p *Proxy) connectQUIC(ctx context.Context, state request.Request) (*dns.Msg, error) {
+	start := time.Now()
+
+	ret, err := p.doq.Exchange(ctx, state.Req, p.readTimeout)
+	if err != nil {
+		return nil, err
+	}
+	// The message ID is always 0 in DoQ, restore the one from the request.
+	ret.Id = state.Req.Id
+
+	rc, ok := dns.RcodeToString[ret.Rcode]
+	if !ok {
+		rc = strconv.Itoa(ret.Rcode)
+	}
+
+	requestDuration.WithLabelValues(p.proxyName, p.addr, rc).Observe(time.Since(start).Seconds())
+
+	return ret, nil
+}
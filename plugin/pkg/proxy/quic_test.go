@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// newQUICServer starts a DoQ server on a random port on localhost that replies with an A record
+// for every query. The number of accepted connections is counted in conns.
+func newQUICServer(t *testing.T, conns *uint32) *quic.Listener {
+	cert, err := tls.LoadX509KeyPair("../../tls/test_cert.pem", "../../tls/test_key.pem")
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %s", err)
+	}
+	l, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{doqALPN}}, nil)
+	if err != nil {
+		t.Fatalf("Failed to start QUIC listener: %s", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			atomic.AddUint32(conns, 1)
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					r, err := readDoQ(stream)
+					if err != nil || r.Id != 0 {
+						conn.CloseWithError(2, "")
+						return
+					}
+					ret := new(dns.Msg)
+					ret.SetReply(r)
+					ret.Answer = append(ret.Answer, test.A("example.org. IN A 127.0.0.1"))
+					buf, _ := ret.Pack()
+					out := make([]byte, 2+len(buf))
+					binary.BigEndian.PutUint16(out, uint16(len(buf)))
+					copy(out[2:], buf)
+					stream.Write(out)
+					stream.Close()
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestProxyQUIC(t *testing.T) {
+	conns := uint32(0)
+	l := newQUICServer(t, &conns)
+	defer l.Close()
+
+	p := NewProxy("TestProxyQUIC", l.Addr().String(), transport.QUIC)
+	p.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+	p.readTimeout = 1 * time.Second
+	p.Start(5 * time.Second)
+	defer p.Stop()
+
+	for i := 0; i < 3; i++ {
+		m := new(dns.Msg)
+		m.SetQuestion("example.org.", dns.TypeA)
+		m.Id = 1234
+
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		req := request.Request{Req: m, W: rec}
+
+		resp, err := p.Connect(context.Background(), req, Options{})
+		if err != nil {
+			t.Fatalf("Failed to connect to QUIC server: %s", err)
+		}
+		if resp.Id != 1234 {
+			t.Errorf("Expected message ID %d, got %d", 1234, resp.Id)
+		}
+		if x := resp.Answer[0].Header().Name; x != "example.org." {
+			t.Errorf("Expected %s, got %s", "example.org.", x)
+		}
+	}
+
+	if x := atomic.LoadUint32(&conns); x != 1 {
+		t.Errorf("Expected QUIC connection to be reused, got %d connections", x)
+	}
+}
+
+func TestQUICDialUnlocked(t *testing.T) {
+	s := dnstest.NewSilentServer()
+	defer s.Close()
+
+	tr := newQUICTransport("TestQUICDialUnlocked", s.Addr)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		_, _, err := tr.Dial(ctx)
+		done <- err
+	}()
+
+	// The handshake never completes, that must not hold up the transport.
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	tr.Stop()
+	if x := time.Since(start); x > 100*time.Millisecond {
+		t.Errorf("Expected Stop not to wait for the handshake, took %s", x)
+	}
+	if err := <-done; err == nil {
+		t.Errorf("Expected the handshake to fail")
+	}
+}
+
+func TestHealthQUIC(t *testing.T) {
+	conns := uint32(0)
+	l := newQUICServer(t, &conns)
+	defer l.Close()
+
+	hc := NewHealthChecker("TestHealthQUIC", transport.QUIC, true, ".")
+	hc.SetTLSConfig(&tls.Config{InsecureSkipVerify: true})
+
+	p := NewProxy("TestHealthQUIC", l.Addr().String(), transport.QUIC)
+	p.fails = 1
+	if err := hc.Check(p); err != nil {
+		t.Errorf("Check failed: %v", err)
+	}
+	if p.Fails() != 0 {
+		t.Errorf("Expected fails to be reset to 0, got %d", p.Fails())
+	}
+}
+
+func TestPackDoQ(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.org.", dns.TypeA)
+	m.Id = 1234
+	m.SetEdns0(4096, false)
+	o := m.IsEdns0()
+	o.Option = append(o.Option, &dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE}, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+
+	buf, err := packDoQ(m)
+	if err != nil {
+		t.Fatalf("Failed to pack message: %s", err)
+	}
+	if l := int(binary.BigEndian.Uint16(buf)); l != len(buf)-2 {
+		t.Errorf("Expected length prefix %d, got %d", len(buf)-2, l)
+	}
+
+	r := new(dns.Msg)
+	if err := r.Unpack(buf[2:]); err != nil {
+		t.Fatalf("Failed to unpack message: %s", err)
+	}
+	if r.Id != 0 {
+		t.Errorf("Expected message ID 0, got %d", r.Id)
+	}
+	if x := len(r.IsEdns0().Option); x != 1 {
+		t.Errorf("Expected 1 EDNS0 option, got %d", x)
+	}
+	// The original message must not be modified.
+	if m.Id != 1234 || len(o.Option) != 2 {
+		t.Errorf("Expected original message to be left unmodified")
+	}
+}
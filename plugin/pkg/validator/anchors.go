@@ -0,0 +1,41 @@
+package validator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// RootAnchors holds the DS records of the root zone's key signing keys, KSK-2017 and KSK-2024, as
+// published by IANA.
+const RootAnchors = `. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+. IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16
+`
+
+// ReadAnchors reads trust anchors, DS or DNSKEY records in zone file format, from r. Other records
+// are ignored.
+func ReadAnchors(r io.Reader, file string) ([]dns.RR, error) {
+	zp := dns.NewZoneParser(r, ".", file)
+	anchors := []dns.RR{}
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch rr.(type) {
+		case *dns.DS, *dns.DNSKEY:
+			anchors = append(anchors, rr)
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	if len(anchors) == 0 {
+		return nil, fmt.Errorf("no DS or DNSKEY records in %s", file)
+	}
+	return anchors, nil
+}
+
+// Root returns the trust anchors of the root zone.
+func Root() []dns.RR {
+	anchors, _ := ReadAnchors(strings.NewReader(RootAnchors), "root anchors")
+	return anchors
+}
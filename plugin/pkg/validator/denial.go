@@ -0,0 +1,399 @@
+package validator
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+
+	"github.com/miekg/dns"
+)
+
+// signatures returns the RRSIG records in rrs.
+func signatures(rrs []dns.RR) []*dns.RRSIG {
+	sigs := []*dns.RRSIG{}
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// rrSets groups the records in rrs by owner name and type, leaving out RRSIG and OPT records.
+func rrSets(rrs []dns.RR) [][]dns.RR {
+	type key struct {
+		name  string
+		rtype uint16
+	}
+	idx := map[key]int{}
+	sets := [][]dns.RR{}
+	for _, rr := range rrs {
+		t := rr.Header().Rrtype
+		if t == dns.TypeRRSIG || t == dns.TypeOPT {
+			continue
+		}
+		k := key{strings.ToLower(rr.Header().Name), t}
+		i, ok := idx[k]
+		if !ok {
+			i = len(sets)
+			idx[k] = i
+			sets = append(sets, nil)
+		}
+		sets[i] = append(sets[i], rr)
+	}
+	return sets
+}
+
+// authority returns the records in the authority section ns that are part of a negative answer,
+// the SOA and the NSEC and NSEC3 records.
+func authority(ns []dns.RR) []dns.RR {
+	ret := []dns.RR{}
+	for _, rr := range ns {
+		switch rr.Header().Rrtype {
+		case dns.TypeSOA, dns.TypeNSEC, dns.TypeNSEC3:
+			ret = append(ret, rr)
+		}
+	}
+	return ret
+}
+
+// synthesized returns true if set is an unsigned CNAME synthesized from one of the DNAMEs, that is
+// its target is its owner name with the DNAME's owner replaced by the DNAME's target, see RFC 6672.
+func synthesized(set []dns.RR, sigs []*dns.RRSIG, dnames []*dns.DNAME) bool {
+	c, ok := set[0].(*dns.CNAME)
+	if !ok || len(set) != 1 {
+		return false
+	}
+	for _, sig := range sigs {
+		if sig.TypeCovered == dns.TypeCNAME && strings.EqualFold(sig.Hdr.Name, c.Hdr.Name) {
+			return false
+		}
+	}
+	for _, d := range dnames {
+		if !dns.IsSubDomain(d.Hdr.Name, c.Hdr.Name) || strings.EqualFold(d.Hdr.Name, c.Hdr.Name) {
+			continue
+		}
+		prefix := c.Hdr.Name[:len(c.Hdr.Name)-len(d.Hdr.Name)]
+		if strings.EqualFold(c.Target, dns.Fqdn(prefix+d.Target)) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcard returns the number of labels of the wildcard that set was expanded from, if it was.
+func wildcard(set []dns.RR, sigs []*dns.RRSIG) (int, bool) {
+	owner := set[0].Header().Name
+	for _, sig := range sigs {
+		if sig.TypeCovered != set[0].Header().Rrtype || !strings.EqualFold(sig.Hdr.Name, owner) {
+			continue
+		}
+		if n := dns.CountLabel(owner); int(sig.Labels) < n {
+			return int(sig.Labels), true
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// target follows the CNAMEs in answer, starting at name, and returns the last target.
+func target(answer []dns.RR, name string) string {
+	for i := 0; i < len(answer); i++ {
+		for _, rr := range answer {
+			if c, ok := rr.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, name) {
+				name = c.Target
+				break
+			}
+		}
+	}
+	return name
+}
+
+// answered returns true if answer holds records of type qtype for name.
+func answered(answer []dns.RR, name string, qtype uint16) bool {
+	for _, rr := range answer {
+		h := rr.Header()
+		if strings.EqualFold(h.Name, name) && (h.Rrtype == qtype || qtype == dns.TypeANY) && h.Rrtype != dns.TypeRRSIG {
+			return true
+		}
+	}
+	return qtype == dns.TypeCNAME && !strings.EqualFold(target(answer, name), name)
+}
+
+// denied returns Secure if the NSEC or NSEC3 records in rrs prove that name doesn't exist, or that it
+// has no records of type qtype if nxdomain is false. The proof is Insecure if it relies on an opt-out
+// NSEC3 record or if the NSEC3 records use too many iterations. It returns false if rrs doesn't
+// prove anything.
+func denied(rrs []dns.RR, name string, qtype uint16, nxdomain bool) (Result, bool) {
+	if expensive(rrs) {
+		return Insecure, true
+	}
+	if !nxdomain {
+		for _, rr := range rrs {
+			var bitmap []uint16
+			switch x := rr.(type) {
+			case *dns.NSEC:
+				if !strings.EqualFold(x.Hdr.Name, name) {
+					continue
+				}
+				bitmap = x.TypeBitMap
+			case *dns.NSEC3:
+				if !x.Match(name) {
+					continue
+				}
+				bitmap = x.TypeBitMap
+			default:
+				continue
+			}
+			return Secure, !hasType(bitmap, qtype) && !hasType(bitmap, dns.TypeCNAME)
+		}
+		// The name may be an empty non-terminal, or match a wildcard without the type.
+		ce, optOut, ok := closestEncloser(rrs, name)
+		if !ok {
+			return 0, false
+		}
+		// An opt-out span may hold an insecure delegation, which has no DS records (RFC 5155, section 8.6).
+		if optOut && qtype == dns.TypeDS {
+			return Insecure, true
+		}
+		for _, rr := range rrs {
+			switch x := rr.(type) {
+			case *dns.NSEC:
+				if strings.EqualFold(x.Hdr.Name, "*."+ce) {
+					return Secure, !hasType(x.TypeBitMap, qtype) && !hasType(x.TypeBitMap, dns.TypeCNAME)
+				}
+				if covers(x, name) && dns.IsSubDomain(name, x.NextDomain) {
+					return Secure, true // empty non-terminal
+				}
+			case *dns.NSEC3:
+				if x.Match("*." + ce) {
+					return Secure, !hasType(x.TypeBitMap, qtype) && !hasType(x.TypeBitMap, dns.TypeCNAME)
+				}
+			}
+		}
+		return 0, false
+	}
+
+	ce, optOut, ok := closestEncloser(rrs, name)
+	if !ok {
+		return 0, false
+	}
+	// No wildcard at the closest encloser either.
+	if !nonexistent(rrs, "*."+ce) {
+		return 0, false
+	}
+	// The name may still exist as an insecure delegation in an opt-out span (RFC 5155, section 9.2).
+	if optOut {
+		return Insecure, true
+	}
+	return Secure, true
+}
+
+// closestEncloser returns the closest encloser of name that doesn't exist, after checking that the
+// name one label below it, the next closer name, is covered by rrs. It also returns true if the
+// NSEC3 record that covers the next closer name has the opt-out flag set.
+func closestEncloser(rrs []dns.RR, name string) (string, bool, bool) {
+	for _, rr := range rrs {
+		nsec, ok := rr.(*dns.NSEC)
+		if !ok || !covers(nsec, name) {
+			continue
+		}
+		// The closest encloser is the longest ancestor shared with either end of the NSEC.
+		ce := commonAncestor(name, nsec.Hdr.Name)
+		if c := commonAncestor(name, nsec.NextDomain); dns.CountLabel(c) > dns.CountLabel(ce) {
+			ce = c
+		}
+		return ce, false, true
+	}
+
+	labels := dns.SplitDomainName(name)
+	for i := 1; i < len(labels); i++ {
+		ce := dns.Fqdn(strings.Join(labels[i:], "."))
+		if !matched(rrs, ce) {
+			continue
+		}
+		next := dns.Fqdn(strings.Join(labels[i-1:], "."))
+		for _, rr := range rrs {
+			if x, ok := rr.(*dns.NSEC3); ok && x.Cover(next) {
+				return ce, x.Flags&1 == 1, true
+			}
+		}
+	}
+	return "", false, false
+}
+
+// nonexistent returns true if an NSEC or NSEC3 record in rrs covers name.
+func nonexistent(rrs []dns.RR, name string) bool {
+	for _, rr := range rrs {
+		switch x := rr.(type) {
+		case *dns.NSEC:
+			if covers(x, name) {
+				return true
+			}
+		case *dns.NSEC3:
+			if x.Cover(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matched returns true if an NSEC3 record in rrs matches name.
+func matched(rrs []dns.RR, name string) bool {
+	for _, rr := range rrs {
+		if x, ok := rr.(*dns.NSEC3); ok && x.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// noCloser returns true if the NSEC or NSEC3 records in rrs prove that there is no name closer to
+// name than the wildcard with labels labels it was expanded from.
+func noCloser(rrs []dns.RR, name string, labels int) bool {
+	l := dns.SplitDomainName(name)
+	if labels+1 > len(l) {
+		return false
+	}
+	next := dns.Fqdn(strings.Join(l[len(l)-labels-1:], "."))
+	for _, rr := range rrs {
+		switch x := rr.(type) {
+		case *dns.NSEC:
+			if covers(x, name) {
+				return true
+			}
+		case *dns.NSEC3:
+			if x.Cover(next) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// delegated returns how name is delegated, according to the denial of existence of its DS records
+// in rrs. It returns false if rrs doesn't prove anything.
+func delegated(rrs []dns.RR, name string, nxdomain bool) (cutKind, bool) {
+	if expensive(rrs) {
+		return cutInsecure, true
+	}
+	for _, rr := range rrs {
+		var bitmap []uint16
+		switch x := rr.(type) {
+		case *dns.NSEC:
+			if !strings.EqualFold(x.Hdr.Name, name) {
+				continue
+			}
+			bitmap = x.TypeBitMap
+		case *dns.NSEC3:
+			if !x.Match(name) {
+				continue
+			}
+			bitmap = x.TypeBitMap
+		default:
+			continue
+		}
+		switch {
+		case hasType(bitmap, dns.TypeDS):
+			return 0, false
+		case hasType(bitmap, dns.TypeNS) && !hasType(bitmap, dns.TypeSOA):
+			return cutInsecure, true
+		}
+		return cutNone, true
+	}
+
+	if nxdomain {
+		r, ok := denied(rrs, name, dns.TypeDS, true)
+		switch {
+		case !ok:
+			return 0, false
+		case r == Insecure:
+			return cutInsecure, true
+		}
+		return cutNXDomain, true
+	}
+
+	for _, rr := range rrs {
+		switch x := rr.(type) {
+		case *dns.NSEC:
+			// An empty non-terminal.
+			if covers(x, name) && dns.IsSubDomain(name, x.NextDomain) {
+				return cutNone, true
+			}
+		case *dns.NSEC3:
+			// An opt-out span may hold insecure delegations.
+			if x.Flags&1 == 1 && x.Cover(name) {
+				return cutInsecure, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// expensive returns true if an NSEC3 record in rrs uses more iterations than validators need to
+// support (RFC 9276, section 3.2).
+func expensive(rrs []dns.RR) bool {
+	for _, rr := range rrs {
+		if x, ok := rr.(*dns.NSEC3); ok && x.Iterations > dnsutil.MaxNSEC3Iterations {
+			return true
+		}
+	}
+	return false
+}
+
+func hasType(bitmap []uint16, t uint16) bool {
+	for _, b := range bitmap {
+		if b == t {
+			return true
+		}
+	}
+	return false
+}
+
+// covers returns true if name falls between the owner and the next name of nsec.
+func covers(nsec *dns.NSEC, name string) bool {
+	owner, next := nsec.Hdr.Name, nsec.NextDomain
+	if compare(owner, next) < 0 {
+		return compare(owner, name) < 0 && compare(name, next) < 0
+	}
+	// The last NSEC in the zone, next is the apex.
+	return compare(owner, name) < 0 || (compare(name, next) < 0 && dns.IsSubDomain(next, name))
+}
+
+// compare compares a and b in canonical DNS name order (RFC 4034, section 6.1).
+func compare(a, b string) int {
+	la, lb := labels(a), labels(b)
+	i, j := len(la)-1, len(lb)-1
+	for i >= 0 && j >= 0 {
+		if c := bytes.Compare(la[i], lb[j]); c != 0 {
+			return c
+		}
+		i--
+		j--
+	}
+	return len(la) - len(lb)
+}
+
+// labels returns the lowercased labels of name in wire format, without the escapes of the
+// presentation format.
+func labels(name string) [][]byte {
+	buf := make([]byte, 256)
+	n, err := dns.PackDomainName(dns.Fqdn(name), buf, 0, nil, false)
+	if err != nil {
+		return nil
+	}
+	ls := [][]byte{}
+	for i := 0; i < n && buf[i] != 0; i += int(buf[i]) + 1 {
+		ls = append(ls, bytes.ToLower(buf[i+1:i+1+int(buf[i])]))
+	}
+	return ls
+}
+
+// commonAncestor returns the longest name that both a and b are equal to or below.
+func commonAncestor(a, b string) string {
+	n := dns.CompareDomainName(a, b)
+	labels := dns.SplitDomainName(a)
+	return dns.Fqdn(strings.Join(labels[len(labels)-n:], "."))
+}
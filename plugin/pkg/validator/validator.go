@@ -0,0 +1,595 @@
+// Package validator implements DNSSEC validation of responses. The chain of trust is followed from
+// the closest trust anchor down to the signer of the data, with the DS and DNSKEY queries that are
+// needed for it sent through an Exchanger. Validated keys and delegations are cached.
+package validator
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+
+	"github.com/miekg/dns"
+)
+
+// Result is the outcome of validating a response.
+type Result int
+
+const (
+	// Insecure means there is no chain of trust to the data, it isn't signed or no trust anchor covers it.
+	Insecure Result = iota
+	// Secure means the data is signed and the signatures are valid up to a trust anchor.
+	Secure
+	// Bogus means the data should have been signed, but the signatures or proofs are missing or invalid.
+	Bogus
+)
+
+func (r Result) String() string {
+	switch r {
+	case Insecure:
+		return "insecure"
+	case Secure:
+		return "secure"
+	case Bogus:
+		return "bogus"
+	}
+	return ""
+}
+
+// Error is the reason a response is bogus. Code is the extended DNS error (RFC 8914) for it.
+type Error struct {
+	Code   uint16
+	Reason string
+
+	temporary bool // caused by a failed query, not remembered
+}
+
+func (e *Error) Error() string { return "dnssec validation failed: " + e.Reason }
+
+func bogus(code uint16, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Reason: fmt.Sprintf(format, a...)}
+}
+
+// Exchanger sends the query m and returns the response. The validator uses it for the DS and DNSKEY
+// queries it needs.
+type Exchanger func(ctx context.Context, m *dns.Msg) (*dns.Msg, error)
+
+// Validator validates responses against a set of trust anchors.
+type Validator struct {
+	anchors map[string][]dns.RR // DS or DNSKEY records, per zone
+
+	zones *cache.Cache // *zone per zone name, holding the validated keys
+	cuts  *cache.Cache // *cut per name, if and how a name is delegated
+
+	now func() time.Time
+}
+
+// New returns a Validator that uses the DS and DNSKEY records in anchors as trust anchors.
+func New(anchors []dns.RR) *Validator {
+	v := &Validator{anchors: map[string][]dns.RR{}, zones: cache.New(defaultCap), cuts: cache.New(defaultCap), now: time.Now}
+	for _, rr := range anchors {
+		name := strings.ToLower(rr.Header().Name)
+		v.anchors[name] = append(v.anchors[name], rr)
+	}
+	return v
+}
+
+const (
+	defaultCap = 10000
+	minTTL     = 10 * time.Second
+	maxTTL     = time.Hour
+	badTTL     = time.Minute // how long validation failures of keys and delegations are remembered
+)
+
+// Validate validates the response m. A bogus response is returned together with an *Error.
+func (v *Validator) Validate(ctx context.Context, ex Exchanger, m *dns.Msg) (Result, error) {
+	if len(m.Question) == 0 {
+		return Insecure, nil
+	}
+	q := m.Question[0]
+	result := Secure
+
+	// The answer section, including CNAME chains.
+	sigs := signatures(m.Answer)
+	dnames := []*dns.DNAME{}
+	for _, rr := range m.Answer {
+		if d, ok := rr.(*dns.DNAME); ok {
+			dnames = append(dnames, d)
+		}
+	}
+	for _, set := range rrSets(m.Answer) {
+		if synthesized(set, sigs, dnames) {
+			continue
+		}
+		r, err := v.verify(ctx, ex, set, sigs)
+		if err != nil {
+			return Bogus, err
+		}
+		if r == Insecure {
+			result = Insecure
+			continue
+		}
+		// Data expanded from a wildcard needs a proof that the name itself doesn't exist.
+		if labels, ok := wildcard(set, sigs); ok {
+			if err := v.verifyAuthority(ctx, ex, m.Ns); err != nil {
+				return Bogus, err
+			}
+			if expensive(m.Ns) {
+				result = Insecure
+				continue
+			}
+			if !noCloser(m.Ns, set[0].Header().Name, labels) {
+				return Bogus, bogus(dns.ExtendedErrorCodeNSECMissing, "no proof for wildcard expansion of %s", set[0].Header().Name)
+			}
+		}
+	}
+
+	name := target(m.Answer, q.Name)
+	if answered(m.Answer, name, q.Qtype) || (m.Rcode != dns.RcodeSuccess && m.Rcode != dns.RcodeNameError) {
+		return result, nil
+	}
+	if result == Insecure {
+		// The CNAME chain went through an insecure zone, so will the denial.
+		return Insecure, nil
+	}
+
+	// A negative answer for name, the authority section should hold the signed denial.
+	auth := authority(m.Ns)
+	if len(auth) == 0 {
+		z, err := v.zone(ctx, ex, name)
+		if err != nil {
+			return Bogus, err
+		}
+		if z.keys == nil {
+			return Insecure, nil
+		}
+		return Bogus, bogus(dns.ExtendedErrorCodeNSECMissing, "no denial of existence for %s", name)
+	}
+	nsigs := signatures(m.Ns)
+	for _, set := range rrSets(auth) {
+		r, err := v.verify(ctx, ex, set, nsigs)
+		if err != nil {
+			return Bogus, err
+		}
+		if r == Insecure {
+			return Insecure, nil
+		}
+	}
+	r, ok := denied(auth, name, q.Qtype, m.Rcode == dns.RcodeNameError)
+	if !ok {
+		return Bogus, bogus(dns.ExtendedErrorCodeNSECMissing, "no valid denial of existence for %s %s", name, dns.Type(q.Qtype))
+	}
+	return r, nil
+}
+
+// verifyAuthority verifies the signatures of the NSEC and NSEC3 records in the authority section ns.
+func (v *Validator) verifyAuthority(ctx context.Context, ex Exchanger, ns []dns.RR) error {
+	sigs := signatures(ns)
+	for _, set := range rrSets(authority(ns)) {
+		if t := set[0].Header().Rrtype; t != dns.TypeNSEC && t != dns.TypeNSEC3 {
+			continue
+		}
+		if r, err := v.verify(ctx, ex, set, sigs); err != nil {
+			return err
+		} else if r == Insecure {
+			return bogus(dns.ExtendedErrorCodeNSECMissing, "unsigned denial of existence in a signed zone")
+		}
+	}
+	return nil
+}
+
+// verify verifies the RRset set with the signatures in sigs that cover it.
+func (v *Validator) verify(ctx context.Context, ex Exchanger, set []dns.RR, sigs []*dns.RRSIG) (Result, error) {
+	owner, typ := set[0].Header().Name, set[0].Header().Rrtype
+	covering := []*dns.RRSIG{}
+	for _, sig := range sigs {
+		if sig.TypeCovered == typ && strings.EqualFold(sig.Hdr.Name, owner) {
+			covering = append(covering, sig)
+		}
+	}
+
+	if len(covering) == 0 {
+		// Unsigned data is fine in an insecure zone. DS records are in the zone of the parent.
+		name := owner
+		if typ == dns.TypeDS {
+			name = parent(owner)
+		}
+		z, err := v.zone(ctx, ex, name)
+		if err != nil {
+			return Bogus, err
+		}
+		if z.keys == nil {
+			return Insecure, nil
+		}
+		return Bogus, bogus(dns.ExtendedErrorCodeRRSIGsMissing, "no signatures for %s %s", owner, dns.Type(typ))
+	}
+
+	var err *Error
+	for _, sig := range covering {
+		signer := sig.SignerName
+		if !dns.IsSubDomain(signer, owner) {
+			err = bogus(dns.ExtendedErrorCodeDNSBogus, "signer %s is not a parent of %s", signer, owner)
+			continue
+		}
+		z, zerr := v.zone(ctx, ex, signer)
+		if zerr != nil {
+			return Bogus, zerr
+		}
+		if z.keys == nil {
+			return Insecure, nil
+		}
+		if !strings.EqualFold(z.name, signer) {
+			err = bogus(dns.ExtendedErrorCodeDNSKEYMissing, "signer %s of %s is not a zone", signer, owner)
+			continue
+		}
+		if err = v.check(sig, z.keys, set); err == nil {
+			return Secure, nil
+		}
+	}
+	return Bogus, err
+}
+
+// check checks the signature sig over set with keys.
+func (v *Validator) check(sig *dns.RRSIG, keys []*dns.DNSKEY, set []dns.RR) *Error {
+	err := bogus(dns.ExtendedErrorCodeDNSKEYMissing, "no key %d for the signature of %s %s", sig.KeyTag, sig.Hdr.Name, dns.Type(sig.TypeCovered))
+	for _, k := range keys {
+		if k.Algorithm != sig.Algorithm || k.KeyTag() != sig.KeyTag {
+			continue
+		}
+		if !sig.ValidityPeriod(v.now()) {
+			return v.expired(sig)
+		}
+		if e := sig.Verify(k, set); e != nil {
+			err = bogus(dns.ExtendedErrorCodeDNSBogus, "signature of %s %s: %s", sig.Hdr.Name, dns.Type(sig.TypeCovered), e)
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+// expired returns the error for the signature sig that is outside of its validity period.
+func (v *Validator) expired(sig *dns.RRSIG) *Error {
+	// Serial number arithmetic on the inception time, like RRSIG.ValidityPeriod does.
+	utc := v.now().UTC().Unix()
+	incep := int64(sig.Inception) + (int64(sig.Inception)-utc)/year68*year68
+	if incep > utc {
+		return bogus(dns.ExtendedErrorCodeSignatureNotYetValid, "signature of %s %s is not yet valid", sig.Hdr.Name, dns.Type(sig.TypeCovered))
+	}
+	return bogus(dns.ExtendedErrorCodeSignatureExpired, "signature of %s %s has expired", sig.Hdr.Name, dns.Type(sig.TypeCovered))
+}
+
+const year68 = 1 << 31 // for RFC 1982 (Serial Arithmetic) calculations in 32 bits
+
+// zone is a zone with its validated keys, keys is nil if the zone is insecure.
+type zone struct {
+	name   string
+	keys   []*dns.DNSKEY
+	err    *Error
+	expire time.Time
+}
+
+// cut says if name is delegated, as proven by the response to a DS query.
+type cut struct {
+	kind   cutKind
+	ds     []dns.RR
+	err    *Error
+	expire time.Time
+}
+
+type cutKind int
+
+const (
+	cutSecure   cutKind = iota // signed DS records
+	cutInsecure                // a delegation without DS records
+	cutNone                    // not a delegation
+	cutNXDomain                // the name doesn't exist
+)
+
+// zone returns the closest enclosing zone of name, by following the chain of trust from the closest
+// trust anchor down. If name isn't covered by a trust anchor or is below an insecure delegation, the
+// returned zone has no keys.
+func (v *Validator) zone(ctx context.Context, ex Exchanger, name string) (*zone, error) {
+	name = strings.ToLower(dns.Fqdn(name))
+	anchor := ""
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if _, ok := v.anchors[name[off:]]; ok {
+			anchor = name[off:]
+			break
+		}
+	}
+	if anchor == "" && v.anchors["."] != nil {
+		anchor = "."
+	}
+	if anchor == "" {
+		return &zone{name: "."}, nil
+	}
+
+	z := v.cachedZone(ctx, ex, anchor, v.anchors[anchor])
+	if z.err != nil {
+		return nil, z.err
+	}
+
+	// Walk down from the anchor to name, one label at a time.
+	labels := dns.SplitDomainName(name)
+	for i := len(labels) - dns.CountLabel(anchor) - 1; i >= 0; i-- {
+		if z.keys == nil {
+			return z, nil
+		}
+		child := dns.Fqdn(strings.Join(labels[i:], "."))
+		c := v.cachedCut(ctx, ex, z, child)
+		if c.err != nil {
+			return nil, c.err
+		}
+		switch c.kind {
+		case cutSecure:
+			z = v.cachedZone(ctx, ex, child, c.ds)
+			if z.err != nil {
+				return nil, z.err
+			}
+		case cutInsecure:
+			return &zone{name: child}, nil
+		case cutNXDomain:
+			return z, nil
+		}
+	}
+	return z, nil
+}
+
+func (v *Validator) cachedZone(ctx context.Context, ex Exchanger, name string, anchors []dns.RR) *zone {
+	k := key("zone", name)
+	if i, ok := v.zones.Get(k); ok {
+		if z := i.(*zone); v.now().Before(z.expire) {
+			return z
+		}
+	}
+	z := v.keys(ctx, ex, name, anchors)
+	if z.err != nil {
+		if z.err.temporary {
+			return z // don't remember failed queries
+		}
+		z.expire = v.now().Add(badTTL)
+	}
+	v.zones.Add(k, z)
+	return z
+}
+
+func (v *Validator) cachedCut(ctx context.Context, ex Exchanger, parent *zone, name string) *cut {
+	k := key("cut", name)
+	if i, ok := v.cuts.Get(k); ok {
+		if c := i.(*cut); v.now().Before(c.expire) {
+			return c
+		}
+	}
+	c := v.delegation(ctx, ex, parent, name)
+	if c.err != nil {
+		if c.err.temporary {
+			return c
+		}
+		c.expire = v.now().Add(badTTL)
+	}
+	v.cuts.Add(k, c)
+	return c
+}
+
+// keys fetches the DNSKEY records of zone name and validates them with the DS or DNSKEY records
+// in anchors.
+func (v *Validator) keys(ctx context.Context, ex Exchanger, name string, anchors []dns.RR) *zone {
+	z := &zone{name: name}
+
+	// Only anchors with algorithms we support count, without any the zone is treated as insecure.
+	supported := []dns.RR{}
+	for _, a := range anchors {
+		switch a := a.(type) {
+		case *dns.DS:
+			if algorithms[a.Algorithm] && digests[a.DigestType] {
+				supported = append(supported, a)
+			}
+		case *dns.DNSKEY:
+			if algorithms[a.Algorithm] {
+				supported = append(supported, a)
+			}
+		}
+	}
+	if len(supported) == 0 {
+		z.expire = v.now().Add(ttl(anchors))
+		return z
+	}
+
+	resp, err := ex(ctx, query(name, dns.TypeDNSKEY))
+	if err != nil {
+		z.err = indeterminate("failed to get DNSKEY for %s: %s", name, err)
+		return z
+	}
+	set := []dns.RR{}
+	trusted := []*dns.DNSKEY{}
+	for _, rr := range resp.Answer {
+		k, ok := rr.(*dns.DNSKEY)
+		if !ok || !strings.EqualFold(k.Hdr.Name, name) {
+			continue
+		}
+		set = append(set, k)
+		if trustedKey(k, supported) {
+			trusted = append(trusted, k)
+		}
+	}
+	if len(trusted) == 0 {
+		z.err = bogus(dns.ExtendedErrorCodeDNSKEYMissing, "no DNSKEY for %s matches its DS or trust anchor", name)
+		return z
+	}
+
+	z.err = bogus(dns.ExtendedErrorCodeRRSIGsMissing, "no signatures for %s DNSKEY", name)
+	for _, sig := range signatures(resp.Answer) {
+		if sig.TypeCovered != dns.TypeDNSKEY || !strings.EqualFold(sig.Hdr.Name, name) {
+			continue
+		}
+		if err := v.check(sig, trusted, set); err != nil {
+			z.err = err
+			continue
+		}
+		z.err = nil
+		break
+	}
+	if z.err != nil {
+		return z
+	}
+
+	for _, rr := range set {
+		k := rr.(*dns.DNSKEY)
+		if k.Flags&dns.ZONE != 0 && k.Flags&dns.REVOKE == 0 {
+			z.keys = append(z.keys, k)
+		}
+	}
+	z.expire = v.now().Add(ttl(set))
+	return z
+}
+
+// delegation finds out if name, a child of the secure zone parent, is delegated.
+func (v *Validator) delegation(ctx context.Context, ex Exchanger, parent *zone, name string) *cut {
+	c := &cut{}
+	resp, err := ex(ctx, query(name, dns.TypeDS))
+	if err != nil {
+		c.err = indeterminate("failed to get DS for %s: %s", name, err)
+		return c
+	}
+
+	ds := []dns.RR{}
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == dns.TypeDS && strings.EqualFold(rr.Header().Name, name) {
+			ds = append(ds, rr)
+		}
+	}
+	if len(ds) > 0 {
+		if err := v.checkSet(parent, ds, signatures(resp.Answer)); err != nil {
+			c.err = err
+			return c
+		}
+		c.kind, c.ds = cutSecure, ds
+		c.expire = v.now().Add(ttl(ds))
+		return c
+	}
+	if len(resp.Answer) > 0 {
+		// An alias, so not a delegation.
+		c.kind = cutNone
+		c.expire = v.now().Add(ttl(resp.Answer))
+		return c
+	}
+
+	auth := authority(resp.Ns)
+	sigs := signatures(resp.Ns)
+	for _, set := range rrSets(auth) {
+		if err := v.checkSet(parent, set, sigs); err != nil {
+			c.err = err
+			return c
+		}
+	}
+	kind, ok := delegated(auth, name, resp.Rcode == dns.RcodeNameError)
+	if !ok {
+		c.err = bogus(dns.ExtendedErrorCodeNSECMissing, "no valid denial of existence for %s DS", name)
+		return c
+	}
+	c.kind = kind
+	c.expire = v.now().Add(ttl(auth))
+	return c
+}
+
+// checkSet checks that set is signed by the secure zone z.
+func (v *Validator) checkSet(z *zone, set []dns.RR, sigs []*dns.RRSIG) *Error {
+	owner, typ := set[0].Header().Name, set[0].Header().Rrtype
+	err := bogus(dns.ExtendedErrorCodeRRSIGsMissing, "no signatures for %s %s", owner, dns.Type(typ))
+	for _, sig := range sigs {
+		if sig.TypeCovered != typ || !strings.EqualFold(sig.Hdr.Name, owner) || !strings.EqualFold(sig.SignerName, z.name) {
+			continue
+		}
+		if err = v.check(sig, z.keys, set); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// indeterminate returns an *Error for a failed query.
+func indeterminate(format string, a ...interface{}) *Error {
+	e := bogus(dns.ExtendedErrorCodeDNSSECIndeterminate, format, a...)
+	e.temporary = true
+	return e
+}
+
+// algorithms holds the DNSSEC algorithms that can be validated.
+var algorithms = map[uint8]bool{
+	dns.RSASHA1:          true,
+	dns.RSASHA1NSEC3SHA1: true,
+	dns.RSASHA256:        true,
+	dns.RSASHA512:        true,
+	dns.ECDSAP256SHA256:  true,
+	dns.ECDSAP384SHA384:  true,
+	dns.ED25519:          true,
+}
+
+// digests holds the DS digest types that can be validated.
+var digests = map[uint8]bool{
+	dns.SHA1:   true,
+	dns.SHA256: true,
+	dns.SHA384: true,
+}
+
+// trustedKey returns true if k matches one of the DS or DNSKEY records in anchors.
+func trustedKey(k *dns.DNSKEY, anchors []dns.RR) bool {
+	for _, a := range anchors {
+		switch a := a.(type) {
+		case *dns.DS:
+			if a.Algorithm != k.Algorithm || a.KeyTag != k.KeyTag() {
+				continue
+			}
+			if ds := k.ToDS(a.DigestType); ds != nil && strings.EqualFold(ds.Digest, a.Digest) {
+				return true
+			}
+		case *dns.DNSKEY:
+			if a.Algorithm == k.Algorithm && a.Flags == k.Flags && a.PublicKey == k.PublicKey {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// query returns a query for name and qtype, asking for signatures without checking them upstream.
+func query(name string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.SetEdns0(dns.DefaultMsgSize, true)
+	m.CheckingDisabled = true
+	return m
+}
+
+// ttl returns the lowest TTL in rrs, bounded by minTTL and maxTTL.
+func ttl(rrs []dns.RR) time.Duration {
+	d := maxTTL
+	for _, rr := range rrs {
+		if t := time.Duration(rr.Header().Ttl) * time.Second; t < d {
+			d = t
+		}
+	}
+	if d < minTTL {
+		d = minTTL
+	}
+	return d
+}
+
+func key(kind, name string) uint64 {
+	h := fnv.New64()
+	h.Write([]byte(kind))
+	h.Write([]byte(strings.ToLower(name)))
+	return h.Sum64()
+}
+
+func parent(name string) string {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[off:]
+}
@@ -0,0 +1,387 @@
+package validator
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+var now = time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+type signer struct {
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newSigner(t *testing.T, zone string) *signer {
+	k := &dns.DNSKEY{Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600}, Flags: 257, Protocol: 3, Algorithm: dns.ECDSAP256SHA256}
+	priv, err := k.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &signer{key: k, priv: priv.(crypto.Signer)}
+}
+
+// sign returns set with its signature appended.
+func (s *signer) sign(t *testing.T, set ...dns.RR) []dns.RR {
+	h := set[0].Header()
+	sig := &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: h.Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: h.Ttl},
+		TypeCovered: h.Rrtype,
+		Algorithm:   s.key.Algorithm,
+		Labels:      uint8(dns.CountLabel(h.Name)),
+		OrigTtl:     h.Ttl,
+		Expiration:  uint32(now.Add(24 * time.Hour).Unix()),
+		Inception:   uint32(now.Add(-24 * time.Hour).Unix()),
+		KeyTag:      s.key.KeyTag(),
+		SignerName:  s.key.Hdr.Name,
+	}
+	if strings.HasPrefix(h.Name, "*.") {
+		sig.Labels--
+	}
+	if err := sig.Sign(s.priv, set); err != nil {
+		t.Fatal(err)
+	}
+	return append(set, sig)
+}
+
+// signEach returns rrs with the signature of each record, as its own RRset, appended.
+func (s *signer) signEach(t *testing.T, rrs ...dns.RR) []dns.RR {
+	ret := []dns.RR{}
+	for _, rr := range rrs {
+		ret = append(ret, s.sign(t, rr)...)
+	}
+	return ret
+}
+
+// hierarchy is a root, org. and example.org. signed zones and an unsigned insecure.org. zone.
+type hierarchy struct {
+	root, org, example *signer
+	responses          map[string]*dns.Msg
+	queries            int
+}
+
+func newHierarchy(t *testing.T) *hierarchy {
+	h := &hierarchy{root: newSigner(t, "."), org: newSigner(t, "org."), example: newSigner(t, "example.org."), responses: map[string]*dns.Msg{}}
+
+	h.add(".", dns.TypeDNSKEY, dns.RcodeSuccess, h.root.sign(t, h.root.key), nil)
+	h.add("org.", dns.TypeDNSKEY, dns.RcodeSuccess, h.org.sign(t, h.org.key), nil)
+	h.add("example.org.", dns.TypeDNSKEY, dns.RcodeSuccess, h.example.sign(t, h.example.key), nil)
+
+	h.add("org.", dns.TypeDS, dns.RcodeSuccess, h.root.sign(t, h.org.key.ToDS(dns.SHA256)), nil)
+	h.add("example.org.", dns.TypeDS, dns.RcodeSuccess, h.org.sign(t, h.example.key.ToDS(dns.SHA256)), nil)
+	h.add("insecure.org.", dns.TypeDS, dns.RcodeSuccess, nil, h.org.sign(t, &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: "insecure.org.", Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 3600},
+		NextDomain: "org.", TypeBitMap: []uint16{dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC},
+	}))
+	h.add("www.example.org.", dns.TypeDS, dns.RcodeSuccess, nil, h.example.sign(t, nsec("www.example.org.", "example.org.", dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC)))
+	return h
+}
+
+func (h *hierarchy) add(name string, qtype uint16, rcode int, answer, ns []dns.RR) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.Response = true
+	m.Rcode = rcode
+	m.Answer = answer
+	m.Ns = ns
+	h.responses[name+dns.Type(qtype).String()] = m
+}
+
+func (h *hierarchy) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	h.queries++
+	q := m.Question[0]
+	if r, ok := h.responses[q.Name+dns.Type(q.Qtype).String()]; ok {
+		return r.Copy(), nil
+	}
+	return nil, errors.New("no response")
+}
+
+func (h *hierarchy) validator() *Validator {
+	v := New([]dns.RR{h.root.key.ToDS(dns.SHA256)})
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func response(name string, qtype uint16, rcode int, answer, ns []dns.RR) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.Response = true
+	m.Rcode = rcode
+	m.Answer = answer
+	m.Ns = ns
+	return m
+}
+
+func nsec(name, next string, types ...uint16) *dns.NSEC {
+	return &dns.NSEC{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300}, NextDomain: next, TypeBitMap: types}
+}
+
+// nsec3 returns an NSEC3 record in zone that matches name.
+func nsec3(zone, name string, types ...uint16) *dns.NSEC3 {
+	h := dns.HashName(name, dns.SHA1, 0, "")
+	return &dns.NSEC3{
+		Hdr:  dns.RR_Header{Name: h + "." + zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+		Hash: dns.SHA1, HashLength: 20, NextDomain: h[:30] + "VV", TypeBitMap: types,
+	}
+}
+
+// nsec3Cover returns an NSEC3 record in zone that covers name, with the opt-out flag if optOut is true.
+func nsec3Cover(zone, name string, optOut bool) *dns.NSEC3 {
+	h := dns.HashName(name, dns.SHA1, 0, "")
+	x := &dns.NSEC3{
+		Hdr:  dns.RR_Header{Name: h[:30] + "00." + zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+		Hash: dns.SHA1, HashLength: 20, NextDomain: h[:30] + "VV", TypeBitMap: []uint16{dns.TypeA, dns.TypeRRSIG},
+	}
+	if optOut {
+		x.Flags = 1
+	}
+	return x
+}
+
+func TestValidate(t *testing.T) {
+	h := newHierarchy(t)
+	a := test.A("www.example.org. 300 IN A 192.0.2.1")
+	tampered := h.example.sign(t, test.A("www.example.org. 300 IN A 192.0.2.1"))
+	tampered[0].(*dns.A).A = net.ParseIP("192.0.2.2")
+	h.add("www.dname.example.org.", dns.TypeDS, dns.RcodeSuccess, nil, h.example.sign(t, nsec("www.dname.example.org.", "www.example.org.", dns.TypeCNAME, dns.TypeRRSIG, dns.TypeNSEC)))
+	h.add("dname.example.org.", dns.TypeDS, dns.RcodeSuccess, nil, h.example.sign(t, nsec("dname.example.org.", "www.example.org.", dns.TypeDNAME, dns.TypeRRSIG, dns.TypeNSEC)))
+	h.add("sub.example.org.", dns.TypeDS, dns.RcodeSuccess, nil, h.example.signEach(t,
+		nsec3("example.org.", "example.org.", dns.TypeSOA, dns.TypeNS, dns.TypeRRSIG, dns.TypeDNSKEY, dns.TypeNSEC3PARAM),
+		nsec3Cover("example.org.", "sub.example.org.", true)))
+
+	soa := h.example.sign(t, test.SOA("example.org. 300 IN SOA ns.example.org. admin.example.org. 1 3600 600 86400 300"))
+	apex := nsec3("example.org.", "example.org.", dns.TypeSOA, dns.TypeNS, dns.TypeRRSIG, dns.TypeDNSKEY, dns.TypeNSEC3PARAM)
+	expensive := []dns.RR{nsec3("example.org.", "example.org.", dns.TypeSOA), nsec3Cover("example.org.", "nx.example.org.", false), nsec3Cover("example.org.", "*.example.org.", false)}
+	for _, rr := range expensive {
+		rr.(*dns.NSEC3).Iterations = 150
+	}
+
+	tests := []struct {
+		name   string
+		m      *dns.Msg
+		result Result
+		code   uint16
+	}{
+		{"secure", response("www.example.org.", dns.TypeA, dns.RcodeSuccess, h.example.sign(t, a), nil), Secure, 0},
+		{"insecure", response("www.insecure.org.", dns.TypeA, dns.RcodeSuccess, []dns.RR{test.A("www.insecure.org. 300 IN A 192.0.2.1")}, nil), Insecure, 0},
+		{"tampered", response("www.example.org.", dns.TypeA, dns.RcodeSuccess, tampered, nil), Bogus, dns.ExtendedErrorCodeDNSBogus},
+		{"unsigned", response("www.example.org.", dns.TypeA, dns.RcodeSuccess, []dns.RR{a}, nil), Bogus, dns.ExtendedErrorCodeRRSIGsMissing},
+		{
+			"wildcard",
+			response("a.example.org.", dns.TypeA, dns.RcodeSuccess,
+				expand(h.example.sign(t, test.A("*.example.org. 300 IN A 192.0.2.1")), "a.example.org."),
+				h.example.sign(t, nsec("*.example.org.", "www.example.org.", dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC))),
+			Secure, 0,
+		},
+		{
+			"wildcard without proof",
+			response("a.example.org.", dns.TypeA, dns.RcodeSuccess, expand(h.example.sign(t, test.A("*.example.org. 300 IN A 192.0.2.1")), "a.example.org."), nil),
+			Bogus, dns.ExtendedErrorCodeNSECMissing,
+		},
+		{
+			"nxdomain",
+			response("nx.example.org.", dns.TypeA, dns.RcodeNameError, nil,
+				append(h.example.sign(t, test.SOA("example.org. 300 IN SOA ns.example.org. admin.example.org. 1 3600 600 86400 300")),
+					h.example.sign(t, nsec("example.org.", "www.example.org.", dns.TypeSOA, dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeDNSKEY))...)),
+			Secure, 0,
+		},
+		{
+			"nxdomain without proof",
+			response("nx.example.org.", dns.TypeA, dns.RcodeNameError, nil,
+				h.example.sign(t, test.SOA("example.org. 300 IN SOA ns.example.org. admin.example.org. 1 3600 600 86400 300"))),
+			Bogus, dns.ExtendedErrorCodeNSECMissing,
+		},
+		{
+			"nodata",
+			response("www.example.org.", dns.TypeMX, dns.RcodeSuccess, nil,
+				h.example.sign(t, nsec("www.example.org.", "example.org.", dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC))),
+			Secure, 0,
+		},
+		{
+			"nodata for existing type",
+			response("www.example.org.", dns.TypeA, dns.RcodeSuccess, nil,
+				h.example.sign(t, nsec("www.example.org.", "example.org.", dns.TypeA, dns.TypeRRSIG, dns.TypeNSEC))),
+			Bogus, dns.ExtendedErrorCodeNSECMissing,
+		},
+		{
+			"dname",
+			response("www.dname.example.org.", dns.TypeA, dns.RcodeSuccess, append(append(
+				h.example.sign(t, test.DNAME("dname.example.org. 300 IN DNAME example.org.")),
+				test.CNAME("www.dname.example.org. 300 IN CNAME www.example.org.")),
+				h.example.sign(t, test.A("www.example.org. 300 IN A 192.0.2.1"))...), nil),
+			Secure, 0,
+		},
+		{
+			"dname with injected target",
+			response("www.dname.example.org.", dns.TypeA, dns.RcodeSuccess, append(append(
+				h.example.sign(t, test.DNAME("dname.example.org. 300 IN DNAME example.org.")),
+				test.CNAME("www.dname.example.org. 300 IN CNAME evil.example.org.")),
+				h.example.sign(t, test.A("evil.example.org. 300 IN A 192.0.2.1"))...), nil),
+			Bogus, dns.ExtendedErrorCodeRRSIGsMissing,
+		},
+		{
+			"nsec3 nxdomain",
+			response("nx.example.org.", dns.TypeA, dns.RcodeNameError, nil, append(soa, h.example.signEach(t,
+				apex, nsec3Cover("example.org.", "nx.example.org.", false), nsec3Cover("example.org.", "*.example.org.", false))...)),
+			Secure, 0,
+		},
+		{
+			"nsec3 nxdomain without wildcard proof",
+			response("nx.example.org.", dns.TypeA, dns.RcodeNameError, nil, append(soa, h.example.signEach(t,
+				apex, nsec3Cover("example.org.", "nx.example.org.", false))...)),
+			Bogus, dns.ExtendedErrorCodeNSECMissing,
+		},
+		{
+			"nsec3 nxdomain opt-out",
+			response("nx.example.org.", dns.TypeA, dns.RcodeNameError, nil, append(soa, h.example.signEach(t,
+				apex, nsec3Cover("example.org.", "nx.example.org.", true), nsec3Cover("example.org.", "*.example.org.", false))...)),
+			Insecure, 0,
+		},
+		{
+			"nsec3 nodata",
+			response("www.example.org.", dns.TypeMX, dns.RcodeSuccess, nil, append(soa, h.example.signEach(t,
+				nsec3("example.org.", "www.example.org.", dns.TypeA, dns.TypeRRSIG))...)),
+			Secure, 0,
+		},
+		{
+			"nsec3 nodata for existing type",
+			response("www.example.org.", dns.TypeA, dns.RcodeSuccess, nil, append(soa, h.example.signEach(t,
+				nsec3("example.org.", "www.example.org.", dns.TypeA, dns.TypeRRSIG))...)),
+			Bogus, dns.ExtendedErrorCodeNSECMissing,
+		},
+		{
+			"nsec3 wildcard",
+			response("a.example.org.", dns.TypeA, dns.RcodeSuccess,
+				expand(h.example.sign(t, test.A("*.example.org. 300 IN A 192.0.2.1")), "a.example.org."),
+				h.example.signEach(t, nsec3Cover("example.org.", "a.example.org.", false))),
+			Secure, 0,
+		},
+		{
+			"nsec3 wildcard nodata",
+			response("a.example.org.", dns.TypeMX, dns.RcodeSuccess, nil, append(soa, h.example.signEach(t,
+				apex, nsec3Cover("example.org.", "a.example.org.", false), nsec3("example.org.", "*.example.org.", dns.TypeA, dns.TypeRRSIG))...)),
+			Secure, 0,
+		},
+		{
+			"nsec3 opt-out ds",
+			response("sub.example.org.", dns.TypeDS, dns.RcodeSuccess, nil, append(soa, h.example.signEach(t,
+				apex, nsec3Cover("example.org.", "sub.example.org.", true))...)),
+			Insecure, 0,
+		},
+		{
+			"nsec3 nodata opt-out",
+			response("sub.example.org.", dns.TypeMX, dns.RcodeSuccess, nil, append(soa, h.example.signEach(t,
+				apex, nsec3Cover("example.org.", "sub.example.org.", true))...)),
+			Bogus, dns.ExtendedErrorCodeNSECMissing,
+		},
+		{
+			"nsec3 opt-out delegation",
+			response("www.sub.example.org.", dns.TypeA, dns.RcodeSuccess, []dns.RR{test.A("www.sub.example.org. 300 IN A 192.0.2.1")}, nil),
+			Insecure, 0,
+		},
+		{
+			"nsec3 too many iterations",
+			response("nx.example.org.", dns.TypeA, dns.RcodeNameError, nil, append(soa, h.example.signEach(t, expensive...)...)),
+			Insecure, 0,
+		},
+	}
+
+	for _, tc := range tests {
+		v := h.validator()
+		res, err := v.Validate(context.TODO(), h.exchange, tc.m)
+		if res != tc.result {
+			t.Errorf("Test %q: expected %s, got %s (%v)", tc.name, tc.result, res, err)
+			continue
+		}
+		if tc.result != Bogus {
+			if err != nil {
+				t.Errorf("Test %q: expected no error, got %s", tc.name, err)
+			}
+			continue
+		}
+		var verr *Error
+		if !errors.As(err, &verr) {
+			t.Errorf("Test %q: expected an *Error, got %v", tc.name, err)
+			continue
+		}
+		if verr.Code != tc.code {
+			t.Errorf("Test %q: expected code %d, got %d (%s)", tc.name, tc.code, verr.Code, verr)
+		}
+	}
+}
+
+// expand returns the signed wildcard records in set with name as the owner.
+func expand(set []dns.RR, name string) []dns.RR {
+	for _, rr := range set {
+		rr.Header().Name = name
+	}
+	return set
+}
+
+func TestValidateExpired(t *testing.T) {
+	h := newHierarchy(t)
+	v := h.validator()
+	v.now = func() time.Time { return now.Add(48 * time.Hour) }
+
+	m := response("www.example.org.", dns.TypeA, dns.RcodeSuccess, h.example.sign(t, test.A("www.example.org. 300 IN A 192.0.2.1")), nil)
+	_, err := v.Validate(context.TODO(), h.exchange, m)
+	var verr *Error
+	if !errors.As(err, &verr) || verr.Code != dns.ExtendedErrorCodeSignatureExpired {
+		t.Errorf("Expected signature expired error, got %v", err)
+	}
+}
+
+func TestValidateCache(t *testing.T) {
+	h := newHierarchy(t)
+	v := h.validator()
+	m := response("www.example.org.", dns.TypeA, dns.RcodeSuccess, h.example.sign(t, test.A("www.example.org. 300 IN A 192.0.2.1")), nil)
+
+	if res, err := v.Validate(context.TODO(), h.exchange, m); res != Secure {
+		t.Fatalf("Expected secure, got %s (%v)", res, err)
+	}
+	queries := h.queries
+	if res, err := v.Validate(context.TODO(), h.exchange, m); res != Secure {
+		t.Fatalf("Expected secure, got %s (%v)", res, err)
+	}
+	if h.queries != queries {
+		t.Errorf("Expected keys and delegations to be cached, got %d more queries", h.queries-queries)
+	}
+}
+
+func TestValidateNoAnchor(t *testing.T) {
+	h := newHierarchy(t)
+	v := New(nil)
+	m := response("www.example.org.", dns.TypeA, dns.RcodeSuccess, []dns.RR{test.A("www.example.org. 300 IN A 192.0.2.1")}, nil)
+	if res, err := v.Validate(context.TODO(), h.exchange, m); res != Insecure || err != nil {
+		t.Errorf("Expected insecure without trust anchors, got %s (%v)", res, err)
+	}
+}
+
+func TestReadAnchors(t *testing.T) {
+	anchors := Root()
+	if len(anchors) != 2 {
+		t.Fatalf("Expected 2 root anchors, got %d", len(anchors))
+	}
+	if _, err := ReadAnchors(strings.NewReader("example.org. IN A 192.0.2.1\n"), "test"); err == nil {
+		t.Errorf("Expected error for a file without anchors")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// The canonical order from RFC 4034, section 6.1.
+	names := []string{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.", "z.example.", "\\001.z.example.", "*.z.example.", "\\200.z.example."}
+	for i := 1; i < len(names); i++ {
+		if compare(names[i-1], names[i]) >= 0 {
+			t.Errorf("Expected %s before %s", names[i-1], names[i])
+		}
+	}
+}
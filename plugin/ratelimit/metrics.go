@@ -0,0 +1,16 @@
+package ratelimit
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// RequestLimitedCount is the number of DNS requests that exceeded the rate limit.
+var RequestLimitedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: plugin.Namespace,
+	Subsystem: pluginName,
+	Name:      "limited_requests_total",
+	Help:      "Counter of DNS requests that exceeded the rate limit.",
+}, []string{"server", "zone", "view", "action"})
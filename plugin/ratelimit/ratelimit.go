@@ -0,0 +1,139 @@
+// Package ratelimit implements per client query rate limiting.
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/request"
+
+	"github.com/infobloxopen/go-trees/iptree"
+	"github.com/miekg/dns"
+	"golang.org/x/time/rate"
+)
+
+var log = clog.NewWithPlugin(pluginName)
+
+// RateLimit limits the rate of queries per client IP or client network with a token bucket.
+type RateLimit struct {
+	Next  plugin.Handler
+	Zones []string
+
+	rate     rate.Limit
+	burst    int
+	ipv4Mask net.IPMask
+	ipv6Mask net.IPMask
+	action   action
+	exempt   *iptree.Tree // networks that are never limited, nil if there are none
+
+	buckets *cache.Cache
+
+	now func() time.Time
+}
+
+// action defines what to do with a query that exceeds the limit.
+type action int
+
+const (
+	// actionRefuse responds with REFUSED.
+	actionRefuse action = iota
+	// actionDrop does not respond.
+	actionDrop
+	// actionTruncate responds with an empty, truncated response so the client retries over TCP.
+	actionTruncate
+)
+
+var actionToString = map[action]string{
+	actionRefuse:   "refuse",
+	actionDrop:     "drop",
+	actionTruncate: "truncate",
+}
+
+func (a action) String() string { return actionToString[a] }
+
+// New returns a new RateLimit with the defaults set.
+func New() *RateLimit {
+	return &RateLimit{
+		rate:     defaultRate,
+		burst:    defaultRate,
+		ipv4Mask: net.CIDRMask(32, 32),
+		ipv6Mask: net.CIDRMask(128, 128),
+		action:   actionRefuse,
+		buckets:  cache.New(defaultTableSize),
+		now:      time.Now,
+	}
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (rl *RateLimit) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+
+	zone := plugin.Zones(rl.Zones).Matches(state.Name())
+	if zone == "" {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	ip := parseIP(state.IP())
+	if ip == nil || rl.allow(ip) {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	act := rl.action
+	// A TCP client can't be asked to retry over TCP.
+	if act == actionTruncate && state.Proto() == "tcp" {
+		act = actionRefuse
+	}
+	RequestLimitedCount.WithLabelValues(metrics.WithServer(ctx), zone, metrics.WithView(ctx), act.String()).Inc()
+
+	switch act {
+	case actionDrop:
+		return dns.RcodeSuccess, nil
+	case actionTruncate:
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Truncated = true
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeRefused)
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the Handler interface.
+func (rl *RateLimit) Name() string { return pluginName }
+
+// allow takes a token from the bucket of the network ip belongs to, it returns false if the bucket is empty.
+func (rl *RateLimit) allow(ip net.IP) bool {
+	if rl.exempt != nil {
+		if _, ok := rl.exempt.GetByIP(ip); ok {
+			return true
+		}
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4.Mask(rl.ipv4Mask)
+	} else {
+		ip = ip.Mask(rl.ipv6Mask)
+	}
+	key := cache.Hash(ip)
+
+	l := rl.buckets.GetOrAdd(key, func() interface{} { return rate.NewLimiter(rl.rate, rl.burst) }).(*rate.Limiter)
+	return l.AllowN(rl.now(), 1)
+}
+
+// parseIP parses ip, stripping any zone.
+func parseIP(ip string) net.IP {
+	if idx := strings.IndexByte(ip, '%'); idx >= 0 {
+		ip = ip[:idx]
+	}
+	return net.ParseIP(ip)
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/infobloxopen/go-trees/iptree"
+	"github.com/miekg/dns"
+)
+
+func newTestRateLimit(now *time.Time) *RateLimit {
+	rl := New()
+	rl.Zones = []string{"example.org."}
+	rl.rate = 1
+	rl.burst = 2
+	rl.Next = test.NextHandler(dns.RcodeSuccess, nil)
+	rl.now = func() time.Time { return *now }
+	return rl
+}
+
+// serve sends a query for qname from ip and returns the recorder, its Msg is nil if nothing was written.
+func serve(t *testing.T, rl plugin.Handler, ip string, tcp bool, qname string) *dnstest.Recorder {
+	t.Helper()
+	m := new(dns.Msg)
+	m.SetQuestion(qname, dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: ip, TCP: tcp})
+	if _, err := rl.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	return rec
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		action action
+		tcp    bool
+		check  func(*dns.Msg) bool
+	}{
+		{actionRefuse, false, func(m *dns.Msg) bool { return m != nil && m.Rcode == dns.RcodeRefused }},
+		{actionDrop, false, func(m *dns.Msg) bool { return m == nil }},
+		{actionTruncate, false, func(m *dns.Msg) bool { return m != nil && m.Truncated && m.Rcode == dns.RcodeSuccess }},
+		// Truncating makes no sense over TCP.
+		{actionTruncate, true, func(m *dns.Msg) bool { return m != nil && m.Rcode == dns.RcodeRefused }},
+	}
+
+	for i, tc := range tests {
+		now := time.Now()
+		rl := newTestRateLimit(&now)
+		rl.action = tc.action
+
+		// The burst allows the first two queries, the NextHandler doesn't write a response.
+		for j := 0; j < 2; j++ {
+			if rec := serve(t, rl, "10.240.0.1", tc.tcp, "example.org."); rec.Msg != nil {
+				t.Fatalf("Test %d: expected query %d to be allowed, got %v", i, j, rec.Msg)
+			}
+		}
+		if rec := serve(t, rl, "10.240.0.1", tc.tcp, "example.org."); !tc.check(rec.Msg) {
+			t.Errorf("Test %d: unexpected response to limited query: %v", i, rec.Msg)
+		}
+
+		// Another client has its own bucket.
+		if rec := serve(t, rl, "10.240.0.2", tc.tcp, "example.org."); rec.Msg != nil {
+			t.Errorf("Test %d: expected query from another client to be allowed", i)
+		}
+		// Queries outside of the zones are not limited.
+		if rec := serve(t, rl, "10.240.0.1", tc.tcp, "example.net."); rec.Msg != nil {
+			t.Errorf("Test %d: expected query outside of the zones to be allowed", i)
+		}
+
+		// A token is added every second.
+		now = now.Add(time.Second)
+		if rec := serve(t, rl, "10.240.0.1", tc.tcp, "example.org."); rec.Msg != nil {
+			t.Errorf("Test %d: expected query to be allowed after a second", i)
+		}
+	}
+}
+
+func TestRateLimitPrefix(t *testing.T) {
+	now := time.Now()
+	rl := newTestRateLimit(&now)
+	rl.ipv4Mask = net.CIDRMask(24, 32)
+
+	for _, ip := range []string{"10.240.0.1", "10.240.0.2"} {
+		if rec := serve(t, rl, ip, false, "example.org."); rec.Msg != nil {
+			t.Fatalf("Expected query from %s to be allowed", ip)
+		}
+	}
+	// The whole /24 shares a bucket.
+	if rec := serve(t, rl, "10.240.0.3", false, "example.org."); rec.Msg == nil {
+		t.Error("Expected query from the same /24 to be limited")
+	}
+	if rec := serve(t, rl, "10.240.1.1", false, "example.org."); rec.Msg != nil {
+		t.Error("Expected query from another /24 to be allowed")
+	}
+}
+
+func TestRateLimitConcurrent(t *testing.T) {
+	now := time.Now()
+	rl := newTestRateLimit(&now)
+
+	// Concurrent queries from a new client share one bucket.
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rl.allow(net.ParseIP("10.240.0.1")) {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 2 {
+		t.Errorf("Expected the burst of 2 queries to be allowed, got %d", allowed)
+	}
+}
+
+func TestRateLimitExempt(t *testing.T) {
+	now := time.Now()
+	rl := newTestRateLimit(&now)
+	rl.exempt = iptree.NewTree()
+	_, n, _ := net.ParseCIDR("10.240.0.0/16")
+	rl.exempt.InplaceInsertNet(n, struct{}{})
+
+	for i := 0; i < 10; i++ {
+		if rec := serve(t, rl, "10.240.0.1", false, "example.org."); rec.Msg != nil {
+			t.Fatalf("Expected query %d from an exempt network to be allowed", i)
+		}
+	}
+}
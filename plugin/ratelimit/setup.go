@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+
+	"github.com/infobloxopen/go-trees/iptree"
+	"golang.org/x/time/rate"
+)
+
+const pluginName = "ratelimit"
+
+func init() { plugin.Register(pluginName, setup) }
+
+func setup(c *caddy.Controller) error {
+	rl, err := parse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		rl.Next = next
+		return rl
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*RateLimit, error) {
+	rl := New()
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		rl.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		burst := -1
+		tableSize := defaultTableSize
+
+		for c.NextBlock() {
+			switch property := c.Val(); property {
+			case "rate":
+				n, err := intArg(c, 1)
+				if err != nil {
+					return nil, err
+				}
+				rl.rate = rate.Limit(n)
+
+			case "burst":
+				n, err := intArg(c, 1)
+				if err != nil {
+					return nil, err
+				}
+				burst = n
+
+			case "ipv4_prefix_length":
+				n, err := intArg(c, 0)
+				if err != nil {
+					return nil, err
+				}
+				if n > 32 {
+					return nil, c.Errf("ipv4_prefix_length must be between 0 and 32: %d", n)
+				}
+				rl.ipv4Mask = net.CIDRMask(n, 32)
+
+			case "ipv6_prefix_length":
+				n, err := intArg(c, 0)
+				if err != nil {
+					return nil, err
+				}
+				if n > 128 {
+					return nil, c.Errf("ipv6_prefix_length must be between 0 and 128: %d", n)
+				}
+				rl.ipv6Mask = net.CIDRMask(n, 128)
+
+			case "action":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch strings.ToLower(c.Val()) {
+				case "refuse":
+					rl.action = actionRefuse
+				case "drop":
+					rl.action = actionDrop
+				case "truncate":
+					rl.action = actionTruncate
+				default:
+					return nil, c.Errf("unexpected action %q; expect 'refuse', 'drop' or 'truncate'", c.Val())
+				}
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+
+			case "exempt":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				if rl.exempt == nil {
+					rl.exempt = iptree.NewTree()
+				}
+				for _, a := range args {
+					a = normalize(a)
+					_, n, err := net.ParseCIDR(a)
+					if err != nil {
+						return nil, c.Errf("illegal CIDR notation %q", a)
+					}
+					rl.exempt.InplaceInsertNet(n, struct{}{})
+				}
+
+			case "max_table_size":
+				n, err := intArg(c, 1)
+				if err != nil {
+					return nil, err
+				}
+				tableSize = n
+
+			default:
+				return nil, c.Errf("unknown property '%s'", property)
+			}
+		}
+
+		// Without an explicit burst, allow one second worth of queries.
+		if burst == -1 {
+			burst = int(rl.rate)
+		}
+		rl.burst = burst
+		rl.buckets = cache.New(tableSize)
+	}
+
+	return rl, nil
+}
+
+// intArg parses the single argument of the current property as an integer of at least min.
+func intArg(c *caddy.Controller, min int) (int, error) {
+	property := c.Val()
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return 0, c.ArgErr()
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, c.Errf("invalid value for %s: %s", property, args[0])
+	}
+	if n < min {
+		return 0, c.Errf("%s must be at least %d: %d", property, min, n)
+	}
+	return n, nil
+}
+
+// normalize appends '/32' for any single IPv4 address and '/128' for IPv6.
+func normalize(rawNet string) string {
+	if strings.Contains(rawNet, "/") {
+		return rawNet
+	}
+	if strings.Contains(rawNet, ":") {
+		return rawNet + "/128"
+	}
+	return rawNet + "/32"
+}
+
+const (
+	defaultRate      = 100
+	defaultTableSize = 100000
+)
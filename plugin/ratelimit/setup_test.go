@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coredns/caddy"
+
+	"golang.org/x/time/rate"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expectErr string
+	}{
+		{`ratelimit`, false, ""},
+		{`ratelimit example.org {
+			rate 10
+		}`, false, ""},
+		{`ratelimit {
+			rate 10
+			burst 20
+			ipv4_prefix_length 24
+			ipv6_prefix_length 64
+			action truncate
+			exempt 10.0.0.0/8 192.168.1.1 ::1
+			max_table_size 1000
+		}`, false, ""},
+		// fails
+		{`ratelimit {
+			rate 0
+		}`, true, "rate must be at least 1"},
+		{`ratelimit {
+			burst foo
+		}`, true, "invalid value for burst"},
+		{`ratelimit {
+			ipv4_prefix_length 33
+		}`, true, "ipv4_prefix_length must be between"},
+		{`ratelimit {
+			ipv6_prefix_length 129
+		}`, true, "ipv6_prefix_length must be between"},
+		{`ratelimit {
+			action block
+		}`, true, "unexpected action"},
+		{`ratelimit {
+			action drop refuse
+		}`, true, "Wrong argument count"},
+		{`ratelimit {
+			exempt
+		}`, true, "Wrong argument count"},
+		{`ratelimit {
+			exempt 10.0.0.0/33
+		}`, true, "illegal CIDR notation"},
+		{`ratelimit {
+			blah
+		}`, true, "unknown property"},
+		{`ratelimit
+		ratelimit`, true, "plugin"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		_, err := parse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found none for input %s", i, test.input)
+		}
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+			if !strings.Contains(err.Error(), test.expectErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectErr, err, test.input)
+			}
+		}
+	}
+}
+
+func TestSetupBurst(t *testing.T) {
+	tests := []struct {
+		input string
+		rate  rate.Limit
+		burst int
+	}{
+		{`ratelimit`, defaultRate, defaultRate},
+		{`ratelimit {
+			rate 10
+		}`, 10, 10},
+		{`ratelimit {
+			rate 10
+			burst 50
+		}`, 10, 50},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		rl, err := parse(c)
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if rl.rate != test.rate || rl.burst != test.burst {
+			t.Errorf("Test %d: expected rate %v and burst %d, got %v and %d", i, test.rate, test.burst, rl.rate, rl.burst)
+		}
+	}
+}
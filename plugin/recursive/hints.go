@@ -0,0 +1,67 @@
+package recursive
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// roots holds the IPv4 and IPv6 addresses of the root servers, a.root-servers.net to m.root-servers.net.
+var roots = []string{
+	"198.41.0.4", "2001:503:ba3e::2:30",
+	"170.247.170.2", "2801:1b8:10::b",
+	"192.33.4.12", "2001:500:2::c",
+	"199.7.91.13", "2001:500:2d::d",
+	"192.203.230.10", "2001:500:a8::e",
+	"192.5.5.241", "2001:500:2f::f",
+	"192.112.36.4", "2001:500:12::d0d",
+	"198.97.190.53", "2001:500:1::53",
+	"192.36.148.17", "2001:7fe::53",
+	"192.58.128.30", "2001:503:c27::2:30",
+	"193.0.14.129", "2001:7fd::1",
+	"199.7.83.42", "2001:500:9f::42",
+	"202.12.27.33", "2001:dc3::35",
+}
+
+// rootHints returns the delegation of the root zone to the root servers.
+func rootHints() *delegation {
+	d := &delegation{zone: "."}
+	for c := 'a'; c <= 'm'; c++ {
+		d.ns = append(d.ns, string(c)+".root-servers.net.")
+	}
+	d.addrs = append(d.addrs, roots...)
+	return d
+}
+
+// readHints reads root hints, the NS records of the root zone and the addresses of those name
+// servers, in zone file format from r.
+func readHints(r io.Reader, file string) (*delegation, error) {
+	zp := dns.NewZoneParser(r, ".", file)
+	d := &delegation{zone: "."}
+	addrs := map[string][]string{}
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		name := strings.ToLower(rr.Header().Name)
+		switch x := rr.(type) {
+		case *dns.NS:
+			if name == "." {
+				d.ns = append(d.ns, strings.ToLower(x.Ns))
+			}
+		case *dns.A:
+			addrs[name] = append(addrs[name], x.A.String())
+		case *dns.AAAA:
+			addrs[name] = append(addrs[name], x.AAAA.String())
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	for _, ns := range d.ns {
+		d.addrs = append(d.addrs, addrs[ns]...)
+	}
+	if len(d.addrs) == 0 {
+		return nil, fmt.Errorf("no root server addresses in %s", file)
+	}
+	return d, nil
+}
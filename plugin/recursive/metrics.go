@@ -0,0 +1,33 @@
+package recursive
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// queryCount is the number of queries sent to authoritative servers.
+	queryCount = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "upstream_queries_total",
+		Help:      "Counter of queries sent to authoritative servers.",
+	})
+	// queryDuration is the time it took authoritative servers to respond.
+	queryDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "upstream_query_duration_seconds",
+		Buckets:   plugin.TimeBuckets,
+		Help:      "Histogram of the time it took authoritative servers to respond.",
+	})
+	// failureCount is the number of client queries that couldn't be resolved.
+	failureCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "failures_total",
+		Help:      "Counter of queries that couldn't be resolved.",
+	}, []string{"server"})
+)
@@ -0,0 +1,79 @@
+// Package recursive implements a plugin that resolves queries iteratively, starting at the root servers.
+package recursive
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	"github.com/coredns/coredns/plugin/pkg/edns"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// Recursive is a plugin that resolves queries by following the delegations from the root zone down
+// to the authoritative servers of the name.
+type Recursive struct {
+	Next  plugin.Handler
+	Zones []string
+
+	hints    *delegation // the root servers
+	minimise bool        // QNAME minimisation (RFC 9156)
+	timeout  time.Duration
+	port     string
+
+	delegations *cache.Cache // *delegation per zone name
+	rtt         *rtts
+}
+
+// New returns a Recursive that uses the built-in root hints.
+func New() *Recursive {
+	return &Recursive{
+		hints:       rootHints(),
+		minimise:    true,
+		timeout:     defaultTimeout,
+		port:        "53",
+		delegations: cache.New(defaultCap),
+		rtt:         newRTTs(),
+	}
+}
+
+const (
+	defaultTimeout = 2 * time.Second
+	defaultCap     = 10000
+)
+
+// ServeDNS implements the plugin.Handler interface.
+func (re *Recursive) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	if plugin.Zones(re.Zones).Matches(state.Name()) == "" || state.QClass() != dns.ClassINET {
+		return plugin.NextOrFailure(re.Name(), re.Next, ctx, w, r)
+	}
+
+	ret, err := re.resolve(ctx, &budget{}, state.QName(), state.QType(), 0)
+	if err != nil {
+		failureCount.WithLabelValues(metrics.WithServer(ctx)).Inc()
+		code := dns.ExtendedErrorCodeNoReachableAuthority
+		if !errors.Is(err, errUnreachable) {
+			code = dns.ExtendedErrorCodeOther
+		}
+		return dns.RcodeServerFailure, edns.NewExtendedError(err, code, "")
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.RecursionAvailable = true
+	m.Rcode = ret.Rcode
+	m.Answer = ret.Answer
+	m.Ns = ret.Ns
+
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+// Name implements the plugin.Handler interface.
+func (re *Recursive) Name() string { return pluginName }
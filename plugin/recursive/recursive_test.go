@@ -0,0 +1,278 @@
+package recursive
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+const rootZone = `. 3600 IN SOA a.root. admin.root. 1 3600 600 86400 300
+. 3600 IN NS a.root.
+a.root. 3600 IN A 127.0.0.1
+org. 3600 IN NS ns1.org.
+ns1.org. 3600 IN A 127.0.0.2
+net. 3600 IN NS ns.net.
+ns.net. 3600 IN A 127.0.0.2
+arpa. 3600 IN NS ns.arpa.
+ns.arpa. 3600 IN A 127.0.0.3
+`
+
+const orgZone = `org. 3600 IN SOA ns1.org. admin.org. 1 3600 600 86400 300
+org. 3600 IN NS ns1.org.
+ns1.org. 3600 IN A 127.0.0.2
+example.org. 3600 IN NS ns1.example.org.
+example.org. 3600 IN NS ns2.example.org.
+ns1.example.org. 3600 IN A 127.0.0.3
+ns2.example.org. 3600 IN A 127.0.0.4
+other.org. 3600 IN NS ns.other.net.
+`
+
+const netZone = `net. 3600 IN SOA ns.net. admin.net. 1 3600 600 86400 300
+net. 3600 IN NS ns.net.
+ns.net. 3600 IN A 127.0.0.2
+ns.other.net. 3600 IN A 127.0.0.3
+`
+
+const exampleZone = `example.org. 3600 IN SOA ns1.example.org. admin.example.org. 1 3600 600 86400 300
+example.org. 3600 IN NS ns1.example.org.
+example.org. 3600 IN NS ns2.example.org.
+ns1.example.org. 3600 IN A 127.0.0.3
+ns2.example.org. 3600 IN A 127.0.0.4
+www.example.org. 300 IN A 192.0.2.1
+alias.example.org. 300 IN CNAME www.example.org.
+ext.example.org. 300 IN CNAME www.other.org.
+deep.a.b.example.org. 300 IN A 192.0.2.3
+`
+
+const arpaZone = `arpa. 3600 IN SOA ns.arpa. admin.arpa. 1 3600 600 86400 300
+arpa. 3600 IN NS ns.arpa.
+ns.arpa. 3600 IN A 127.0.0.3
+1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa. 300 IN PTR www.example.org.
+`
+
+const otherZone = `other.org. 3600 IN SOA ns.other.net. admin.other.org. 1 3600 600 86400 300
+other.org. 3600 IN NS ns.other.net.
+www.other.org. 300 IN A 192.0.2.2
+`
+
+// authoritative is an authoritative server for some zones that records the queries it gets.
+type authoritative struct {
+	udp, tcp *dns.Server
+
+	mu      sync.Mutex
+	queries []string
+}
+
+func (a *authoritative) seen() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string{}, a.queries...)
+}
+
+// newAuthoritative starts a server for zones on addr, if port is empty a port is picked.
+func newAuthoritative(t *testing.T, addr, port string, zones ...string) *authoritative {
+	f := file.File{Next: test.ErrorHandler(), Zones: file.Zones{Z: map[string]*file.Zone{}}}
+	for _, z := range zones {
+		origin := strings.Fields(z)[0]
+		zone, err := file.Parse(strings.NewReader(z), origin, "stdin", 0)
+		if err != nil {
+			t.Fatalf("Failed to parse zone %s: %s", origin, err)
+		}
+		f.Zones.Z[origin] = zone
+		f.Zones.Names = append(f.Zones.Names, origin)
+	}
+
+	// A server without zones, so CNAME targets in other zones aren't resolved, like most
+	// authoritative servers do.
+	ctx := context.WithValue(context.Background(), dnsserver.Key{}, &dnsserver.Server{})
+
+	a := &authoritative{}
+	h := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		a.mu.Lock()
+		a.queries = append(a.queries, r.Question[0].Name+" "+dns.Type(r.Question[0].Qtype).String())
+		a.mu.Unlock()
+		f.ServeDNS(ctx, w, r)
+	})
+
+	if port == "" {
+		port = "0"
+	}
+	pc, err := net.ListenPacket("udp", net.JoinHostPort(addr, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.udp = &dns.Server{PacketConn: pc, Handler: h}
+	a.tcp = &dns.Server{Listener: l, Handler: h}
+	go a.udp.ActivateAndServe()
+	go a.tcp.ActivateAndServe()
+	t.Cleanup(func() {
+		a.udp.Shutdown()
+		a.tcp.Shutdown()
+	})
+	return a
+}
+
+// newTestRecursive starts the authoritative servers of the test zones and returns a Recursive
+// that uses them. The servers of the root and org. zones are returned too.
+func newTestRecursive(t *testing.T) (*Recursive, *authoritative, *authoritative) {
+	root := newAuthoritative(t, "127.0.0.1", "", rootZone)
+	_, port, _ := net.SplitHostPort(root.udp.PacketConn.LocalAddr().String())
+	org := newAuthoritative(t, "127.0.0.2", port, orgZone, netZone)
+	newAuthoritative(t, "127.0.0.3", port, exampleZone, otherZone, arpaZone)
+
+	re := New()
+	re.Zones = []string{"."}
+	re.port = port
+	re.timeout = time.Second
+	re.hints = &delegation{zone: ".", ns: []string{"a.root."}, addrs: []string{"127.0.0.1"}}
+	return re, root, org
+}
+
+func TestRecursive(t *testing.T) {
+	re, _, _ := newTestRecursive(t)
+
+	tests := []struct {
+		qname  string
+		qtype  uint16
+		rcode  int
+		answer []dns.RR
+		ns     []dns.RR
+	}{
+		{
+			qname: "www.example.org.", qtype: dns.TypeA,
+			answer: []dns.RR{test.A("www.example.org. 300 IN A 192.0.2.1")},
+		},
+		{
+			qname: "alias.example.org.", qtype: dns.TypeA,
+			answer: []dns.RR{
+				test.CNAME("alias.example.org. 300 IN CNAME www.example.org."),
+				test.A("www.example.org. 300 IN A 192.0.2.1"),
+			},
+		},
+		{
+			// The CNAME points into a zone whose name server has no glue.
+			qname: "ext.example.org.", qtype: dns.TypeA,
+			answer: []dns.RR{
+				test.CNAME("ext.example.org. 300 IN CNAME www.other.org."),
+				test.A("www.other.org. 300 IN A 192.0.2.2"),
+			},
+		},
+		{
+			// Below empty non-terminals.
+			qname: "deep.a.b.example.org.", qtype: dns.TypeA,
+			answer: []dns.RR{test.A("deep.a.b.example.org. 300 IN A 192.0.2.3")},
+		},
+		{
+			// More labels than referrals allowed, QNAME minimisation must not add them one by one.
+			qname: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", qtype: dns.TypePTR,
+			answer: []dns.RR{test.PTR("1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa. 300 IN PTR www.example.org.")},
+		},
+		{
+			qname: "nx.example.org.", qtype: dns.TypeA, rcode: dns.RcodeNameError,
+			ns: []dns.RR{test.SOA("example.org. 3600 IN SOA ns1.example.org. admin.example.org. 1 3600 600 86400 300")},
+		},
+		{
+			qname: "www.example.org.", qtype: dns.TypeMX,
+			ns: []dns.RR{test.SOA("example.org. 3600 IN SOA ns1.example.org. admin.example.org. 1 3600 600 86400 300")},
+		},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := re.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if !rec.Msg.RecursionAvailable {
+			t.Errorf("Test %d: expected RA bit to be set", i)
+		}
+		if err := test.SortAndCheck(rec.Msg, test.Case{Qname: tc.qname, Qtype: tc.qtype, Rcode: tc.rcode, Answer: tc.answer, Ns: tc.ns}); err != nil {
+			t.Errorf("Test %d: %s", i, err)
+		}
+	}
+}
+
+func TestRecursiveQnameMinimisation(t *testing.T) {
+	re, root, org := newTestRecursive(t)
+
+	m := new(dns.Msg)
+	m.SetQuestion("deep.a.b.example.org.", dns.TypeAAAA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := re.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	for _, q := range root.seen() {
+		if q != "org. A" {
+			t.Errorf("Expected root server to only see org. A, got %s", q)
+		}
+	}
+	for _, q := range org.seen() {
+		if q != "example.org. A" {
+			t.Errorf("Expected org. server to only see example.org. A, got %s", q)
+		}
+	}
+}
+
+func TestRecursiveDelegationCache(t *testing.T) {
+	re, root, org := newTestRecursive(t)
+
+	for _, name := range []string{"www.example.org.", "alias.example.org.", "nx.example.org."} {
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		if _, err := re.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Expected no error for %s, got %s", name, err)
+		}
+	}
+	if n := len(root.seen()); n != 1 {
+		t.Errorf("Expected 1 query to the root server, got %d", n)
+	}
+	if n := len(org.seen()); n != 1 {
+		t.Errorf("Expected 1 query to the org. server, got %d", n)
+	}
+}
+
+func TestRecursiveUnreachable(t *testing.T) {
+	re, _, _ := newTestRecursive(t)
+	re.hints = &delegation{zone: ".", ns: []string{"a.root."}, addrs: []string{"127.0.0.4"}}
+
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	rcode, err := re.ServeDNS(context.TODO(), rec, m)
+	if rcode != dns.RcodeServerFailure || err == nil {
+		t.Errorf("Expected SERVFAIL and an error, got %s and %v", dns.RcodeToString[rcode], err)
+	}
+}
+
+func TestRTTSort(t *testing.T) {
+	r := newRTTs()
+	r.update("192.0.2.1", 50*time.Millisecond)
+	r.update("192.0.2.2", 10*time.Millisecond)
+	r.timeout("192.0.2.3", time.Second)
+
+	got := r.sort([]string{"192.0.2.3", "192.0.2.1", "192.0.2.4", "192.0.2.2"})
+	expect := []string{"192.0.2.4", "192.0.2.2", "192.0.2.1", "192.0.2.3"}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Fatalf("Expected %v, got %v", expect, got)
+		}
+	}
+}
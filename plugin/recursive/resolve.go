@@ -0,0 +1,398 @@
+package recursive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+
+	"github.com/miekg/dns"
+)
+
+var (
+	errUnreachable = errors.New("no authoritative server reachable")
+	errBudget      = errors.New("too many upstream queries")
+	errLoop        = errors.New("too many referrals or CNAMEs")
+)
+
+const (
+	maxQueries   = 128 // upstream queries for a single client query
+	maxDepth     = 8   // CNAMEs followed, and nesting of name server address lookups
+	maxReferrals = 32  // referrals and minimised queries for a single name
+	maxMinimise  = 10  // minimised queries for a single name, RFC 9156 MAX_MINIMISE_COUNT
+	minimiseOne  = 4   // minimised queries that add a single label, RFC 9156 MINIMISE_ONE_LAB
+	ednsSize     = 1232
+
+	minTTL = 5 * time.Second
+	maxTTL = 24 * time.Hour
+)
+
+// budget counts the upstream queries sent for a client query.
+type budget struct {
+	queries int
+}
+
+// delegation is a zone and the names and addresses of its name servers.
+type delegation struct {
+	zone   string
+	ns     []string
+	addrs  []string
+	expire time.Time
+}
+
+// resolve resolves name and qtype, following CNAMEs into other zones. depth is the number of
+// enclosing lookups, for name server addresses.
+func (re *Recursive) resolve(ctx context.Context, b *budget, name string, qtype uint16, depth int) (*dns.Msg, error) {
+	chain := []dns.RR{}
+	for i := 0; i <= maxDepth; i++ {
+		ret, err := re.lookup(ctx, b, name, qtype, depth)
+		if err != nil {
+			return nil, err
+		}
+		ret.Answer = append(chain, ret.Answer...)
+		if ret.Rcode != dns.RcodeSuccess || qtype == dns.TypeCNAME {
+			return ret, nil
+		}
+		t := target(ret.Answer, name)
+		if strings.EqualFold(t, name) || answered(ret.Answer, t, qtype) {
+			return ret, nil
+		}
+		chain = ret.Answer
+		name = t
+	}
+	return nil, errLoop
+}
+
+// lookup resolves name and qtype by following the delegations down from the closest known zone.
+// CNAMEs are not followed.
+func (re *Recursive) lookup(ctx context.Context, b *budget, name string, qtype uint16, depth int) (*dns.Msg, error) {
+	// DS records live in the parent zone.
+	start := name
+	if qtype == dns.TypeDS {
+		start = parent(name)
+	}
+	d := re.closest(start)
+
+	labels := dns.SplitDomainName(name)
+	minimise := re.minimise
+	n := dns.CountLabel(d.zone) + 1
+	count := 0
+	for i := 0; i < maxReferrals; i++ {
+		qname, qt := name, qtype
+		if minimise && n < len(labels) && count < maxMinimise {
+			qname = dns.Fqdn(strings.Join(labels[len(labels)-n:], "."))
+			qt = dns.TypeA
+			count++
+		}
+
+		resp, err := re.exchange(ctx, b, d, qname, qt)
+		if err != nil {
+			return nil, err
+		}
+
+		if zone, ok := referral(resp, d.zone, qname); ok {
+			if d, err = re.referral(ctx, b, d, zone, resp, depth); err != nil {
+				return nil, err
+			}
+			n = dns.CountLabel(d.zone) + 1
+			continue
+		}
+
+		if qname != name {
+			// Some servers wrongly answer NXDOMAIN for empty non-terminals, ask for the full name instead.
+			if resp.Rcode == dns.RcodeNameError {
+				minimise = false
+				continue
+			}
+			n += step(count, len(labels)-n)
+			continue
+		}
+		return bailiwick(resp, d.zone), nil
+	}
+	return nil, errLoop
+}
+
+// step returns the number of labels to add to the next minimised query name, after count minimised
+// queries with left labels still missing. Long names get more labels at a time, so they take at
+// most maxMinimise queries (RFC 9156, section 2.3).
+func step(count, left int) int {
+	if count < minimiseOne || count >= maxMinimise {
+		return 1
+	}
+	if s := left / (maxMinimise - count); s > 1 {
+		return s
+	}
+	return 1
+}
+
+// closest returns the delegation of the closest enclosing zone of name that's cached, or the root
+// hints.
+func (re *Recursive) closest(name string) *delegation {
+	name = strings.ToLower(name)
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if i, ok := re.delegations.Get(key(name[off:])); ok {
+			if d := i.(*delegation); time.Now().Before(d.expire) {
+				return d
+			}
+		}
+	}
+	return re.hints
+}
+
+// referral returns the delegation for zone from the referral resp, sent by a server of parent. The
+// delegation is cached.
+func (re *Recursive) referral(ctx context.Context, b *budget, parent *delegation, zone string, resp *dns.Msg, depth int) (*delegation, error) {
+	d := &delegation{zone: zone}
+	ttl := maxTTL
+	for _, rr := range resp.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok || !strings.EqualFold(ns.Hdr.Name, zone) {
+			continue
+		}
+		d.ns = append(d.ns, strings.ToLower(ns.Ns))
+		if t := time.Duration(ns.Hdr.Ttl) * time.Second; t < ttl {
+			ttl = t
+		}
+	}
+	if ttl < minTTL {
+		ttl = minTTL
+	}
+
+	// Only glue for names in the zone of the parent is used, any other address could be spoofed.
+	for _, rr := range resp.Extra {
+		name := strings.ToLower(rr.Header().Name)
+		if !contains(d.ns, name) || !dns.IsSubDomain(parent.zone, name) {
+			continue
+		}
+		switch a := rr.(type) {
+		case *dns.A:
+			d.addrs = append(d.addrs, a.A.String())
+		case *dns.AAAA:
+			d.addrs = append(d.addrs, a.AAAA.String())
+		}
+	}
+	if len(d.addrs) == 0 {
+		d.addrs = re.addresses(ctx, b, d, depth)
+	}
+	if len(d.addrs) == 0 {
+		return nil, fmt.Errorf("%w: no addresses for the name servers of %s", errUnreachable, zone)
+	}
+
+	d.expire = time.Now().Add(ttl)
+	re.delegations.Add(key(zone), d)
+	return d, nil
+}
+
+// addresses looks up the addresses of the name servers of d that weren't given as glue. It stops
+// when it has found a few, the others are looked up if the delegation is seen again after these
+// failed.
+func (re *Recursive) addresses(ctx context.Context, b *budget, d *delegation, depth int) []string {
+	if depth >= maxDepth {
+		return nil
+	}
+	addrs := []string{}
+	for _, ns := range d.ns {
+		// Names inside the zone can't be resolved without glue.
+		if dns.IsSubDomain(d.zone, ns) {
+			continue
+		}
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			ret, err := re.resolve(ctx, b, ns, qtype, depth+1)
+			if err != nil {
+				if errors.Is(err, errBudget) || ctx.Err() != nil {
+					return addrs
+				}
+				continue
+			}
+			for _, rr := range ret.Answer {
+				switch a := rr.(type) {
+				case *dns.A:
+					addrs = append(addrs, a.A.String())
+				case *dns.AAAA:
+					addrs = append(addrs, a.AAAA.String())
+				}
+			}
+			if len(addrs) > 0 {
+				break
+			}
+		}
+		if len(addrs) >= 2 {
+			break
+		}
+	}
+	return addrs
+}
+
+// exchange sends the query for qname and qtype to the servers of d, fastest first, until one
+// returns a usable response.
+func (re *Recursive) exchange(ctx context.Context, b *budget, d *delegation, qname string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, qtype)
+	m.RecursionDesired = false
+	m.SetEdns0(ednsSize, false)
+
+	for _, addr := range re.rtt.sort(d.addrs) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if b.queries >= maxQueries {
+			return nil, errBudget
+		}
+		b.queries++
+
+		m.Id = dns.Id()
+		resp, rtt, err := re.query(ctx, m, addr)
+		if err != nil {
+			log.Debugf("Failed to query %s for %s %s: %s", addr, qname, dns.Type(qtype), err)
+			re.rtt.timeout(addr, re.timeout)
+			continue
+		}
+		re.rtt.update(addr, rtt)
+		if !usable(resp, d.zone) {
+			log.Debugf("Unusable response from %s for %s %s: %s", addr, qname, dns.Type(qtype), dns.RcodeToString[resp.Rcode])
+			continue
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("%w for %s", errUnreachable, d.zone)
+}
+
+// query sends m to addr, over UDP and over TCP if the response is truncated.
+func (re *Recursive) query(ctx context.Context, m *dns.Msg, addr string) (*dns.Msg, time.Duration, error) {
+	hostport := net.JoinHostPort(addr, re.port)
+	c := &dns.Client{Net: "udp", Timeout: re.timeout}
+
+	start := time.Now()
+	resp, _, err := c.ExchangeContext(ctx, m, hostport)
+	if err == nil && resp.Truncated {
+		c.Net = "tcp"
+		resp, _, err = c.ExchangeContext(ctx, m, hostport)
+	}
+	rtt := time.Since(start)
+	queryCount.Inc()
+	queryDuration.Observe(rtt.Seconds())
+	if err != nil {
+		return nil, rtt, err
+	}
+
+	q := m.Question[0]
+	if len(resp.Question) != 1 || !strings.EqualFold(resp.Question[0].Name, q.Name) || resp.Question[0].Qtype != q.Qtype {
+		return nil, rtt, errors.New("wrong question in response")
+	}
+	return resp, rtt, nil
+}
+
+// usable returns true if resp, from a server of zone, is an answer, a referral or a negative answer.
+func usable(resp *dns.Msg, zone string) bool {
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return false
+	}
+	if len(resp.Answer) > 0 {
+		return true
+	}
+	// A referral up or sideways comes from a lame server.
+	for _, rr := range resp.Ns {
+		switch rr.Header().Rrtype {
+		case dns.TypeSOA:
+			return true
+		case dns.TypeNS:
+			if !dns.IsSubDomain(zone, rr.Header().Name) || strings.EqualFold(zone, rr.Header().Name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// referral returns the zone that resp, from a server of zone, delegates qname to, if it's a referral.
+func referral(resp *dns.Msg, zone, qname string) (string, bool) {
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) > 0 {
+		return "", false
+	}
+	child := ""
+	for _, rr := range resp.Ns {
+		switch rr.Header().Rrtype {
+		case dns.TypeSOA:
+			return "", false
+		case dns.TypeNS:
+			name := strings.ToLower(rr.Header().Name)
+			if dns.IsSubDomain(zone, name) && !strings.EqualFold(zone, name) && dns.IsSubDomain(name, qname) {
+				child = name
+			}
+		}
+	}
+	return child, child != ""
+}
+
+// bailiwick returns resp with only the records of the answer and authority sections that are
+// below zone, the records the servers of zone may answer for.
+func bailiwick(resp *dns.Msg, zone string) *dns.Msg {
+	ret := new(dns.Msg)
+	ret.Rcode = resp.Rcode
+	for _, rr := range resp.Answer {
+		if dns.IsSubDomain(zone, rr.Header().Name) {
+			ret.Answer = append(ret.Answer, rr)
+		}
+	}
+	// The authority section is only needed for negative answers.
+	if len(ret.Answer) == 0 {
+		for _, rr := range resp.Ns {
+			if rr.Header().Rrtype != dns.TypeNS && dns.IsSubDomain(zone, rr.Header().Name) {
+				ret.Ns = append(ret.Ns, rr)
+			}
+		}
+	}
+	return ret
+}
+
+// target follows the CNAMEs in answer, starting at name, and returns the last target.
+func target(answer []dns.RR, name string) string {
+	for i := 0; i < len(answer); i++ {
+		found := false
+		for _, rr := range answer {
+			if c, ok := rr.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, name) {
+				name = c.Target
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return name
+}
+
+// answered returns true if answer holds records of type qtype for name.
+func answered(answer []dns.RR, name string, qtype uint16) bool {
+	for _, rr := range answer {
+		h := rr.Header()
+		if strings.EqualFold(h.Name, name) && (h.Rrtype == qtype || qtype == dns.TypeANY) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func key(name string) uint64 { return cache.Hash([]byte(strings.ToLower(name))) }
+
+func parent(name string) string {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[off:]
+}
@@ -0,0 +1,86 @@
+package recursive
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rtts tracks the smoothed round trip time of the authoritative servers, so the fastest server of
+// a zone is asked first.
+type rtts struct {
+	mu sync.Mutex
+	m  map[string]*rtt
+}
+
+type rtt struct {
+	srtt time.Duration
+	seen time.Time
+}
+
+// rttExpire is how long a measurement is used. After that the server is unknown again and will be
+// tried, so a server that timed out once isn't avoided forever.
+const rttExpire = 10 * time.Minute
+
+func newRTTs() *rtts { return &rtts{m: map[string]*rtt{}} }
+
+// sort returns a copy of addrs ordered by their round trip time. Servers without one come first,
+// in random order, so all servers get measured.
+func (r *rtts) sort(addrs []string) []string {
+	sorted := make([]string, len(addrs))
+	copy(sorted, addrs)
+	rand.Shuffle(len(sorted), func(i, j int) { sorted[i], sorted[j] = sorted[j], sorted[i] })
+
+	r.mu.Lock()
+	est := make(map[string]time.Duration, len(sorted))
+	now := time.Now()
+	for _, a := range sorted {
+		if x, ok := r.m[a]; ok && now.Sub(x.seen) < rttExpire {
+			est[a] = x.srtt
+		}
+	}
+	r.mu.Unlock()
+
+	sort.SliceStable(sorted, func(i, j int) bool { return est[sorted[i]] < est[sorted[j]] })
+	return sorted
+}
+
+// update adds the round trip time d of a response from addr.
+func (r *rtts) update(addr string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	x, ok := r.m[addr]
+	if !ok || time.Since(x.seen) >= rttExpire {
+		r.set(addr, d)
+		return
+	}
+	x.srtt = (7*x.srtt + d) / 8
+	x.seen = time.Now()
+}
+
+// timeout penalizes addr for not answering, timeout is the query timeout.
+func (r *rtts) timeout(addr string, timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := timeout
+	if x, ok := r.m[addr]; ok && 2*x.srtt > d {
+		d = 2 * x.srtt
+	}
+	r.set(addr, d)
+}
+
+func (r *rtts) set(addr string, d time.Duration) {
+	if len(r.m) >= defaultCap {
+		now := time.Now()
+		for a, x := range r.m {
+			if now.Sub(x.seen) >= rttExpire {
+				delete(r.m, a)
+			}
+		}
+		if len(r.m) >= defaultCap {
+			r.m = map[string]*rtt{}
+		}
+	}
+	r.m[addr] = &rtt{srtt: d, seen: time.Now()}
+}
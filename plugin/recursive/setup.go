@@ -0,0 +1,88 @@
+package recursive
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+)
+
+const pluginName = "recursive"
+
+var log = clog.NewWithPlugin(pluginName)
+
+func init() { plugin.Register(pluginName, setup) }
+
+func setup(c *caddy.Controller) error {
+	re, err := recursiveParse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		re.Next = next
+		return re
+	})
+
+	return nil
+}
+
+func recursiveParse(c *caddy.Controller) (*Recursive, error) {
+	config := dnsserver.GetConfig(c)
+	re := New()
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		re.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "hints":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				path := args[0]
+				if !filepath.IsAbs(path) && config.Root != "" {
+					path = filepath.Join(config.Root, path)
+				}
+				f, err := os.Open(path)
+				if err != nil {
+					return nil, c.Errf("unable to open hints '%s': %v", path, err)
+				}
+				re.hints, err = readHints(f, path)
+				f.Close()
+				if err != nil {
+					return nil, c.Errf("unable to read hints '%s': %v", path, err)
+				}
+			case "timeout":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d <= 0 {
+					return nil, c.Errf("invalid timeout '%s'", args[0])
+				}
+				re.timeout = d
+			case "no_qname_minimisation":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				re.minimise = false
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+	return re, nil
+}
@@ -0,0 +1,78 @@
+package recursive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	dir := t.TempDir()
+	hints := filepath.Join(dir, "named.root")
+	content := `.                        3600000      NS    A.ROOT-SERVERS.NET.
+A.ROOT-SERVERS.NET.      3600000      A     198.41.0.4
+A.ROOT-SERVERS.NET.      3600000      AAAA  2001:503:ba3e::2:30
+`
+	if err := os.WriteFile(hints, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		zones     []string
+		addrs     int
+		minimise  bool
+		timeout   time.Duration
+	}{
+		{`recursive`, false, []string{}, len(roots), true, defaultTimeout},
+		{`recursive example.org {
+			hints ` + hints + `
+			timeout 500ms
+			no_qname_minimisation
+		}`, false, []string{"example.org."}, 2, false, 500 * time.Millisecond},
+		// fails
+		{`recursive {
+			hints /does/not/exist
+		}`, true, nil, 0, false, 0},
+		{`recursive {
+			timeout 0s
+		}`, true, nil, 0, false, 0},
+		{`recursive {
+			no_qname_minimisation yes
+		}`, true, nil, 0, false, 0},
+		{`recursive {
+			blah
+		}`, true, nil, 0, false, 0},
+		{"recursive\nrecursive", true, nil, 0, false, 0},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		re, err := recursiveParse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if len(re.Zones) != len(tc.zones) || (len(tc.zones) > 0 && re.Zones[0] != tc.zones[0]) {
+			t.Errorf("Test %d: expected zones %v, got %v", i, tc.zones, re.Zones)
+		}
+		if len(re.hints.addrs) != tc.addrs {
+			t.Errorf("Test %d: expected %d root server addresses, got %d", i, tc.addrs, len(re.hints.addrs))
+		}
+		if re.minimise != tc.minimise {
+			t.Errorf("Test %d: expected minimise %t, got %t", i, tc.minimise, re.minimise)
+		}
+		if re.timeout != tc.timeout {
+			t.Errorf("Test %d: expected timeout %s, got %s", i, tc.timeout, re.timeout)
+		}
+	}
+}
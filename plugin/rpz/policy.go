@@ -0,0 +1,292 @@
+package rpz
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/file/tree"
+
+	"github.com/infobloxopen/go-trees/iptree"
+	"github.com/miekg/dns"
+)
+
+// action is the policy action of a rule.
+type action int
+
+const (
+	actionNXDomain  action = iota // CNAME .
+	actionNoData                  // CNAME *.
+	actionPassthru                // CNAME rpz-passthru.
+	actionDrop                    // CNAME rpz-drop.
+	actionTCPOnly                 // CNAME rpz-tcp-only.
+	actionCNAME                   // CNAME to any other name
+	actionLocalData               // any other records
+)
+
+func (a action) String() string {
+	switch a {
+	case actionNXDomain:
+		return "nxdomain"
+	case actionNoData:
+		return "nodata"
+	case actionPassthru:
+		return "passthru"
+	case actionDrop:
+		return "drop"
+	case actionTCPOnly:
+		return "tcp-only"
+	case actionCNAME:
+		return "cname"
+	case actionLocalData:
+		return "local-data"
+	}
+	return ""
+}
+
+// trigger is the part of a query or response that is matched by a rule.
+type trigger int
+
+const (
+	triggerClientIP trigger = iota // rpz-client-ip, the address of the client
+	triggerQName                   // the query name
+	triggerIP                      // rpz-ip, addresses in the answer
+	triggerNSDName                 // rpz-nsdname, names of the name servers in the response
+)
+
+func (t trigger) String() string {
+	switch t {
+	case triggerClientIP:
+		return "client-ip"
+	case triggerQName:
+		return "qname"
+	case triggerIP:
+		return "ip"
+	case triggerNSDName:
+		return "nsdname"
+	}
+	return ""
+}
+
+// rule is the action for a trigger in a policy zone.
+type rule struct {
+	action action
+	target string   // target of the CNAME for actionCNAME
+	rrs    []dns.RR // records for actionLocalData
+}
+
+// names holds the rules for domain names, wildcard rules are stored under their parent name.
+type names struct {
+	exact    map[string]*rule
+	wildcard map[string]*rule
+}
+
+func newNames() names {
+	return names{exact: map[string]*rule{}, wildcard: map[string]*rule{}}
+}
+
+func (n names) add(name string, r *rule) {
+	if strings.HasPrefix(name, "*.") {
+		n.wildcard[name[2:]] = r
+		return
+	}
+	n.exact[name] = r
+}
+
+// match returns the rule for name. An exact rule is preferred, otherwise the most specific
+// wildcard rule is returned.
+func (n names) match(name string) *rule {
+	if r, ok := n.exact[name]; ok {
+		return r
+	}
+	if len(n.wildcard) == 0 {
+		return nil
+	}
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		if r, ok := n.wildcard[name[off:]]; ok {
+			return r
+		}
+	}
+	return n.wildcard["."]
+}
+
+// rules holds the rules of a version of a policy zone.
+type rules struct {
+	soa      *dns.SOA // SOA of the version of the zone the rules are compiled from
+	clientIP *iptree.Tree
+	qname    names
+	ip       *iptree.Tree
+	nsdname  names
+}
+
+// response returns true if there are rules that need the response to match.
+func (r *rules) response() bool {
+	return r.ip != nil || len(r.nsdname.exact) > 0 || len(r.nsdname.wildcard) > 0
+}
+
+// policy is a policy zone.
+type policy struct {
+	name string
+	z    *file.Zone
+
+	mu    sync.Mutex
+	rules atomic.Pointer[rules]
+}
+
+func newPolicy(z *file.Zone, name string) *policy {
+	return &policy{name: name, z: z}
+}
+
+// get returns the rules for the current version of the policy zone.
+func (p *policy) get() *rules {
+	p.z.RLock()
+	soa, t := p.z.Apex.SOA, p.z.Tree
+	p.z.RUnlock()
+
+	if r := p.rules.Load(); r != nil && r.soa == soa {
+		return r
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r := p.rules.Load(); r != nil && r.soa == soa {
+		return r
+	}
+	r := compile(p.name, t)
+	r.soa = soa
+	p.rules.Store(r)
+	if soa != nil {
+		log.Infof("Loaded policy zone %q with SOA serial %d", p.name, soa.Serial)
+	}
+	return r
+}
+
+// compile returns the rules in the tree t of the policy zone origin.
+func compile(origin string, t *tree.Tree) *rules {
+	r := &rules{qname: newNames(), nsdname: newNames()}
+	if t == nil {
+		return r
+	}
+	t.Walk(func(e *tree.Elem, rrsets map[uint16][]dns.RR) error {
+		name := e.Name()
+		if !dns.IsSubDomain(origin, name) || name == origin {
+			return nil
+		}
+		owner := strings.TrimSuffix(name[:len(name)-len(origin)], ".")
+		ru := newRule(e.All())
+
+		// The trigger type is the last label, the rest holds the address or name.
+		typ, rest := owner, ""
+		if i := strings.LastIndex(owner, "."); i >= 0 {
+			typ, rest = owner[i+1:], owner[:i]
+		}
+		switch typ {
+		case "rpz-client-ip":
+			n, err := parseIP(rest)
+			if err != nil {
+				log.Warningf("Invalid trigger %q in policy zone %q: %s", name, origin, err)
+				return nil
+			}
+			if r.clientIP == nil {
+				r.clientIP = iptree.NewTree()
+			}
+			r.clientIP.InplaceInsertNet(n, ru)
+		case "rpz-ip":
+			n, err := parseIP(rest)
+			if err != nil {
+				log.Warningf("Invalid trigger %q in policy zone %q: %s", name, origin, err)
+				return nil
+			}
+			if r.ip == nil {
+				r.ip = iptree.NewTree()
+			}
+			r.ip.InplaceInsertNet(n, ru)
+		case "rpz-nsdname":
+			if rest != "" {
+				r.nsdname.add(rest+".", ru)
+			}
+		case "rpz-nsip":
+			// Not supported, we don't know the addresses of the name servers.
+		default:
+			r.qname.add(owner+".", ru)
+		}
+		return nil
+	})
+	return r
+}
+
+// newRule returns the rule defined by the records rrs of a trigger.
+func newRule(rrs []dns.RR) *rule {
+	for _, rr := range rrs {
+		cname, ok := rr.(*dns.CNAME)
+		if !ok {
+			continue
+		}
+		switch cname.Target {
+		case ".":
+			return &rule{action: actionNXDomain}
+		case "*.":
+			return &rule{action: actionNoData}
+		case "rpz-passthru.":
+			return &rule{action: actionPassthru}
+		case "rpz-drop.":
+			return &rule{action: actionDrop}
+		case "rpz-tcp-only.":
+			return &rule{action: actionTCPOnly}
+		}
+		return &rule{action: actionCNAME, target: cname.Target, rrs: []dns.RR{cname}}
+	}
+	return &rule{action: actionLocalData, rrs: rrs}
+}
+
+// parseIP parses the network in the owner name of an IP trigger, i.e. "24.0.2.0.192" for 192.0.2.0/24
+// or "48.zz.db8.2001" for 2001:db8::/48.
+func parseIP(s string) (*net.IPNet, error) {
+	labels := strings.Split(s, ".")
+	if len(labels) < 2 {
+		return nil, fmt.Errorf("not an IP trigger: %q", s)
+	}
+	prefix, err := strconv.Atoi(labels[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid prefix length: %q", labels[0])
+	}
+	labels = labels[1:]
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+
+	bits := net.IPv6len * 8
+	var ip net.IP
+	if len(labels) == net.IPv4len && !strings.Contains(s, "zz") {
+		bits = net.IPv4len * 8
+		ip = net.ParseIP(strings.Join(labels, ".")).To4()
+	} else {
+		for i := range labels {
+			if labels[i] == "zz" {
+				labels[i] = ""
+			}
+		}
+		addr := strings.Join(labels, ":")
+		if strings.HasPrefix(addr, ":") {
+			addr = ":" + addr
+		}
+		if strings.HasSuffix(addr, ":") {
+			addr += ":"
+		}
+		ip = net.ParseIP(addr)
+		if ip.To4() != nil {
+			ip = nil // IPv4 mapped addresses can't be used.
+		}
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address in %q", s)
+	}
+	if prefix < 1 || prefix > bits {
+		return nil, fmt.Errorf("invalid prefix length: %d", prefix)
+	}
+	return &net.IPNet{IP: ip.Mask(net.CIDRMask(prefix, bits)), Mask: net.CIDRMask(prefix, bits)}, nil
+}
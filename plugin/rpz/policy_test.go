@@ -0,0 +1,153 @@
+package rpz
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/file"
+)
+
+const policyZone = `$ORIGIN rpz.example.
+$TTL 300
+@                               IN SOA  ns.rpz.example. admin.rpz.example. 1 3600 600 86400 300
+@                               IN NS   ns.rpz.example.
+
+bad.example.org                 IN CNAME .
+*.bad.example.org               IN CNAME .
+nodata.example.org              IN CNAME *.
+ok.bad.example.org              IN CNAME rpz-passthru.
+drop.example.org                IN CNAME rpz-drop.
+tcp.example.org                 IN CNAME rpz-tcp-only.
+garden.example.org              IN CNAME walled.garden.example.
+*.wildgarden.example.org        IN CNAME *.walled.garden.example.
+local.example.org               IN A    192.0.2.1
+local.example.org               IN TXT  "blocked"
+
+32.1.0.0.127.rpz-client-ip      IN CNAME rpz-drop.
+24.0.2.0.192.rpz-ip             IN CNAME .
+48.zz.db8.2001.rpz-ip           IN CNAME *.
+ns.bad.example.net.rpz-nsdname  IN CNAME .
+*.evil.example.rpz-nsdname      IN CNAME .
+32.1.0.0.10.rpz-nsip            IN CNAME .
+`
+
+func newTestPolicy(t *testing.T) *policy {
+	t.Helper()
+	z, err := file.Parse(strings.NewReader(policyZone), "rpz.example.", "stdin", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newPolicy(z, "rpz.example.")
+}
+
+func TestCompile(t *testing.T) {
+	p := newTestPolicy(t)
+	r := p.get()
+
+	tests := []struct {
+		qname  string
+		action action
+		found  bool
+	}{
+		{"bad.example.org.", actionNXDomain, true},
+		{"www.bad.example.org.", actionNXDomain, true},
+		{"a.b.bad.example.org.", actionNXDomain, true},
+		{"ok.bad.example.org.", actionPassthru, true},
+		{"nodata.example.org.", actionNoData, true},
+		{"drop.example.org.", actionDrop, true},
+		{"tcp.example.org.", actionTCPOnly, true},
+		{"garden.example.org.", actionCNAME, true},
+		{"www.wildgarden.example.org.", actionCNAME, true},
+		{"local.example.org.", actionLocalData, true},
+		{"example.org.", 0, false},
+		{"www.example.org.", 0, false},
+		{"wildgarden.example.org.", 0, false},
+	}
+	for i, tc := range tests {
+		ru := r.qname.match(tc.qname)
+		if (ru != nil) != tc.found {
+			t.Errorf("Test %d: expected found to be %t for %s", i, tc.found, tc.qname)
+			continue
+		}
+		if ru != nil && ru.action != tc.action {
+			t.Errorf("Test %d: expected action %s for %s, got %s", i, tc.action, tc.qname, ru.action)
+		}
+	}
+
+	if ru := r.qname.match("local.example.org."); len(ru.rrs) != 2 {
+		t.Errorf("Expected 2 local data records, got %d", len(ru.rrs))
+	}
+	if ru := r.qname.match("garden.example.org."); ru.target != "walled.garden.example." {
+		t.Errorf("Expected CNAME target walled.garden.example., got %s", ru.target)
+	}
+
+	for _, ip := range []string{"127.0.0.1"} {
+		if _, ok := r.clientIP.GetByIP(net.ParseIP(ip)); !ok {
+			t.Errorf("Expected client IP rule for %s", ip)
+		}
+	}
+	for _, ip := range []string{"192.0.2.1", "192.0.2.255", "2001:db8::1", "2001:db8:0:ffff::1"} {
+		if _, ok := r.ip.GetByIP(net.ParseIP(ip)); !ok {
+			t.Errorf("Expected IP rule for %s", ip)
+		}
+	}
+	for _, ip := range []string{"192.0.3.1", "2001:db9::1", "10.0.0.1"} {
+		if _, ok := r.ip.GetByIP(net.ParseIP(ip)); ok {
+			t.Errorf("Expected no IP rule for %s", ip)
+		}
+	}
+	for _, ns := range []string{"ns.bad.example.net.", "ns1.evil.example."} {
+		if r.nsdname.match(ns) == nil {
+			t.Errorf("Expected NSDNAME rule for %s", ns)
+		}
+	}
+	if !r.response() {
+		t.Error("Expected rules that need the response")
+	}
+
+	// The rules are only compiled again when the zone changes.
+	if r1 := p.get(); r1 != r {
+		t.Error("Expected the same rules for the same version of the zone")
+	}
+}
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"32.1.0.0.127", "127.0.0.1/32"},
+		{"24.0.2.0.192", "192.0.2.0/24"},
+		{"8.1.2.3.10", "10.0.0.0/8"},
+		{"128.1.zz.db8.2001", "2001:db8::1/128"},
+		{"48.zz.db8.2001", "2001:db8::/48"},
+		{"64.zz.1.0.db8.2001", "2001:db8:0:1::/64"},
+		{"128.1.zz", "::1/128"},
+		{"128.8.7.6.5.4.3.2.1", "1:2:3:4:5:6:7:8/128"},
+		// invalid
+		{"127", ""},
+		{"x.1.0.0.127", ""},
+		{"33.1.0.0.127", ""},
+		{"0.1.0.0.127", ""},
+		{"32.1.0.300.127", ""},
+		{"129.1.zz", ""},
+		{"64.1.zz.zz.2001", ""},
+	}
+	for i, tc := range tests {
+		n, err := parseIP(tc.in)
+		if tc.expected == "" {
+			if err == nil {
+				t.Errorf("Test %d: expected error for %q, got %s", i, tc.in, n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error for %q, got %s", i, tc.in, err)
+			continue
+		}
+		if n.String() != tc.expected {
+			t.Errorf("Test %d: expected %s, got %s", i, tc.expected, n)
+		}
+	}
+}
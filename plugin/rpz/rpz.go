@@ -0,0 +1,210 @@
+// Package rpz implements DNS response policy zones (RPZ).
+package rpz
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+// RPZ is a plugin that applies the rules in response policy zones to queries and their responses.
+type RPZ struct {
+	Next  plugin.Handler
+	Zones []string
+
+	policies []*policy // in order of precedence
+}
+
+// hit is a rule that matched a query or its response.
+type hit struct {
+	policy  *policy
+	trigger trigger
+	rule    *rule
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (p *RPZ) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+	if plugin.Zones(p.Zones).Matches(state.Name()) == "" {
+		return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+	}
+
+	rules := make([]*rules, len(p.policies))
+	for i := range p.policies {
+		rules[i] = p.policies[i].get()
+	}
+
+	// Policy zones are checked in order, the first zone with a matching rule wins. Rules that
+	// need the response are only checked if a zone before the first match has them.
+	h, i := p.query(state, rules)
+	response := false
+	for _, ru := range rules[:i] {
+		response = response || ru.response()
+	}
+	if !response {
+		if h == nil {
+			return plugin.NextOrFailure(p.Name(), p.Next, ctx, w, r)
+		}
+		return p.apply(ctx, state, h, nil)
+	}
+
+	nw := nonwriter.New(w)
+	rcode, err := plugin.NextOrFailure(p.Name(), p.Next, ctx, nw, r)
+	if nw.Msg == nil {
+		if h != nil {
+			return p.apply(ctx, state, h, nil)
+		}
+		return rcode, err
+	}
+	if h1 := p.response(nw.Msg, rules[:i]); h1 != nil {
+		h = h1
+	}
+	if h == nil {
+		w.WriteMsg(nw.Msg)
+		return rcode, err
+	}
+	return p.apply(ctx, state, h, nw.Msg)
+}
+
+// query returns the first rule that matches the client address or the query name, and the index of
+// its policy zone. If there is no match the number of policy zones is returned.
+func (p *RPZ) query(state request.Request, rules []*rules) (*hit, int) {
+	ip := net.ParseIP(state.IP())
+	qname := strings.ToLower(state.Name())
+	for i, ru := range rules {
+		if ru.clientIP != nil && ip != nil {
+			if v, ok := ru.clientIP.GetByIP(ip); ok {
+				return &hit{p.policies[i], triggerClientIP, v.(*rule)}, i
+			}
+		}
+		if r := ru.qname.match(qname); r != nil {
+			return &hit{p.policies[i], triggerQName, r}, i
+		}
+	}
+	return nil, len(rules)
+}
+
+// response returns the first rule that matches an address in the answer or a name server in the
+// response res.
+func (p *RPZ) response(res *dns.Msg, rules []*rules) *hit {
+	for i, ru := range rules {
+		if ru.ip != nil {
+			for _, rr := range res.Answer {
+				var ip net.IP
+				switch x := rr.(type) {
+				case *dns.A:
+					ip = x.A
+				case *dns.AAAA:
+					ip = x.AAAA
+				default:
+					continue
+				}
+				if v, ok := ru.ip.GetByIP(ip); ok {
+					return &hit{p.policies[i], triggerIP, v.(*rule)}
+				}
+			}
+		}
+		for _, rrs := range [][]dns.RR{res.Answer, res.Ns} {
+			for _, rr := range rrs {
+				ns, ok := rr.(*dns.NS)
+				if !ok {
+					continue
+				}
+				if r := ru.nsdname.match(strings.ToLower(ns.Ns)); r != nil {
+					return &hit{p.policies[i], triggerNSDName, r}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// apply applies the action of the rule in h. The response res is nil if the query wasn't resolved.
+func (p *RPZ) apply(ctx context.Context, state request.Request, h *hit, res *dns.Msg) (int, error) {
+	act := h.rule.action
+	if act == actionTCPOnly && state.Proto() == "tcp" {
+		act = actionPassthru
+	}
+	hits.WithLabelValues(metrics.WithServer(ctx), h.policy.name, h.trigger.String(), h.rule.action.String()).Inc()
+
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.RecursionAvailable = true
+
+	switch act {
+	case actionPassthru:
+		if res == nil {
+			return plugin.NextOrFailure(p.Name(), p.Next, ctx, state.W, state.Req)
+		}
+		state.W.WriteMsg(res)
+		return dns.RcodeSuccess, nil
+
+	case actionDrop:
+		return dns.RcodeSuccess, nil
+
+	case actionTCPOnly:
+		m.Truncated = true
+
+	case actionNXDomain:
+		m.Rcode = dns.RcodeNameError
+		m.Ns = p.soa(h.policy)
+
+	case actionNoData:
+		m.Ns = p.soa(h.policy)
+
+	case actionCNAME:
+		target := h.rule.target
+		if strings.HasPrefix(target, "*.") {
+			target = state.Name() + target[2:]
+		}
+		cname := &dns.CNAME{Hdr: dns.RR_Header{Name: state.QName(), Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: h.rule.rrs[0].Header().Ttl}, Target: target}
+		m.Answer = []dns.RR{cname}
+
+		// Resolve the target, without applying the policy zones again.
+		r := state.Req.Copy()
+		r.Question[0].Name = target
+		nw := nonwriter.New(state.W)
+		plugin.NextOrFailure(p.Name(), p.Next, ctx, nw, r)
+		if nw.Msg != nil {
+			m.Rcode = nw.Msg.Rcode
+			m.Answer = append(m.Answer, nw.Msg.Answer...)
+			m.Ns = nw.Msg.Ns
+		}
+
+	case actionLocalData:
+		for _, rr := range h.rule.rrs {
+			if rr.Header().Rrtype != state.QType() && state.QType() != dns.TypeANY {
+				continue
+			}
+			rr = dns.Copy(rr)
+			rr.Header().Name = state.QName()
+			m.Answer = append(m.Answer, rr)
+		}
+		if len(m.Answer) == 0 {
+			m.Ns = p.soa(h.policy)
+		}
+	}
+
+	state.W.WriteMsg(m)
+	return dns.RcodeSuccess, nil
+}
+
+// soa returns the SOA record of the policy zone, to be added to negative responses.
+func (p *RPZ) soa(pol *policy) []dns.RR {
+	pol.z.RLock()
+	defer pol.z.RUnlock()
+	if pol.z.Apex.SOA == nil {
+		return nil
+	}
+	return []dns.RR{dns.Copy(pol.z.Apex.SOA)}
+}
+
+// Name implements the Handler interface.
+func (p *RPZ) Name() string { return pluginName }
@@ -0,0 +1,164 @@
+package rpz
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestRPZ(t *testing.T) {
+	p := &RPZ{Zones: []string{"."}, policies: []*policy{newTestPolicy(t)}, Next: backend()}
+
+	tests := []struct {
+		qname    string
+		qtype    uint16
+		tcp      bool
+		remoteIP string
+		dropped  bool
+		tc       bool
+		rcode    int
+		answer   []dns.RR
+		soa      bool // whether the SOA of the policy zone is in the authority section
+	}{
+		{qname: "www.example.org.", qtype: dns.TypeA, answer: []dns.RR{test.A("www.example.org. 300 IN A 198.51.100.1")}},
+		{qname: "bad.example.org.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true},
+		{qname: "www.bad.example.org.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true},
+		{qname: "ok.bad.example.org.", qtype: dns.TypeA, answer: []dns.RR{test.A("ok.bad.example.org. 300 IN A 198.51.100.1")}},
+		{qname: "nodata.example.org.", qtype: dns.TypeA, soa: true},
+		{qname: "drop.example.org.", qtype: dns.TypeA, dropped: true},
+		{qname: "tcp.example.org.", qtype: dns.TypeA, tc: true},
+		{qname: "tcp.example.org.", qtype: dns.TypeA, tcp: true, answer: []dns.RR{test.A("tcp.example.org. 300 IN A 198.51.100.1")}},
+		{qname: "garden.example.org.", qtype: dns.TypeA, answer: []dns.RR{
+			test.CNAME("garden.example.org. 300 IN CNAME walled.garden.example."),
+			test.A("walled.garden.example. 300 IN A 203.0.113.1"),
+		}},
+		{qname: "www.wildgarden.example.org.", qtype: dns.TypeA, answer: []dns.RR{
+			test.CNAME("www.wildgarden.example.org. 300 IN CNAME www.wildgarden.example.org.walled.garden.example."),
+			test.A("www.wildgarden.example.org.walled.garden.example. 300 IN A 198.51.100.1"),
+		}},
+		{qname: "local.example.org.", qtype: dns.TypeA, answer: []dns.RR{test.A("local.example.org. 300 IN A 192.0.2.1")}},
+		{qname: "local.example.org.", qtype: dns.TypeAAAA, soa: true},
+		{qname: "www.example.org.", qtype: dns.TypeA, remoteIP: "127.0.0.1", dropped: true},
+		// Response triggers.
+		{qname: "ip.example.com.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true},
+		{qname: "ip.example.com.", qtype: dns.TypeAAAA, soa: true},
+		{qname: "ns.example.com.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true},
+		{qname: "ns.evil.example.", qtype: dns.TypeNS, rcode: dns.RcodeNameError, soa: true},
+	}
+
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, tc.qtype)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{TCP: tc.tcp, RemoteIP: tc.remoteIP})
+		if _, err := p.ServeDNS(context.TODO(), rec, m); err != nil {
+			t.Fatalf("Test %d: expected no error, got %s", i, err)
+		}
+		if tc.dropped {
+			if rec.Msg != nil {
+				t.Errorf("Test %d: expected no response, got %v", i, rec.Msg)
+			}
+			continue
+		}
+		if rec.Msg == nil {
+			t.Fatalf("Test %d: expected a response", i)
+		}
+		if rec.Msg.Truncated != tc.tc {
+			t.Errorf("Test %d: expected TC to be %t", i, tc.tc)
+		}
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rec.Msg.Rcode])
+		}
+		if err := test.Section(test.Case{Answer: tc.answer}, test.Answer, rec.Msg.Answer); err != nil {
+			t.Errorf("Test %d: %s", i, err)
+		}
+		soa := len(rec.Msg.Ns) == 1 && rec.Msg.Ns[0].Header().Name == "rpz.example."
+		if soa != tc.soa {
+			t.Errorf("Test %d: expected policy SOA to be %t, got %v", i, tc.soa, rec.Msg.Ns)
+		}
+	}
+}
+
+func TestRPZPrecedence(t *testing.T) {
+	const first = `$ORIGIN first.example.
+@                IN SOA  ns.first.example. admin.first.example. 1 3600 600 86400 300
+ip.example.com   IN CNAME rpz-passthru.
+24.0.2.0.192.rpz-ip IN CNAME *.
+`
+	z, err := file.Parse(strings.NewReader(first), "first.example.", "stdin", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &RPZ{Zones: []string{"."}, policies: []*policy{newPolicy(z, "first.example."), newTestPolicy(t)}, Next: backend()}
+
+	tests := []struct {
+		qname  string
+		rcode  int
+		answer int
+		ns     string // owner of the SOA in the authority section
+	}{
+		// A passthru in the first zone wins from the response trigger in the second zone.
+		{"ip.example.com.", dns.RcodeSuccess, 1, ""},
+		// A response trigger in the first zone wins from a query name trigger in the second zone.
+		{"ip.bad.example.org.", dns.RcodeSuccess, 0, "first.example."},
+		// Without a match in the first zone, the second zone is used.
+		{"bad.example.org.", dns.RcodeNameError, 0, "rpz.example."},
+	}
+	for i, tc := range tests {
+		m := new(dns.Msg)
+		m.SetQuestion(tc.qname, dns.TypeA)
+		rec := dnstest.NewRecorder(&test.ResponseWriter{})
+		p.ServeDNS(context.TODO(), rec, m)
+
+		if rec.Msg.Rcode != tc.rcode {
+			t.Errorf("Test %d: expected rcode %s, got %s", i, dns.RcodeToString[tc.rcode], dns.RcodeToString[rec.Msg.Rcode])
+		}
+		if len(rec.Msg.Answer) != tc.answer {
+			t.Errorf("Test %d: expected %d answers, got %d", i, tc.answer, len(rec.Msg.Answer))
+		}
+		ns := ""
+		if len(rec.Msg.Ns) > 0 {
+			ns = rec.Msg.Ns[0].Header().Name
+		}
+		if ns != tc.ns {
+			t.Errorf("Test %d: expected SOA of %q, got %q", i, tc.ns, ns)
+		}
+	}
+}
+
+// backend answers with 192.0.2.10 and 2001:db8::10 for ip.*, with 203.0.113.1 for walled.garden.example.
+// and with 198.51.100.1 otherwise. Names starting with ns. get the name server ns.bad.example.net. in
+// the authority section, NS queries are answered with ns1.evil.example.
+func backend() plugin.Handler {
+	return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		qname := r.Question[0].Name
+		switch r.Question[0].Qtype {
+		case dns.TypeA:
+			addr := "198.51.100.1"
+			switch {
+			case strings.HasPrefix(qname, "ip."):
+				addr = "192.0.2.10"
+			case qname == "walled.garden.example.":
+				addr = "203.0.113.1"
+			}
+			m.Answer = []dns.RR{test.A(qname + " 300 IN A " + addr)}
+		case dns.TypeAAAA:
+			m.Answer = []dns.RR{test.AAAA(qname + " 300 IN AAAA 2001:db8::10")}
+		case dns.TypeNS:
+			m.Answer = []dns.RR{test.NS(qname + " 300 IN NS ns1.evil.example.")}
+		}
+		if strings.HasPrefix(qname, "ns.") {
+			m.Ns = []dns.RR{test.NS("example.com. 300 IN NS ns.bad.example.net.")}
+		}
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	})
+}
@@ -0,0 +1,171 @@
+package rpz
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/file"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/parse"
+
+	"github.com/miekg/dns"
+)
+
+const pluginName = "rpz"
+
+var log = clog.NewWithPlugin(pluginName)
+
+func init() { plugin.Register(pluginName, setup) }
+
+func setup(c *caddy.Controller) error {
+	p, err := rpzParse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	for _, pol := range p.policies {
+		z := pol.z
+		if len(z.TransferFrom) == 0 {
+			c.OnStartup(func() error {
+				z.StartupOnce.Do(func() { z.Reload(nil) })
+				return nil
+			})
+			c.OnShutdown(z.OnShutdown)
+			continue
+		}
+
+		// Retrieve the zone and keep it up to date, like the secondary plugin.
+		name := pol.name
+		c.OnStartup(func() error {
+			z.StartupOnce.Do(func() {
+				go func() {
+					dur := time.Millisecond * 250
+					step := time.Duration(2)
+					max := time.Second * 10
+					for {
+						err := z.TransferIn()
+						if err == nil {
+							break
+						}
+						log.Warningf("All '%s' masters failed to transfer, retrying in %s: %s", name, dur.String(), err)
+						time.Sleep(dur)
+						dur = step * dur
+						if dur > max {
+							dur = max
+						}
+					}
+					z.Update()
+				}()
+			})
+			return nil
+		})
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		p.Next = next
+		return p
+	})
+
+	return nil
+}
+
+func rpzParse(c *caddy.Controller) (*RPZ, error) {
+	p := &RPZ{}
+	config := dnsserver.GetConfig(c)
+	reload := 1 * time.Minute
+	var (
+		openErr  error
+		openFile string // the file that failed to open
+	)
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		p.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "file":
+				// file FILE POLICY-ZONE
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				fileName, name := args[0], dns.Fqdn(args[1])
+				if !filepath.IsAbs(fileName) && config.Root != "" {
+					fileName = filepath.Join(config.Root, fileName)
+				}
+				reader, err := os.Open(filepath.Clean(fileName))
+				if err != nil {
+					// The zone is loaded when the file appears, if reloading is enabled.
+					openErr, openFile = err, fileName
+					p.policies = append(p.policies, newPolicy(file.NewZone(name, fileName), name))
+					continue
+				}
+				z, err := file.Parse(reader, name, fileName, 0)
+				reader.Close()
+				if err != nil {
+					return nil, err
+				}
+				p.policies = append(p.policies, newPolicy(z, name))
+
+			case "transfer":
+				// transfer POLICY-ZONE from ADDRESS...
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				name := dns.Fqdn(c.Val())
+				from, err := parse.TransferIn(c)
+				if err != nil {
+					return nil, err
+				}
+				z := file.NewZone(name, "stdin")
+				z.TransferFrom = from
+				p.policies = append(p.policies, newPolicy(z, name))
+
+			case "reload":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[0])
+				if err != nil || d < 0 {
+					return nil, c.Errf("invalid reload interval: %s", args[0])
+				}
+				reload = d
+
+			default:
+				return nil, c.Errf("unknown property '%s'", c.Val())
+			}
+		}
+	}
+
+	if len(p.policies) == 0 {
+		return nil, c.Err("no policy zones")
+	}
+	if openErr != nil {
+		if reload == 0 {
+			return nil, openErr
+		}
+		log.Warningf("Failed to open %q: %s: trying again in %s", openFile, openErr, reload)
+	}
+	seen := map[string]bool{}
+	for _, pol := range p.policies {
+		if seen[pol.name] {
+			return nil, c.Errf("duplicate policy zone: %s", pol.name)
+		}
+		seen[pol.name] = true
+		if len(pol.z.TransferFrom) == 0 {
+			pol.z.ReloadInterval = reload
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,99 @@
+package rpz
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/test"
+)
+
+func TestSetup(t *testing.T) {
+	name, rm, err := test.TempFile(".", policyZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm()
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		policies  []string
+		zones     []string
+		reload    time.Duration
+	}{
+		{`rpz {
+			file ` + name + ` rpz.example
+		}`, false, []string{"rpz.example."}, []string{}, time.Minute},
+		{`rpz example.org {
+			file ` + name + ` rpz.example
+			transfer feed.example from 10.0.0.1
+			reload 10s
+		}`, false, []string{"rpz.example.", "feed.example."}, []string{"example.org."}, 10 * time.Second},
+		// fails
+		{`rpz`, true, nil, nil, 0},
+		{`rpz {
+			file ` + name + `
+		}`, true, nil, nil, 0},
+		{`rpz {
+			file /does/not/exist rpz.example
+		}`, false, []string{"rpz.example."}, []string{}, time.Minute},
+		{`rpz {
+			file /does/not/exist rpz.example
+			reload 0
+		}`, true, nil, nil, 0},
+		{`rpz {
+			transfer feed.example
+		}`, true, nil, nil, 0},
+		{`rpz {
+			transfer feed.example to 10.0.0.1
+		}`, true, nil, nil, 0},
+		{`rpz {
+			file ` + name + ` rpz.example
+			reload -1s
+		}`, true, nil, nil, 0},
+		{`rpz {
+			file ` + name + ` rpz.example
+			transfer rpz.example from 10.0.0.1
+		}`, true, nil, nil, 0},
+		{`rpz {
+			file ` + name + ` rpz.example
+			bla
+		}`, true, nil, nil, 0},
+		{`rpz {
+			file ` + name + ` rpz.example
+		}
+		rpz`, true, nil, nil, 0},
+	}
+
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		p, err := rpzParse(c)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: expected no error, got %s", i, err)
+			continue
+		}
+		if len(p.policies) != len(tc.policies) {
+			t.Errorf("Test %d: expected %d policy zones, got %d", i, len(tc.policies), len(p.policies))
+			continue
+		}
+		for j, pol := range p.policies {
+			if pol.name != tc.policies[j] {
+				t.Errorf("Test %d: expected policy zone %s, got %s", i, tc.policies[j], pol.name)
+			}
+			if len(pol.z.TransferFrom) == 0 && pol.z.ReloadInterval != tc.reload {
+				t.Errorf("Test %d: expected reload %s, got %s", i, tc.reload, pol.z.ReloadInterval)
+			}
+		}
+		if !reflect.DeepEqual(p.Zones, tc.zones) {
+			t.Errorf("Test %d: expected zones %v, got %v", i, tc.zones, p.Zones)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package rrl
+
+// class is the response class a response is accounted to.
+type class int
+
+const (
+	classResponses class = iota
+	classNoData
+	classNXDomains
+	classReferrals
+	classErrors
+	classCount // keep this last, classNone is after this on purpose
+
+	classNone
+)
+
+var classToString = map[class]string{
+	classResponses: "responses",
+	classNoData:    "nodata",
+	classNXDomains: "nxdomains",
+	classReferrals: "referrals",
+	classErrors:    "errors",
+}
+
+func (c class) String() string { return classToString[c] }
@@ -0,0 +1,25 @@
+package rrl
+
+import (
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// ResponsesDroppedCount is the number of responses that were dropped.
+	ResponsesDroppedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "responses_dropped_total",
+		Help:      "Counter of responses dropped because the rate limit was exceeded.",
+	}, []string{"server", "zone", "class"})
+	// ResponsesSlippedCount is the number of responses that were slipped, i.e. sent truncated.
+	ResponsesSlippedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: pluginName,
+		Name:      "responses_slipped_total",
+		Help:      "Counter of truncated responses sent because the rate limit was exceeded.",
+	}, []string{"server", "zone", "class"})
+)
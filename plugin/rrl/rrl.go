@@ -0,0 +1,153 @@
+// Package rrl implements response rate limiting as described in
+// https://kb.isc.org/docs/aa-01000 and implemented by BIND.
+package rrl
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/response"
+	"github.com/coredns/coredns/request"
+
+	"github.com/miekg/dns"
+)
+
+var log = clog.NewWithPlugin(pluginName)
+
+// RRL limits the rate of responses sent to a client prefix.
+type RRL struct {
+	Next  plugin.Handler
+	Zones []string
+
+	window   time.Duration
+	ipv4Mask net.IPMask
+	ipv6Mask net.IPMask
+
+	// rates holds the allowed responses per second for each response class, 0 is unlimited.
+	rates [classCount]float64
+
+	slipRatio  uint
+	reportOnly bool
+
+	table *cache.Cache
+
+	now func() time.Time
+}
+
+// New returns a new RRL with the defaults set.
+func New() *RRL {
+	return &RRL{
+		window:   defaultWindow,
+		ipv4Mask: net.CIDRMask(defaultIPv4Prefix, 32),
+		ipv6Mask: net.CIDRMask(defaultIPv6Prefix, 128),
+
+		slipRatio: defaultSlipRatio,
+		table:     cache.New(defaultTableSize),
+		now:       time.Now,
+	}
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (rl *RRL) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: r}
+
+	// TCP clients can't spoof their source address, so there is nothing to limit. Neither can clients
+	// that sent a valid server cookie, see RFC 7873.
+	if valid, _ := ctx.Value(dnsserver.CookieKey{}).(bool); valid || state.Proto() != "udp" {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+	zone := plugin.Zones(rl.Zones).Matches(state.Name())
+	if zone == "" {
+		return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, w, r)
+	}
+
+	rw := &ResponseWriter{ResponseWriter: w, rrl: rl, server: metrics.WithServer(ctx), zone: zone, ip: state.IP()}
+	return plugin.NextOrFailure(rl.Name(), rl.Next, ctx, rw, r)
+}
+
+// Name implements the Handler interface.
+func (rl *RRL) Name() string { return pluginName }
+
+// ResponseWriter is a response writer that applies the rate limits to the responses written.
+type ResponseWriter struct {
+	dns.ResponseWriter
+	rrl *RRL
+
+	server string
+	zone   string
+	ip     string
+}
+
+// WriteMsg implements the dns.ResponseWriter interface.
+func (w *ResponseWriter) WriteMsg(res *dns.Msg) error {
+	c, name := classify(res)
+	if c == classNone {
+		return w.ResponseWriter.WriteMsg(res)
+	}
+
+	switch w.rrl.debit(w.ip, c, name) {
+	case actionDrop:
+		ResponsesDroppedCount.WithLabelValues(w.server, w.zone, c.String()).Inc()
+		if w.rrl.reportOnly {
+			log.Debugf("Would drop %s response to %s for %q", c, w.ip, name)
+			break
+		}
+		return nil
+
+	case actionSlip:
+		ResponsesSlippedCount.WithLabelValues(w.server, w.zone, c.String()).Inc()
+		if w.rrl.reportOnly {
+			log.Debugf("Would slip %s response to %s for %q", c, w.ip, name)
+			break
+		}
+		// Send an empty, truncated response, a real client will retry over TCP.
+		m := new(dns.Msg)
+		m.SetReply(res)
+		m.Rcode = res.Rcode
+		m.Truncated = true
+		return w.ResponseWriter.WriteMsg(m)
+	}
+
+	return w.ResponseWriter.WriteMsg(res)
+}
+
+// classify returns the response class of res and the name to account the response to.
+func classify(res *dns.Msg) (class, string) {
+	if len(res.Question) == 0 {
+		return classNone, ""
+	}
+
+	t, _ := response.Typify(res, time.Now().UTC())
+	switch t {
+	case response.NoError:
+		q := res.Question[0]
+		return classResponses, strings.ToLower(q.Name) + "/" + dns.Type(q.Qtype).String()
+	case response.NoData:
+		return classNoData, strings.ToLower(res.Question[0].Name)
+	case response.NameError:
+		// Account NXDOMAINs to the zone, random subdomain attacks would otherwise never be limited.
+		for _, rr := range res.Ns {
+			if rr.Header().Rrtype == dns.TypeSOA {
+				return classNXDomains, strings.ToLower(rr.Header().Name)
+			}
+		}
+		return classNXDomains, ""
+	case response.Delegation:
+		for _, rr := range res.Ns {
+			if rr.Header().Rrtype == dns.TypeNS {
+				return classReferrals, strings.ToLower(rr.Header().Name)
+			}
+		}
+		return classReferrals, ""
+	case response.ServerError, response.OtherError:
+		return classErrors, ""
+	}
+	return classNone, ""
+}
@@ -0,0 +1,187 @@
+package rrl
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func answer(rcode int) plugin.Handler {
+	return plugin.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+		m := new(dns.Msg)
+		m.SetRcode(r, rcode)
+		switch rcode {
+		case dns.RcodeSuccess:
+			m.Answer = []dns.RR{test.A(r.Question[0].Name + " 300 IN A 127.0.0.1")}
+		case dns.RcodeNameError:
+			m.Ns = []dns.RR{test.SOA("example.org. 300 IN SOA ns.example.org. admin.example.org. 1 3600 600 86400 300")}
+		}
+		w.WriteMsg(m)
+		return rcode, nil
+	})
+}
+
+func newTestRRL(next plugin.Handler, now *time.Time) *RRL {
+	rl := New()
+	rl.Zones = []string{"example.org."}
+	rl.Next = next
+	for c := classResponses; c < classCount; c++ {
+		rl.rates[c] = 2
+	}
+	rl.now = func() time.Time { return *now }
+	return rl
+}
+
+// serve sends a query for qname from ip and returns the response, or nil if it was dropped.
+func serve(t *testing.T, rl *RRL, ip string, tcp bool, qname string) *dns.Msg {
+	t.Helper()
+	m := new(dns.Msg)
+	m.SetQuestion(qname, dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: ip, TCP: tcp})
+	if _, err := rl.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	return rec.Msg
+}
+
+func TestRRL(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(answer(dns.RcodeSuccess), &now)
+
+	// The first two responses are within the rate.
+	for i := 0; i < 2; i++ {
+		if m := serve(t, rl, "10.240.0.1", false, "a.example.org."); m == nil || m.Truncated {
+			t.Fatalf("Expected response %d to be sent", i)
+		}
+	}
+	// Then every other response is dropped, and the others are slipped.
+	if m := serve(t, rl, "10.240.0.1", false, "a.example.org."); m != nil {
+		t.Fatalf("Expected response to be dropped, got %v", m)
+	}
+	m := serve(t, rl, "10.240.0.1", false, "a.example.org.")
+	if m == nil || !m.Truncated || len(m.Answer) != 0 {
+		t.Fatalf("Expected an empty truncated response, got %v", m)
+	}
+
+	// Another address in the same /24 shares the account.
+	if m := serve(t, rl, "10.240.0.2", false, "a.example.org."); m != nil {
+		t.Fatalf("Expected response to be dropped, got %v", m)
+	}
+	// A different name, client prefix, or TCP is not limited.
+	if m := serve(t, rl, "10.240.0.1", false, "b.example.org."); m == nil || m.Truncated {
+		t.Fatal("Expected response for a different name to be sent")
+	}
+	if m := serve(t, rl, "10.240.1.1", false, "a.example.org."); m == nil || m.Truncated {
+		t.Fatal("Expected response to a different prefix to be sent")
+	}
+	if m := serve(t, rl, "10.240.0.1", true, "a.example.org."); m == nil || m.Truncated {
+		t.Fatal("Expected TCP response to be sent")
+	}
+	// Names outside the zones are not limited either.
+	for i := 0; i < 5; i++ {
+		if m := serve(t, rl, "10.240.0.1", false, "example.net."); m == nil {
+			t.Fatal("Expected response outside of the zones to be sent")
+		}
+	}
+
+	// The account went 3 responses into debt, it takes 2 seconds to get back to a positive balance.
+	now = now.Add(time.Second)
+	if m := serve(t, rl, "10.240.0.1", false, "a.example.org."); m != nil && !m.Truncated {
+		t.Fatal("Expected response to still be limited")
+	}
+	now = now.Add(3 * time.Second)
+	if m := serve(t, rl, "10.240.0.1", false, "a.example.org."); m == nil || m.Truncated {
+		t.Fatal("Expected response to be sent after backing off")
+	}
+}
+
+func TestRRLConcurrent(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(answer(dns.RcodeSuccess), &now)
+
+	// Concurrent responses to a new client share one account.
+	var sent int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rl.debit("10.240.0.1", classResponses, "a.example.org.") == actionSend {
+				atomic.AddInt32(&sent, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if sent != 2 {
+		t.Errorf("Expected 2 responses to be sent, got %d", sent)
+	}
+}
+
+func TestRRLCookie(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(answer(dns.RcodeSuccess), &now)
+
+	for i := 0; i < 3; i++ {
+		serve(t, rl, "10.240.0.1", false, "a.example.org.")
+	}
+	// A client with a valid server cookie can't be spoofed, so it isn't limited.
+	m := new(dns.Msg)
+	m.SetQuestion("a.example.org.", dns.TypeA)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{RemoteIP: "10.240.0.1"})
+	ctx := context.WithValue(context.TODO(), dnsserver.CookieKey{}, true)
+	if _, err := rl.ServeDNS(ctx, rec, m); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if rec.Msg == nil || rec.Msg.Truncated {
+		t.Fatal("Expected response to a client with a valid cookie to be sent")
+	}
+}
+
+func TestRRLNXDomain(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(answer(dns.RcodeNameError), &now)
+
+	// NXDOMAINs are accounted to the zone, so random names share the same account.
+	sent := 0
+	for _, name := range []string{"a.example.org.", "b.example.org.", "c.example.org.", "d.example.org."} {
+		if m := serve(t, rl, "10.240.0.1", false, name); m != nil && !m.Truncated {
+			sent++
+		}
+	}
+	if sent != 2 {
+		t.Errorf("Expected 2 responses to be sent, got %d", sent)
+	}
+}
+
+func TestRRLReportOnly(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(answer(dns.RcodeSuccess), &now)
+	rl.reportOnly = true
+
+	for i := 0; i < 10; i++ {
+		if m := serve(t, rl, "10.240.0.1", false, "a.example.org."); m == nil || m.Truncated {
+			t.Fatalf("Expected response %d to be sent", i)
+		}
+	}
+}
+
+func TestRRLUnlimited(t *testing.T) {
+	now := time.Now()
+	rl := newTestRRL(answer(dns.RcodeSuccess), &now)
+	rl.rates[classResponses] = 0
+
+	for i := 0; i < 10; i++ {
+		if m := serve(t, rl, "10.240.0.1", false, "a.example.org."); m == nil || m.Truncated {
+			t.Fatalf("Expected response %d to be sent", i)
+		}
+	}
+}
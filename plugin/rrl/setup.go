@@ -0,0 +1,156 @@
+package rrl
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/cache"
+)
+
+const pluginName = "rrl"
+
+func init() { plugin.Register(pluginName, setup) }
+
+func setup(c *caddy.Controller) error {
+	rl, err := parse(c)
+	if err != nil {
+		return plugin.Error(pluginName, err)
+	}
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		rl.Next = next
+		return rl
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*RRL, error) {
+	rl := New()
+
+	i := 0
+	for c.Next() {
+		if i > 0 {
+			return nil, plugin.ErrOnce
+		}
+		i++
+
+		rl.Zones = plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
+
+		// Per class rates that are not set default to responses_per_second.
+		var set [classCount]bool
+		tableSize := defaultTableSize
+
+		for c.NextBlock() {
+			switch property := c.Val(); property {
+			case "window":
+				n, err := uintArg(c, 1)
+				if err != nil {
+					return nil, err
+				}
+				rl.window = time.Duration(n) * time.Second
+
+			case "ipv4_prefix_length":
+				n, err := uintArg(c, 0)
+				if err != nil {
+					return nil, err
+				}
+				if n > 32 {
+					return nil, c.Errf("ipv4_prefix_length must be between 0 and 32: %d", n)
+				}
+				rl.ipv4Mask = net.CIDRMask(n, 32)
+
+			case "ipv6_prefix_length":
+				n, err := uintArg(c, 0)
+				if err != nil {
+					return nil, err
+				}
+				if n > 128 {
+					return nil, c.Errf("ipv6_prefix_length must be between 0 and 128: %d", n)
+				}
+				rl.ipv6Mask = net.CIDRMask(n, 128)
+
+			case "responses_per_second", "nodata_per_second", "nxdomains_per_second", "referrals_per_second", "errors_per_second":
+				n, err := uintArg(c, 0)
+				if err != nil {
+					return nil, err
+				}
+				cl := optionToClass[property]
+				rl.rates[cl] = float64(n)
+				set[cl] = true
+
+			case "slip_ratio":
+				n, err := uintArg(c, 0)
+				if err != nil {
+					return nil, err
+				}
+				if n > 10 {
+					return nil, c.Errf("slip_ratio must be between 0 and 10: %d", n)
+				}
+				rl.slipRatio = uint(n)
+
+			case "max_table_size":
+				n, err := uintArg(c, 1)
+				if err != nil {
+					return nil, err
+				}
+				tableSize = n
+
+			case "report_only":
+				if c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				rl.reportOnly = true
+
+			default:
+				return nil, c.Errf("unknown property '%s'", property)
+			}
+		}
+
+		for cl := classNoData; cl < classCount; cl++ {
+			if !set[cl] {
+				rl.rates[cl] = rl.rates[classResponses]
+			}
+		}
+		rl.table = cache.New(tableSize)
+	}
+
+	return rl, nil
+}
+
+// uintArg parses the single argument of the current property as an integer of at least min.
+func uintArg(c *caddy.Controller, min int) (int, error) {
+	property := c.Val()
+	args := c.RemainingArgs()
+	if len(args) != 1 {
+		return 0, c.ArgErr()
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, c.Errf("invalid value for %s: %s", property, args[0])
+	}
+	if n < min {
+		return 0, c.Errf("%s must be at least %d: %d", property, min, n)
+	}
+	return n, nil
+}
+
+var optionToClass = map[string]class{
+	"responses_per_second": classResponses,
+	"nodata_per_second":    classNoData,
+	"nxdomains_per_second": classNXDomains,
+	"referrals_per_second": classReferrals,
+	"errors_per_second":    classErrors,
+}
+
+const (
+	defaultWindow     = 15 * time.Second
+	defaultIPv4Prefix = 24
+	defaultIPv6Prefix = 56
+	defaultSlipRatio  = 2
+	defaultTableSize  = 100000
+)
@@ -0,0 +1,105 @@
+package rrl
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expectErr string
+	}{
+		{`rrl`, false, ""},
+		{`rrl example.org {
+			responses_per_second 10
+		}`, false, ""},
+		{`rrl {
+			window 5
+			ipv4_prefix_length 32
+			ipv6_prefix_length 64
+			responses_per_second 10
+			nodata_per_second 5
+			nxdomains_per_second 5
+			referrals_per_second 5
+			errors_per_second 5
+			slip_ratio 0
+			max_table_size 1000
+			report_only
+		}`, false, ""},
+		// fails
+		{`rrl {
+			window 0
+		}`, true, "window must be at least 1"},
+		{`rrl {
+			ipv4_prefix_length 33
+		}`, true, "ipv4_prefix_length must be between"},
+		{`rrl {
+			ipv6_prefix_length 129
+		}`, true, "ipv6_prefix_length must be between"},
+		{`rrl {
+			responses_per_second foo
+		}`, true, "invalid value for responses_per_second"},
+		{`rrl {
+			slip_ratio 11
+		}`, true, "slip_ratio must be between"},
+		{`rrl {
+			report_only yes
+		}`, true, "Wrong argument count"},
+		{`rrl {
+			blah
+		}`, true, "unknown property"},
+		{`rrl
+		rrl`, true, "plugin"},
+	}
+
+	for i, test := range tests {
+		c := caddy.NewTestController("dns", test.input)
+		_, err := parse(c)
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d: expected error but found none for input %s", i, test.input)
+		}
+		if err != nil {
+			if !test.shouldErr {
+				t.Errorf("Test %d: expected no error but found one for input %s, got: %v", i, test.input, err)
+			}
+			if !strings.Contains(err.Error(), test.expectErr) {
+				t.Errorf("Test %d: expected error to contain: %v, found error: %v, input: %s", i, test.expectErr, err, test.input)
+			}
+		}
+	}
+}
+
+func TestSetupDefaults(t *testing.T) {
+	c := caddy.NewTestController("dns", `rrl {
+		responses_per_second 10
+		nxdomains_per_second 2
+	}`)
+	rl, err := parse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if rl.window != 15*time.Second {
+		t.Errorf("Expected window of 15s, got %s", rl.window)
+	}
+	if ones, _ := rl.ipv4Mask.Size(); ones != 24 {
+		t.Errorf("Expected IPv4 prefix length of 24, got %d", ones)
+	}
+	if !net.IP(rl.ipv6Mask).Equal(net.IP(net.CIDRMask(56, 128))) {
+		t.Errorf("Expected IPv6 prefix length of 56, got %s", rl.ipv6Mask)
+	}
+	if rl.slipRatio != 2 {
+		t.Errorf("Expected slip ratio of 2, got %d", rl.slipRatio)
+	}
+	if rl.rates[classNoData] != 10 || rl.rates[classErrors] != 10 {
+		t.Errorf("Expected unset rates to default to responses_per_second, got %v", rl.rates)
+	}
+	if rl.rates[classNXDomains] != 2 {
+		t.Errorf("Expected nxdomains rate of 2, got %v", rl.rates[classNXDomains])
+	}
+}
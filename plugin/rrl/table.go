@@ -0,0 +1,91 @@
+package rrl
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/cache"
+)
+
+// action is what to do with a response.
+type action int
+
+const (
+	actionSend action = iota
+	actionDrop
+	actionSlip
+)
+
+// account tracks the responses of a single class and name sent to a client prefix.
+type account struct {
+	sync.Mutex
+
+	balance float64   // credits left, a response costs one credit
+	last    time.Time // last time the balance was updated
+	limited uint      // number of consecutive limited responses, used for slipping
+}
+
+// debit charges a response of class c for name to the prefix ip belongs to and returns what to do
+// with the response.
+func (rl *RRL) debit(ip string, c class, name string) action {
+	rate := rl.rates[c]
+	if rate == 0 {
+		return actionSend
+	}
+
+	key, ok := rl.key(ip, c, name)
+	if !ok {
+		return actionSend
+	}
+
+	now := rl.now()
+	a := rl.table.GetOrAdd(key, func() interface{} { return &account{balance: rate, last: now} }).(*account)
+
+	a.Lock()
+	defer a.Unlock()
+
+	// Credits are added at rate per second, but never more than one second's worth. The balance
+	// can go negative up to window seconds worth of responses; a client that keeps sending
+	// will stay limited until it backs off.
+	a.balance += now.Sub(a.last).Seconds() * rate
+	if a.balance > rate {
+		a.balance = rate
+	}
+	a.last = now
+
+	a.balance--
+	if min := -rl.window.Seconds() * rate; a.balance < min {
+		a.balance = min
+	}
+
+	if a.balance >= 0 {
+		a.limited = 0
+		return actionSend
+	}
+
+	a.limited++
+	if rl.slipRatio > 0 && a.limited%rl.slipRatio == 0 {
+		return actionSlip
+	}
+	return actionDrop
+}
+
+// key returns the table key for the client prefix of ip, class c and name.
+func (rl *RRL) key(ip string, c class, name string) (uint64, bool) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return 0, false
+	}
+	if v4 := addr.To4(); v4 != nil {
+		addr = v4.Mask(rl.ipv4Mask)
+	} else {
+		addr = addr.Mask(rl.ipv6Mask)
+	}
+
+	b := make([]byte, 0, len(addr)+1+len(name))
+	b = append(b, addr...)
+	b = append(b, byte(c))
+	b = append(b, name...)
+	return cache.Hash(b), true
+}
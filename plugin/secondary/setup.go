@@ -1,6 +1,7 @@
 package secondary
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/coredns/caddy"
@@ -69,6 +70,7 @@ func secondaryParse(c *caddy.Controller) (file.Zones, error) {
 			origins := plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys)
 			for i := range origins {
 				z[origins[i]] = file.NewZone(origins[i], "stdin")
+				z[origins[i]].JournalSize = file.DefaultJournalSize
 				names = append(names, origins[i])
 			}
 
@@ -82,6 +84,18 @@ func secondaryParse(c *caddy.Controller) (file.Zones, error) {
 					if err != nil {
 						return file.Zones{}, err
 					}
+				case "journal":
+					t := c.RemainingArgs()
+					if len(t) != 1 {
+						return file.Zones{}, c.ArgErr()
+					}
+					n, err := strconv.Atoi(t[0])
+					if err != nil || n < 0 {
+						return file.Zones{}, c.Errf("invalid journal size: %s", t[0])
+					}
+					for _, origin := range origins {
+						z[origin].JournalSize = n
+					}
 				default:
 					return file.Zones{}, c.Errf("unknown property '%s'", c.Val())
 				}
@@ -2,20 +2,15 @@ package sign
 
 import (
 	"crypto"
-	"crypto/ecdsa"
-	"crypto/rsa"
 	"fmt"
-	"io"
-	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin/pkg/keyprovider"
 
 	"github.com/miekg/dns"
-	"golang.org/x/crypto/ed25519"
 )
 
 // Pair holds DNSSEC key information, both the public and private components are stored here.
@@ -25,85 +20,78 @@ type Pair struct {
 	Private crypto.Signer
 }
 
-// keyParse reads the public and private key from disk.
-func keyParse(c *caddy.Controller) ([]Pair, error) {
+// keyParse reads the public and private key from disk, or the public key from disk and the private
+// key from a PKCS#11 token. For "directory" no keys are read, but the directory is returned, the keys
+// in it are managed by a keyStore.
+func keyParse(c *caddy.Controller) ([]Pair, string, error) {
 	if !c.NextArg() {
-		return nil, c.ArgErr()
+		return nil, "", c.ArgErr()
 	}
 	pairs := []Pair{}
 	config := dnsserver.GetConfig(c)
 
+	var (
+		provider keyprovider.Provider
+		ks       []string
+	)
 	switch c.Val() {
 	case "file":
-		ks := c.RemainingArgs()
-		if len(ks) == 0 {
-			return nil, c.ArgErr()
+		provider = keyprovider.File{}
+		ks = c.RemainingArgs()
+	case "pkcs11":
+		// pkcs11 MODULE TOKEN PIN KEY...
+		args := c.RemainingArgs()
+		if len(args) < 4 {
+			return nil, "", c.ArgErr()
 		}
-		for _, k := range ks {
-			base := k
-			// Kmiek.nl.+013+26205.key, handle .private or without extension: Kmiek.nl.+013+26205
-			if strings.HasSuffix(k, ".key") {
-				base = k[:len(k)-4]
-			}
-			if strings.HasSuffix(k, ".private") {
-				base = k[:len(k)-8]
-			}
-			if !filepath.IsAbs(base) && config.Root != "" {
-				base = filepath.Join(config.Root, base)
-			}
-
-			pair, err := readKeyPair(base+".key", base+".private")
-			if err != nil {
-				return nil, err
-			}
-			pairs = append(pairs, pair)
+		p, err := keyprovider.NewPKCS11(args[0], args[1], args[2])
+		if err != nil {
+			return nil, "", err
 		}
+		c.OnShutdown(p.Close)
+		provider, ks = p, args[3:]
 	case "directory":
-		return nil, fmt.Errorf("directory: not implemented")
-	}
-
-	return pairs, nil
-}
-
-func readKeyPair(public, private string) (Pair, error) {
-	rk, err := os.Open(filepath.Clean(public))
-	if err != nil {
-		return Pair{}, err
-	}
-	b, err := io.ReadAll(rk)
-	if err != nil {
-		return Pair{}, err
-	}
-	dnskey, err := dns.NewRR(string(b))
-	if err != nil {
-		return Pair{}, err
-	}
-	if _, ok := dnskey.(*dns.DNSKEY); !ok {
-		return Pair{}, fmt.Errorf("RR in %q is not a DNSKEY: %d", public, dnskey.Header().Rrtype)
+		dir := c.RemainingArgs()
+		if len(dir) != 1 {
+			return nil, "", c.ArgErr()
+		}
+		if !filepath.IsAbs(dir[0]) && config.Root != "" {
+			dir[0] = filepath.Join(config.Root, dir[0])
+		}
+		return nil, dir[0], nil
+	default:
+		return nil, "", c.Errf("unknown key type '%s'", c.Val())
 	}
-	ksk := dnskey.(*dns.DNSKEY).Flags&(1<<8) == (1<<8) && dnskey.(*dns.DNSKEY).Flags&1 == 1
-	if !ksk {
-		return Pair{}, fmt.Errorf("DNSKEY in %q is not a CSK/KSK", public)
+	if len(ks) == 0 {
+		return nil, "", c.ArgErr()
 	}
 
-	rp, err := os.Open(filepath.Clean(private))
-	if err != nil {
-		return Pair{}, err
+	for _, k := range ks {
+		// Kmiek.nl.+013+26205.key, handle .private or without extension: Kmiek.nl.+013+26205
+		base := keyprovider.Base(k, config.Root)
+		pair, err := loadPair(provider, base)
+		if err != nil {
+			return nil, "", err
+		}
+		if pair.Public.Flags&dns.SEP != dns.SEP {
+			return nil, "", fmt.Errorf("DNSKEY in %q is not a CSK/KSK", base+".key")
+		}
+		pairs = append(pairs, pair)
 	}
-	privkey, err := dnskey.(*dns.DNSKEY).ReadPrivateKey(rp, private)
+
+	return pairs, "", nil
+}
+
+// loadPair loads the key pair with base name base from provider, the DNSKEY must have the zone flag set.
+func loadPair(provider keyprovider.Provider, base string) (Pair, error) {
+	k, err := provider.Load(base)
 	if err != nil {
 		return Pair{}, err
 	}
-	switch signer := privkey.(type) {
-	case *ecdsa.PrivateKey:
-		return Pair{Public: dnskey.(*dns.DNSKEY), KeyTag: dnskey.(*dns.DNSKEY).KeyTag(), Private: signer}, nil
-	case ed25519.PrivateKey:
-		return Pair{Public: dnskey.(*dns.DNSKEY), KeyTag: dnskey.(*dns.DNSKEY).KeyTag(), Private: signer}, nil
-	case *rsa.PrivateKey:
-		return Pair{Public: dnskey.(*dns.DNSKEY), KeyTag: dnskey.(*dns.DNSKEY).KeyTag(), Private: signer}, nil
-	default:
-		return Pair{}, fmt.Errorf("unsupported algorithm %s", signer)
+	if k.Public.Flags&dns.ZONE != dns.ZONE {
+		return Pair{}, fmt.Errorf("DNSKEY in %q is not a zone key", base+".key")
 	}
+	return Pair{Public: k.Public, KeyTag: k.Public.KeyTag(), Private: k.Private}, nil
 }
 
 // keyTag returns the key tags of the keys in ps as a formatted string.
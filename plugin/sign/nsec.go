@@ -2,6 +2,7 @@ package sign
 
 import (
 	"sort"
+	"strings"
 
 	"github.com/coredns/coredns/plugin/file"
 	"github.com/coredns/coredns/plugin/file/tree"
@@ -34,3 +35,65 @@ func NSEC(name, next string, ttl uint32, bitmap []uint16) *dns.NSEC {
 		TypeBitMap: bitmap,
 	}
 }
+
+// nsec3Params holds the parameters of an NSEC3 chain (RFC 5155).
+type nsec3Params struct {
+	iterations uint16
+	salt       string // hex encoded, empty for no salt
+	optOut     bool
+}
+
+// NSEC3PARAM returns the NSEC3PARAM record for the apex of origin.
+func (p *nsec3Params) NSEC3PARAM(origin string) *dns.NSEC3PARAM {
+	return &dns.NSEC3PARAM{
+		Hdr:        dns.RR_Header{Name: origin, Ttl: 0, Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET},
+		Hash:       dns.SHA1,
+		Iterations: p.iterations,
+		SaltLength: uint8(len(p.salt) / 2),
+		Salt:       p.salt,
+	}
+}
+
+// nsec3Chain returns the NSEC3 records for the names in bitmaps, which hold the types of each name.
+// Empty non-terminals between the names and origin are added to the chain. The records are sorted
+// on the hashed owner name, and each points to the next one.
+func nsec3Chain(origin string, bitmaps map[string][]uint16, ttl uint32, p *nsec3Params) []*dns.NSEC3 {
+	for name := range bitmaps {
+		for off, end := dns.NextLabel(name, 0); !end && dns.IsSubDomain(origin, name[off:]); off, end = dns.NextLabel(name, off) {
+			if _, ok := bitmaps[name[off:]]; !ok {
+				bitmaps[name[off:]] = []uint16{}
+			}
+		}
+	}
+
+	flags := uint8(0)
+	if p.optOut {
+		flags = 1
+	}
+	chain := make([]*dns.NSEC3, 0, len(bitmaps))
+	for name, bitmap := range bitmaps {
+		sort.Slice(bitmap, func(i, j int) bool { return bitmap[i] < bitmap[j] })
+		hash := dns.HashName(name, dns.SHA1, p.iterations, p.salt)
+		chain = append(chain, &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: strings.ToLower(hash) + "." + origin, Ttl: ttl, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET},
+			Hash:       dns.SHA1,
+			Flags:      flags,
+			Iterations: p.iterations,
+			SaltLength: uint8(len(p.salt) / 2),
+			Salt:       p.salt,
+			HashLength: 20,
+			NextDomain: hash,
+			TypeBitMap: bitmap,
+		})
+	}
+	sort.Slice(chain, func(i, j int) bool { return chain[i].NextDomain < chain[j].NextDomain })
+
+	hashes := make([]string, len(chain))
+	for i := range chain {
+		hashes[i] = chain[i].NextDomain
+	}
+	for i := range chain {
+		chain[i].NextDomain = hashes[(i+1)%len(chain)]
+	}
+	return chain
+}
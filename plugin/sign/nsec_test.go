@@ -1,10 +1,19 @@
 package sign
 
 import (
+	"context"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
 )
 
 func TestNames(t *testing.T) {
@@ -25,3 +34,124 @@ func TestNames(t *testing.T) {
 		}
 	}
 }
+
+func TestSignNSEC3(t *testing.T) {
+	input := `sign testdata/db.miek.nl miek.nl {
+		key file testdata/Kmiek.nl.+013+59725
+		nsec3 1 AABBCCDD
+	}`
+	c := caddy.NewTestController("dns", input)
+	sign, err := parse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := sign.signers[0].Sign(time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apex, _ := z.Search("miek.nl.")
+	if x := apex.Type(dns.TypeNSEC3PARAM); len(x) != 1 {
+		t.Fatalf("Expected 1 NSEC3PARAM, got %d", len(x))
+	}
+	if x := apex.Type(dns.TypeNSEC); len(x) != 0 {
+		t.Errorf("Expected no NSEC records, got %d", len(x))
+	}
+
+	// Every authoritative name has an NSEC3 record, and the chain is closed.
+	nsec3s := map[string]*dns.NSEC3{}
+	for _, rr := range z.Apex.NSEC3s() {
+		if x, ok := rr.(*dns.NSEC3); ok {
+			nsec3s[x.Hdr.Name] = x
+		}
+	}
+	for _, name := range names("miek.nl.", z) {
+		h := strings.ToLower(dns.HashName(name, dns.SHA1, 1, "AABBCCDD")) + ".miek.nl."
+		if _, ok := nsec3s[h]; !ok {
+			t.Errorf("Expected an NSEC3 record for %s", name)
+		}
+	}
+	for _, x := range nsec3s {
+		if _, ok := nsec3s[strings.ToLower(x.NextDomain)+".miek.nl."]; !ok {
+			t.Errorf("Expected next hashed owner %s to exist", x.NextDomain)
+		}
+		if x.Flags != 0 || x.Iterations != 1 || x.Salt != "AABBCCDD" {
+			t.Errorf("Expected NSEC3 parameters 0 1 AABBCCDD, got %d %d %s", x.Flags, x.Iterations, x.Salt)
+		}
+	}
+}
+
+func TestSignNSEC3Lookup(t *testing.T) {
+	db := `$TTL 30M
+$ORIGIN example.org.
+@       IN SOA ns.example.org. admin.example.org. ( 1 4H 1H 7D 4H )
+        IN NS  ns
+ns      IN A   127.0.0.1
+www.a   IN A   127.0.0.1
+sub     IN NS  ns.example.net.
+`
+	dbfile := filepath.Join(t.TempDir(), "db.example.org")
+	if err := os.WriteFile(dbfile, []byte(db), 0644); err != nil {
+		t.Fatal(err)
+	}
+	input := `sign ` + dbfile + ` example.org {
+		key file testdata/Kmiek.nl.+013+59725
+		nsec3 opt_out
+	}`
+	c := caddy.NewTestController("dns", input)
+	sign, err := parse(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := sign.signers[0].Sign(time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Apex, ns, a (empty non-terminal) and www.a, the unsigned delegation is opted out.
+	if x := len(z.Apex.NSEC3s()); x != 8 {
+		t.Errorf("Expected 4 NSEC3 records and their signatures, got %d records", x)
+	}
+
+	f := file.File{Next: test.ErrorHandler(), Zones: file.Zones{Z: map[string]*file.Zone{"example.org.": z}, Names: []string{"example.org."}}}
+	m := new(dns.Msg)
+	m.SetQuestion("nx.example.org.", dns.TypeA)
+	m.SetEdns0(4096, true)
+	rec := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := f.ServeDNS(context.TODO(), rec, m); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Msg.Rcode != dns.RcodeNameError {
+		t.Fatalf("Expected NXDOMAIN, got %s", dns.RcodeToString[rec.Msg.Rcode])
+	}
+
+	key := sign.signers[0].keys[0].Public
+	nsec3s, sigs := 0, 0
+	for _, rr := range rec.Msg.Ns {
+		switch x := rr.(type) {
+		case *dns.NSEC3:
+			nsec3s++
+			if x.Flags != 1 {
+				t.Errorf("Expected opt-out flag to be set")
+			}
+		case *dns.RRSIG:
+			if x.TypeCovered != dns.TypeNSEC3 {
+				continue
+			}
+			sigs++
+			var rrset []dns.RR
+			for _, r := range rec.Msg.Ns {
+				if r.Header().Rrtype == dns.TypeNSEC3 && r.Header().Name == x.Hdr.Name {
+					rrset = append(rrset, r)
+				}
+			}
+			if err := x.Verify(key, rrset); err != nil {
+				t.Errorf("Expected NSEC3 signature to verify, got %s", err)
+			}
+		}
+	}
+	// Closest encloser, next closer name and wildcard, but these may share NSEC3 records.
+	if nsec3s == 0 || nsec3s > 3 || sigs != nsec3s {
+		t.Errorf("Expected up to 3 signed NSEC3 records, got %d with %d signatures", nsec3s, sigs)
+	}
+}
@@ -0,0 +1,565 @@
+package sign
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/plugin/pkg/keyprovider"
+
+	"github.com/miekg/dns"
+)
+
+// keyStore manages the keys of a zone in a directory. Keys are generated and rolled according to
+// the policy, and the timing of every key (RFC 7583) is saved in a state file next to the keys, so
+// rollovers continue where they left off after a restart.
+type keyStore struct {
+	dir    string
+	origin string
+	policy policy
+
+	state state
+	pairs map[string]Pair // per key file base name
+	ipub  time.Duration   // publication interval of the last signing
+
+	// lookupDS returns the DS records of the zone at the parent and their highest TTL.
+	lookupDS func(zone string) ([]*dns.DS, time.Duration, error)
+}
+
+// policy says when and how keys are rolled. A zero lifetime means keys of that kind never roll.
+type policy struct {
+	algorithm   uint8
+	zskLifetime time.Duration
+	kskLifetime time.Duration
+	zskMethod   method
+}
+
+// method is the method used for a ZSK rollover. KSKs are always rolled with the double-KSK method
+// (RFC 7583, section 3.3.1), the new KSK is published and signs the DNSKEY RRset right away.
+type method int
+
+const (
+	prePublish      method = iota // RFC 7583, section 3.2.1
+	doubleSignature               // RFC 7583, section 3.2.2
+)
+
+// state is the content of the state file.
+type state struct {
+	Signed time.Time    `json:"signed"` // the last time the zone was signed
+	CDS    []uint16     `json:"cds"`    // key tags of the keys in the CDS and CDNSKEY records
+	Keys   []*keyTiming `json:"keys"`
+}
+
+// keyTiming holds the timing of a key. A zero time is an event that isn't scheduled.
+type keyTiming struct {
+	File     string    `json:"file"` // base name of the .key and .private files
+	KSK      bool      `json:"ksk"`
+	Publish  time.Time `json:"publish"`
+	Activate time.Time `json:"activate"`
+	Inactive time.Time `json:"inactive"`
+	Delete   time.Time `json:"delete"`
+
+	// Successor is the KSK that replaces this one, this KSK is removed when the DS records at the
+	// parent point to the successor.
+	Successor string `json:"successor,omitempty"`
+}
+
+func (k *keyTiming) published(now time.Time) bool {
+	return !k.Publish.After(now) && (k.Delete.IsZero() || k.Delete.After(now))
+}
+
+func (k *keyTiming) active(now time.Time) bool {
+	return !k.Activate.After(now) && (k.Inactive.IsZero() || k.Inactive.After(now))
+}
+
+func newKeyStore(dir, origin string, p policy) *keyStore {
+	return &keyStore{dir: dir, origin: origin, policy: p, pairs: map[string]Pair{}, lookupDS: lookupDS(nil)}
+}
+
+// stateFile returns the path of the state file, K<origin>state, i.e. Kexample.org.state.
+func (ks *keyStore) stateFile() string { return filepath.Join(ks.dir, "K"+ks.origin+"state") }
+
+// load reads the state file and the keys in it. Without a state file, the keys for the zone that are
+// in the directory are used, and are considered active.
+func (ks *keyStore) load(now time.Time) error {
+	if ks.state.Keys != nil {
+		return nil
+	}
+	buf, err := os.ReadFile(ks.stateFile())
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(buf, &ks.state); err != nil {
+			return fmt.Errorf("failed to parse %q: %s", ks.stateFile(), err)
+		}
+	case os.IsNotExist(err):
+		files, _ := filepath.Glob(filepath.Join(ks.dir, "K"+ks.origin+"+*.key"))
+		for _, f := range files {
+			base := strings.TrimSuffix(filepath.Base(f), ".key")
+			ks.state.Keys = append(ks.state.Keys, &keyTiming{File: base, Publish: now, Activate: now})
+		}
+	default:
+		return err
+	}
+
+	for _, k := range ks.state.Keys {
+		base := filepath.Join(ks.dir, k.File)
+		pair, err := loadPair(keyprovider.File{}, base)
+		if err != nil {
+			return err
+		}
+		pair.Public.Header().Name = ks.origin
+		k.KSK = pair.Public.Flags&dns.SEP == dns.SEP
+		ks.pairs[k.File] = pair
+	}
+	if ks.state.Keys == nil {
+		ks.state.Keys = []*keyTiming{}
+	}
+	return nil
+}
+
+// save writes the state file.
+func (ks *keyStore) save() error {
+	buf, err := json.MarshalIndent(ks.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(ks.dir, "state-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	f.Close()
+	return os.Rename(f.Name(), ks.stateFile())
+}
+
+// roll brings the keys up to date at now: keys past their delete time are removed, keys are
+// generated when the zone has none, and successors are generated for keys that reach the end of
+// their lifetime. The DNSKEY TTL is ttl, maxTTL is the highest TTL in the zone.
+func (ks *keyStore) roll(now time.Time, ttl, maxTTL time.Duration) error {
+	if err := ks.load(now); err != nil {
+		return err
+	}
+	ks.ipub = ttl + durationPropagation
+
+	keep := ks.state.Keys[:0]
+	for _, k := range ks.state.Keys {
+		if !k.Delete.IsZero() && !now.Before(k.Delete) {
+			log.Infof("Removing retired key %d of %q", ks.pairs[k.File].KeyTag, ks.origin)
+			base := filepath.Join(ks.dir, k.File)
+			os.Remove(base + ".key")
+			os.Remove(base + ".private")
+			delete(ks.pairs, k.File)
+			continue
+		}
+		keep = append(keep, k)
+	}
+	ks.state.Keys = keep
+
+	// A zone needs a KSK, it signs everything when there is no ZSK. A ZSK is only generated when
+	// ZSKs are rolled.
+	if len(ks.kind(true)) == 0 {
+		if _, err := ks.generate(true, now, now); err != nil {
+			return err
+		}
+	}
+	if len(ks.kind(false)) == 0 && ks.policy.zskLifetime > 0 {
+		if _, err := ks.generate(false, now, now); err != nil {
+			return err
+		}
+	}
+
+	// An old KSK goes when the old DS records have expired from all caches.
+	for _, k := range ks.retirable(now) {
+		ttl, ok := ks.replaced(k)
+		if !ok {
+			continue
+		}
+		k.Inactive = now.Add(ttl + durationPropagation)
+		k.Delete = k.Inactive
+		log.Infof("DS records of %q at the parent no longer point to KSK %d, it is removed at %s", ks.origin, ks.pairs[k.File].KeyTag, k.Delete.Format(timeFmt))
+	}
+
+	for _, ksk := range []bool{true, false} {
+		cur := ks.rollable(ksk, now)
+		if cur == nil {
+			continue
+		}
+		switch {
+		case ksk:
+			// The old KSK stays until the parent has replaced its DS records, see replaced.
+			k, err := ks.generate(true, now, now)
+			if err != nil {
+				return err
+			}
+			cur.Successor = k.File
+			log.Infof("Rolling KSK %d of %q: KSK %d is published, KSK %d is removed when the DS records at the parent are updated", ks.pairs[cur.File].KeyTag, ks.origin, ks.pairs[k.File].KeyTag, ks.pairs[cur.File].KeyTag)
+		case ks.policy.zskMethod == prePublish:
+			// The new ZSK is published and takes over when it's in all caches, the old one is removed
+			// when its signatures have expired from all caches.
+			k, err := ks.generate(false, now, now.Add(ks.ipub))
+			if err != nil {
+				return err
+			}
+			cur.Inactive = k.Activate
+			cur.Delete = cur.Inactive.Add(maxTTL + durationPropagation)
+			log.Infof("Rolling ZSK %d of %q: ZSK %d is published and active at %s", ks.pairs[cur.File].KeyTag, ks.origin, ks.pairs[k.File].KeyTag, k.Activate.Format(timeFmt))
+		default:
+			// Both ZSKs sign the zone until the new DNSKEY is in all caches.
+			k, err := ks.generate(false, now, now)
+			if err != nil {
+				return err
+			}
+			cur.Inactive = now.Add(ks.ipub)
+			cur.Delete = cur.Inactive
+			log.Infof("Rolling ZSK %d of %q: ZSK %d is published and active, ZSK %d is removed at %s", ks.pairs[cur.File].KeyTag, ks.origin, ks.pairs[k.File].KeyTag, ks.pairs[cur.File].KeyTag, cur.Delete.Format(timeFmt))
+		}
+	}
+
+	return ks.save()
+}
+
+// rollable returns the active key of the kind if it has reached the end of its lifetime, and no
+// successor was generated for it yet.
+func (ks *keyStore) rollable(ksk bool, now time.Time) *keyTiming {
+	lifetime := ks.policy.zskLifetime
+	if ksk {
+		lifetime = ks.policy.kskLifetime
+	}
+	if lifetime == 0 {
+		return nil
+	}
+	var cur *keyTiming
+	for _, k := range ks.kind(ksk) {
+		if k.active(now) && (cur == nil || k.Activate.After(cur.Activate)) {
+			cur = k
+		}
+	}
+	if cur == nil {
+		return nil
+	}
+	for _, k := range ks.kind(ksk) {
+		if k.Activate.After(cur.Activate) {
+			return nil // successor is published, but not active yet
+		}
+	}
+	// A pre-published ZSK is generated early enough to take over at the end of the lifetime.
+	lead := time.Duration(0)
+	if !ksk && ks.policy.zskMethod == prePublish {
+		lead = ks.ipub
+	}
+	if now.Before(cur.Activate.Add(lifetime - lead)) {
+		return nil
+	}
+	return cur
+}
+
+// due returns the reason the zone must be signed again because of the keys, or nil.
+func (ks *keyStore) due(now time.Time) error {
+	if err := ks.load(now); err != nil {
+		return err
+	}
+	if len(ks.kind(true)) == 0 {
+		return errors.New("no keys")
+	}
+	for _, k := range ks.state.Keys {
+		for _, t := range []time.Time{k.Publish, k.Activate, k.Inactive, k.Delete} {
+			if !t.IsZero() && t.After(ks.state.Signed) && !t.After(now) {
+				return fmt.Errorf("the timing of key %d changed at %s", ks.pairs[k.File].KeyTag, t.Format(timeFmt))
+			}
+		}
+	}
+	for _, ksk := range []bool{true, false} {
+		if k := ks.rollable(ksk, now); k != nil {
+			return fmt.Errorf("key %d reached the end of its lifetime", ks.pairs[k.File].KeyTag)
+		}
+	}
+	for _, k := range ks.retirable(now) {
+		if _, ok := ks.replaced(k); ok {
+			return fmt.Errorf("the DS records at the parent no longer point to key %d", ks.pairs[k.File].KeyTag)
+		}
+	}
+	return nil
+}
+
+// retirable returns the KSKs that wait for the parent to replace their DS records, once the CDS
+// records are for their successor.
+func (ks *keyStore) retirable(now time.Time) []*keyTiming {
+	ret := []*keyTiming{}
+	for _, k := range ks.kind(true) {
+		if k.Successor == "" || !k.Delete.IsZero() {
+			continue
+		}
+		for _, s := range ks.kind(true) {
+			if s.File == k.Successor && !s.Publish.Add(ks.ipub).After(now) {
+				ret = append(ret, k)
+			}
+		}
+	}
+	return ret
+}
+
+// replaced returns true if the DS records at the parent point to the successor of the KSK k and not
+// to k, and the highest TTL of the DS records. A parent without DS records for the zone doesn't
+// depend on k either.
+func (ks *keyStore) replaced(k *keyTiming) (time.Duration, bool) {
+	ds, ttl, err := ks.lookupDS(ks.origin)
+	if err != nil {
+		log.Warningf("Failed to check the DS records of %q at the parent: %s", ks.origin, err)
+		return 0, false
+	}
+	if len(ds) == 0 {
+		return ttl, true
+	}
+	if !hasDS(ds, ks.pairs[k.Successor].Public) || hasDS(ds, ks.pairs[k.File].Public) {
+		log.Infof("Waiting for the DS records of %q at the parent to point to KSK %d, instead of KSK %d", ks.origin, ks.pairs[k.Successor].KeyTag, ks.pairs[k.File].KeyTag)
+		return 0, false
+	}
+	return ttl, true
+}
+
+// hasDS returns true if one of the DS records in ds is for key.
+func hasDS(ds []*dns.DS, key *dns.DNSKEY) bool {
+	if key == nil {
+		return false
+	}
+	for _, d := range ds {
+		if x := key.ToDS(d.DigestType); x != nil && x.KeyTag == d.KeyTag && strings.EqualFold(x.Digest, d.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupDS returns a function that queries servers for the DS records of a zone, or the servers in
+// /etc/resolv.conf when there are none. All servers must return the same DS records, so a change
+// is only seen once it has reached all of them.
+func lookupDS(servers []string) func(zone string) ([]*dns.DS, time.Duration, error) {
+	return func(zone string) ([]*dns.DS, time.Duration, error) {
+		addrs := servers
+		if len(addrs) == 0 {
+			conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+			if err != nil {
+				return nil, 0, err
+			}
+			for _, s := range conf.Servers {
+				addrs = append(addrs, net.JoinHostPort(s, conf.Port))
+			}
+		}
+
+		var (
+			ds    []*dns.DS
+			ttl   time.Duration
+			first = true
+		)
+		for _, addr := range addrs {
+			set, t, err := queryDS(zone, addr)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%s: %s", addr, err)
+			}
+			if !first && !sameDS(ds, set) {
+				return nil, 0, fmt.Errorf("%s: DS records differ from the other servers", addr)
+			}
+			ds, first = set, false
+			if t > ttl {
+				ttl = t
+			}
+		}
+		return ds, ttl, nil
+	}
+}
+
+// queryDS queries addr for the DS records of zone, it retries over TCP when the reply is truncated.
+func queryDS(zone, addr string) ([]*dns.DS, time.Duration, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(zone, dns.TypeDS)
+	m.SetEdns0(4096, true)
+
+	c := new(dns.Client)
+	r, _, err := c.Exchange(m, addr)
+	if err == nil && r.Truncated {
+		c.Net = "tcp"
+		r, _, err = c.Exchange(m, addr)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, 0, fmt.Errorf("rcode %s", dns.RcodeToString[r.Rcode])
+	}
+
+	ds := []*dns.DS{}
+	ttl := time.Duration(0)
+	for _, rr := range r.Answer {
+		d, ok := rr.(*dns.DS)
+		if !ok || !strings.EqualFold(d.Hdr.Name, zone) {
+			continue
+		}
+		ds = append(ds, d)
+		if t := time.Duration(d.Hdr.Ttl) * time.Second; t > ttl {
+			ttl = t
+		}
+	}
+	return ds, ttl, nil
+}
+
+// sameDS returns true if a and b hold the same DS records.
+func sameDS(a, b []*dns.DS) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if x.KeyTag == y.KeyTag && x.Algorithm == y.Algorithm && x.DigestType == y.DigestType && strings.EqualFold(x.Digest, y.Digest) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// keys returns the keys that are published in the zone at now, the KSKs that sign the DNSKEY
+// RRset, the ZSKs that sign the other RRsets and the KSKs that go in the CDS and CDNSKEY records.
+func (ks *keyStore) keys(now time.Time) (published, ksks, zsks, cds []Pair) {
+	// The parent is asked to replace the DS records with the newest KSK, when its DNSKEY is in all caches.
+	var newest time.Time
+	for _, k := range ks.state.Keys {
+		if k.KSK && k.active(now) && !k.Publish.Add(ks.ipub).After(now) && k.Publish.After(newest) {
+			newest = k.Publish
+		}
+	}
+
+	for _, k := range ks.state.Keys {
+		pair := ks.pairs[k.File]
+		if k.published(now) {
+			published = append(published, pair)
+		}
+		if !k.active(now) {
+			continue
+		}
+		if k.KSK {
+			ksks = append(ksks, pair)
+			if k.Publish.Equal(newest) {
+				cds = append(cds, pair)
+			}
+			continue
+		}
+		zsks = append(zsks, pair)
+	}
+	if len(zsks) == 0 {
+		zsks = ksks
+	}
+	if len(cds) == 0 {
+		cds = ksks
+	}
+	return published, ksks, zsks, cds
+}
+
+// signed records that the zone was signed at now, with the keys in cds in the CDS and CDNSKEY records.
+func (ks *keyStore) signed(now time.Time, cds []Pair) error {
+	tags := make([]uint16, len(cds))
+	for i, p := range cds {
+		tags[i] = p.KeyTag
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	if fmt.Sprint(tags) != fmt.Sprint(ks.state.CDS) {
+		log.Infof("CDS and CDNSKEY records of %q changed from key tags %v to %v, make sure the DS records at the parent are updated", ks.origin, ks.state.CDS, tags)
+	}
+	ks.state.CDS = tags
+	ks.state.Signed = now
+	return ks.save()
+}
+
+// kind returns the KSKs or the ZSKs.
+func (ks *keyStore) kind(ksk bool) []*keyTiming {
+	ret := []*keyTiming{}
+	for _, k := range ks.state.Keys {
+		if k.KSK == ksk {
+			ret = append(ret, k)
+		}
+	}
+	return ret
+}
+
+// generate generates a new key and writes it to the directory. It's published at publish and
+// active at activate.
+func (ks *keyStore) generate(ksk bool, publish, activate time.Time) (*keyTiming, error) {
+	k := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: ks.origin, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE,
+		Protocol:  3,
+		Algorithm: ks.policy.algorithm,
+	}
+	if ksk {
+		k.Flags |= dns.SEP
+	}
+
+	var priv crypto.PrivateKey
+	for i := 0; ; i++ {
+		var err error
+		if priv, err = k.Generate(bits[k.Algorithm]); err != nil {
+			return nil, err
+		}
+		if !ks.hasTag(k.KeyTag()) {
+			break
+		}
+		if i > 10 {
+			return nil, fmt.Errorf("failed to generate a key with a unique key tag for %q", ks.origin)
+		}
+	}
+
+	base := fmt.Sprintf("K%s+%03d+%05d", ks.origin, k.Algorithm, k.KeyTag())
+	path := filepath.Join(ks.dir, base)
+	if err := os.WriteFile(path+".key", []byte(k.String()+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path+".private", []byte(k.PrivateKeyString(priv)), 0600); err != nil {
+		return nil, err
+	}
+
+	t := &keyTiming{File: base, KSK: ksk, Publish: publish, Activate: activate}
+	ks.state.Keys = append(ks.state.Keys, t)
+	ks.pairs[base] = Pair{Public: k, KeyTag: k.KeyTag(), Private: priv.(crypto.Signer)}
+	log.Infof("Generated %s %d for %q in %q", kindName(ksk), k.KeyTag(), ks.origin, path)
+	return t, nil
+}
+
+func (ks *keyStore) hasTag(tag uint16) bool {
+	for _, p := range ks.pairs {
+		if p.KeyTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func kindName(ksk bool) string {
+	if ksk {
+		return "KSK"
+	}
+	return "ZSK"
+}
+
+// bits holds the key size used when generating keys, per algorithm.
+var bits = map[uint8]int{
+	dns.RSASHA256:       2048,
+	dns.RSASHA512:       2048,
+	dns.ECDSAP256SHA256: 256,
+	dns.ECDSAP384SHA384: 384,
+	dns.ED25519:         256,
+}
@@ -0,0 +1,334 @@
+package sign
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/plugin/file"
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+// newRolloverSigner returns a signer for miek.nl. that manages its keys in a temporary directory.
+func newRolloverSigner(t *testing.T, p policy) *Signer {
+	p.algorithm = dns.ECDSAP256SHA256
+	ks := newKeyStore(t.TempDir(), "miek.nl.", p)
+	ks.lookupDS = func(string) ([]*dns.DS, time.Duration, error) { return nil, 0, errors.New("no parent") }
+	return &Signer{
+		origin: "miek.nl.",
+		dbfile: "testdata/db.miek.nl",
+		store:  ks,
+	}
+}
+
+// signedBy returns the key tags of the signatures over qtype at the apex of z.
+func signedBy(z *file.Zone, qtype uint16) map[uint16]bool {
+	apex, _ := z.Search("miek.nl.")
+	sigs := apex.Type(dns.TypeRRSIG)
+	if qtype == dns.TypeSOA {
+		sigs = z.Apex.SIGSOA // the SOA isn't kept in the tree
+	}
+	tags := map[uint16]bool{}
+	for _, rr := range sigs {
+		if sig := rr.(*dns.RRSIG); sig.TypeCovered == qtype {
+			tags[sig.KeyTag] = true
+		}
+	}
+	return tags
+}
+
+func apexCount(z *file.Zone, qtype uint16) int {
+	apex, _ := z.Search("miek.nl.")
+	return len(apex.Type(qtype))
+}
+
+// signAt signs the zone at now and records it, like signAndLog does.
+func signAt(t *testing.T, s *Signer, now time.Time) *file.Zone {
+	z, err := s.Sign(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, cds := s.store.keys(now)
+	if err := s.store.signed(now, cds); err != nil {
+		t.Fatal(err)
+	}
+	return z
+}
+
+func TestRolloverZSKPrePublish(t *testing.T) {
+	s := newRolloverSigner(t, policy{zskLifetime: 60 * 24 * time.Hour, zskMethod: prePublish})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ipub := 30*time.Minute + durationPropagation // DNSKEY TTL is the SOA's TTL
+
+	z := signAt(t, s, now)
+	if x := apexCount(z, dns.TypeDNSKEY); x != 2 {
+		t.Fatalf("Expected 2 DNSKEYs, got %d", x)
+	}
+	if x := apexCount(z, dns.TypeCDNSKEY); x != 1 {
+		t.Errorf("Expected 1 CDNSKEY, got %d", x)
+	}
+	ksk, zsk := s.store.kind(true)[0], s.store.kind(false)[0]
+	kskTag, zskTag := s.store.pairs[ksk.File].KeyTag, s.store.pairs[zsk.File].KeyTag
+	if x := signedBy(z, dns.TypeDNSKEY); len(x) != 1 || !x[kskTag] {
+		t.Errorf("Expected DNSKEY RRset to be signed by KSK %d, got %v", kskTag, x)
+	}
+	if x := signedBy(z, dns.TypeSOA); len(x) != 1 || !x[zskTag] {
+		t.Errorf("Expected SOA to be signed by ZSK %d, got %v", zskTag, x)
+	}
+	if err := s.store.due(now.Add(time.Hour)); err != nil {
+		t.Errorf("Expected zone not to be due, got %s", err)
+	}
+
+	// The successor is published ahead of the end of the lifetime.
+	now = now.Add(60*24*time.Hour - ipub)
+	if err := s.store.due(now); err == nil {
+		t.Errorf("Expected zone to be due for a new ZSK")
+	}
+	z = signAt(t, s, now)
+	if x := apexCount(z, dns.TypeDNSKEY); x != 3 {
+		t.Fatalf("Expected 3 DNSKEYs, got %d", x)
+	}
+	if x := signedBy(z, dns.TypeSOA); len(x) != 1 || !x[zskTag] {
+		t.Errorf("Expected SOA to be signed by ZSK %d, got %v", zskTag, x)
+	}
+
+	// And takes over when it's in all caches.
+	now = now.Add(ipub)
+	if err := s.store.due(now); err == nil {
+		t.Errorf("Expected zone to be due for the activation of the new ZSK")
+	}
+	z = signAt(t, s, now)
+	if x := apexCount(z, dns.TypeDNSKEY); x != 3 {
+		t.Errorf("Expected 3 DNSKEYs, got %d", x)
+	}
+	if x := signedBy(z, dns.TypeSOA); len(x) != 1 || x[zskTag] {
+		t.Errorf("Expected SOA to be signed by the new ZSK, got %v", x)
+	}
+
+	// The old ZSK is removed after its signatures have expired from caches.
+	now = zsk.Delete
+	z = signAt(t, s, now)
+	if x := apexCount(z, dns.TypeDNSKEY); x != 2 {
+		t.Errorf("Expected 2 DNSKEYs, got %d", x)
+	}
+	if _, err := os.Stat(filepath.Join(s.store.dir, zsk.File+".private")); !os.IsNotExist(err) {
+		t.Errorf("Expected the old ZSK to be removed from disk")
+	}
+}
+
+func TestRolloverZSKDoubleSignature(t *testing.T) {
+	s := newRolloverSigner(t, policy{zskLifetime: 60 * 24 * time.Hour, zskMethod: doubleSignature})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	signAt(t, s, now)
+	now = now.Add(60 * 24 * time.Hour)
+	z := signAt(t, s, now)
+	if x := apexCount(z, dns.TypeDNSKEY); x != 3 {
+		t.Fatalf("Expected 3 DNSKEYs, got %d", x)
+	}
+	if x := signedBy(z, dns.TypeSOA); len(x) != 2 {
+		t.Errorf("Expected SOA to be signed by 2 ZSKs, got %v", x)
+	}
+
+	now = now.Add(30*time.Minute + durationPropagation)
+	z = signAt(t, s, now)
+	if x := apexCount(z, dns.TypeDNSKEY); x != 2 {
+		t.Errorf("Expected 2 DNSKEYs, got %d", x)
+	}
+	if x := signedBy(z, dns.TypeSOA); len(x) != 1 {
+		t.Errorf("Expected SOA to be signed by 1 ZSK, got %v", x)
+	}
+}
+
+func TestRolloverKSK(t *testing.T) {
+	// Without a ZSK lifetime the KSK is a CSK and signs everything.
+	s := newRolloverSigner(t, policy{kskLifetime: 365 * 24 * time.Hour})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ipub := 30*time.Minute + durationPropagation
+
+	z := signAt(t, s, now)
+	if x := apexCount(z, dns.TypeDNSKEY); x != 1 {
+		t.Fatalf("Expected 1 DNSKEY, got %d", x)
+	}
+	old := s.store.pairs[s.store.kind(true)[0].File]
+	if x := signedBy(z, dns.TypeSOA); len(x) != 1 || !x[old.KeyTag] {
+		t.Errorf("Expected SOA to be signed by CSK %d, got %v", old.KeyTag, x)
+	}
+
+	now = now.Add(365 * 24 * time.Hour)
+	z = signAt(t, s, now)
+	if x := apexCount(z, dns.TypeDNSKEY); x != 2 {
+		t.Fatalf("Expected 2 DNSKEYs, got %d", x)
+	}
+	if x := signedBy(z, dns.TypeDNSKEY); len(x) != 2 {
+		t.Errorf("Expected DNSKEY RRset to be signed by 2 KSKs, got %v", x)
+	}
+	if x := s.store.state.CDS; len(x) != 1 || x[0] != old.KeyTag {
+		t.Errorf("Expected CDS to be for KSK %d, got %v", old.KeyTag, x)
+	}
+
+	// The CDS switches to the new KSK when its DNSKEY is in all caches.
+	now = now.Add(ipub)
+	signAt(t, s, now)
+	if x := s.store.state.CDS; len(x) != 1 || x[0] == old.KeyTag {
+		t.Errorf("Expected CDS to be for the new KSK, got %v", x)
+	}
+	var cur Pair
+	for _, p := range s.store.pairs {
+		if p.KeyTag != old.KeyTag {
+			cur = p
+		}
+	}
+
+	// The old KSK stays as long as the parent has its DS records, or can't be asked.
+	ds := []*dns.DS{old.Public.ToDS(dns.SHA256)}
+	var dsErr error
+	s.store.lookupDS = func(zone string) ([]*dns.DS, time.Duration, error) { return ds, 2 * time.Hour, dsErr }
+	for _, err := range []error{nil, errors.New("timeout")} {
+		dsErr = err
+		now = now.Add(30 * 24 * time.Hour)
+		if why := s.store.due(now); why != nil {
+			t.Errorf("Expected no signing to be due, got %s", why)
+		}
+		z = signAt(t, s, now)
+		if x := apexCount(z, dns.TypeDNSKEY); x != 2 {
+			t.Errorf("Expected 2 DNSKEYs, got %d", x)
+		}
+	}
+
+	// When the DS records are replaced, the old KSK goes once the old ones expired from caches.
+	ds, dsErr = []*dns.DS{cur.Public.ToDS(dns.SHA256)}, nil
+	if why := s.store.due(now); why == nil {
+		t.Errorf("Expected signing to be due")
+	}
+	z = signAt(t, s, now)
+	if x := apexCount(z, dns.TypeDNSKEY); x != 2 {
+		t.Errorf("Expected 2 DNSKEYs, got %d", x)
+	}
+
+	now = now.Add(2*time.Hour + durationPropagation)
+	z = signAt(t, s, now)
+	if x := apexCount(z, dns.TypeDNSKEY); x != 1 {
+		t.Errorf("Expected 1 DNSKEY, got %d", x)
+	}
+	if x := signedBy(z, dns.TypeSOA); len(x) != 1 || !x[cur.KeyTag] {
+		t.Errorf("Expected SOA to be signed by KSK %d, got %v", cur.KeyTag, x)
+	}
+}
+
+func TestLookupDS(t *testing.T) {
+	s := dnstest.NewServer(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = []dns.RR{
+			test.DS("miek.nl. 3600 IN DS 59725 13 2 E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855"),
+			test.DS("miek.nl. 7200 IN DS 12345 13 2 0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF"),
+		}
+		w.WriteMsg(m)
+	})
+	defer s.Close()
+
+	ds, ttl, err := lookupDS([]string{s.Addr, s.Addr})("miek.nl.")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(ds) != 2 {
+		t.Errorf("Expected 2 DS records, got %d", len(ds))
+	}
+	if ttl != 2*time.Hour {
+		t.Errorf("Expected the highest TTL of 2h, got %s", ttl)
+	}
+}
+
+func TestRolloverState(t *testing.T) {
+	s := newRolloverSigner(t, policy{zskLifetime: 60 * 24 * time.Hour})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	signAt(t, s, now)
+
+	// A restart continues with the same keys.
+	ks := newKeyStore(s.store.dir, "miek.nl.", s.store.policy)
+	if err := ks.load(now); err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.state.Keys) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(ks.state.Keys))
+	}
+	for file, p := range s.store.pairs {
+		if ks.pairs[file].KeyTag != p.KeyTag {
+			t.Errorf("Expected key %d to be loaded from %s", p.KeyTag, file)
+		}
+	}
+	if !ks.state.Signed.Equal(now) {
+		t.Errorf("Expected signed time %s, got %s", now, ks.state.Signed)
+	}
+}
+
+func TestParseKeyDirectory(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+	}{
+		{`sign testdata/db.miek.nl miek.nl {
+			key directory testdata
+			zsk_lifetime 1440h
+			ksk_lifetime 8760h
+			zsk_rollover double_signature
+			algorithm ED25519
+			ds_check 127.0.0.1 [::1]:5353
+		}`, false},
+		{`sign testdata/db.miek.nl miek.nl {
+			key file testdata/Kmiek.nl.+013+59725
+			zsk_lifetime 720h
+		}`, true},
+		{`sign testdata/db.miek.nl miek.nl {
+			key directory testdata
+			zsk_lifetime 24h
+		}`, true},
+		{`sign testdata/db.miek.nl miek.nl {
+			key directory testdata
+			zsk_rollover never
+		}`, true},
+		{`sign testdata/db.miek.nl miek.nl {
+			key directory testdata
+			algorithm DSA
+		}`, true},
+		{`sign testdata/db.miek.nl miek.nl {
+			key file testdata/Kmiek.nl.+013+59725
+			ds_check 127.0.0.1
+		}`, true},
+		{`sign testdata/db.miek.nl miek.nl {
+			key directory testdata
+			ds_check tls://127.0.0.1
+		}`, true},
+		{`sign testdata/db.miek.nl miek.nl {
+			key directory testdata
+			ds_check
+		}`, true},
+	}
+	for i, tc := range tests {
+		c := caddy.NewTestController("dns", tc.input)
+		sign, err := parse(c)
+		if err == nil && tc.shouldErr {
+			t.Fatalf("Test %d expected errors, but got no error", i)
+		}
+		if err != nil && !tc.shouldErr {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		if tc.shouldErr {
+			continue
+		}
+		ks := sign.signers[0].store
+		if ks == nil || ks.dir != "testdata" {
+			t.Fatalf("Test %d expected keys to be managed in testdata", i)
+		}
+		if ks.policy.zskMethod != doubleSignature || ks.policy.algorithm != dns.ED25519 {
+			t.Errorf("Test %d expected double signature rollovers with ED25519, got %+v", i, ks.policy)
+		}
+	}
+}
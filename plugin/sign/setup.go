@@ -4,11 +4,17 @@ import (
 	"fmt"
 	"math/rand"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	pkgparse "github.com/coredns/coredns/plugin/pkg/parse"
+	"github.com/coredns/coredns/plugin/pkg/transport"
+
+	"github.com/miekg/dns"
 )
 
 func init() { plugin.Register("sign", setup) }
@@ -64,13 +70,20 @@ func parse(c *caddy.Controller) (*Sign, error) {
 			}
 		}
 
+		keydir := ""
+		pol := policy{algorithm: dns.ECDSAP256SHA256}
+		var dsServers []string
 		for c.NextBlock() {
 			switch c.Val() {
 			case "key":
-				pairs, err := keyParse(c)
+				pairs, dir, err := keyParse(c)
 				if err != nil {
 					return sign, err
 				}
+				if dir != "" {
+					keydir = dir
+					continue
+				}
 				for i := range signers {
 					for _, p := range pairs {
 						p.Public.Header().Name = signers[i].origin
@@ -89,12 +102,122 @@ func parse(c *caddy.Controller) (*Sign, error) {
 					signers[i].directory = dir[0]
 					signers[i].signedfile = fmt.Sprintf("db.%ssigned", signers[i].origin)
 				}
+			case "nsec3":
+				p, err := nsec3Parse(c)
+				if err != nil {
+					return nil, err
+				}
+				for i := range signers {
+					signers[i].nsec3 = p
+				}
+			case "cds":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				mode := cdsPublish
+				switch c.Val() {
+				case "publish":
+				case "delete":
+					mode = cdsDelete
+				case "none":
+					mode = cdsNone
+				default:
+					return nil, c.Errf("unknown cds value '%s'", c.Val())
+				}
+				for i := range signers {
+					signers[i].cds = mode
+				}
+			case "algorithm":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				alg, ok := dns.StringToAlgorithm[strings.ToUpper(c.Val())]
+				if _, known := bits[alg]; !ok || !known {
+					return nil, c.Errf("unsupported algorithm '%s'", c.Val())
+				}
+				pol.algorithm = alg
+			case "zsk_lifetime", "ksk_lifetime":
+				prop := c.Val()
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(c.Val())
+				if err != nil {
+					return nil, c.Errf("invalid duration for '%s': %s", prop, err)
+				}
+				if d < durationSignatureExpireDays {
+					return nil, c.Errf("'%s' must be at least %s", prop, durationSignatureExpireDays)
+				}
+				if prop == "zsk_lifetime" {
+					pol.zskLifetime = d
+				} else {
+					pol.kskLifetime = d
+				}
+			case "zsk_rollover":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				switch c.Val() {
+				case "prepublish":
+					pol.zskMethod = prePublish
+				case "double_signature":
+					pol.zskMethod = doubleSignature
+				default:
+					return nil, c.Errf("unknown rollover method '%s'", c.Val())
+				}
+			case "ds_check":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				servers, err := pkgparse.HostPortOrFile(args...)
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				for _, s := range servers {
+					if trans, _ := pkgparse.Transport(s); trans != transport.DNS {
+						return nil, c.Errf("only plain DNS servers can be used for 'ds_check', got '%s'", s)
+					}
+				}
+				dsServers = servers
 			default:
 				return nil, c.Errf("unknown property '%s'", c.Val())
 			}
 		}
+
+		if keydir == "" {
+			if pol != (policy{algorithm: dns.ECDSAP256SHA256}) || dsServers != nil {
+				return nil, c.Errf("key rollover needs 'key directory'")
+			}
+		} else {
+			for i := range signers {
+				if len(signers[i].keys) > 0 {
+					return nil, c.Errf("can't use 'key directory' together with 'key file' or 'key pkcs11'")
+				}
+				signers[i].store = newKeyStore(keydir, signers[i].origin, pol)
+				if dsServers != nil {
+					signers[i].store.lookupDS = lookupDS(dsServers)
+				}
+			}
+		}
 		sign.signers = append(sign.signers, signers...)
 	}
 
 	return sign, nil
 }
+
+// nsec3Parse parses the arguments of nsec3: [opt_out] [ITERATIONS [SALT]].
+func nsec3Parse(c *caddy.Controller) (*nsec3Params, error) {
+	p := &nsec3Params{}
+	args := c.RemainingArgs()
+	if len(args) > 0 && args[0] == "opt_out" {
+		p.optOut = true
+		args = args[1:]
+	}
+	it, salt, err := dnsutil.ParseNSEC3(args)
+	if err != nil {
+		return nil, c.Err(err.Error())
+	}
+	p.iterations, p.salt = it, salt
+	return p, nil
+}
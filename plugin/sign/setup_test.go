@@ -44,6 +44,18 @@ func TestParse(t *testing.T) {
 			true,
 			nil,
 		},
+		{`sign testdata/db.miek.nl miek.nl {
+			key pkcs11 /usr/lib/softhsm/libsofthsm2.so coredns 1234
+		 }`,
+			true,
+			nil,
+		},
+		{`sign testdata/db.miek.nl miek.nl {
+			key pkcs11 /nonexistent/libpkcs11.so coredns 1234 testdata/Kmiek.nl.+013+59725
+		 }`,
+			true,
+			nil,
+		},
 	}
 	for i, tc := range tests {
 		c := caddy.NewTestController("dns", tc.input)
@@ -73,3 +85,37 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestParseNSEC3(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		exp       *nsec3Params
+	}{
+		{`nsec3`, false, &nsec3Params{}},
+		{`nsec3 opt_out`, false, &nsec3Params{optOut: true}},
+		{`nsec3 5 aabb`, false, &nsec3Params{iterations: 5, salt: "AABB"}},
+		{`nsec3 opt_out 0 -`, false, &nsec3Params{optOut: true}},
+		// errors
+		{`nsec3 1000`, true, nil},
+		{`nsec3 1 xyz`, true, nil},
+		{`nsec3 1 aa bb`, true, nil},
+	}
+	for i, tc := range tests {
+		input := "sign testdata/db.miek.nl miek.nl {\n" + tc.input + "\n}"
+		c := caddy.NewTestController("dns", input)
+		sign, err := parse(c)
+		if err == nil && tc.shouldErr {
+			t.Fatalf("Test %d expected errors, but got no error", i)
+		}
+		if err != nil && !tc.shouldErr {
+			t.Fatalf("Test %d expected no errors, but got '%v'", i, err)
+		}
+		if tc.shouldErr {
+			continue
+		}
+		if x := sign.signers[0].nsec3; *x != *tc.exp {
+			t.Errorf("Test %d expected %+v, got %+v", i, tc.exp, x)
+		}
+	}
+}
@@ -14,7 +14,7 @@ type Sign struct {
 // OnStartup scans all signers and signs or resigns zones if needed.
 func (s *Sign) OnStartup() error {
 	for _, signer := range s.signers {
-		why := signer.resign()
+		why := signer.due()
 		if why == nil {
 			log.Infof("Skipping signing zone %q in %q: signatures are valid", signer.origin, filepath.Join(signer.directory, signer.signedfile))
 			continue
@@ -33,6 +33,7 @@ const (
 	durationInceptionJitter         = -18 * time.Hour     // default max jitter for the inception
 	durationExpirationDayJitter     = 5 * 24 * time.Hour  // default max jitter for the expiration
 	durationSignatureInceptionHours = -3 * time.Hour      // -(2+1) hours, be sure to catch daylight saving time and such, jitter is subtracted
+	durationPropagation             = 1 * time.Hour       // time for a change to reach all secondaries
 )
 
 const timeFmt = "2006-01-02T15:04:05.000Z07:00"
@@ -27,8 +27,21 @@ type Signer struct {
 
 	signedfile string
 	stop       chan struct{}
+
+	store *keyStore    // keys from a directory, when set keys is not used
+	nsec3 *nsec3Params // when set an NSEC3 chain is used instead of NSEC records
+	cds   cdsMode
 }
 
+// cdsMode says which CDS and CDNSKEY records are published.
+type cdsMode int
+
+const (
+	cdsPublish cdsMode = iota // the records for the KSKs (RFC 7344)
+	cdsDelete                 // the delete form, the parent should remove the DS records (RFC 8078)
+	cdsNone                   // no records
+)
+
 // Sign signs a zone file according to the parameters in s.
 func (s *Signer) Sign(now time.Time) (*file.Zone, error) {
 	rd, err := os.Open(s.dbfile)
@@ -46,18 +59,36 @@ func (s *Signer) Sign(now time.Time) (*file.Zone, error) {
 	inception, expiration := lifetime(now, s.jitterIncep, s.jitterExpir)
 	z.Apex.SOA.Serial = uint32(now.Unix())
 
-	for _, pair := range s.keys {
+	published, ksks, zsks, cds, err := s.keySet(now, z)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range published {
 		pair.Public.Header().Ttl = ttl // set TTL on key so it matches the RRSIG.
 		z.Insert(pair.Public)
-		z.Insert(pair.Public.ToDS(dns.SHA1).ToCDS())
-		z.Insert(pair.Public.ToDS(dns.SHA256).ToCDS())
-		z.Insert(pair.Public.ToCDNSKEY())
+	}
+	switch s.cds {
+	case cdsPublish:
+		for _, pair := range cds {
+			z.Insert(pair.Public.ToDS(dns.SHA256).ToCDS())
+			z.Insert(pair.Public.ToCDNSKEY())
+		}
+	case cdsDelete:
+		hdr := dns.RR_Header{Name: s.origin, Rrtype: dns.TypeCDS, Class: dns.ClassINET, Ttl: ttl}
+		z.Insert(&dns.CDS{DS: dns.DS{Hdr: hdr, Digest: "00"}})
+		hdr.Rrtype = dns.TypeCDNSKEY
+		z.Insert(&dns.CDNSKEY{DNSKEY: dns.DNSKEY{Hdr: hdr, Protocol: 3, PublicKey: "AA=="}})
+	}
+
+	if s.nsec3 != nil {
+		z.Insert(s.nsec3.NSEC3PARAM(s.origin))
 	}
 
 	names := names(s.origin, z)
 	ln := len(names)
+	bitmaps := map[string][]uint16{} // types per name, for the NSEC3 chain
 
-	for _, pair := range s.keys {
+	for _, pair := range zsks {
 		rrsig, err := pair.signRRs([]dns.RR{z.Apex.SOA}, s.origin, ttl, inception, expiration)
 		if err != nil {
 			return nil, err
@@ -80,7 +111,18 @@ func (s *Signer) Sign(now time.Time) (*file.Zone, error) {
 			return nil
 		}
 
-		if e.Name() == s.origin {
+		if s.nsec3 != nil {
+			types := e.Types()
+			switch {
+			case e.Name() == s.origin:
+				bitmaps[e.Name()] = append(types, dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG)
+			case e.Type(dns.TypeNS) == nil || e.Type(dns.TypeDS) != nil:
+				bitmaps[e.Name()] = append(types, dns.TypeRRSIG)
+			case !s.nsec3.optOut:
+				// An unsigned delegation has no signatures. With opt-out it's left out of the chain.
+				bitmaps[e.Name()] = types
+			}
+		} else if e.Name() == s.origin {
 			nsec := NSEC(e.Name(), names[(ln+i)%ln], mttl, append(e.Types(), dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC))
 			z.Insert(nsec)
 		} else {
@@ -94,7 +136,11 @@ func (s *Signer) Sign(now time.Time) (*file.Zone, error) {
 			if t == dns.TypeRRSIG || t == dns.TypeNS {
 				continue
 			}
-			for _, pair := range s.keys {
+			signers := zsks
+			if t == dns.TypeDNSKEY || t == dns.TypeCDS || t == dns.TypeCDNSKEY {
+				signers = ksks
+			}
+			for _, pair := range signers {
 				rrsig, err := pair.signRRs(rrs, s.origin, rrs[0].Header().Ttl, inception, expiration)
 				if err != nil {
 					return err
@@ -105,7 +151,75 @@ func (s *Signer) Sign(now time.Time) (*file.Zone, error) {
 		i++
 		return nil
 	})
-	return z, err
+	if err != nil || s.nsec3 == nil {
+		return z, err
+	}
+
+	for _, nsec3 := range nsec3Chain(s.origin, bitmaps, mttl, s.nsec3) {
+		z.Insert(nsec3)
+		for _, pair := range zsks {
+			rrsig, err := pair.signRRs([]dns.RR{nsec3}, s.origin, mttl, inception, expiration)
+			if err != nil {
+				return nil, err
+			}
+			z.Insert(rrsig)
+		}
+	}
+	return z, nil
+}
+
+// keySet returns the keys that are published in z, the keys that sign the DNSKEY, CDS and CDNSKEY
+// RRsets, the keys that sign all other RRsets and the keys that go in the CDS and CDNSKEY records.
+// Keys given with "key file" do all of this.
+func (s *Signer) keySet(now time.Time, z *file.Zone) (published, ksks, zsks, cds []Pair, err error) {
+	if s.store == nil {
+		return s.keys, s.keys, s.keys, s.keys, nil
+	}
+
+	ttl := z.Apex.SOA.Header().Ttl
+	maxTTL := ttl
+	for _, rr := range z.Apex.NS {
+		if rr.Header().Ttl > maxTTL {
+			maxTTL = rr.Header().Ttl
+		}
+	}
+	z.Walk(func(e *tree.Elem, _ map[uint16][]dns.RR) error {
+		for _, rr := range e.All() {
+			if rr.Header().Ttl > maxTTL {
+				maxTTL = rr.Header().Ttl
+			}
+		}
+		return nil
+	})
+
+	if err := s.store.roll(now, time.Duration(ttl)*time.Second, time.Duration(maxTTL)*time.Second); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	published, ksks, zsks, cds = s.store.keys(now)
+	return published, ksks, zsks, cds, nil
+}
+
+// signing returns the keys that sign the zone at now.
+func (s *Signer) signing(now time.Time) []Pair {
+	if s.store == nil {
+		return s.keys
+	}
+	_, ksks, zsks, _ := s.store.keys(now)
+	if len(ksks) > 0 && len(zsks) > 0 && ksks[0].KeyTag == zsks[0].KeyTag {
+		return ksks // CSKs
+	}
+	return append(ksks, zsks...)
+}
+
+// due checks if the zone needs resigning, because the signatures or the keys are due.
+func (s *Signer) due() error {
+	if why := s.resign(); why != nil {
+		return why
+	}
+	if s.store == nil {
+		return nil
+	}
+	return s.store.due(time.Now().UTC())
 }
 
 // resign checks if the signed zone exists, or needs resigning.
@@ -174,7 +288,7 @@ func signAndLog(s *Signer, why error) {
 	z, err := s.Sign(now)
 	log.Infof("Signing %q because %s", s.origin, why)
 	if err != nil {
-		log.Warningf("Error signing %q with key tags %q in %s: %s, next: %s", s.origin, keyTag(s.keys), time.Since(now), err, now.Add(durationRefreshHours).Format(timeFmt))
+		log.Warningf("Error signing %q with key tags %q in %s: %s, next: %s", s.origin, keyTag(s.signing(now)), time.Since(now), err, now.Add(durationRefreshHours).Format(timeFmt))
 		return
 	}
 
@@ -182,7 +296,16 @@ func signAndLog(s *Signer, why error) {
 		log.Warningf("Error signing %q: failed to move zone file into place: %s", s.origin, err)
 		return
 	}
-	log.Infof("Successfully signed zone %q in %q with key tags %q and %d SOA serial, elapsed %f, next: %s", s.origin, filepath.Join(s.directory, s.signedfile), keyTag(s.keys), z.Apex.SOA.Serial, time.Since(now).Seconds(), now.Add(durationRefreshHours).Format(timeFmt))
+	if s.store != nil {
+		_, _, _, cds := s.store.keys(now)
+		if s.cds != cdsPublish {
+			cds = nil
+		}
+		if err := s.store.signed(now, cds); err != nil {
+			log.Warningf("Error saving the key state of %q: %s", s.origin, err)
+		}
+	}
+	log.Infof("Successfully signed zone %q in %q with key tags %q and %d SOA serial, elapsed %f, next: %s", s.origin, filepath.Join(s.directory, s.signedfile), keyTag(s.signing(now)), z.Apex.SOA.Serial, time.Since(now).Seconds(), now.Add(durationRefreshHours).Format(timeFmt))
 }
 
 // refresh checks every val if some zones need to be resigned.
@@ -194,7 +317,7 @@ func (s *Signer) refresh(val time.Duration) {
 		case <-s.stop:
 			return
 		case <-tick.C:
-			why := s.resign()
+			why := s.due()
 			if why == nil {
 				continue
 			}
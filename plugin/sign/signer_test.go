@@ -32,8 +32,10 @@ func TestSign(t *testing.T) {
 	if x := apex.Type(dns.TypeDS); len(x) != 0 {
 		t.Errorf("Expected %d DS records, got %d", 0, len(x))
 	}
-	if x := apex.Type(dns.TypeCDS); len(x) != 2 {
-		t.Errorf("Expected %d CDS records, got %d", 2, len(x))
+	if x := apex.Type(dns.TypeCDS); len(x) != 1 {
+		t.Errorf("Expected %d CDS record, got %d", 1, len(x))
+	} else if d := x[0].(*dns.CDS).DigestType; d != dns.SHA256 {
+		t.Errorf("Expected CDS digest type %d, got %d", dns.SHA256, d)
 	}
 	if x := apex.Type(dns.TypeCDNSKEY); len(x) != 1 {
 		t.Errorf("Expected %d CDNSKEY record, got %d", 1, len(x))
@@ -175,3 +177,51 @@ func TestSignDS(t *testing.T) {
 		t.Errorf("Expected no NSEC TTL to be %d for %s, got %d", minttl, "www.miek.nl.", x)
 	}
 }
+
+func TestSignCDS(t *testing.T) {
+	tests := []struct {
+		cds     string
+		cdsRRs  int
+		deleted bool
+	}{
+		{"publish", 1, false},
+		{"delete", 1, true},
+		{"none", 0, false},
+	}
+	for i, tc := range tests {
+		input := `sign testdata/db.miek.nl miek.nl {
+			key file testdata/Kmiek.nl.+013+59725
+			cds ` + tc.cds + `
+		}`
+		c := caddy.NewTestController("dns", input)
+		sign, err := parse(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		z, err := sign.signers[0].Sign(time.Now().UTC())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		apex, _ := z.Search("miek.nl.")
+		cds := apex.Type(dns.TypeCDS)
+		if len(cds) != tc.cdsRRs {
+			t.Errorf("Test %d: expected %d CDS records, got %d", i, tc.cdsRRs, len(cds))
+		}
+		if tc.deleted {
+			if x := cds[0].(*dns.CDS); x.Algorithm != 0 || x.Digest != "00" {
+				t.Errorf("Test %d: expected the CDS delete form, got %s", i, x)
+			}
+			if x := apex.Type(dns.TypeCDNSKEY)[0].(*dns.CDNSKEY); x.Algorithm != 0 || x.PublicKey != "AA==" {
+				t.Errorf("Test %d: expected the CDNSKEY delete form, got %s", i, x)
+			}
+		}
+		signed := false
+		for _, rr := range apex.Type(dns.TypeRRSIG) {
+			signed = signed || rr.(*dns.RRSIG).TypeCovered == dns.TypeCDS
+		}
+		if signed != (tc.cdsRRs > 0) {
+			t.Errorf("Test %d: expected CDS signatures only if CDS records are published", i)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/metadata"
 	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/edns"
 	"github.com/coredns/coredns/plugin/pkg/fall"
 	"github.com/coredns/coredns/request"
 
@@ -133,8 +134,7 @@ func (h Handler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg)
 
 		if template.ederror != nil {
 			msg = msg.SetEdns0(4096, true)
-			ede := dns.EDNS0_EDE{InfoCode: template.ederror.code, ExtraText: template.ederror.reason}
-			msg.IsEdns0().Option = append(msg.IsEdns0().Option, &ede)
+			edns.SetExtendedError(msg, template.ederror.code, template.ederror.reason)
 		}
 
 		w.WriteMsg(msg)
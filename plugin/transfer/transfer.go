@@ -42,8 +42,10 @@ type Transferer interface {
 	//
 	// If serial is not 0, it will be handled as an IXFR request. If the serial is equal to or greater (newer) than
 	// the current serial for the zone, send a single SOA record to the channel and then close it.
-	// If the serial is less (older) than the current serial for the zone, perform an AXFR fallback
-	// by proceeding as if an AXFR was requested (as above).
+	// If the serial is less (older) than the current serial for the zone, either send the changes since
+	// serial in the format of RFC 1995, section 4: the current SOA, then for each change the old SOA
+	// followed by the deleted records and the new SOA followed by the added records, and finally the
+	// current SOA again. Or perform an AXFR fallback by proceeding as if an AXFR was requested (as above).
 	Transfer(zone string, serial uint32) (<-chan []dns.RR, error)
 }
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"strings"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
@@ -75,6 +76,7 @@ func (t *TSIGServer) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.
 	}
 
 	if rcode == dns.RcodeSuccess {
+		ctx = context.WithValue(ctx, keyNameKey{}, strings.ToLower(tsigRR.Hdr.Name))
 		rcode, err = plugin.NextOrFailure(t.Name(), t.Next, ctx, w, r)
 		if err != nil {
 			log.Errorf("request handler returned an error: %v\n", err)
@@ -137,4 +139,13 @@ func (r *restoreTsigWriter) WriteMsg(m *dns.Msg) error {
 	return r.ResponseWriter.WriteMsg(m)
 }
 
+type keyNameKey struct{}
+
+// KeyName returns the (lowercased) name of the TSIG key the request was signed with. It returns the empty
+// string if the request wasn't TSIG signed, or wasn't validated by this plugin.
+func KeyName(ctx context.Context) string {
+	name, _ := ctx.Value(keyNameKey{}).(string)
+	return name
+}
+
 const pluginName = "tsig"
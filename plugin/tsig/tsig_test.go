@@ -226,6 +226,37 @@ func TestServeDNSTsigErrors(t *testing.T) {
 	}
 }
 
+func TestKeyName(t *testing.T) {
+	var keyName string
+	tsig := TSIGServer{
+		Zones: []string{"."},
+		Next: test.HandlerFunc(func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+			keyName = KeyName(ctx)
+			return testHandler()(ctx, w, r)
+		}),
+	}
+
+	for _, signed := range []bool{true, false} {
+		keyName = "bogus"
+		r := new(dns.Msg)
+		r.SetQuestion("test.example.", dns.TypeA)
+		if signed {
+			r.SetTsig("Test.Key.", dns.HmacSHA256, 300, time.Now().Unix())
+		}
+		if _, err := tsig.ServeDNS(context.TODO(), dnstest.NewRecorder(&test.ResponseWriter{}), r); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := ""
+		if signed {
+			expected = "test.key."
+		}
+		if keyName != expected {
+			t.Errorf("Expected key name %q, got %q", expected, keyName)
+		}
+	}
+}
+
 func testHandler() test.HandlerFunc {
 	return func(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
 		state := request.Request{W: w, Req: r}
@@ -0,0 +1,78 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+
+	"github.com/miekg/dns"
+)
+
+func TestFileUpdate(t *testing.T) {
+	name, rm, err := test.TempFile(".", exampleOrg)
+	if err != nil {
+		t.Fatalf("Failed to create zone: %s", err)
+	}
+	defer rm()
+
+	corefile := `example.org:0 {
+		tsig {
+			secret ` + tsigKey + ` ` + tsigSecret + `
+		}
+		file ` + name + ` {
+			update ` + tsigKey + `
+		}
+	}`
+
+	i, udp, tcp, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer i.Stop()
+
+	m := new(dns.Msg)
+	m.SetUpdate("example.org.")
+	m.Insert([]dns.RR{test.A("new.example.org. 300 IN A 127.0.0.4")})
+
+	// Without a TSIG signature the update is refused.
+	r, err := dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Could not send update: %s", err)
+	}
+	if r.Rcode != dns.RcodeRefused {
+		t.Fatalf("Expected REFUSED for an unsigned update, got %s", dns.RcodeToString[r.Rcode])
+	}
+
+	m.SetTsig(tsigKey, dns.HmacSHA256, 300, time.Now().Unix())
+	client := dns.Client{Net: "tcp", TsigSecret: map[string]string{tsigKey: tsigSecret}}
+	r, _, err = client.Exchange(m, tcp)
+	if err != nil {
+		t.Fatalf("Could not send update: %s", err)
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR for a signed update, got %s", dns.RcodeToString[r.Rcode])
+	}
+
+	m = new(dns.Msg)
+	m.SetQuestion("new.example.org.", dns.TypeA)
+	r, err = dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Could not send query: %s", err)
+	}
+	if r.Rcode != dns.RcodeSuccess || len(r.Answer) != 1 {
+		t.Fatalf("Expected one answer for the updated name, got %s with %d answers", dns.RcodeToString[r.Rcode], len(r.Answer))
+	}
+	if a := r.Answer[0].(*dns.A).A.String(); a != "127.0.0.4" {
+		t.Errorf("Expected 127.0.0.4, got %s", a)
+	}
+
+	m.SetQuestion("example.org.", dns.TypeSOA)
+	r, err = dns.Exchange(m, udp)
+	if err != nil {
+		t.Fatalf("Could not send query: %s", err)
+	}
+	if len(r.Answer) != 1 || r.Answer[0].(*dns.SOA).Serial != 2015082542 {
+		t.Errorf("Expected the SOA serial to be increased to 2015082542, got %v", r.Answer)
+	}
+}
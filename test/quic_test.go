@@ -0,0 +1,70 @@
+package test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/core/dnsserver"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+func TestQUIC(t *testing.T) {
+	corefile := `quic://.:0 {
+		tls ../plugin/tls/test_cert.pem ../plugin/tls/test_key.pem
+		whoami
+	}`
+
+	ex, udp, _, err := CoreDNSServerAndPorts(corefile)
+	if err != nil {
+		t.Fatalf("Could not get CoreDNS serving instance: %s", err)
+	}
+	defer ex.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := quic.DialAddr(ctx, udp, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"doq"}}, nil)
+	if err != nil {
+		t.Fatalf("Could not dial QUIC server: %s", err)
+	}
+	defer conn.CloseWithError(0, "")
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	m.Id = 0
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("Could not open stream: %s", err)
+	}
+	buf, _ := m.Pack()
+	if _, err := stream.Write(dnsserver.AddPrefix(buf)); err != nil {
+		t.Fatalf("Could not write message: %s", err)
+	}
+	stream.Close()
+
+	resp, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("Could not read response: %s", err)
+	}
+	if len(resp) < 2 || int(binary.BigEndian.Uint16(resp)) != len(resp)-2 {
+		t.Fatalf("Response has an invalid length prefix")
+	}
+
+	r := new(dns.Msg)
+	if err := r.Unpack(resp[2:]); err != nil {
+		t.Fatalf("Could not unpack response: %s", err)
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected success but got %d", r.Rcode)
+	}
+	if n := len(r.Extra); n != 2 {
+		t.Errorf("Expected 2 RRs in additional section, but got %d", n)
+	}
+}